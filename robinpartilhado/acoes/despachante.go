@@ -0,0 +1,263 @@
+package acoes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/TomascpMarques/dynamic-querys-go/actions"
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/rastreio"
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/registos"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+)
+
+// tipoContexto tipo do primeiro parametro das actions que recebem o contexto do pedido
+var tipoContexto = reflect.TypeOf((*context.Context)(nil)).Elem()
+
+// chamadaFuncao linhas do body da action que representam a chamada de uma função
+var chamadaFuncao = regexp.MustCompile(`^"\w+":$`)
+
+// chamada Função a chamar e os parametros enviados na action
+type chamada struct {
+	nome   string
+	params []interface{}
+}
+
+// Despachante Handler http das actions, faz o mesmo que o actions.Handler do dynamic-querys-go,
+// mas as actions cujo primeiro parametro é um context.Context recebem o contexto do pedido (ver PedidoDe),
+// esse parametro não é enviado pelo cliente. Cada chamada é registada com o id do pedido, a action, o user e a latência.
+// As actions também podem ser chamadas com os parametros em JSON, uma por pedido (ver ServeJSON)
+type Despachante struct {
+	Funcs      map[string]interface{} // Normalmente o actions.FuncsStorage
+	Registador *registos.Registador   // registos.Padrao se for nil
+	// Utilizador devolve o user da token (o último parametro das actions), para os logs, nil se não for registado
+	Utilizador func(token string) string
+	// ConfiarProxy usa os headers X-Forwarded-For (o último endereço) e X-Real-IP para obter o IP do cliente,
+	// só deve ser ativo se o serviço estiver atrás de um só proxy de confiança, que acrescenta o IP que viu
+	ConfiarProxy bool
+}
+
+// recebeContexto Indica se a função recebe o contexto do pedido como primeiro parametro
+func recebeContexto(funcao reflect.Type) bool {
+	return funcao.NumIn() > 0 && funcao.In(0) == tipoContexto
+}
+
+// responderErro Escreve a resposta de erro, com o mesmo formato do actions.Handler
+func responderErro(rw http.ResponseWriter, estado int, mensagem string) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(estado)
+	rw.Write([]byte(`{"error":"` + mensagem + `"}`))
+}
+
+// interpretar Converte o conteúdo da action nas chamadas de funções, as funções que não existem são ignoradas
+func (d *Despachante) interpretar(conteudo actions.BodyContents) ([]chamada, error) {
+	chamadas := make([]chamada, 0)
+	ignorar := true
+	for _, linha := range conteudo.FuncsContent {
+		if chamadaFuncao.MatchString(linha) {
+			nome := linha[1 : len(linha)-2]
+			_, existe := d.Funcs[nome]
+			ignorar = !existe
+			if existe {
+				chamadas = append(chamadas, chamada{nome: nome, params: make([]interface{}, 0)})
+			}
+			continue
+		}
+		if ignorar {
+			continue
+		}
+
+		valor, err := actions.CheckTypeAndConvert(linha)
+		if err != nil {
+			return nil, err
+		}
+		atual := &chamadas[len(chamadas)-1]
+		atual.params = append(atual.params, valor)
+	}
+
+	// Verifica o número de parametros, sem contar com o contexto
+	for _, c := range chamadas {
+		tipo := reflect.TypeOf(d.Funcs[c.nome])
+		esperados := tipo.NumIn()
+		if recebeContexto(tipo) {
+			esperados--
+		}
+		if esperados == 0 || len(c.params) != esperados {
+			return nil, errors.New("bad parameters")
+		}
+	}
+	return chamadas, nil
+}
+
+// utilizador User da token enviada na chamada, vazio se a action não receber uma token válida
+func (d *Despachante) utilizador(c chamada) string {
+	if d.Utilizador == nil || len(c.params) == 0 {
+		return ""
+	}
+	token, ok := c.params[len(c.params)-1].(string)
+	if !ok {
+		return ""
+	}
+	return d.Utilizador(token)
+}
+
+// ChaveErro Indica se a key do retorno de uma action guarda um erro, as actions mais antigas usam "error" ou "err"
+// em vez de "erro", com ou sem maiúsculas
+func ChaveErro(chave string) bool {
+	for _, chaveErro := range ChavesErro {
+		if strings.EqualFold(chave, chaveErro) {
+			return true
+		}
+	}
+	return false
+}
+
+// erroRetorno Erro devolvido pela action (ver ChavesErro), nil se a action não devolveu um erro
+func erroRetorno(resultados []interface{}) error {
+	if len(resultados) == 0 {
+		return nil
+	}
+	retorno, ok := resultados[0].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	for chave, erro := range retorno {
+		if ChaveErro(chave) && erro != nil && erro != "" {
+			if err, ok := erro.(error); ok {
+				return err
+			}
+			return fmt.Errorf("%v", erro)
+		}
+	}
+	return nil
+}
+
+// registarChamada Regista a chamada da action, em Aviso se a action devolveu um erro (retorno["erro"])
+func registarChamada(ctx context.Context, registador *registos.Registador, latencia time.Duration, resultados []interface{}) {
+	if erro := erroRetorno(resultados); erro != nil {
+		registador.Aviso(ctx, "action devolveu um erro", registos.CampoLatencia, latencia, registos.CampoErro, erro)
+		return
+	}
+	registador.Info(ctx, "action chamada", registos.CampoLatencia, latencia)
+}
+
+// chamar Chama a função com os parametros da action, e o contexto se a função o receber.
+// Se a action entrar em pânico (ex: um campo em falta no map enviado), devolve um retorno com o erro e err com o motivo
+func (d *Despachante) chamar(ctx context.Context, c chamada) (devolvidos []interface{}, err error) {
+	defer func() {
+		if panico := recover(); panico != nil {
+			devolvidos = []interface{}{map[string]interface{}{"erro": ErrInterno}}
+			err = fmt.Errorf("pânico na action %s: %v", c.nome, panico)
+		}
+	}()
+	funcao := reflect.ValueOf(d.Funcs[c.nome])
+	tipo := funcao.Type()
+
+	params := make([]reflect.Value, 0, len(c.params)+1)
+	if recebeContexto(tipo) {
+		params = append(params, reflect.ValueOf(ctx))
+	}
+	for _, param := range c.params {
+		valor := reflect.ValueOf(param)
+		// Os valores null do JSON passam a ser o valor zero do tipo do parametro
+		if !valor.IsValid() {
+			valor = reflect.Zero(tipo.In(len(params)))
+		}
+		params = append(params, valor)
+	}
+
+	resultados := funcao.Call(params)
+	devolvidos = make([]interface{}, len(resultados))
+	for i, resultado := range resultados {
+		devolvidos[i] = resultado.Interface()
+	}
+	return devolvidos, nil
+}
+
+// executar Chama a action com o seu span, e regista a chamada com o nome da action, o user e a latência
+func (d *Despachante) executar(ctx context.Context, registador *registos.Registador, c chamada) []interface{} {
+	// As linhas registadas pela action com o contexto levam o nome da action e o user
+	ctxAcao := registos.ComCampos(ctx, registos.CampoAcao, c.nome)
+	atributos := []attribute.KeyValue{attribute.String(registos.CampoAcao, c.nome)}
+	if user := d.utilizador(c); user != "" {
+		ctxAcao = registos.ComCampos(ctxAcao, registos.CampoUser, user)
+		atributos = append(atributos, semconv.EnduserIDKey.String(user))
+	}
+	// Cada action têm o seu span, pai dos spans das operações feitas com o contexto (ex: chamadas a outros serviços)
+	ctxAcao, terminar := rastreio.Operacao(ctxAcao, "acao "+c.nome, atributos...)
+	inicio := time.Now()
+	devolvidos, err := d.chamar(ctxAcao, c)
+	if err != nil {
+		registador.Erro(ctxAcao, "action entrou em pânico", registos.CampoLatencia, time.Since(inicio), registos.CampoErro, err)
+		terminar(err)
+		return devolvidos
+	}
+	registarChamada(ctxAcao, registador, time.Since(inicio), devolvidos)
+	terminar(erroRetorno(devolvidos))
+	return devolvidos
+}
+
+// registador Registador das chamadas, registos.Padrao se não for indicado
+func (d *Despachante) registador() *registos.Registador {
+	if d.Registador == nil {
+		return registos.Padrao
+	}
+	return d.Registador
+}
+
+// ServeHTTP Interpreta a action enviada no body do pedido, chama as funções pedidas e devolve os seus resultados
+func (d *Despachante) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	registador := d.registador()
+	corpo, _ := ioutil.ReadAll(r.Body)
+	action := strings.TrimSpace(string(corpo))
+	if err := actions.CheckRequestIsAction(action); err != nil {
+		registador.Aviso(r.Context(), "action inválida", registos.CampoErro, err)
+		responderErro(rw, http.StatusBadRequest, "The request sent was not a valid action")
+		return
+	}
+
+	conteudo, err := actions.ParseActionContents(action)
+	if err != nil {
+		registador.Aviso(r.Context(), "action inválida", registos.CampoErro, err)
+		responderErro(rw, http.StatusBadRequest, "Not able to parse one or more content-parts of the action")
+		return
+	}
+
+	chamadas, err := d.interpretar(conteudo)
+	if err != nil {
+		registador.Aviso(r.Context(), "action inválida", registos.CampoErro, err)
+		responderErro(rw, http.StatusBadRequest, "Not able to convert to primitive")
+		return
+	}
+
+	ctx := ComPedido(r.Context(), NovoPedido(r, d.ConfiarProxy))
+	resultados := make(map[string]interface{})
+	for i, c := range chamadas {
+		// Chamadas repetidas da mesma função ficam com o nome <nome>_V<posição>, tal como no actions.Handler
+		nome := c.nome
+		if _, repetida := resultados[nome]; repetida {
+			nome = fmt.Sprintf("%s_V%d", c.nome, i)
+		}
+		devolvidos := d.executar(ctx, registador, c)
+		mensagensErro(devolvidos)
+		resultados[nome] = devolvidos
+	}
+
+	resposta, err := json.Marshal(resultados)
+	if err != nil {
+		registador.Erro(ctx, "erro ao converter os resultados das actions", registos.CampoErro, err)
+		responderErro(rw, http.StatusInternalServerError, "Unable to marshal the actions results")
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Write(resposta)
+}
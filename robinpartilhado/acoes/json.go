@@ -0,0 +1,169 @@
+package acoes
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/autorizacao"
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/registos"
+)
+
+const (
+	// RotaJSON prefixo do caminho das actions chamadas em JSON, seguido do nome da action, ex: /acoes/CriarRepositorio
+	RotaJSON = "/acoes/"
+	// MensagemErroInterno erro devolvido no lugar do retorno das actions que entraram em pânico
+	MensagemErroInterno = "erro interno ao executar a action"
+
+	// tamanhoMaximoJSON tamanho máximo do body das chamadas em JSON, o conteúdo dos ficheiros da documentação vai no body
+	tamanhoMaximoJSON = 8 << 20
+)
+
+// ChavesErro Keys do retorno das actions que guardam um erro (ver ChaveErro)
+var ChavesErro = []string{"erro", "error", "err"}
+
+// ErrInterno erro devolvido no lugar do retorno das actions que entraram em pânico
+var ErrInterno = errors.New(MensagemErroInterno)
+
+/*
+PedidoJSON Body de uma chamada a uma action em JSON (ver Despachante.ServeJSON): os parametros pela ordem da função,
+sem o contexto, e com a token como último parametro nas actions que a recebem, ex:
+---
+
+	POST /acoes/BuscarRepositorio
+	{"params": [{"nome": "manutencao \"geral\""}, "<token>"]}
+
+Ao contrário das actions em texto, os valores podem ter aspas, chavetas e mudanças de linha
+*/
+type PedidoJSON struct {
+	Params []interface{} `json:"params"`
+}
+
+// pedidoJSON Body recebido, cada parametro é convertido no tipo do parametro da função
+type pedidoJSON struct {
+	Params []json.RawMessage `json:"params"`
+}
+
+// Estado Estado http que corresponde ao retorno de uma action: 200 sem erro (ver ChavesErro), 401 se a token não foi aceite,
+// 403 se a token não têm as permissões pedidas, 500 se a action entrou em pânico, e 400 para os outros erros.
+// Os erros são identificados com errors.Is, por isso as actions têm de guardar no retorno o error devolvido
+// pelo pacote autorizacao, e não a sua mensagem
+func Estado(retorno map[string]interface{}) int {
+	erro := erroRetorno([]interface{}{retorno})
+	switch {
+	case erro == nil:
+		return http.StatusOK
+	case errors.Is(erro, autorizacao.ErrTokenInvalida),
+		errors.Is(erro, autorizacao.ErrTokenRevogada),
+		errors.Is(erro, autorizacao.ErrTipoToken):
+		return http.StatusUnauthorized
+	case errors.Is(erro, autorizacao.ErrSemPermissoes):
+		return http.StatusForbidden
+	case errors.Is(erro, ErrInterno):
+		return http.StatusInternalServerError
+	}
+	return http.StatusBadRequest
+}
+
+// responderJSON Escreve o valor em JSON, com o estado indicado
+func responderJSON(rw http.ResponseWriter, estado int, valor interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(estado)
+	json.NewEncoder(rw).Encode(valor)
+}
+
+// converterParams Converte os parametros JSON nos tipos dos parametros da função, sem contar com o contexto
+func converterParams(funcao reflect.Type, params []json.RawMessage) ([]interface{}, error) {
+	inicio := 0
+	if recebeContexto(funcao) {
+		inicio = 1
+	}
+	if esperados := funcao.NumIn() - inicio; len(params) != esperados {
+		return nil, fmt.Errorf("a action recebe %d parametros, foram enviados %d", esperados, len(params))
+	}
+
+	valores := make([]interface{}, len(params))
+	for i, param := range params {
+		valor := reflect.New(funcao.In(inicio + i))
+		if err := json.Unmarshal(param, valor.Interface()); err != nil {
+			return nil, fmt.Errorf("parametro %d: %v", i+1, err)
+		}
+		valores[i] = valor.Elem().Interface()
+	}
+	return valores, nil
+}
+
+// retornoDe Retorno da action (o primeiro valor devolvido), com os erros ainda guardados como error (ver Estado)
+func retornoDe(devolvidos []interface{}) map[string]interface{} {
+	if len(devolvidos) == 0 {
+		return map[string]interface{}{}
+	}
+	retorno, ok := devolvidos[0].(map[string]interface{})
+	if !ok {
+		return map[string]interface{}{"resultado": devolvidos}
+	}
+	return retorno
+}
+
+// mensagensErro Substitui os erros guardados como error no retorno das actions pela sua mensagem,
+// em JSON um error é um objeto vazio
+func mensagensErro(devolvidos []interface{}) {
+	if len(devolvidos) == 0 {
+		return
+	}
+	retorno, ok := devolvidos[0].(map[string]interface{})
+	if !ok {
+		return
+	}
+	for chave, valor := range retorno {
+		if erro, ok := valor.(error); ok {
+			retorno[chave] = erro.Error()
+		}
+	}
+}
+
+// ServeJSON Chama a action do caminho (RotaJSON seguido do nome) com os parametros do body (ver PedidoJSON),
+// e responde com o retorno da action em JSON e o estado http do resultado (ver Estado)
+func (d *Despachante) ServeJSON(rw http.ResponseWriter, r *http.Request) {
+	registador := d.registador()
+	nome := strings.TrimPrefix(r.URL.Path, RotaJSON)
+	funcao, existe := d.Funcs[nome]
+	if !existe {
+		responderJSON(rw, http.StatusNotFound, map[string]interface{}{"erro": "action desconhecida: " + nome})
+		return
+	}
+
+	var pedido pedidoJSON
+	if err := json.NewDecoder(http.MaxBytesReader(rw, r.Body, tamanhoMaximoJSON)).Decode(&pedido); err != nil && err != io.EOF {
+		registador.Aviso(r.Context(), "action inválida", registos.CampoAcao, nome, registos.CampoErro, err)
+		responderJSON(rw, http.StatusBadRequest, map[string]interface{}{"erro": "o body têm de ser um objeto JSON com os parametros da action"})
+		return
+	}
+	params, err := converterParams(reflect.TypeOf(funcao), pedido.Params)
+	if err != nil {
+		registador.Aviso(r.Context(), "action inválida", registos.CampoAcao, nome, registos.CampoErro, err)
+		responderJSON(rw, http.StatusBadRequest, map[string]interface{}{"erro": err.Error()})
+		return
+	}
+
+	ctx := ComPedido(r.Context(), NovoPedido(r, d.ConfiarProxy))
+	devolvidos := d.executar(ctx, registador, chamada{nome: nome, params: params})
+	retorno := retornoDe(devolvidos)
+	// O estado é calculado antes dos erros passarem a ser só a mensagem
+	estado := Estado(retorno)
+	mensagensErro(devolvidos)
+	resposta, err := json.Marshal(retorno)
+	if err != nil {
+		registador.Erro(ctx, "erro ao converter o retorno da action", registos.CampoAcao, nome, registos.CampoErro, err)
+		responderJSON(rw, http.StatusInternalServerError, map[string]interface{}{"erro": "não foi possível converter o retorno da action"})
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(estado)
+	rw.Write(resposta)
+}
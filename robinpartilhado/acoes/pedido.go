@@ -0,0 +1,56 @@
+package acoes
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// chavePedido chave do contexto onde são guardados os dados do pedido http
+type chavePedido struct{}
+
+// Pedido Dados do pedido http que originou a chamada de uma action
+type Pedido struct {
+	IP string // IP do cliente que fez o pedido
+}
+
+// ComPedido Devolve uma cópia do contexto com os dados do pedido
+func ComPedido(ctx context.Context, pedido Pedido) context.Context {
+	return context.WithValue(ctx, chavePedido{}, pedido)
+}
+
+// PedidoDe Devolve os dados do pedido guardados no contexto, vazio se o contexto não tiver pedido
+func PedidoDe(ctx context.Context) Pedido {
+	pedido, _ := ctx.Value(chavePedido{}).(Pedido)
+	return pedido
+}
+
+// NovoPedido Extrai os dados do pedido http, para os handlers que não passam pelo Despachante
+func NovoPedido(r *http.Request, confiarProxy bool) Pedido {
+	return Pedido{IP: ipCliente(r, confiarProxy)}
+}
+
+// ipCliente Devolve o IP do cliente, os headers X-Forwarded-For e X-Real-IP só são usados
+// se o serviço confiar no proxy à sua frente, caso contrário qualquer cliente podia escolher o seu IP.
+// Do X-Forwarded-For só é usado o último endereço, o acrescentado pelo proxy de confiança: os anteriores
+// vêm do cliente (ou de proxies desconhecidos) e podem ser inventados
+func ipCliente(r *http.Request, confiarProxy bool) string {
+	if confiarProxy {
+		if encaminhados := r.Header.Values("X-Forwarded-For"); len(encaminhados) > 0 {
+			enderecos := strings.Split(encaminhados[len(encaminhados)-1], ",")
+			if ultimo := strings.TrimSpace(enderecos[len(enderecos)-1]); ultimo != "" {
+				return ultimo
+			}
+		}
+		if real := r.Header.Get("X-Real-IP"); real != "" {
+			return strings.TrimSpace(real)
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,174 @@
+package autorizacao
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	// ROOT utilizador com as permissões mais elevadas, valor 1
+	ROOT = iota + 1
+	// ADMIN administrador da plataforma, valor 2
+	ADMIN
+	// USER previlégios básicos, valor 3
+	USER
+)
+
+const (
+	// EmissorTokens valor da claim iss de todas as tokens emitidas pelo serviço de autenticação
+	EmissorTokens = "Robin-Servico-Auth"
+	// TipoRefresh valor da claim typ das tokens de refresh, que não podem ser usadas como tokens de acesso
+	TipoRefresh = "reauth"
+	// TipoParcial valor da claim typ das tokens parciais, emitidas no login antes do segundo fator (TOTP)
+	TipoParcial = "2fa"
+	// PrefixoServico prefixo da claim sub das tokens de serviço, seguido do nome da conta de serviço
+	PrefixoServico = "svc:"
+)
+
+var (
+	// ErrTokenInvalida a token não têm uma assinatura válida, expirou, ou não foi emitida pelo serviço de autenticação
+	ErrTokenInvalida = errors.New("token inválida ou expirada")
+	// ErrTokenRevogada a token é válida mas foi revogada
+	ErrTokenRevogada = errors.New("token revogada")
+	// ErrTipoToken a token não é do tipo esperado (ex: uma token de refresh usada como token de acesso)
+	ErrTipoToken = errors.New("tipo de token inesperado")
+	// ErrSemPermissoes a token é válida mas não têm as permissões necessárias
+	ErrSemPermissoes = errors.New("a token não têm permissões")
+)
+
+// erroPermissoes Erro de permissões com a mensagem da action, errors.Is(erro, ErrSemPermissoes) é verdade
+type erroPermissoes struct {
+	mensagem string
+}
+
+func (erro erroPermissoes) Error() string {
+	return erro.mensagem
+}
+
+func (erro erroPermissoes) Unwrap() error {
+	return ErrSemPermissoes
+}
+
+// SemPermissoes Erro de permissões com uma mensagem própria (ex: nas actions que verificam o dono do recurso),
+// tratado como o ErrSemPermissoes
+func SemPermissoes(mensagem string) error {
+	return erroPermissoes{mensagem: mensagem}
+}
+
+// Claims Valores do body de uma token emitida pelo serviço de autenticação
+type Claims struct {
+	User       string   // Vazio nas tokens de serviço
+	Sujeito    string   // Claim sub, "svc:<conta>" nas tokens de serviço
+	Perms      int      // Nivel do user (ROOT, ADMIN ou USER), 0 se a token não tiver permissões (ex: tokens de refresh)
+	Roles      []string // Roles do user quando a token foi emitida
+	Permissoes []string // Permissões dadas pelos roles do user
+	Scopes     []string // Claim scope, separada por espaços
+	Tipo       string   // Claim typ, vazia nas tokens de acesso
+	JTI        string
+	Familia    string
+	Emissor    string
+	Emitida    time.Time
+	Expira     time.Time
+
+	// Mapa claims originais da token
+	Mapa jwt.MapClaims
+}
+
+// NovasClaims Converte as claims de uma token para a struct Claims,
+// as claims em falta ou com o tipo errado ficam com o valor zero
+func NovasClaims(mapa jwt.MapClaims) Claims {
+	claims := Claims{Mapa: mapa}
+
+	claims.User, _ = mapa["user"].(string)
+	claims.Sujeito, _ = mapa["sub"].(string)
+	claims.Tipo, _ = mapa["typ"].(string)
+	claims.JTI, _ = mapa["jti"].(string)
+	claims.Familia, _ = mapa["fam"].(string)
+	claims.Emissor, _ = mapa["iss"].(string)
+	if perms, ok := mapa["perms"].(float64); ok {
+		claims.Perms = int(perms)
+	}
+	claims.Roles = listaStrings(mapa["roles"])
+	claims.Permissoes = listaStrings(mapa["permissoes"])
+	if scope, ok := mapa["scope"].(string); ok {
+		claims.Scopes = strings.Fields(scope)
+	}
+	// O iat pode ter a fração dos segundos (precisão dos milissegundos)
+	if iat, ok := mapa["iat"].(float64); ok {
+		claims.Emitida = time.UnixMilli(int64(math.Round(iat * 1000)))
+	}
+	if exp, ok := mapa["exp"].(float64); ok {
+		claims.Expira = time.Unix(int64(exp), 0)
+	}
+	return claims
+}
+
+// listaStrings Converte uma claim com uma lista (json) para []string, ignora os valores que não são strings
+func listaStrings(valor interface{}) []string {
+	lista, _ := valor.([]interface{})
+	resultado := make([]string, 0, len(lista))
+	for _, v := range lista {
+		if s, ok := v.(string); ok {
+			resultado = append(resultado, s)
+		}
+	}
+	return resultado
+}
+
+// Refresh Indica se as claims são de uma token de refresh
+func (claims Claims) Refresh() bool {
+	return claims.Tipo == TipoRefresh
+}
+
+// Servico Indica se as claims são de uma token de serviço, emitida a uma conta de serviço
+// (client credentials) para as chamadas entre serviços
+func (claims Claims) Servico() bool {
+	return strings.HasPrefix(claims.Sujeito, PrefixoServico) && claims.User == ""
+}
+
+// ContaServico Devolve o nome da conta de serviço dona da token, vazio se não for uma token de serviço
+func (claims Claims) ContaServico() string {
+	if !claims.Servico() {
+		return ""
+	}
+	return strings.TrimPrefix(claims.Sujeito, PrefixoServico)
+}
+
+// TemPermissao Verifica se o user têm as permissões pedidas ou superiores (ROOT > ADMIN > USER)
+func (claims Claims) TemPermissao(perms int) bool {
+	return claims.Perms >= ROOT && claims.Perms <= perms
+}
+
+// Pode Verifica se algum dos roles do user lhe dá a permissão pedida
+func (claims Claims) Pode(permissao string) bool {
+	for _, p := range claims.Permissoes {
+		if p == permissao {
+			return true
+		}
+	}
+	return false
+}
+
+// TemRole Verifica se o user têm o role pedido
+func (claims Claims) TemRole(role string) bool {
+	for _, r := range claims.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// TemScope Verifica se a token foi emitida com o scope pedido
+func (claims Claims) TemScope(scope string) bool {
+	for _, s := range claims.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package autorizacao
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// URLIntrospecaoDefault endpoint default do serviço de autenticação que indica se uma token continua ativa (não revogada)
+const URLIntrospecaoDefault = "http://0.0.0.0:8081/introspecao"
+
+// duracaoCacheIntrospecao tempo durante o qual a resposta do serviço de autenticação é reutilizada,
+// é também o tempo máximo que uma token revogada pode continuar a ser aceite por um serviço
+const duracaoCacheIntrospecao = time.Second * 30
+
+// resultadoIntrospecao Resposta do serviço de autenticação guardada em cache
+type resultadoIntrospecao struct {
+	ativa  bool
+	expira time.Time
+}
+
+// Introspecao Pergunta ao serviço de autenticação se as tokens foram revogadas, e guarda as respostas por token
+type Introspecao struct {
+	url     string
+	logger  *log.Logger
+	cliente *http.Client
+
+	mutex  sync.Mutex
+	tokens map[string]resultadoIntrospecao
+}
+
+// NovaIntrospecao Cria o cliente do endpoint de introspeção em url (URLIntrospecaoDefault se url == ""),
+// os erros ao contactar o serviço de autenticação são escritos no logger
+func NovaIntrospecao(url string, logger *log.Logger) *Introspecao {
+	if url == "" {
+		url = URLIntrospecaoDefault
+	}
+	return &Introspecao{
+		url:     url,
+		logger:  logger,
+		cliente: &http.Client{Timeout: time.Second * 2},
+		tokens:  make(map[string]resultadoIntrospecao),
+	}
+}
+
+// UsarTransporte Define o transporte dos pedidos ao endpoint de introspeção (ex: com métricas), nil usa o http.DefaultTransport
+func (introspecao *Introspecao) UsarTransporte(transporte http.RoundTripper) *Introspecao {
+	introspecao.cliente.Transport = transporte
+	return introspecao
+}
+
+// Ativa Pergunta ao serviço de autenticação se a token não foi revogada, com cache das respostas.
+// Se não for possivél contactar o serviço de autenticação a token é considerada inativa
+func (introspecao *Introspecao) Ativa(token string, _ Claims) bool {
+	introspecao.mutex.Lock()
+	resultado, existe := introspecao.tokens[token]
+	introspecao.mutex.Unlock()
+	if existe && time.Now().Before(resultado.expira) {
+		return resultado.ativa
+	}
+
+	resp, err := introspecao.cliente.PostForm(introspecao.url, url.Values{"token": {token}})
+	if err != nil {
+		introspecao.logger.Println("Erro ao contactar o serviço de autenticação: ", err)
+		return false
+	}
+	defer resp.Body.Close()
+
+	var resposta struct {
+		Ativa bool `json:"ativa"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&resposta); err != nil {
+		introspecao.logger.Println("Erro ao ler a resposta do serviço de autenticação: ", err)
+		return false
+	}
+
+	introspecao.mutex.Lock()
+	// Limpa as entradas expiradas para a cache não crescer sem limite
+	if len(introspecao.tokens) > 1024 {
+		for t, r := range introspecao.tokens {
+			if time.Now().After(r.expira) {
+				delete(introspecao.tokens, t)
+			}
+		}
+	}
+	introspecao.tokens[token] = resultadoIntrospecao{
+		ativa:  resposta.Ativa,
+		expira: time.Now().Add(duracaoCacheIntrospecao),
+	}
+	introspecao.mutex.Unlock()
+
+	return resposta.Ativa
+}
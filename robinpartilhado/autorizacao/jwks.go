@@ -0,0 +1,173 @@
+package autorizacao
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// URLJWKSDefault endpoint default do serviço de autenticação que publica as chaves públicas de verificação das tokens
+const URLJWKSDefault = "http://0.0.0.0:8081/.well-known/jwks.json"
+
+const (
+	// duracaoCacheJWKS tempo durante o qual as chaves buscadas são usadas sem voltar a perguntar ao serviço de autenticação
+	duracaoCacheJWKS = time.Minute * 10
+	// intervaloMinimoJWKS tempo minimo entre pedidos ao serviço de autenticação, quando aparece um kid desconhecido
+	// ou quando o último pedido falhou
+	intervaloMinimoJWKS = time.Second * 30
+	// validadeMaximaJWKS tempo durante o qual as chaves buscadas continuam a ser usadas se o serviço de autenticação
+	// não responder, as tokens de acesso expiram antes
+	validadeMaximaJWKS = time.Hour
+)
+
+// ChavesJWKS Busca e guarda em cache (por kid) as chaves públicas publicadas pelo serviço de autenticação
+type ChavesJWKS struct {
+	url     string
+	logger  *log.Logger
+	cliente *http.Client
+
+	mutex    sync.Mutex
+	chaves   map[string]*rsa.PublicKey
+	buscadas time.Time     // Último pedido ao serviço de autenticação com sucesso
+	tentada  time.Time     // Último pedido ao serviço de autenticação, com ou sem sucesso
+	emCurso  chan struct{} // Fechado quando o pedido em curso termina, nil se não houver nenhum
+}
+
+// NovasChavesJWKS Cria a cache das chaves publicadas em url (URLJWKSDefault se url == ""),
+// os erros ao contactar o serviço de autenticação são escritos no logger
+func NovasChavesJWKS(url string, logger *log.Logger) *ChavesJWKS {
+	if url == "" {
+		url = URLJWKSDefault
+	}
+	return &ChavesJWKS{
+		url:     url,
+		logger:  logger,
+		cliente: &http.Client{Timeout: time.Second * 2},
+		chaves:  make(map[string]*rsa.PublicKey),
+	}
+}
+
+// UsarTransporte Define o transporte dos pedidos ao endpoint JWKS (ex: com métricas), nil usa o http.DefaultTransport
+func (jwks *ChavesJWKS) UsarTransporte(transporte http.RoundTripper) *ChavesJWKS {
+	jwks.cliente.Transport = transporte
+	return jwks
+}
+
+// buscar Pede o conjunto de chaves públicas ao serviço de autenticação
+func (jwks *ChavesJWKS) buscar() (map[string]*rsa.PublicKey, error) {
+	resp, err := jwks.cliente.Get(jwks.url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("resposta inesperada do endpoint JWKS: %s", resp.Status)
+	}
+
+	var conjunto struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&conjunto); err != nil {
+		return nil, err
+	}
+
+	chaves := make(map[string]*rsa.PublicKey)
+	for _, chave := range conjunto.Keys {
+		if chave.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(chave.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(chave.E)
+		if err != nil {
+			return nil, err
+		}
+		chaves[chave.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	return chaves, nil
+}
+
+// chavePublica Devolve a chave pública com o kid fornecido, busca o conjunto outra vez
+// se a cache expirou, ou se o kid é desconhecido (a chave pode ter sido rodada).
+// Só é feito um pedido de cada vez, fora do mutex, e no máximo um a cada intervaloMinimoJWKS
+func (jwks *ChavesJWKS) chavePublica(kid string) (*rsa.PublicKey, error) {
+	jwks.mutex.Lock()
+	defer jwks.mutex.Unlock()
+
+	for {
+		if chave, existe := jwks.chaves[kid]; existe && time.Since(jwks.buscadas) < duracaoCacheJWKS {
+			return chave, nil
+		}
+		if time.Since(jwks.tentada) < intervaloMinimoJWKS {
+			return jwks.chaveConhecida(kid)
+		}
+		if jwks.emCurso == nil {
+			break
+		}
+		// Outro pedido já está a buscar as chaves, usa o resultado desse
+		emCurso := jwks.emCurso
+		jwks.mutex.Unlock()
+		<-emCurso
+		jwks.mutex.Lock()
+	}
+
+	emCurso := make(chan struct{})
+	jwks.emCurso = emCurso
+	jwks.mutex.Unlock()
+	chaves, err := jwks.buscar()
+	jwks.mutex.Lock()
+	jwks.emCurso = nil
+	jwks.tentada = time.Now()
+	close(emCurso)
+
+	if err != nil {
+		// Continua a usar as chaves que já conhecia, até à validadeMaximaJWKS
+		jwks.logger.Println("Erro ao buscar as chaves do serviço de autenticação: ", err)
+	} else {
+		jwks.chaves = chaves
+		jwks.buscadas = jwks.tentada
+	}
+	return jwks.chaveConhecida(kid)
+}
+
+// chaveConhecida Devolve a chave com o kid fornecido entre as chaves já buscadas, se não passou a validadeMaximaJWKS
+// desde a última busca com sucesso. Tem de ser chamado com o mutex obtido
+func (jwks *ChavesJWKS) chaveConhecida(kid string) (*rsa.PublicKey, error) {
+	chave, existe := jwks.chaves[kid]
+	if !existe {
+		return nil, fmt.Errorf("kid desconhecido: %v", kid)
+	}
+	if time.Since(jwks.buscadas) > validadeMaximaJWKS {
+		return nil, fmt.Errorf("as chaves de verificação não são atualizadas desde %v", jwks.buscadas)
+	}
+	return chave, nil
+}
+
+// ChaveVerificacao Devolve a chave pública para verificar a token, pelo kid no header da mesma,
+// só são aceites tokens assinadas com RSA
+func (jwks *ChavesJWKS) ChaveVerificacao(token *jwt.Token) (interface{}, error) {
+	// valida o metodo de assinatura da key
+	if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+		return nil, fmt.Errorf("metodo de assinatura inesperado: %v", token.Header["alg"])
+	}
+	kid, _ := token.Header["kid"].(string)
+	return jwks.chavePublica(kid)
+}
@@ -0,0 +1,110 @@
+package autorizacao
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// servidorJWKS Endpoint JWKS de teste que publica a chave com o kid indicado, conta os pedidos recebidos
+// e responde 503 enquanto falhar for verdadeiro
+func servidorJWKS(t *testing.T, kid string, chave *rsa.PublicKey, pedidos *int32, falhar *int32) *httptest.Server {
+	t.Helper()
+	servidor := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(pedidos, 1)
+		// Atrasa a resposta, para os pedidos em simultâneo chegarem durante a busca
+		time.Sleep(time.Millisecond * 50)
+		if atomic.LoadInt32(falhar) != 0 {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(rw).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": kid,
+			"n":   base64.RawURLEncoding.EncodeToString(chave.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(chave.E)).Bytes()),
+		}}})
+	}))
+	t.Cleanup(servidor.Close)
+	return servidor
+}
+
+func TestChavesJWKSUmPedido(t *testing.T) {
+	privada, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pedidos, falhar int32
+	servidor := servidorJWKS(t, "kid-1", &privada.PublicKey, &pedidos, &falhar)
+	jwks := NovasChavesJWKS(servidor.URL, log.New(io.Discard, "", 0))
+
+	// Os pedidos em simultâneo esperam pela mesma busca
+	var grupo sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		grupo.Add(1)
+		go func() {
+			defer grupo.Done()
+			if _, err := jwks.chavePublica("kid-1"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	grupo.Wait()
+	if atomic.LoadInt32(&pedidos) != 1 {
+		t.Fatalf("esperava 1 pedido ao endpoint JWKS, foram feitos %d", atomic.LoadInt32(&pedidos))
+	}
+
+	// Os kids desconhecidos não voltam a buscar as chaves antes do intervalo minimo
+	for i := 0; i < 5; i++ {
+		if _, err := jwks.chavePublica("inventado"); err == nil {
+			t.Fatal("kid desconhecido aceite")
+		}
+	}
+	if atomic.LoadInt32(&pedidos) != 1 {
+		t.Fatalf("os kids desconhecidos fizeram %d pedidos", atomic.LoadInt32(&pedidos)-1)
+	}
+}
+
+func TestChavesJWKSFalha(t *testing.T) {
+	privada, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pedidos, falhar int32
+	servidor := servidorJWKS(t, "kid-1", &privada.PublicKey, &pedidos, &falhar)
+	jwks := NovasChavesJWKS(servidor.URL, log.New(io.Discard, "", 0))
+	if _, err := jwks.chavePublica("kid-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Com a cache expirada e o serviço de autenticação em baixo, a chave conhecida continua a ser usada,
+	// e a falha não é repetida em cada verificação
+	atomic.StoreInt32(&falhar, 1)
+	jwks.buscadas = time.Now().Add(-duracaoCacheJWKS)
+	jwks.tentada = jwks.buscadas
+	for i := 0; i < 5; i++ {
+		if _, err := jwks.chavePublica("kid-1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if atomic.LoadInt32(&pedidos) != 2 {
+		t.Fatalf("esperava 2 pedidos ao endpoint JWKS, foram feitos %d", atomic.LoadInt32(&pedidos))
+	}
+
+	// Mas só até à validade máxima
+	jwks.buscadas = time.Now().Add(-validadeMaximaJWKS)
+	jwks.tentada = jwks.buscadas
+	if _, err := jwks.chavePublica("kid-1"); err == nil {
+		t.Fatal("chave aceite depois da validade máxima")
+	}
+}
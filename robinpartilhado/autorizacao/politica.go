@@ -0,0 +1,90 @@
+package autorizacao
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// tipoRetornoAcao tipo devolvido por todas as actions
+var tipoRetornoAcao = reflect.TypeOf(map[string]interface{}{})
+
+// Politica Requisitos de autorização de uma action, verificados antes da action ser chamada.
+// A token é sempre o último parametro da action
+type Politica struct {
+	Publica    bool     // A action não precisa de token
+	Perms      int      // Nivel minimo (ROOT, ADMIN ou USER), 0 aceita qualquer token de acesso válida de um user
+	Permissoes []string // Permissões (dadas pelos roles do user) que a token têm de ter
+	Scopes     []string // Scopes que a token têm de ter
+	// Dono posição (a começar em 1, a contar com o contexto se a action o receber) do parametro com o nome do user dono do recurso,
+	// a token têm de ser desse user ou de um admin, 0 se a action não tiver dono
+	Dono int
+	// Servicos scopes com que uma token de serviço pode chamar a action em vez de uma token de user,
+	// as regras do user não se aplicam às tokens de serviço. Vazio se a action só aceitar tokens de users
+	Servicos []string
+}
+
+// regras Converte a politica nas regras a verificar, para os parametros da chamada
+func (politica Politica) regras(params []reflect.Value) []Regra {
+	regras := make([]Regra, 0, 5)
+	regras = append(regras, Utilizador())
+	if politica.Perms != 0 {
+		regras = append(regras, Permissao(politica.Perms))
+	}
+	if len(politica.Permissoes) > 0 {
+		regras = append(regras, Permite(politica.Permissoes...))
+	}
+	if len(politica.Scopes) > 0 {
+		regras = append(regras, Scopes(politica.Scopes...))
+	}
+	if politica.Dono > 0 {
+		regras = append(regras, DonoOuAdmin(params[politica.Dono-1].String()))
+	}
+	if len(politica.Servicos) > 0 {
+		return []Regra{Alguma(Todas(regras...), Servico(politica.Servicos...))}
+	}
+	return regras
+}
+
+// Proteger Devolve uma função com a mesma assinatura da action, que só chama a action
+// se a token cumprir a politica, caso contrário devolve {"erro": <motivo>}, com o motivo como error (ver acoes.Estado). As actions publicas não são alteradas.
+// Entra em pânico se a action não for compativél com a politica, para o erro ser visto no arranque do serviço
+func Proteger(v *Verificador, politica Politica, acao interface{}) interface{} {
+	if politica.Publica {
+		return acao
+	}
+
+	funcao := reflect.ValueOf(acao)
+	tipo := funcao.Type()
+	if tipo.Kind() != reflect.Func || tipo.NumOut() != 1 || tipo.Out(0) != tipoRetornoAcao {
+		panic(fmt.Sprintf("autorizacao: a action %v têm de devolver só map[string]interface{}", tipo))
+	}
+	if tipo.NumIn() == 0 || tipo.In(tipo.NumIn()-1).Kind() != reflect.String {
+		panic(fmt.Sprintf("autorizacao: o último parametro da action %v têm de ser a token", tipo))
+	}
+	if politica.Dono > 0 && (politica.Dono >= tipo.NumIn() || tipo.In(politica.Dono-1).Kind() != reflect.String) {
+		panic(fmt.Sprintf("autorizacao: o parametro dono %d da action %v não é uma string", politica.Dono, tipo))
+	}
+
+	return reflect.MakeFunc(tipo, func(params []reflect.Value) []reflect.Value {
+		token := params[len(params)-1].String()
+		if _, err := v.Exigir(token, politica.regras(params)...); err != nil {
+			return []reflect.Value{reflect.ValueOf(map[string]interface{}{"erro": err})}
+		}
+		return funcao.Call(params)
+	}).Interface()
+}
+
+// Acoes Regista as actions de um serviço, cada uma protegida pela sua politica
+type Acoes struct {
+	Funcs       map[string]interface{} // Normalmente o actions.FuncsStorage
+	Verificador *Verificador
+	Politicas   map[string]Politica // A politica de cada action registada, usada no esquema das actions (opcional)
+}
+
+// Registar Regista a action com o nome fornecido, protegida pela politica
+func (acoes Acoes) Registar(nome string, acao interface{}, politica Politica) {
+	acoes.Funcs[nome] = Proteger(acoes.Verificador, politica, acao)
+	if acoes.Politicas != nil {
+		acoes.Politicas[nome] = politica
+	}
+}
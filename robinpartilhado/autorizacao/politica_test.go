@@ -0,0 +1,174 @@
+package autorizacao
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// emissorTeste Assina tokens de teste com uma chave RSA, e cria o verificador dessas tokens
+type emissorTeste struct {
+	t       *testing.T
+	privada *rsa.PrivateKey
+}
+
+func novoEmissorTeste(t *testing.T) emissorTeste {
+	t.Helper()
+	privada, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return emissorTeste{t: t, privada: privada}
+}
+
+// verificador Verificador das tokens do emissor, as tokens com o jti "revogada" são revogadas
+func (emissor emissorTeste) verificador() *Verificador {
+	return NovoVerificador(func(*jwt.Token) (interface{}, error) {
+		return &emissor.privada.PublicKey, nil
+	}, func(_ string, claims Claims) bool {
+		return claims.JTI != "revogada"
+	})
+}
+
+// token Assina uma token com as claims fornecidas, mais o emissor e a expiração
+func (emissor emissorTeste) token(claims jwt.MapClaims) string {
+	emissor.t.Helper()
+	claims["iss"] = EmissorTokens
+	claims["exp"] = time.Now().Add(time.Minute).Unix()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(emissor.privada)
+	if err != nil {
+		emissor.t.Fatal(err)
+	}
+	return token
+}
+
+// tokenUser Token de acesso de um user com o nivel e as permissões fornecidas
+func (emissor emissorTeste) tokenUser(user string, perms int, permissoes ...string) string {
+	lista := make([]interface{}, len(permissoes))
+	for i, permissao := range permissoes {
+		lista[i] = permissao
+	}
+	return emissor.token(jwt.MapClaims{"user": user, "perms": perms, "permissoes": lista})
+}
+
+// tokenServico Token de uma conta de serviço com os scopes fornecidos (separados por espaços)
+func (emissor emissorTeste) tokenServico(conta string, scopes string) string {
+	return emissor.token(jwt.MapClaims{"sub": PrefixoServico + conta, "scope": scopes})
+}
+
+// acaoDono Action de teste com o dono no primeiro parametro e a token no último
+func acaoDono(dono string, token string) map[string]interface{} {
+	return map[string]interface{}{"sucesso": dono}
+}
+
+func TestPolitica(t *testing.T) {
+	emissor := novoEmissorTeste(t)
+	v := emissor.verificador()
+
+	tokenAna := emissor.tokenUser("ana", USER)
+	tokenRui := emissor.tokenUser("rui", USER)
+	tokenAdmin := emissor.tokenUser("gestor", ADMIN)
+	tokenAuditor := emissor.tokenUser("eva", USER, "auditoria:ver")
+	tokenServico := emissor.tokenServico("documentacao", "userinfo:contribuicoes")
+	tokenOutroServico := emissor.tokenServico("relatorios", "outro:scope")
+
+	casos := []struct {
+		nome     string
+		politica Politica
+		token    string
+		erro     error
+	}{
+		{"publica sem token", Politica{Publica: true}, "", nil},
+		{"token inválida", Politica{}, "invalida", ErrTokenInvalida},
+		{"token revogada", Politica{}, emissor.token(jwt.MapClaims{"user": "ana", "perms": USER, "jti": "revogada"}), ErrTokenRevogada},
+		{"token de refresh", Politica{}, emissor.token(jwt.MapClaims{"user": "ana", "typ": TipoRefresh}), ErrTipoToken},
+		{"qualquer user", Politica{}, tokenAna, nil},
+		{"nivel insuficiente", Politica{Perms: ADMIN}, tokenAna, ErrSemPermissoes},
+		{"nivel suficiente", Politica{Perms: ADMIN}, tokenAdmin, nil},
+		{"sem a permissão", Politica{Permissoes: []string{"auditoria:ver"}}, tokenAdmin, ErrSemPermissoes},
+		{"com a permissão", Politica{Permissoes: []string{"auditoria:ver"}}, tokenAuditor, nil},
+		{"dono", Politica{Dono: 1}, tokenAna, nil},
+		{"outro user", Politica{Dono: 1}, tokenRui, ErrSemPermissoes},
+		{"admin no lugar do dono", Politica{Dono: 1}, tokenAdmin, nil},
+		{"dono sem o nivel", Politica{Dono: 1, Perms: ADMIN}, tokenAna, ErrSemPermissoes},
+		{"serviço sem servicos na politica", Politica{Perms: USER}, tokenServico, ErrSemPermissoes},
+		{"serviço com o scope", Politica{Perms: ADMIN, Dono: 1, Servicos: []string{"userinfo:contribuicoes"}}, tokenServico, nil},
+		{"serviço sem o scope", Politica{Dono: 1, Servicos: []string{"userinfo:contribuicoes"}}, tokenOutroServico, ErrSemPermissoes},
+		{"user numa action com servicos", Politica{Dono: 1, Servicos: []string{"userinfo:contribuicoes"}}, tokenAna, nil},
+		{"outro user numa action com servicos", Politica{Dono: 1, Servicos: []string{"userinfo:contribuicoes"}}, tokenRui, ErrSemPermissoes},
+	}
+	for _, caso := range casos {
+		acao := Proteger(v, caso.politica, acaoDono).(func(string, string) map[string]interface{})
+		retorno := acao("ana", caso.token)
+
+		erro, _ := retorno["erro"].(error)
+		if caso.erro == nil && retorno["sucesso"] != "ana" {
+			t.Errorf("%s: esperava a action chamada, retorno: %v", caso.nome, retorno)
+		}
+		if caso.erro != nil && !errors.Is(erro, caso.erro) {
+			t.Errorf("%s: esperava o erro %v, retorno: %v", caso.nome, caso.erro, retorno)
+		}
+	}
+}
+
+func TestProtegerActionIncompativel(t *testing.T) {
+	v := novoEmissorTeste(t).verificador()
+	casos := map[string]struct {
+		politica Politica
+		acao     interface{}
+	}{
+		"sem retorno":        {Politica{}, func(token string) {}},
+		"sem token":          {Politica{}, func() map[string]interface{} { return nil }},
+		"dono que é a token": {Politica{Dono: 2}, acaoDono},
+		"dono que não é string": {Politica{Dono: 1}, func(dono int, token string) map[string]interface{} {
+			return nil
+		}},
+	}
+	for nome, caso := range casos {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: esperava um pânico no registo", nome)
+				}
+			}()
+			Proteger(v, caso.politica, caso.acao)
+		}()
+	}
+}
+
+func TestRegras(t *testing.T) {
+	emissor := novoEmissorTeste(t)
+	v := emissor.verificador()
+
+	// A regra dos handlers das contribuições: o dono, um admin ou o serviço com o scope
+	regra := Alguma(DonoOuAdmin("ana"), Servico("userinfo:contribuicoes"))
+	casos := map[string]struct {
+		token  string
+		aceite bool
+	}{
+		"dono":                {emissor.tokenUser("ana", USER), true},
+		"admin":               {emissor.tokenUser("gestor", ADMIN), true},
+		"outro user":          {emissor.tokenUser("rui", USER), false},
+		"serviço com o scope": {emissor.tokenServico("documentacao", "userinfo:contribuicoes outro:scope"), true},
+		"serviço sem o scope": {emissor.tokenServico("relatorios", "outro:scope"), false},
+		// Uma token de user com o sub de serviço não é uma token de serviço
+		"user com sub de serviço": {emissor.token(jwt.MapClaims{"user": "rui", "perms": USER, "sub": PrefixoServico + "documentacao", "scope": "userinfo:contribuicoes"}), false},
+	}
+	for nome, caso := range casos {
+		_, err := v.Exigir(caso.token, regra)
+		if caso.aceite && err != nil {
+			t.Errorf("%s: recusada: %v", nome, err)
+		}
+		if !caso.aceite && !errors.Is(err, ErrSemPermissoes) {
+			t.Errorf("%s: esperava ErrSemPermissoes, recebeu %v", nome, err)
+		}
+	}
+
+	if err := SemPermissoes("mensagem da action"); !errors.Is(err, ErrSemPermissoes) || err.Error() != "mensagem da action" {
+		t.Fatalf("SemPermissoes: %v", err)
+	}
+}
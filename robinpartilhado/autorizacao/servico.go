@@ -0,0 +1,116 @@
+package autorizacao
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scopes das actions internas do serviço userinfo, chamadas pelos outros serviços com tokens de serviço
+const (
+	// ScopeUserinfoContribuicoes permite registar e alterar as contribuições dos users
+	ScopeUserinfoContribuicoes = "userinfo:contribuicoes"
+	// ScopeUserinfoAtualizar permite atualizar a informação dos users (ex: status)
+	ScopeUserinfoAtualizar = "userinfo:atualizar"
+	// ScopeUserinfoRenomear permite mudar o nome dos users
+	ScopeUserinfoRenomear = "userinfo:renomear"
+)
+
+// URLTokenDefault endpoint default do serviço de autenticação que emite as tokens das contas de serviço
+const URLTokenDefault = "http://0.0.0.0:8081/token"
+
+// margemRenovacaoServico a token de serviço é pedida de novo quando faltar menos do que isto para expirar,
+// para não ser usada numa chamada que chegue ao outro serviço já expirada
+const margemRenovacaoServico = time.Second * 30
+
+// ErrSemCredenciais o serviço não têm uma conta de serviço configurada
+var ErrSemCredenciais = errors.New("credenciais de serviço não configuradas")
+
+// CredenciaisServico Conta de serviço usada por um serviço para chamar as actions internas dos outros,
+// pede as tokens ao serviço de autenticação (client credentials) e guarda-as até estarem perto de expirar
+type CredenciaisServico struct {
+	url     string
+	conta   string
+	segredo string
+	scopes  []string
+	cliente *http.Client
+
+	mutex  sync.Mutex
+	token  string
+	expira time.Time
+}
+
+// NovasCredenciaisServico Cria as credenciais da conta de serviço, as tokens são pedidas em url
+// (URLTokenDefault se url == "") só com os scopes indicados, ou com todos os scopes da conta se scopes for vazio
+func NovasCredenciaisServico(url string, conta string, segredo string, scopes []string) *CredenciaisServico {
+	if url == "" {
+		url = URLTokenDefault
+	}
+	return &CredenciaisServico{
+		url:     url,
+		conta:   conta,
+		segredo: segredo,
+		scopes:  scopes,
+		cliente: &http.Client{Timeout: time.Second * 2},
+	}
+}
+
+// UsarTransporte Define o transporte dos pedidos das tokens de serviço (ex: com métricas), nil usa o http.DefaultTransport
+func (credenciais *CredenciaisServico) UsarTransporte(transporte http.RoundTripper) *CredenciaisServico {
+	credenciais.cliente.Transport = transporte
+	return credenciais
+}
+
+// Configuradas Indica se há uma conta de serviço, se não houver as chamadas internas usam a token do user
+func (credenciais *CredenciaisServico) Configuradas() bool {
+	return credenciais != nil && credenciais.conta != "" && credenciais.segredo != ""
+}
+
+// Token Devolve uma token de serviço válida, pedida ao serviço de autenticação se a anterior estiver perto de expirar
+func (credenciais *CredenciaisServico) Token() (string, error) {
+	if !credenciais.Configuradas() {
+		return "", ErrSemCredenciais
+	}
+
+	credenciais.mutex.Lock()
+	defer credenciais.mutex.Unlock()
+	if credenciais.token != "" && time.Until(credenciais.expira) > margemRenovacaoServico {
+		return credenciais.token, nil
+	}
+
+	pedido := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {credenciais.conta},
+		"client_secret": {credenciais.segredo},
+	}
+	if len(credenciais.scopes) > 0 {
+		pedido.Set("scope", strings.Join(credenciais.scopes, " "))
+	}
+	resp, err := credenciais.cliente.PostForm(credenciais.url, pedido)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var resposta struct {
+		Token   string `json:"access_token"`
+		Expira  int64  `json:"expires_in"`
+		Erro    string `json:"error"`
+		Detalhe string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&resposta); err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK || resposta.Token == "" {
+		return "", fmt.Errorf("o serviço de autenticação recusou a conta de serviço %s: %s %s", credenciais.conta, resposta.Erro, resposta.Detalhe)
+	}
+
+	credenciais.token = resposta.Token
+	credenciais.expira = time.Now().Add(time.Duration(resposta.Expira) * time.Second)
+	return credenciais.token, nil
+}
@@ -0,0 +1,204 @@
+package autorizacao
+
+import (
+	"github.com/dgrijalva/jwt-go"
+)
+
+// VerificarAtiva Verifica se uma token com assinatura válida não foi revogada
+type VerificarAtiva func(token string, claims Claims) bool
+
+// Regra Requisito que as claims de uma token de acesso têm de cumprir
+type Regra func(claims Claims) error
+
+// Verificador Valida as tokens emitidas pelo serviço de autenticação
+type Verificador struct {
+	chaves jwt.Keyfunc
+	ativa  VerificarAtiva
+}
+
+// NovoVerificador Cria um verificador que busca as chaves de verificação em chaves,
+// e que pergunta a ativa se a token foi revogada (nil se não houver revogação)
+func NovoVerificador(chaves jwt.Keyfunc, ativa VerificarAtiva) *Verificador {
+	return &Verificador{
+		chaves: chaves,
+		ativa:  ativa,
+	}
+}
+
+// Claims Valida a assinatura, a expiração e o emissor da token e devolve as suas claims,
+// não verifica o tipo da token nem se foi revogada
+func (v *Verificador) Claims(token string) (Claims, error) {
+	tokenJWT, err := jwt.Parse(token, v.chaves)
+	if err != nil || !tokenJWT.Valid {
+		return Claims{}, ErrTokenInvalida
+	}
+
+	mapa, ok := tokenJWT.Claims.(jwt.MapClaims)
+	if !ok || mapa["iss"] != EmissorTokens {
+		return Claims{}, ErrTokenInvalida
+	}
+	return NovasClaims(mapa), nil
+}
+
+// Utilizador Devolve o user da token (o sujeito nas tokens de serviço), vazio se a token for inválida,
+// só para identificar o autor dos pedidos nos logs, não verifica o tipo da token nem se foi revogada
+func (v *Verificador) Utilizador(token string) string {
+	claims, err := v.Claims(token)
+	if err != nil {
+		return ""
+	}
+	if claims.User != "" {
+		return claims.User
+	}
+	return claims.Sujeito
+}
+
+// Acesso Valida uma token de acesso, que não pode ter sido revogada.
+// As tokens com tipo (refresh, parciais) não são tokens de acesso
+func (v *Verificador) Acesso(token string) (Claims, error) {
+	claims, err := v.Claims(token)
+	if err != nil {
+		return Claims{}, err
+	}
+	if claims.Tipo != "" {
+		return Claims{}, ErrTipoToken
+	}
+	if v.ativa != nil && !v.ativa(token, claims) {
+		return Claims{}, ErrTokenRevogada
+	}
+	return claims, nil
+}
+
+// Refresh Valida uma token de refresh, a revogação destas tokens é gerida pelo serviço de autenticação
+func (v *Verificador) Refresh(token string) (Claims, error) {
+	claims, err := v.Claims(token)
+	if err != nil {
+		return Claims{}, err
+	}
+	if !claims.Refresh() {
+		return Claims{}, ErrTipoToken
+	}
+	return claims, nil
+}
+
+// Parcial Valida uma token parcial, que só serve para completar o login com o segundo fator
+func (v *Verificador) Parcial(token string) (Claims, error) {
+	claims, err := v.Claims(token)
+	if err != nil {
+		return Claims{}, err
+	}
+	if claims.Tipo != TipoParcial {
+		return Claims{}, ErrTipoToken
+	}
+	if v.ativa != nil && !v.ativa(token, claims) {
+		return Claims{}, ErrTokenRevogada
+	}
+	return claims, nil
+}
+
+// Exigir Valida a token de acesso e verifica que as suas claims cumprem todas as regras
+func (v *Verificador) Exigir(token string, regras ...Regra) (Claims, error) {
+	claims, err := v.Acesso(token)
+	if err != nil {
+		return Claims{}, err
+	}
+	for _, regra := range regras {
+		if err := regra(claims); err != nil {
+			return Claims{}, err
+		}
+	}
+	return claims, nil
+}
+
+// Permissao A token têm de ter as permissões pedidas ou superiores
+func Permissao(perms int) Regra {
+	return func(claims Claims) error {
+		if !claims.TemPermissao(perms) {
+			return ErrSemPermissoes
+		}
+		return nil
+	}
+}
+
+// Permite A token têm de ter todas as permissões pedidas
+func Permite(permissoes ...string) Regra {
+	return func(claims Claims) error {
+		for _, permissao := range permissoes {
+			if !claims.Pode(permissao) {
+				return ErrSemPermissoes
+			}
+		}
+		return nil
+	}
+}
+
+// Scopes A token têm de ter todos os scopes pedidos
+func Scopes(scopes ...string) Regra {
+	return func(claims Claims) error {
+		for _, scope := range scopes {
+			if !claims.TemScope(scope) {
+				return ErrSemPermissoes
+			}
+		}
+		return nil
+	}
+}
+
+// User A token têm de pertencer ao user pedido
+func User(user string) Regra {
+	return func(claims Claims) error {
+		if claims.User == "" || claims.User != user {
+			return ErrSemPermissoes
+		}
+		return nil
+	}
+}
+
+// Alguma A token têm de cumprir pelo menos uma das regras
+func Alguma(regras ...Regra) Regra {
+	return func(claims Claims) error {
+		for _, regra := range regras {
+			if regra(claims) == nil {
+				return nil
+			}
+		}
+		return ErrSemPermissoes
+	}
+}
+
+// Todas A token têm de cumprir todas as regras
+func Todas(regras ...Regra) Regra {
+	return func(claims Claims) error {
+		for _, regra := range regras {
+			if err := regra(claims); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Utilizador A token têm de ser de um user, as tokens de serviço são recusadas
+func Utilizador() Regra {
+	return func(claims Claims) error {
+		if claims.User == "" || claims.Servico() {
+			return ErrSemPermissoes
+		}
+		return nil
+	}
+}
+
+// Servico A token têm de ser de uma conta de serviço, emitida com todos os scopes pedidos
+func Servico(scopes ...string) Regra {
+	return func(claims Claims) error {
+		if !claims.Servico() {
+			return ErrSemPermissoes
+		}
+		return Scopes(scopes...)(claims)
+	}
+}
+
+// DonoOuAdmin A token têm de pertencer ao user dono do recurso, ou a um admin
+func DonoOuAdmin(dono string) Regra {
+	return Alguma(User(dono), Permissao(ADMIN))
+}
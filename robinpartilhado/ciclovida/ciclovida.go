@@ -0,0 +1,131 @@
+package ciclovida
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// fecho Recurso fechado ao desligar o serviço (ex: cliente mongo ou redis, registo de auditoria)
+type fecho struct {
+	nome   string
+	funcao func(ctx context.Context) error
+}
+
+// CicloVida Arranque e paragem de um serviço http: serve os pedidos até receber SIGINT ou SIGTERM,
+// espera pelos pedidos em curso até ao tempo de desligar, para as tarefas em segundo plano e fecha os recursos
+type CicloVida struct {
+	servidor *http.Server
+	desligar time.Duration
+	logger   *log.Logger
+
+	tarefas []func(ctx context.Context)
+	fechos  []fecho
+}
+
+// Novo Cria o ciclo de vida do servidor, desligar é o tempo máximo de espera pelos pedidos em curso
+// (0 fecha as conexões logo), as mensagens do arranque e da paragem são escritas no logger
+func Novo(servidor *http.Server, desligar time.Duration, logger *log.Logger) *CicloVida {
+	if logger == nil {
+		logger = log.New(os.Stderr, "", log.LstdFlags)
+	}
+	return &CicloVida{servidor: servidor, desligar: desligar, logger: logger}
+}
+
+// Tarefa Adiciona uma tarefa em segundo plano, iniciada com o servidor, o contexto da tarefa
+// termina quando o serviço começa a desligar, e a paragem espera que a tarefa retorne
+func (ciclo *CicloVida) Tarefa(tarefa func(ctx context.Context)) {
+	ciclo.tarefas = append(ciclo.tarefas, tarefa)
+}
+
+// AoDesligar Adiciona um recurso a fechar depois de os pedidos em curso terminarem,
+// os recursos são fechados pela ordem inversa em que foram adicionados, cada paragem com um novo prazo do tempo de desligar
+func (ciclo *CicloVida) AoDesligar(nome string, funcao func(ctx context.Context) error) {
+	ciclo.fechos = append(ciclo.fechos, fecho{nome: nome, funcao: funcao})
+}
+
+/*
+Executar Serve os pedidos até receber SIGINT/SIGTERM, o contexto terminar ou o servidor falhar, e desliga o serviço:
+---
+	1. deixa de aceitar conexões e espera pelos pedidos em curso (http.Server.Shutdown)
+	2. termina o contexto das tarefas e espera que retornem
+	3. fecha os recursos (ver AoDesligar)
+
+Os passos 1 e 2 não demoram mais do que o tempo de desligar, depois as conexões são fechadas à força,
+e o passo 3 têm outro prazo igual.
+Devolve o erro do servidor, nil se o serviço foi desligado por um sinal ou pelo contexto
+*/
+func (ciclo *CicloVida) Executar(ctx context.Context) error {
+	sinais, pararSinais := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer pararSinais()
+
+	contextoTarefas, pararTarefas := context.WithCancel(context.Background())
+	defer pararTarefas()
+	var tarefas sync.WaitGroup
+	for _, tarefa := range ciclo.tarefas {
+		tarefas.Add(1)
+		go func(tarefa func(ctx context.Context)) {
+			defer tarefas.Done()
+			tarefa(contextoTarefas)
+		}(tarefa)
+	}
+
+	erroServidor := make(chan error, 1)
+	go func() {
+		erroServidor <- ciclo.servidor.ListenAndServe()
+	}()
+	ciclo.logger.Println("Servidor a escutar em ", ciclo.servidor.Addr)
+
+	var erro error
+	select {
+	case erro = <-erroServidor:
+		if errors.Is(erro, http.ErrServerClosed) {
+			erro = nil
+		}
+	case <-sinais.Done():
+		ciclo.logger.Println("Servidor a desligar, à espera dos pedidos em curso")
+	}
+	// Um segundo sinal termina o processo logo
+	pararSinais()
+
+	prazo, cancelar := context.WithTimeout(context.Background(), ciclo.desligar)
+	defer cancelar()
+
+	if err := ciclo.servidor.Shutdown(prazo); err != nil {
+		ciclo.logger.Println("Pedidos em curso não terminaram a tempo, conexões fechadas: ", err)
+		ciclo.servidor.Close()
+	}
+
+	pararTarefas()
+	terminadas := make(chan struct{})
+	go func() {
+		tarefas.Wait()
+		close(terminadas)
+	}()
+	select {
+	case <-terminadas:
+	case <-prazo.Done():
+		ciclo.logger.Println("Tarefas em segundo plano não terminaram a tempo")
+	}
+
+	// Os recursos têm um prazo próprio, para serem fechados mesmo se os pedidos esgotaram o tempo de desligar
+	prazoFechos, cancelarFechos := context.WithCancel(context.Background())
+	if ciclo.desligar > 0 {
+		prazoFechos, cancelarFechos = context.WithTimeout(context.Background(), ciclo.desligar)
+	}
+	defer cancelarFechos()
+	for i := len(ciclo.fechos) - 1; i >= 0; i-- {
+		if err := ciclo.fechos[i].funcao(prazoFechos); err != nil {
+			ciclo.logger.Printf("Erro ao fechar %s: %v", ciclo.fechos[i].nome, err)
+		}
+	}
+
+	ciclo.logger.Println("Servidor desligado")
+	return erro
+}
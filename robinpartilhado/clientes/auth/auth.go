@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/clientes"
+)
+
+// Sessao Tokens devolvidas no login, ou só a token parcial se o user precisar do segundo fator (ver VerificarTOTP)
+type Sessao struct {
+	Token          string `json:"token"`
+	RefreshToken   string `json:"refresh_token"`
+	TokenParcial   string `json:"token_parcial"`
+	TOTPNecessario bool   `json:"totp_necessario"`
+	AtivarTOTP     bool   `json:"ativar_totp"` // Administradores sem TOTP, que têm de o ativar antes de receber as tokens
+}
+
+// ResumoUser Dados de um user na listagem dos users
+type ResumoUser struct {
+	User             string     `json:"user"`
+	Email            string     `json:"email"`
+	Roles            []string   `json:"roles"`
+	Perms            int        `json:"perms"`
+	MudarPassword    bool       `json:"mudar_password"`
+	TOTPAtivo        bool       `json:"totp_ativo"`
+	Estado           string     `json:"estado"`
+	MotivoEstado     string     `json:"motivo_estado"`
+	ExpiraEm         *time.Time `json:"expira_em"` // nil se a conta não expira
+	CriadoEm         *time.Time `json:"criado_em"`
+	UltimoLogin      *time.Time `json:"ultimo_login"`
+	PasswordMudadaEm *time.Time `json:"passwd_mudada_em"`
+}
+
+// Pesquisa Filtros da listagem dos users, todos opcionais
+type Pesquisa struct {
+	Prefixo string `json:"prefixo,omitempty"`
+	Role    string `json:"role,omitempty"`
+	Limite  int    `json:"limite,omitempty"`
+	Cursor  string `json:"cursor,omitempty"` // Cursor devolvido pela página anterior
+}
+
+// Pagina Página da listagem dos users, Cursor é "0" na última página
+type Pagina struct {
+	Users  []ResumoUser `json:"users"`
+	Cursor string       `json:"cursor"`
+}
+
+// Cliente Cliente das actions do serviço de autenticação
+type Cliente struct {
+	*clientes.Cliente
+}
+
+// Novo Cria o cliente do serviço de autenticação (ver clientes.Novo)
+func Novo(cliente *clientes.Cliente) *Cliente {
+	return &Cliente{cliente}
+}
+
+// Login Inicia a sessão do user
+func (cliente *Cliente) Login(ctx context.Context, user string, password string) (Sessao, error) {
+	var sessao Sessao
+	err := cliente.Chamar(ctx, "Login", &sessao, user, password)
+	return sessao, err
+}
+
+// VerificarTOTP Troca a token parcial do login pelas tokens da sessão, com o código TOTP ou um código de recuperação
+func (cliente *Cliente) VerificarTOTP(ctx context.Context, codigo string, tokenParcial string) (Sessao, error) {
+	var sessao Sessao
+	err := cliente.Chamar(ctx, "VerificarTOTP", &sessao, codigo, tokenParcial)
+	return sessao, err
+}
+
+// RenovarToken Novas tokens de acesso e de refresh a partir da token de refresh
+func (cliente *Cliente) RenovarToken(ctx context.Context, refreshToken string) (Sessao, error) {
+	var sessao Sessao
+	err := cliente.Chamar(ctx, "RenovarToken", &sessao, refreshToken)
+	return sessao, err
+}
+
+// Logout Termina a sessão da token
+func (cliente *Cliente) Logout(ctx context.Context, token string) error {
+	return cliente.Chamar(ctx, "Logout", nil, token)
+}
+
+// RevogarTokens Revoga todas as tokens do user
+func (cliente *Cliente) RevogarTokens(ctx context.Context, user string, token string) error {
+	return cliente.Chamar(ctx, "RevogarTokens", nil, user, token)
+}
+
+// MudarPassword Muda a password do user, não precisa de token
+func (cliente *Cliente) MudarPassword(ctx context.Context, user string, atual string, nova string) error {
+	return cliente.Chamar(ctx, "MudarPassword", nil, user, atual, nova)
+}
+
+// Registar Regista um user novo com as permissões dadas (ver autorizacao.ROOT, ADMIN e USER)
+func (cliente *Cliente) Registar(ctx context.Context, user string, password string, perms int, token string) error {
+	return cliente.Chamar(ctx, "Registar", nil, user, password, perms, token)
+}
+
+// AtualizarUser Altera os campos do user
+func (cliente *Cliente) AtualizarUser(ctx context.Context, user string, campos map[string]interface{}, token string) error {
+	return cliente.Chamar(ctx, "AtualizarUser", nil, user, campos, token)
+}
+
+// ApagarUser Apaga o user
+func (cliente *Cliente) ApagarUser(ctx context.Context, user string, token string) error {
+	return cliente.Chamar(ctx, "ApagarUser", nil, user, token)
+}
+
+// ListarUsers Página dos users que cumprem a pesquisa
+func (cliente *Cliente) ListarUsers(ctx context.Context, pesquisa Pesquisa, token string) (Pagina, error) {
+	var pagina Pagina
+	err := cliente.Chamar(ctx, "ListarUsers", &pagina, pesquisa, token)
+	return pagina, err
+}
+
+// VerificarUserExiste Indica se já existe um user com o nome dado
+func (cliente *Cliente) VerificarUserExiste(ctx context.Context, user string, token string) (bool, error) {
+	var resposta struct {
+		Existe bool `json:"existe"`
+	}
+	err := cliente.Chamar(ctx, "VerificarUserExiste", &resposta, user, token)
+	return resposta.Existe, err
+}
+
+// SessActualStatus Atualiza a mensagem de status do user
+func (cliente *Cliente) SessActualStatus(ctx context.Context, user string, status string, token string) error {
+	return cliente.Chamar(ctx, "SessActualStatus", nil, user, status, token)
+}
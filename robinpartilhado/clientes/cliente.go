@@ -0,0 +1,157 @@
+package clientes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/acoes"
+)
+
+// tamanhoMaximoResposta tamanho máximo do body das respostas, o conteúdo dos ficheiros da documentação vai na resposta
+const tamanhoMaximoResposta = 8 << 20
+
+// Config Timeout e tentativas das chamadas a um serviço, parte da configuração dos serviços que chamam outros
+type Config struct {
+	Timeout    time.Duration `conf:"timeout" desc:"tempo máximo de cada tentativa de uma chamada ao serviço"`
+	Tentativas int           `conf:"tentativas" desc:"número máximo de tentativas das chamadas que falharam antes de chegar ao serviço"`
+	Espera     time.Duration `conf:"espera" desc:"espera antes da segunda tentativa, duplica a cada tentativa"`
+}
+
+// ConfigDefault 5 segundos por tentativa, e até 3 tentativas com 200ms, 400ms de espera
+func ConfigDefault() Config {
+	return Config{
+		Timeout:    time.Second * 5,
+		Tentativas: 3,
+		Espera:     time.Millisecond * 200,
+	}
+}
+
+// Validar O timeout e a espera têm de ser maiores que 0, e pelo menos uma tentativa
+func (config *Config) Validar() error {
+	if config.Timeout <= 0 {
+		return errors.New("o timeout das chamadas têm de ser maior que 0")
+	}
+	if config.Tentativas < 1 {
+		return errors.New("as chamadas têm de ter pelo menos uma tentativa")
+	}
+	if config.Espera <= 0 {
+		return errors.New("a espera entre tentativas têm de ser maior que 0")
+	}
+	return nil
+}
+
+// Cliente Chama as actions de um serviço em JSON (ver acoes.Despachante.ServeJSON), a base dos clientes de cada serviço.
+// Os parametros são convertidos em JSON, por isso os valores podem ter aspas, chavetas e mudanças de linha
+type Cliente struct {
+	url    string
+	http   *http.Client
+	config Config
+}
+
+// Novo Cria o cliente do serviço em url (ex: http://0.0.0.0:8001), com o cliente http dado (ex: com métricas e trace),
+// http.DefaultClient se for nil. Os campos da config a 0 usam os valores do ConfigDefault
+func Novo(url string, cliente *http.Client, config Config) *Cliente {
+	if cliente == nil {
+		cliente = http.DefaultClient
+	}
+	padrao := ConfigDefault()
+	if config.Timeout <= 0 {
+		config.Timeout = padrao.Timeout
+	}
+	if config.Tentativas < 1 {
+		config.Tentativas = padrao.Tentativas
+	}
+	if config.Espera <= 0 {
+		config.Espera = padrao.Espera
+	}
+	return &Cliente{url: strings.TrimRight(url, "/"), http: cliente, config: config}
+}
+
+// URL Endereço do serviço
+func (cliente *Cliente) URL() string {
+	return cliente.url
+}
+
+/*
+Chamar Chama a action no serviço com os parametros dados (pela ordem da função, sem o contexto, e com a token
+em último nas actions que a recebem), e converte o retorno em resposta (nil ignora o retorno), ex:
+---
+
+	var resposta struct{ Repo Repositorio `json:"repo"` }
+	err := cliente.Chamar(ctx, "BuscarRepositorio", &resposta, map[string]interface{}{"nome": "manuais"}, token)
+
+Devolve um *Erro se a action devolveu um erro (ver acoes.ChavesErro) ou o serviço respondeu com um estado de erro.
+As chamadas que falham antes de chegar ao serviço (ligação recusada, 502 ou 503) são repetidas até config.Tentativas,
+as outras não, a action pode já ter sido executada
+*/
+func (cliente *Cliente) Chamar(ctx context.Context, acao string, resposta interface{}, params ...interface{}) error {
+	if params == nil {
+		params = []interface{}{}
+	}
+	corpo, err := json.Marshal(acoes.PedidoJSON{Params: params})
+	if err != nil {
+		return &Erro{Acao: acao, Mensagem: "parametros inválidos: " + err.Error()}
+	}
+
+	espera := cliente.config.Espera
+	for tentativa := 1; ; tentativa++ {
+		err = cliente.tentar(ctx, acao, corpo, resposta)
+		if err == nil || tentativa >= cliente.config.Tentativas || !repetivel(err) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(espera):
+		}
+		espera *= 2
+	}
+}
+
+// tentar Faz uma tentativa da chamada, com o timeout da config
+func (cliente *Cliente) tentar(ctx context.Context, acao string, corpo []byte, resposta interface{}) error {
+	ctx, cancelar := context.WithTimeout(ctx, cliente.config.Timeout)
+	defer cancelar()
+
+	pedido, err := http.NewRequestWithContext(ctx, http.MethodPost, cliente.url+acoes.RotaJSON+acao, bytes.NewReader(corpo))
+	if err != nil {
+		return &Erro{Acao: acao, Mensagem: err.Error()}
+	}
+	pedido.Header.Set("Content-Type", "application/json")
+	resp, err := cliente.http.Do(pedido)
+	if err != nil {
+		return &Erro{Acao: acao, Mensagem: "o serviço não respondeu", Causa: err}
+	}
+	defer resp.Body.Close()
+
+	retorno, err := ioutil.ReadAll(io.LimitReader(resp.Body, tamanhoMaximoResposta+1))
+	if err != nil {
+		return &Erro{Acao: acao, Estado: resp.StatusCode, Mensagem: "resposta incompleta do serviço", Causa: err}
+	}
+	if len(retorno) > tamanhoMaximoResposta {
+		return &Erro{Acao: acao, Estado: resp.StatusCode, Mensagem: "a resposta do serviço ultrapassa o tamanho máximo"}
+	}
+	return lerResposta(acao, resp.StatusCode, retorno, resposta)
+}
+
+// repetivel Indica se a chamada falhou antes de chegar ao serviço: a ligação não foi estabelecida,
+// ou um proxy respondeu que o serviço não está disponível
+func repetivel(err error) bool {
+	var erro *Erro
+	if !errors.As(err, &erro) {
+		return false
+	}
+	if erro.Causa != nil {
+		var erroRede *net.OpError
+		return errors.As(erro.Causa, &erroRede) && erroRede.Op == "dial"
+	}
+	return erro.Estado == http.StatusBadGateway || erro.Estado == http.StatusServiceUnavailable
+}
@@ -0,0 +1,254 @@
+package clientes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/acoes"
+)
+
+// configTeste Tentativas com esperas curtas, para os testes não demorarem
+var configTeste = Config{Timeout: time.Second, Tentativas: 3, Espera: time.Millisecond}
+
+// transporteContado Conta os pedidos feitos pelo cliente http, incluindo os que não chegam ao serviço
+type transporteContado struct {
+	pedidos int32
+}
+
+func (transporte *transporteContado) RoundTrip(pedido *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&transporte.pedidos, 1)
+	return http.DefaultTransport.RoundTrip(pedido)
+}
+
+// servicoTeste Serviço que responde às chamadas com os estados e bodies indicados, um por pedido,
+// o último repete-se nos pedidos seguintes
+func servicoTeste(t *testing.T, estados []int, corpos []string) (*httptest.Server, *int32) {
+	t.Helper()
+	var pedidos int32
+	servidor := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		i := int(atomic.AddInt32(&pedidos, 1)) - 1
+		if i >= len(estados) {
+			i = len(estados) - 1
+		}
+		rw.WriteHeader(estados[i])
+		rw.Write([]byte(corpos[i]))
+	}))
+	t.Cleanup(servidor.Close)
+	return servidor, &pedidos
+}
+
+func TestChamar(t *testing.T) {
+	var recebido acoes.PedidoJSON
+	var caminho string
+	servidor := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		caminho = r.URL.Path
+		json.NewDecoder(r.Body).Decode(&recebido)
+		rw.Write([]byte(`{"repo": {"nome": "manuais"}, "erro": ""}`))
+	}))
+	t.Cleanup(servidor.Close)
+
+	// Os parametros vão em JSON, com aspas e mudanças de linha intactas
+	cliente := Novo(servidor.URL+"/", nil, configTeste)
+	var resposta struct {
+		Repo struct {
+			Nome string `json:"nome"`
+		} `json:"repo"`
+	}
+	err := cliente.Chamar(context.Background(), "BuscarRepositorio", &resposta, map[string]interface{}{"nome": "manutenção \"geral\"\n"}, "tok")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if caminho != acoes.RotaJSON+"BuscarRepositorio" {
+		t.Fatalf("caminho da action: %s", caminho)
+	}
+	esperados := []interface{}{map[string]interface{}{"nome": "manutenção \"geral\"\n"}, "tok"}
+	if !reflect.DeepEqual(recebido.Params, esperados) {
+		t.Fatalf("esperava os parametros %v, recebeu %v", esperados, recebido.Params)
+	}
+	if resposta.Repo.Nome != "manuais" {
+		t.Fatalf("retorno não convertido: %+v", resposta)
+	}
+
+	// Sem parametros é enviada uma lista vazia, e a resposta nil ignora o retorno
+	if err := cliente.Chamar(context.Background(), "Listar", nil); err != nil {
+		t.Fatal(err)
+	}
+	if recebido.Params == nil || len(recebido.Params) != 0 {
+		t.Fatalf("esperava uma lista de parametros vazia, recebeu %v", recebido.Params)
+	}
+}
+
+func TestChamarErros(t *testing.T) {
+	var resposta struct {
+		Repo string `json:"repo"`
+	}
+	casos := []struct {
+		nome     string
+		estado   int
+		corpo    string
+		resposta interface{}
+		erro     *Erro // nil se a chamada tiver sucesso
+		causa    bool
+	}{
+		{"sucesso com erro vazio", http.StatusOK, `{"erro": "", "err": null, "error": false, "sucesso": true}`, nil, nil, false},
+		{"erro da action", http.StatusOK, `{"erro": "Repo inexistente"}`, nil, &Erro{Estado: http.StatusOK, Mensagem: "Repo inexistente"}, false},
+		{"chave de erro em maiúsculas", http.StatusBadRequest, `{"Error": "Campo em falta"}`, nil, &Erro{Estado: http.StatusBadRequest, Mensagem: "Campo em falta"}, false},
+		{"erro que não é texto", http.StatusBadRequest, `{"err": {"codigo": 7}}`, nil, &Erro{Estado: http.StatusBadRequest, Mensagem: `{"codigo": 7}`}, false},
+		{"estado de erro sem erro", http.StatusForbidden, `{"sucesso": false}`, nil, &Erro{Estado: http.StatusForbidden, Mensagem: "Forbidden"}, false},
+		{"estado de erro sem JSON", http.StatusInternalServerError, "panic", nil, &Erro{Estado: http.StatusInternalServerError, Mensagem: "Internal Server Error"}, false},
+		{"sucesso sem JSON", http.StatusOK, "ok", nil, &Erro{Estado: http.StatusOK, Mensagem: "resposta inválida do serviço"}, true},
+		{"retorno com outro formato", http.StatusOK, `{"repo": 5}`, &resposta, &Erro{Estado: http.StatusOK, Mensagem: "retorno da action com um formato inesperado"}, true},
+	}
+	for _, caso := range casos {
+		t.Run(caso.nome, func(t *testing.T) {
+			servidor, _ := servicoTeste(t, []int{caso.estado}, []string{caso.corpo})
+			err := Novo(servidor.URL, nil, configTeste).Chamar(context.Background(), "Teste", caso.resposta)
+			if caso.erro == nil {
+				if err != nil {
+					t.Fatalf("esperava sucesso, recebeu %v", err)
+				}
+				return
+			}
+
+			var erro *Erro
+			if !errors.As(err, &erro) {
+				t.Fatalf("esperava um *Erro, recebeu %v", err)
+			}
+			if erro.Acao != "Teste" || erro.Estado != caso.erro.Estado || erro.Mensagem != caso.erro.Mensagem {
+				t.Fatalf("esperava %+v, recebeu %+v", caso.erro, erro)
+			}
+			if (erro.Causa != nil) != caso.causa {
+				t.Fatalf("causa inesperada: %v", erro.Causa)
+			}
+		})
+	}
+}
+
+func TestChamarRetornoErro(t *testing.T) {
+	// Os outros campos do retorno de um erro ficam disponíveis, ex: o tentar_depois do Login
+	servidor, _ := servicoTeste(t, []int{http.StatusTooManyRequests}, []string{`{"erro": "Demasiadas tentativas", "tentar_depois": 30}`})
+	err := Novo(servidor.URL, nil, configTeste).Chamar(context.Background(), "Login", nil, "ana", "segredo")
+
+	var erro *Erro
+	if !errors.As(err, &erro) || string(erro.Retorno["tentar_depois"]) != "30" {
+		t.Fatalf("esperava o retorno completo no erro, recebeu %#v", err)
+	}
+	if err.Error() != "Login: Demasiadas tentativas" {
+		t.Fatalf("mensagem do erro: %s", err)
+	}
+	if Estado(fmt.Errorf("ao entrar: %w", err)) != http.StatusTooManyRequests || Estado(errors.New("outro")) != 0 {
+		t.Fatal("Estado não encontrou o estado da resposta")
+	}
+}
+
+func TestChamarTentativas(t *testing.T) {
+	casos := []struct {
+		nome    string
+		estados []int
+		pedidos int32
+		sucesso bool
+	}{
+		{"serviço disponível depois de falhar", []int{http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusOK}, 3, true},
+		{"serviço sempre indisponível", []int{http.StatusServiceUnavailable}, 3, false},
+		// A action pode já ter sido executada, não é repetida
+		{"erro interno", []int{http.StatusInternalServerError, http.StatusOK}, 1, false},
+		{"erro da action", []int{http.StatusBadRequest, http.StatusOK}, 1, false},
+		{"timeout do gateway", []int{http.StatusGatewayTimeout, http.StatusOK}, 1, false},
+	}
+	for _, caso := range casos {
+		t.Run(caso.nome, func(t *testing.T) {
+			corpos := make([]string, len(caso.estados))
+			for i := range corpos {
+				corpos[i] = `{"sucesso": true}`
+			}
+			servidor, pedidos := servicoTeste(t, caso.estados, corpos)
+			err := Novo(servidor.URL, nil, configTeste).Chamar(context.Background(), "Teste", nil)
+			if (err == nil) != caso.sucesso {
+				t.Fatalf("sucesso esperado: %v, erro: %v", caso.sucesso, err)
+			}
+			if atomic.LoadInt32(pedidos) != caso.pedidos {
+				t.Fatalf("esperava %d pedidos, foram feitos %d", caso.pedidos, atomic.LoadInt32(pedidos))
+			}
+		})
+	}
+}
+
+func TestChamarFalhasLigacao(t *testing.T) {
+	// A ligação recusada é repetida
+	desligado := httptest.NewServer(http.NotFoundHandler())
+	desligado.Close()
+	transporte := &transporteContado{}
+	err := Novo(desligado.URL, &http.Client{Transport: transporte}, configTeste).Chamar(context.Background(), "Teste", nil)
+	if Estado(err) != 0 || errors.Unwrap(err) == nil {
+		t.Fatalf("esperava um erro de ligação, recebeu %v", err)
+	}
+	if atomic.LoadInt32(&transporte.pedidos) != 3 {
+		t.Fatalf("esperava 3 tentativas, foram feitas %d", atomic.LoadInt32(&transporte.pedidos))
+	}
+
+	// O timeout de uma tentativa não é repetido, o pedido pode ter chegado ao serviço
+	lento := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	t.Cleanup(lento.Close)
+	transporte = &transporteContado{}
+	config := configTeste
+	config.Timeout = time.Millisecond * 50
+	err = Novo(lento.URL, &http.Client{Transport: transporte}, config).Chamar(context.Background(), "Teste", nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("esperava context.DeadlineExceeded, recebeu %v", err)
+	}
+	if atomic.LoadInt32(&transporte.pedidos) != 1 {
+		t.Fatalf("o timeout foi repetido %d vezes", atomic.LoadInt32(&transporte.pedidos)-1)
+	}
+}
+
+func TestChamarContextoCancelado(t *testing.T) {
+	// O fim do contexto interrompe a espera entre tentativas
+	servidor, pedidos := servicoTeste(t, []int{http.StatusServiceUnavailable}, []string{"{}"})
+	config := configTeste
+	config.Espera = time.Hour
+	ctx, cancelar := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancelar()
+
+	inicio := time.Now()
+	err := Novo(servidor.URL, nil, config).Chamar(ctx, "Teste", nil)
+	if Estado(err) != http.StatusServiceUnavailable {
+		t.Fatalf("esperava o erro da primeira tentativa, recebeu %v", err)
+	}
+	if time.Since(inicio) > time.Second || atomic.LoadInt32(pedidos) != 1 {
+		t.Fatalf("a espera não foi interrompida: %v, %d pedidos", time.Since(inicio), atomic.LoadInt32(pedidos))
+	}
+}
+
+func TestChamarRespostaGrande(t *testing.T) {
+	corpo := `{"conteudo": "` + strings.Repeat("a", tamanhoMaximoResposta) + `"}`
+	servidor, _ := servicoTeste(t, []int{http.StatusOK}, []string{corpo})
+	err := Novo(servidor.URL, nil, configTeste).Chamar(context.Background(), "Teste", nil)
+
+	var erro *Erro
+	if !errors.As(err, &erro) || erro.Mensagem != "a resposta do serviço ultrapassa o tamanho máximo" {
+		t.Fatalf("esperava o erro do tamanho máximo, recebeu %v", err)
+	}
+}
+
+func TestNovoDefaults(t *testing.T) {
+	cliente := Novo("http://0.0.0.0:8001/", nil, Config{Tentativas: 5})
+	esperada := ConfigDefault()
+	esperada.Tentativas = 5
+	if cliente.config != esperada || cliente.URL() != "http://0.0.0.0:8001" || cliente.http != http.DefaultClient {
+		t.Fatalf("cliente com defaults inesperados: %+v", cliente)
+	}
+}
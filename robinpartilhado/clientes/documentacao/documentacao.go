@@ -0,0 +1,132 @@
+package documentacao
+
+import (
+	"context"
+
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/clientes"
+)
+
+// Repositorio Repo da documentação, com os ficheiros que contêm
+type Repositorio struct {
+	Nome           string           `json:"nome,omitempty"`
+	Tema           string           `json:"tema,omitempty"`
+	Autor          string           `json:"autor,omitempty"`
+	Contribuidores []string         `json:"contribuidores,omitempty"`
+	Ficheiros      []FicheiroNoRepo `json:"ficheiros,omitempty"`
+	Criacao        string           `json:"criacao,omitempty"`
+}
+
+// FicheiroNoRepo Ficheiro listado no repo
+type FicheiroNoRepo struct {
+	Nome string   `json:"nome,omitempty"`
+	Hash string   `json:"hash,omitempty"`
+	Path []string `json:"path,omitempty"`
+}
+
+// Ficheiro Meta data de um ficheiro, nas pesquisas só os campos definidos são comparados.
+// O Path começa no nome do repo e acaba no nome do ficheiro, ex: ["manuais", "motores", "limpeza.md"]
+type Ficheiro struct {
+	Nome     string   `json:"nome,omitempty"`
+	Autor    string   `json:"autor,omitempty"`
+	Criacao  string   `json:"criacao,omitempty"`
+	RepoNome string   `json:"reponome,omitempty"`
+	Hash     string   `json:"hash,omitempty"`
+	Path     []string `json:"path,omitempty"`
+}
+
+// Conteudo Conteúdo de um ficheiro, com a sha256 do conteúdo em hexadecimal
+type Conteudo struct {
+	Nome     string   `json:"nome,omitempty"`
+	Conteudo string   `json:"conteudo,omitempty"`
+	Hash     string   `json:"hash,omitempty"`
+	Path     []string `json:"path,omitempty"`
+}
+
+// Cliente Cliente das actions do serviço de documentação
+type Cliente struct {
+	*clientes.Cliente
+}
+
+// Novo Cria o cliente do serviço de documentação (ver clientes.Novo)
+func Novo(cliente *clientes.Cliente) *Cliente {
+	return &Cliente{cliente}
+}
+
+// CriarRepositorio Cria o repo, o nome, o tema e o autor são obrigatórios
+func (cliente *Cliente) CriarRepositorio(ctx context.Context, repo Repositorio, token string) error {
+	return cliente.Chamar(ctx, "CriarRepositorio", nil, repo, token)
+}
+
+// BuscarRepositorio Repo com o nome dado
+func (cliente *Cliente) BuscarRepositorio(ctx context.Context, nome string, token string) (Repositorio, error) {
+	var resposta struct {
+		Repo Repositorio `json:"repo"`
+	}
+	err := cliente.Chamar(ctx, "BuscarRepositorio", &resposta, Repositorio{Nome: nome}, token)
+	return resposta.Repo, err
+}
+
+// DropRepositorio Apaga o repo e os seus ficheiros, só o autor ou um admin
+func (cliente *Cliente) DropRepositorio(ctx context.Context, nome string, token string) error {
+	return cliente.Chamar(ctx, "DropRepositorio", nil, Repositorio{Nome: nome}, token)
+}
+
+// BuscarUserRepos Repos de que o user é autor
+func (cliente *Cliente) BuscarUserRepos(ctx context.Context, user string, token string) ([]Repositorio, error) {
+	var resposta struct {
+		Repos []Repositorio `json:"repos"`
+	}
+	err := cliente.Chamar(ctx, "BuscarUserRepos", &resposta, user, token)
+	return resposta.Repos, err
+}
+
+// BuscarTodosOsReposNotTokenUsr Todos os repos que não são do user da token
+func (cliente *Cliente) BuscarTodosOsReposNotTokenUsr(ctx context.Context, token string) ([]Repositorio, error) {
+	var resposta struct {
+		Repos []Repositorio `json:"repos"`
+	}
+	err := cliente.Chamar(ctx, "BuscarTodosOsReposNotTokenUsr", &resposta, token)
+	return resposta.Repos, err
+}
+
+// CriarFicheiroMetaData Cria a meta data e o ficheiro vazio no repo, antes de enviar o conteúdo (ver InserirConteudoFicheiro)
+func (cliente *Cliente) CriarFicheiroMetaData(ctx context.Context, ficheiro Ficheiro, token string) error {
+	return cliente.Chamar(ctx, "CriarFicheiroMetaData", nil, ficheiro, token)
+}
+
+// BuscarMetaData Meta data do ficheiro que cumpre os campos definidos
+func (cliente *Cliente) BuscarMetaData(ctx context.Context, ficheiro Ficheiro, token string) (Ficheiro, error) {
+	var resposta struct {
+		MetaData Ficheiro `json:"meta_data"`
+	}
+	err := cliente.Chamar(ctx, "BuscarMetaData", &resposta, ficheiro, token)
+	return resposta.MetaData, err
+}
+
+// ApagarFicheiroMetaData Apaga o ficheiro e a sua meta data, só o autor ou um admin
+func (cliente *Cliente) ApagarFicheiroMetaData(ctx context.Context, ficheiro Ficheiro, token string) error {
+	return cliente.Chamar(ctx, "ApagarFicheiroMetaData", nil, ficheiro, token)
+}
+
+// InserirConteudoFicheiro Escreve o conteúdo no ficheiro, a hash têm de corresponder ao conteúdo
+func (cliente *Cliente) InserirConteudoFicheiro(ctx context.Context, conteudo Conteudo, token string) error {
+	return cliente.Chamar(ctx, "InserirConteudoFicheiro", nil, conteudo, token)
+}
+
+// BuscarConteudoFicheiro Conteúdo do ficheiro
+func (cliente *Cliente) BuscarConteudoFicheiro(ctx context.Context, ficheiro Ficheiro, token string) (Conteudo, error) {
+	var resposta struct {
+		Conteudo Conteudo `json:"conteudo"`
+	}
+	err := cliente.Chamar(ctx, "BuscarConteudoFicheiro", &resposta, ficheiro, token)
+	return resposta.Conteudo, err
+}
+
+// VerificarFicheiroExiste Indica se o ficheiro existe no repo
+func (cliente *Cliente) VerificarFicheiroExiste(ctx context.Context, ficheiro Ficheiro, token string) (bool, error) {
+	var resposta struct {
+		Existe bool `json:"existe"`
+	}
+	err := cliente.Chamar(ctx, "VerificarFicheiroExiste", &resposta, ficheiro, token)
+	return resposta.Existe, err
+}
@@ -0,0 +1,89 @@
+package equipamento
+
+import (
+	"context"
+
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/clientes"
+)
+
+// Meta Meta de um registo de equipamento, o tipo é a coleção onde o registo fica
+type Meta struct {
+	Tipo       string  `json:"tipo,omitempty"`
+	Estado     string  `json:"estado,omitempty"`
+	Quantidade float64 `json:"quantidade,omitempty"`
+}
+
+// Query Pesquisa nos registos de uma coleção: os campos que os registos têm de ter,
+// e os caminhos dos valores a extrair de cada registo, ex: [["body", "marca"]]
+type Query struct {
+	Campos  map[string]interface{} `json:"campos,omitempty"`
+	Extrair [][]interface{}        `json:"extrair,omitempty"`
+}
+
+// Atualizacoes Número de registos encontrados e alterados numa atualização
+type Atualizacoes struct {
+	Encontrados int64 `json:"MatchedCount"`
+	Alterados   int64 `json:"ModifiedCount"`
+}
+
+// Cliente Cliente das actions do serviço de gestão de equipamento
+type Cliente struct {
+	*clientes.Cliente
+}
+
+// Novo Cria o cliente do serviço de gestão de equipamento (ver clientes.Novo)
+func Novo(cliente *clientes.Cliente) *Cliente {
+	return &Cliente{cliente}
+}
+
+// AdicionarRegisto Adiciona o item à coleção do tipo da meta
+func (cliente *Cliente) AdicionarRegisto(ctx context.Context, meta Meta, item map[string]interface{}, token string) error {
+	return cliente.Chamar(ctx, "AdicionarRegisto", nil, meta, item, token)
+}
+
+// BuscarTodosRegistosBD Todos os registos, pelo nome da coleção
+func (cliente *Cliente) BuscarTodosRegistosBD(ctx context.Context, token string) (map[string][]map[string]interface{}, error) {
+	var resposta struct {
+		Registos map[string][]map[string]interface{} `json:"registos"`
+	}
+	err := cliente.Chamar(ctx, "BuscarTodosRegistosBD", &resposta, token)
+	return resposta.Registos, err
+}
+
+// BuscarTodosOsRegistosColecao Todos os registos da coleção
+func (cliente *Cliente) BuscarTodosOsRegistosColecao(ctx context.Context, colecao string, token string) ([]map[string]interface{}, error) {
+	var resposta struct {
+		Registos []map[string]interface{} `json:"registos"`
+	}
+	err := cliente.Chamar(ctx, "BuscarTodosOsRegistosColecao", &resposta, colecao, token)
+	return resposta.Registos, err
+}
+
+// QueryRegistoJSON Valores extraidos dos registos da coleção que cumprem o query
+func (cliente *Cliente) QueryRegistoJSON(ctx context.Context, query Query, colecao string, token string) (interface{}, error) {
+	var resposta struct {
+		Registos map[string]interface{} `json:"registos"`
+	}
+	err := cliente.Chamar(ctx, "QueryRegistoJSON", &resposta, query, colecao, token)
+	return resposta.Registos[colecao], err
+}
+
+// AtualizarRegistoDeItem Altera os campos do registo com o id dado (ObjectID em hexadecimal)
+func (cliente *Cliente) AtualizarRegistoDeItem(ctx context.Context, colecao string, id string, campos map[string]interface{}, token string) (Atualizacoes, error) {
+	var resposta struct {
+		Atualizacoes Atualizacoes `json:"atualizacoes"`
+	}
+	err := cliente.Chamar(ctx, "AtualizarRegistoDeItem", &resposta, colecao, id, campos, token)
+	return resposta.Atualizacoes, err
+}
+
+// ApagarRegistoDeItem Apaga o registo com o id dado, devolve false se o registo não existia
+func (cliente *Cliente) ApagarRegistoDeItem(ctx context.Context, colecao string, id string, token string) (bool, error) {
+	var resposta struct {
+		Apagado struct {
+			Apagados int64 `json:"DeletedCount"`
+		} `json:"registo_apagado"`
+	}
+	err := cliente.Chamar(ctx, "ApagarRegistoDeItem", &resposta, colecao, id, token)
+	return resposta.Apagado.Apagados > 0, err
+}
@@ -0,0 +1,89 @@
+package clientes
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/acoes"
+)
+
+// Erro Erro de uma chamada a uma action: o erro devolvido pela action, o estado de erro do serviço,
+// ou a falha da ligação (em Causa)
+type Erro struct {
+	Acao     string
+	Estado   int    // Estado http da resposta, 0 se o serviço não respondeu
+	Mensagem string // Erro devolvido pela action, ou a descrição da falha
+	Causa    error  // Erro da ligação ou da leitura da resposta, nil se o serviço respondeu
+	// Retorno Retorno completo da action, com os outros campos do erro (ex: tentar_depois no Login), nil se a action não respondeu
+	Retorno map[string]json.RawMessage
+}
+
+// Error Mensagem do erro com o nome da action, ex: "AdicionarContrbRepo: Erro ao criar repo nas contribuições do user"
+func (erro *Erro) Error() string {
+	if erro.Causa != nil {
+		return erro.Acao + ": " + erro.Mensagem + ": " + erro.Causa.Error()
+	}
+	return erro.Acao + ": " + erro.Mensagem
+}
+
+// Unwrap Erro da ligação, para o errors.Is (ex: context.DeadlineExceeded)
+func (erro *Erro) Unwrap() error {
+	return erro.Causa
+}
+
+// Estado Estado http da resposta do erro de uma chamada, 0 se o erro não veio de uma resposta do serviço
+// (ex: 401 se a token não foi aceite, 403 sem permissões, ver acoes.Estado)
+func Estado(err error) int {
+	var erro *Erro
+	if !errors.As(err, &erro) {
+		return 0
+	}
+	return erro.Estado
+}
+
+// lerResposta Procura o erro no retorno da action, ou converte o retorno em resposta se não houver erro
+func lerResposta(acao string, estado int, corpo []byte, resposta interface{}) error {
+	var retorno map[string]json.RawMessage
+	if err := json.Unmarshal(corpo, &retorno); err != nil {
+		if estado != http.StatusOK {
+			return &Erro{Acao: acao, Estado: estado, Mensagem: http.StatusText(estado)}
+		}
+		return &Erro{Acao: acao, Estado: estado, Mensagem: "resposta inválida do serviço", Causa: err}
+	}
+
+	for chave, valor := range retorno {
+		if mensagem, existe := mensagemErro(chave, valor); existe {
+			return &Erro{Acao: acao, Estado: estado, Mensagem: mensagem, Retorno: retorno}
+		}
+	}
+	if estado != http.StatusOK {
+		return &Erro{Acao: acao, Estado: estado, Mensagem: http.StatusText(estado), Retorno: retorno}
+	}
+
+	if resposta == nil {
+		return nil
+	}
+	if err := json.Unmarshal(corpo, resposta); err != nil {
+		return &Erro{Acao: acao, Estado: estado, Mensagem: "retorno da action com um formato inesperado", Causa: err}
+	}
+	return nil
+}
+
+// mensagemErro Mensagem do erro guardado na key do retorno, se a key for de um erro (ver acoes.ChavesErro) com um valor definido.
+// Os erros que não são texto ficam com o seu JSON
+func mensagemErro(chave string, valor json.RawMessage) (string, bool) {
+	if !acoes.ChaveErro(chave) {
+		return "", false
+	}
+	switch texto := string(bytes.TrimSpace(valor)); texto {
+	case "", "null", `""`, "false":
+		return "", false
+	}
+	var mensagem string
+	if err := json.Unmarshal(valor, &mensagem); err != nil {
+		return string(valor), true
+	}
+	return mensagem, true
+}
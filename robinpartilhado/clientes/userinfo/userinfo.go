@@ -0,0 +1,110 @@
+package userinfo
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/clientes"
+)
+
+// Operações das contribuições de ficheiros (ver ModificarContribuicoes)
+const (
+	OperacaoAdicionar = "add"
+	OperacaoRemover   = "rmv"
+)
+
+// Utilizador Informação de um user guardada no serviço userinfo
+type Utilizador struct {
+	Nome           string          `json:"nome"`
+	User           string          `json:"user"`
+	Status         string          `json:"status"`
+	Email          string          `json:"email"`
+	StatusMss      string          `json:"statusmss"`
+	Contribuicoes  []Contribuicoes `json:"contribuicoes"`
+	Especialidades []string        `json:"especialidades"`
+}
+
+// Contribuicoes Ficheiros de um repo em que o user contribuiu
+type Contribuicoes struct {
+	RepoNome  string   `json:"reponome,omitempty"`
+	Ficheiros []string `json:"ficheiros,omitempty"`
+}
+
+// Contribuicao Identifica o repo, e o ficheiro nas operações dos ficheiros, nas contribuições de um user
+type Contribuicao struct {
+	User string `json:"user"`
+	Repo string `json:"repo"`
+	File string `json:"file,omitempty"`
+}
+
+// Cliente Cliente das actions do serviço userinfo
+type Cliente struct {
+	*clientes.Cliente
+}
+
+// Novo Cria o cliente do serviço userinfo (ver clientes.Novo)
+func Novo(cliente *clientes.Cliente) *Cliente {
+	return &Cliente{cliente}
+}
+
+// Ping Verifica se o serviço está online, devolve a mensagem do serviço
+func (cliente *Cliente) Ping(ctx context.Context, nome string) (string, error) {
+	var resposta struct {
+		Status string `json:"status"`
+	}
+	err := cliente.Chamar(ctx, "Ping", &resposta, nome)
+	return resposta.Status, err
+}
+
+// GetInfoUtilizador Informação do user
+func (cliente *Cliente) GetInfoUtilizador(ctx context.Context, user string, token string) (Utilizador, error) {
+	var resposta struct {
+		User Utilizador `json:"user"`
+	}
+	err := cliente.Chamar(ctx, "GetInfoUtilizador", &resposta, user, token)
+	return resposta.User, err
+}
+
+// CriarRegistoUser Cria o registo da informação do user, info têm de ter o campo user
+func (cliente *Cliente) CriarRegistoUser(ctx context.Context, info Utilizador, token string) error {
+	return cliente.Chamar(ctx, "CriarRegistoUser", nil, info, token)
+}
+
+// UpdateInfoUtilizador Atualiza os campos da informação do user, devolve o número de registos alterados
+// (0 se os campos já tinham os valores pedidos)
+func (cliente *Cliente) UpdateInfoUtilizador(ctx context.Context, user string, campos map[string]interface{}, token string) (int64, error) {
+	var resposta struct {
+		Alterados json.RawMessage `json:"num_campos_updt"`
+	}
+	if err := cliente.Chamar(ctx, "UpdateInfoUtilizador", &resposta, user, campos, token); err != nil {
+		return 0, err
+	}
+	// Sem alterações o serviço devolve uma mensagem em vez do número
+	var alterados int64
+	json.Unmarshal(resposta.Alterados, &alterados)
+	return alterados, nil
+}
+
+// RenomearUtilizador Muda o nome do user, devolve false se o user não tinha informação registada
+func (cliente *Cliente) RenomearUtilizador(ctx context.Context, user string, novoNome string, token string) (bool, error) {
+	var resposta struct {
+		Renomeado bool `json:"renomeado"`
+	}
+	err := cliente.Chamar(ctx, "RenomearUtilizador", &resposta, user, novoNome, token)
+	return resposta.Renomeado, err
+}
+
+// AdicionarContrbRepo Adiciona o repo às contribuições do user
+func (cliente *Cliente) AdicionarContrbRepo(ctx context.Context, user string, repo string, token string) error {
+	return cliente.Chamar(ctx, "AdicionarContrbRepo", nil, user, repo, token)
+}
+
+// RemoverRepoContributo Remove o repo das contribuições do user, contribuicao sem o ficheiro
+func (cliente *Cliente) RemoverRepoContributo(ctx context.Context, contribuicao Contribuicao, token string) error {
+	return cliente.Chamar(ctx, "RemoverRepoContributo", nil, contribuicao, token)
+}
+
+// ModificarContribuicoes Adiciona (OperacaoAdicionar) ou remove (OperacaoRemover) o ficheiro das contribuições do user no repo
+func (cliente *Cliente) ModificarContribuicoes(ctx context.Context, operacao string, contribuicao Contribuicao, token string) error {
+	return cliente.Chamar(ctx, "ModificarContribuicoes", nil, operacao, contribuicao, token)
+}
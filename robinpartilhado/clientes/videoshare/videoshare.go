@@ -0,0 +1,46 @@
+package videoshare
+
+import (
+	"context"
+
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/clientes"
+)
+
+// Video Video partilhado
+type Video struct {
+	URL       string `json:"url,omitempty"`
+	Tema      string `json:"tema,omitempty"`
+	Titulo    string `json:"titulo,omitempty"`
+	Criador   string `json:"criador,omitempty"`
+	Descricao string `json:"descricao,omitempty"`
+}
+
+// Pesquisa Campos dos videos a procurar (iguais, não parciais), e o número máximo de resultados
+type Pesquisa struct {
+	Params map[string]interface{} `json:"params,omitempty"`
+	Quanti int                    `json:"quanti,omitempty"`
+}
+
+// Cliente Cliente das actions do serviço de video-sharing
+type Cliente struct {
+	*clientes.Cliente
+}
+
+// Novo Cria o cliente do serviço de video-sharing (ver clientes.Novo)
+func Novo(cliente *clientes.Cliente) *Cliente {
+	return &Cliente{cliente}
+}
+
+// CriarVideoShare Partilha o video, o criador têm de ser o user da token
+func (cliente *Cliente) CriarVideoShare(ctx context.Context, video Video, token string) error {
+	return cliente.Chamar(ctx, "CriarVideoShare", nil, video, token)
+}
+
+// GetVideoShares Videos que cumprem a pesquisa
+func (cliente *Cliente) GetVideoShares(ctx context.Context, pesquisa Pesquisa, token string) ([]Video, error) {
+	var resposta struct {
+		Shares []Video `json:"shares"`
+	}
+	err := cliente.Chamar(ctx, "GetVideoShares", &resposta, pesquisa, token)
+	return resposta.Shares, err
+}
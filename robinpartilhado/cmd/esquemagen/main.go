@@ -0,0 +1,365 @@
+/*
+esquemagen Gera as descrições das actions de um serviço (esquema.Descricao) a partir do código fonte:
+procura as actions registadas com Registar("Nome", funcao, politica) nos ficheiros do pacote, e tira da função de cada action
+o comentário, os nomes dos parametros (sem o contexto) e as keys atribuídas ao retorno, ex: retorno["user"] = ...
+Os tipos e a autorização vêm das próprias actions quando o serviço arranca (ver esquema.Novo). Usado com o go generate:
+---
+
+	//go:generate go run github.com/tomascpmarques/PAP/backend/robinpartilhado/cmd/esquemagen
+
+Escreve o ficheiro esquemagerado.go, com a variável descricoesAcoes, no pacote onde é executado
+*/
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/acoes"
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/esquema"
+)
+
+// cabecalho início do ficheiro gerado, reconhecido pelas ferramentas de go como código gerado
+const cabecalho = "// Code generated by esquemagen a partir das actions registadas. DO NOT EDIT.\n\n"
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("esquemagen: ")
+	saida := flag.String("o", "esquemagerado.go", "ficheiro gerado, no diretório do pacote")
+	variavel := flag.String("var", "descricoesAcoes", "nome da variável com as descrições")
+	flag.Parse()
+
+	fset := token.NewFileSet()
+	pacote, registos, err := lerRegistos(fset, ".", *saida)
+	if err != nil {
+		log.Fatal(err)
+	}
+	funcoes, err := lerFuncoes(fset, ".", *saida)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	descricoes := make(map[string]esquema.Descricao, len(registos))
+	for acao, funcao := range registos {
+		declaracoes := candidatas(funcoes[funcao])
+		if len(declaracoes) == 0 {
+			log.Fatalf("a função %s da action %s não foi encontrada", funcao, acao)
+		}
+		if len(declaracoes) > 1 {
+			log.Printf("aviso: há %d funções %s, a action %s usa a de %s", len(declaracoes), funcao, acao, fset.Position(declaracoes[0].Pos()))
+		}
+		descricoes[acao] = descrever(declaracoes[0], funcoes)
+	}
+
+	codigo, err := gerar(pacote, *variavel, descricoes)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Os ficheiros de alguns serviços usam CRLF, o ficheiro gerado segue o resto do pacote
+	if exemplo, err := os.ReadFile("app.go"); err == nil && bytes.Contains(exemplo, []byte("\r\n")) {
+		codigo = bytes.ReplaceAll(codigo, []byte("\n"), []byte("\r\n"))
+	}
+	if err := os.WriteFile(*saida, codigo, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// lerRegistos Nome do pacote e as actions registadas nos ficheiros do diretório, pelo nome da função de cada action
+func lerRegistos(fset *token.FileSet, diretorio string, ignorar string) (string, map[string]string, error) {
+	pacotes, err := parser.ParseDir(fset, diretorio, filtro(ignorar), 0)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(pacotes) != 1 {
+		return "", nil, fmt.Errorf("o diretório %s têm de ter um só pacote, têm %d", diretorio, len(pacotes))
+	}
+
+	registos := make(map[string]string)
+	var nomePacote string
+	for nome, pacote := range pacotes {
+		nomePacote = nome
+		for _, ficheiro := range pacote.Files {
+			ast.Inspect(ficheiro, func(no ast.Node) bool {
+				chamada, ok := no.(*ast.CallExpr)
+				if !ok || len(chamada.Args) != 3 {
+					return true
+				}
+				if seletor, ok := chamada.Fun.(*ast.SelectorExpr); !ok || seletor.Sel.Name != "Registar" {
+					return true
+				}
+				literal, ok := chamada.Args[0].(*ast.BasicLit)
+				if !ok || literal.Kind != token.STRING {
+					return true
+				}
+				acao, _ := strconv.Unquote(literal.Value)
+				switch funcao := chamada.Args[1].(type) {
+				case *ast.SelectorExpr:
+					registos[acao] = funcao.Sel.Name
+				case *ast.Ident:
+					registos[acao] = funcao.Name
+				}
+				return true
+			})
+		}
+	}
+	if len(registos) == 0 {
+		return "", nil, fmt.Errorf("nenhuma action registada em %s", diretorio)
+	}
+	return nomePacote, registos, nil
+}
+
+// lerFuncoes Declarações das funções e métodos do módulo, a partir do diretório, pelo nome
+func lerFuncoes(fset *token.FileSet, diretorio string, ignorar string) (map[string][]*ast.FuncDecl, error) {
+	funcoes := make(map[string][]*ast.FuncDecl)
+	err := filepath.Walk(diretorio, func(caminho string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return err
+		}
+		if nome := info.Name(); caminho != diretorio && (strings.HasPrefix(nome, ".") || nome == "vendor" || nome == "testdata") {
+			return filepath.SkipDir
+		}
+		pacotes, err := parser.ParseDir(fset, caminho, filtro(ignorar), parser.ParseComments)
+		if err != nil {
+			return err
+		}
+		for _, pacote := range pacotes {
+			for _, ficheiro := range pacote.Files {
+				for _, declaracao := range ficheiro.Decls {
+					if funcao, ok := declaracao.(*ast.FuncDecl); ok && funcao.Body != nil {
+						funcoes[funcao.Name.Name] = append(funcoes[funcao.Name.Name], funcao)
+					}
+				}
+			}
+		}
+		return nil
+	})
+	// Os ficheiros são lidos por ordem, mas os pacotes não, a escolha entre funções com o mesmo nome não muda entre execuções
+	for _, declaracoes := range funcoes {
+		sort.Slice(declaracoes, func(i, j int) bool {
+			return fset.Position(declaracoes[i].Pos()).String() < fset.Position(declaracoes[j].Pos()).String()
+		})
+	}
+	return funcoes, err
+}
+
+// candidatas Funções que podem ser actions, as que só devolvem map[string]interface{},
+// ou todas se nenhuma o fizer (as actions publicas não são verificadas pelo autorizacao.Proteger)
+func candidatas(declaracoes []*ast.FuncDecl) []*ast.FuncDecl {
+	resultado := make([]*ast.FuncDecl, 0, len(declaracoes))
+	for _, declaracao := range declaracoes {
+		resultados := declaracao.Type.Results
+		if resultados == nil || resultados.NumFields() != 1 {
+			continue
+		}
+		if tipo, ok := resultados.List[0].Type.(*ast.MapType); ok && nomeTipo(tipo.Key) == "string" && nomeTipo(tipo.Value) == "interface{}" {
+			resultado = append(resultado, declaracao)
+		}
+	}
+	if len(resultado) == 0 {
+		return declaracoes
+	}
+	return resultado
+}
+
+// nomeTipo Nome dos tipos simples usados no retorno das actions
+func nomeTipo(tipo ast.Expr) string {
+	switch tipo := tipo.(type) {
+	case *ast.Ident:
+		return tipo.Name
+	case *ast.InterfaceType:
+		if len(tipo.Methods.List) == 0 {
+			return "interface{}"
+		}
+	}
+	return ""
+}
+
+// filtro Ignora os testes e o ficheiro gerado, que pode estar desatualizado
+func filtro(ignorar string) func(os.FileInfo) bool {
+	return func(info os.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go") && info.Name() != ignorar
+	}
+}
+
+// descrever Descrição da action a partir da sua função, as funções do módulo são usadas
+// para as keys do retorno das actions que o recebem de outra função
+func descrever(funcao *ast.FuncDecl, funcoes map[string][]*ast.FuncDecl) esquema.Descricao {
+	keys := make([]string, 0)
+	respostas(funcao, funcoes, map[*ast.FuncDecl]bool{}, &keys)
+	return esquema.Descricao{
+		Descricao: comentario(funcao),
+		Params:    parametros(funcao),
+		Respostas: keys,
+	}
+}
+
+// comentario Primeiro parágrafo do comentário da função numa só linha, sem o nome da função no início
+func comentario(funcao *ast.FuncDecl) string {
+	texto := strings.TrimSpace(funcao.Doc.Text())
+	if fim := strings.Index(texto, "\n\n"); fim >= 0 {
+		texto = texto[:fim]
+	}
+	texto = strings.Join(strings.Fields(texto), " ")
+	return strings.TrimLeft(strings.TrimPrefix(texto, funcao.Name.Name), " ,:-")
+}
+
+// parametros Nomes dos parametros da função, sem o contexto do pedido
+func parametros(funcao *ast.FuncDecl) []string {
+	nomes := make([]string, 0)
+	for _, campo := range funcao.Type.Params.List {
+		if seletor, ok := campo.Type.(*ast.SelectorExpr); ok && seletor.Sel.Name == "Context" {
+			if pacote, ok := seletor.X.(*ast.Ident); ok && pacote.Name == "context" {
+				continue
+			}
+		}
+		if len(campo.Names) == 0 {
+			nomes = append(nomes, fmt.Sprintf("param%d", len(nomes)+1))
+		}
+		for _, nome := range campo.Names {
+			nomes = append(nomes, nome.Name)
+		}
+	}
+	return nomes
+}
+
+// respostas Acrescenta às keys as keys atribuídas ao retorno da função, pela ordem em que aparecem, sem as keys de erro
+// (ver acoes.ChavesErro). O retorno é o resultado com nome da função, ou as variáveis devolvidas nos returns.
+// Quando o retorno é o resultado de outra função do módulo, as keys dessa função também são acrescentadas
+func respostas(funcao *ast.FuncDecl, funcoes map[string][]*ast.FuncDecl, visitadas map[*ast.FuncDecl]bool, keys *[]string) {
+	if visitadas[funcao] || funcao.Body == nil {
+		return
+	}
+	visitadas[funcao] = true
+
+	retornos := make(map[string]bool)
+	if resultados := funcao.Type.Results; resultados != nil {
+		for _, campo := range resultados.List {
+			for _, nome := range campo.Names {
+				retornos[nome.Name] = true
+			}
+		}
+	}
+
+	adicionar := func(expressao ast.Expr) {
+		literal, ok := expressao.(*ast.BasicLit)
+		if !ok || literal.Kind != token.STRING {
+			return
+		}
+		key, _ := strconv.Unquote(literal.Value)
+		if acoes.ChaveErro(key) {
+			return
+		}
+		for _, existente := range *keys {
+			if existente == key {
+				return
+			}
+		}
+		*keys = append(*keys, key)
+	}
+	// valor Keys de um valor dado ao retorno: um map literal, ou a chamada a outra função
+	valor := func(expressao ast.Expr) {
+		switch expressao := expressao.(type) {
+		case *ast.CompositeLit:
+			for _, elemento := range expressao.Elts {
+				if par, ok := elemento.(*ast.KeyValueExpr); ok {
+					adicionar(par.Key)
+				}
+			}
+		case *ast.CallExpr:
+			var nome string
+			switch chamada := expressao.Fun.(type) {
+			case *ast.SelectorExpr:
+				nome = chamada.Sel.Name
+			case *ast.Ident:
+				nome = chamada.Name
+			}
+			if declaracoes := candidatas(funcoes[nome]); len(declaracoes) == 1 {
+				respostas(declaracoes[0], funcoes, visitadas, keys)
+			}
+		}
+	}
+
+	// As variáveis devolvidas primeiro, as atribuições podem aparecer antes do return
+	ast.Inspect(funcao.Body, func(no ast.Node) bool {
+		if _, ok := no.(*ast.FuncLit); ok {
+			return false
+		}
+		if retorno, ok := no.(*ast.ReturnStmt); ok && len(retorno.Results) == 1 {
+			if variavel, ok := retorno.Results[0].(*ast.Ident); ok {
+				retornos[variavel.Name] = true
+			}
+		}
+		return true
+	})
+
+	ast.Inspect(funcao.Body, func(no ast.Node) bool {
+		switch no := no.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.AssignStmt:
+			for i, destino := range no.Lhs {
+				switch destino := destino.(type) {
+				case *ast.IndexExpr:
+					if variavel, ok := destino.X.(*ast.Ident); ok && retornos[variavel.Name] {
+						adicionar(destino.Index)
+					}
+				case *ast.Ident:
+					if retornos[destino.Name] && len(no.Lhs) == len(no.Rhs) {
+						valor(no.Rhs[i])
+					}
+				}
+			}
+		case *ast.ReturnStmt:
+			if len(no.Results) == 1 {
+				valor(no.Results[0])
+			}
+		}
+		return true
+	})
+}
+
+// gerar Código formatado do ficheiro gerado, com as actions por ordem alfabética
+func gerar(pacote string, variavel string, descricoes map[string]esquema.Descricao) ([]byte, error) {
+	nomes := make([]string, 0, len(descricoes))
+	for nome := range descricoes {
+		nomes = append(nomes, nome)
+	}
+	sort.Strings(nomes)
+
+	var codigo bytes.Buffer
+	codigo.WriteString(cabecalho)
+	fmt.Fprintf(&codigo, "package %s\n\n", pacote)
+	codigo.WriteString("import \"github.com/tomascpmarques/PAP/backend/robinpartilhado/esquema\"\n\n")
+	fmt.Fprintf(&codigo, "// %s Descrição, parametros e keys do retorno de cada action registada, tiradas do código fonte\n", variavel)
+	fmt.Fprintf(&codigo, "var %s = map[string]esquema.Descricao{\n", variavel)
+	for _, nome := range nomes {
+		descricao := descricoes[nome]
+		fmt.Fprintf(&codigo, "%q: {\n", nome)
+		fmt.Fprintf(&codigo, "Descricao: %q,\n", descricao.Descricao)
+		fmt.Fprintf(&codigo, "Params: %s,\n", listaStrings(descricao.Params))
+		fmt.Fprintf(&codigo, "Respostas: %s,\n", listaStrings(descricao.Respostas))
+		codigo.WriteString("},\n")
+	}
+	codigo.WriteString("}\n")
+	return format.Source(codigo.Bytes())
+}
+
+// listaStrings Literal de um []string com os valores
+func listaStrings(valores []string) string {
+	citados := make([]string, len(valores))
+	for i, valor := range valores {
+		citados[i] = strconv.Quote(valor)
+	}
+	return "[]string{" + strings.Join(citados, ", ") + "}"
+}
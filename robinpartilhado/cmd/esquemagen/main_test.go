@@ -0,0 +1,159 @@
+package main
+
+import (
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/esquema"
+)
+
+// servicoTeste Pacote de um serviço com duas actions registadas: um método com o retorno com nome,
+// e uma função que devolve o retorno de outra
+const servicoTeste = `package servico
+
+import "context"
+
+type despachante interface{ Registar(string, interface{}, interface{}) }
+
+type Servico struct{}
+
+func (s *Servico) registar(d despachante) {
+	d.Registar("Buscar", s.Buscar, nil)
+	d.Registar("Listar", Listar, nil)
+	d.Registar(nome, s.Buscar, nil)
+}
+
+var nome = "Ignorada"
+
+// Buscar Procura o repo pelo nome,
+// numa só linha.
+//
+// O segundo parágrafo não faz parte da descrição.
+func (s *Servico) Buscar(ctx context.Context, nome string, token string) (retorno map[string]interface{}) {
+	retorno = make(map[string]interface{})
+	if nome == "" {
+		retorno["erro"] = "nome vazio"
+		return
+	}
+	retorno["repo"] = nome
+	retorno["total"] = 1
+	func() {
+		retorno["interior"] = true
+	}()
+	return
+}
+
+// Listar: Lista os repos
+func Listar(filtro map[string]interface{}, token string) map[string]interface{} {
+	return listar(filtro)
+}
+
+func listar(filtro map[string]interface{}) map[string]interface{} {
+	resultado := map[string]interface{}{"itens": filtro, "err": nil}
+	resultado["pagina"] = 1
+	return resultado
+}
+`
+
+// pacoteTeste Escreve o serviço de teste numa pasta temporária, com um subpacote com outra função Buscar,
+// e um ficheiro gerado desatualizado que não compila
+func pacoteTeste(t *testing.T) string {
+	t.Helper()
+	diretorio := t.TempDir()
+	ficheiros := map[string]string{
+		"servico.go":       servicoTeste,
+		"servico_test.go":  "package servico\n\nfunc Buscar() map[string]interface{} { return nil }\n",
+		"esquemagerado.go": "package servico\n\nisto não compila\n",
+		"outro/outro.go":   "package outro\n\nfunc Buscar(nome string) error { return nil }\n",
+	}
+	for nome, conteudo := range ficheiros {
+		caminho := filepath.Join(diretorio, nome)
+		if err := os.MkdirAll(filepath.Dir(caminho), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(caminho, []byte(conteudo), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return diretorio
+}
+
+func TestDescricoes(t *testing.T) {
+	diretorio := pacoteTeste(t)
+	fset := token.NewFileSet()
+	pacote, registos, err := lerRegistos(fset, diretorio, "esquemagerado.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pacote != "servico" || !reflect.DeepEqual(registos, map[string]string{"Buscar": "Buscar", "Listar": "Listar"}) {
+		t.Fatalf("registos inesperados: %s %v", pacote, registos)
+	}
+	funcoes, err := lerFuncoes(fset, diretorio, "esquemagerado.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(funcoes["Buscar"]) != 2 {
+		t.Fatalf("esperava as funções Buscar do pacote e do subpacote, sem a dos testes: %d", len(funcoes["Buscar"]))
+	}
+
+	descricoes := make(map[string]esquema.Descricao)
+	for acao, funcao := range registos {
+		declaracoes := candidatas(funcoes[funcao])
+		if len(declaracoes) != 1 {
+			t.Fatalf("esperava uma só função candidata para %s, há %d", acao, len(declaracoes))
+		}
+		descricoes[acao] = descrever(declaracoes[0], funcoes)
+	}
+
+	esperadas := map[string]esquema.Descricao{
+		"Buscar": {
+			Descricao: "Procura o repo pelo nome, numa só linha.",
+			Params:    []string{"nome", "token"},
+			Respostas: []string{"repo", "total"},
+		},
+		"Listar": {
+			Descricao: "Lista os repos",
+			Params:    []string{"filtro", "token"},
+			Respostas: []string{"itens", "pagina"},
+		},
+	}
+	if !reflect.DeepEqual(descricoes, esperadas) {
+		t.Fatalf("descrições inesperadas:\n%+v\nesperava:\n%+v", descricoes, esperadas)
+	}
+}
+
+func TestGerar(t *testing.T) {
+	codigo, err := gerar("servico", "descricoesAcoes", map[string]esquema.Descricao{
+		"Listar": {Descricao: "Lista os repos \"todos\"", Params: []string{"filtro"}, Respostas: []string{}},
+		"Buscar": {Descricao: "Procura o repo", Params: []string{"nome", "token"}, Respostas: []string{"repo"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	texto := string(codigo)
+	if !strings.HasPrefix(texto, cabecalho+"package servico\n") {
+		t.Fatalf("cabeçalho inesperado:\n%s", texto)
+	}
+	if strings.Index(texto, `"Buscar": {`) > strings.Index(texto, `"Listar": {`) {
+		t.Fatal("as actions não estão por ordem alfabética")
+	}
+	partes := []string{
+		"var descricoesAcoes = map[string]esquema.Descricao{\n",
+		"\t\tParams:    []string{\"nome\", \"token\"},\n",
+		"\t\tDescricao: \"Lista os repos \\\"todos\\\"\",\n",
+		"\t\tRespostas: []string{},\n",
+	}
+	for _, parte := range partes {
+		if !strings.Contains(texto, parte) {
+			t.Errorf("o código gerado não contêm %q:\n%s", parte, texto)
+		}
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "esquemagerado.go", codigo, 0); err != nil {
+		t.Fatalf("código gerado inválido: %v", err)
+	}
+}
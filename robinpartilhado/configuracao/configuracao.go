@@ -0,0 +1,321 @@
+package configuracao
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// tagInline tag dos campos cuja struct não é uma secção, os seus campos pertencem à secção onde estão
+const tagInline = ",inline"
+
+// Validador Secção da configuração que verifica os próprios valores, chamado depois de todas as camadas serem aplicadas
+type Validador interface {
+	Validar() error
+}
+
+// Opcoes Opções do carregamento da configuração de um serviço
+type Opcoes struct {
+	// Prefixo das variáveis de ambiente do serviço, ex: "AUTH" lê servidor.porta de AUTH_SERVIDOR_PORTA
+	Prefixo string
+	// Args argumentos da linha de comandos, os.Args[1:] se for nil
+	Args []string
+	// Variaveis nomes antigos das variáveis de ambiente de cada campo, ex: {"servidor.porta": "LOGIN_SERV_PORT"},
+	// só usados se a variável com o prefixo não estiver definida
+	Variaveis map[string]string
+}
+
+// campo Valor final (folha) da configuração, com os nomes usados em cada camada
+type campo struct {
+	caminho   string        // Nome no ficheiro e na flag, ex: "servidor.porta"
+	valor     reflect.Value // Campo da struct a preencher
+	variaveis []string      // Variáveis de ambiente, a primeira definida é usada
+	flags     []string      // Flags da linha de comandos
+	descricao string        // Texto de ajuda das flags
+}
+
+// valorFlag Guarda o texto das flags passadas, aplicado só depois do ficheiro e das variáveis de ambiente
+type valorFlag struct {
+	texto    string
+	omissao  string
+	booleano bool
+	campo    *campo
+}
+
+func (v *valorFlag) String() string {
+	if v == nil {
+		return ""
+	}
+	return v.omissao
+}
+
+func (v *valorFlag) Set(texto string) error {
+	v.texto = texto
+	return nil
+}
+
+func (v *valorFlag) IsBoolFlag() bool { return v.booleano }
+
+/*
+Carregar Preenche a configuração de um serviço, as camadas são aplicadas por esta ordem (a última ganha):
+---
+	1. os valores já presentes em config, que são os defaults do serviço
+	2. o ficheiro YAML (.yaml/.yml) ou TOML (.toml) indicado na flag -config ou na variável <PREFIXO>_CONFIG
+	3. as variáveis de ambiente <PREFIXO>_<SECCAO>_<CAMPO>, ex: AUTH_SERVIDOR_PORTA
+	4. as flags -<seccao>.<campo>, ex: -servidor.porta=8081
+
+No fim, as secções que implementam Validador são validadas.
+Os campos são definidos pela tag `conf:"nome"` (o nome do campo em minúsculas se não tiver tag),
+com nomes alternativos nas tags `env:"VAR1,VAR2"` e `flag:"nome"`, e o texto de ajuda na tag `desc`.
+Os campos com a tag `conf:",inline"` juntam os campos da sua struct à secção onde estão.
+---
+Params:
+	config - ponteiro para a struct da configuração, já com os valores default
+	opcoes - Opcoes prefixo das variáveis de ambiente e argumentos
+*/
+func Carregar(config interface{}, opcoes Opcoes) error {
+	raiz := reflect.ValueOf(config)
+	if raiz.Kind() != reflect.Ptr || raiz.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("configuração têm de ser um ponteiro para uma struct, recebido %T", config)
+	}
+
+	campos := make([]*campo, 0)
+	seccoes := make(map[string]bool)
+	if err := recolherCampos(raiz.Elem(), nil, opcoes.Prefixo, &campos, seccoes); err != nil {
+		return err
+	}
+	for _, c := range campos {
+		if antiga, existe := opcoes.Variaveis[c.caminho]; existe {
+			c.variaveis = append(c.variaveis, antiga)
+		}
+	}
+
+	// As flags são lidas primeiro para saber o ficheiro, mas só são aplicadas no fim
+	args := opcoes.Args
+	if args == nil {
+		args = os.Args[1:]
+	}
+	flags := flag.NewFlagSet(filepath.Base(os.Args[0]), flag.ExitOnError)
+	ficheiro := flags.String("config", "", "ficheiro de configuração, YAML ou TOML (ou a variável "+nomeVariavel(opcoes.Prefixo, "config")+")")
+	valoresFlags := make(map[string]*valorFlag)
+	for _, c := range campos {
+		for _, nome := range c.flags {
+			valor := &valorFlag{omissao: textoValor(c.valor), booleano: c.valor.Kind() == reflect.Bool, campo: c}
+			valoresFlags[nome] = valor
+			flags.Var(valor, nome, c.descricao)
+		}
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *ficheiro == "" {
+		*ficheiro = os.Getenv(nomeVariavel(opcoes.Prefixo, "config"))
+	}
+	if *ficheiro != "" {
+		if err := aplicarFicheiro(*ficheiro, campos, seccoes); err != nil {
+			return err
+		}
+	}
+
+	for _, c := range campos {
+		for _, variavel := range c.variaveis {
+			texto, existe := os.LookupEnv(variavel)
+			if !existe {
+				continue
+			}
+			if err := definirTexto(c.valor, texto); err != nil {
+				return fmt.Errorf("variável %s: %v", variavel, err)
+			}
+			break
+		}
+	}
+
+	var erroFlag error
+	flags.Visit(func(f *flag.Flag) {
+		valor, existe := valoresFlags[f.Name]
+		if !existe || erroFlag != nil {
+			return
+		}
+		if err := definirTexto(valor.campo.valor, valor.texto); err != nil {
+			erroFlag = fmt.Errorf("flag -%s: %v", f.Name, err)
+		}
+	})
+	if erroFlag != nil {
+		return erroFlag
+	}
+
+	return validar(raiz.Elem(), "")
+}
+
+// recolherCampos Percorre a struct e junta os campos folha, e o caminho das secções (usado para detetar chaves desconhecidas no ficheiro)
+func recolherCampos(valor reflect.Value, caminho []string, prefixo string, campos *[]*campo, seccoes map[string]bool) error {
+	tipo := valor.Type()
+	for i := 0; i < tipo.NumField(); i++ {
+		definicao := tipo.Field(i)
+		if definicao.PkgPath != "" {
+			continue
+		}
+		nome := definicao.Tag.Get("conf")
+		if nome == "-" {
+			continue
+		}
+
+		if nome == tagInline && definicao.Type.Kind() == reflect.Struct {
+			if err := recolherCampos(valor.Field(i), caminho, prefixo, campos, seccoes); err != nil {
+				return err
+			}
+			continue
+		}
+		if nome == "" {
+			nome = strings.ToLower(definicao.Name)
+		}
+		caminhoCampo := append(append([]string{}, caminho...), nome)
+
+		if definicao.Type.Kind() == reflect.Struct {
+			seccoes[strings.Join(caminhoCampo, ".")] = true
+			if err := recolherCampos(valor.Field(i), caminhoCampo, prefixo, campos, seccoes); err != nil {
+				return err
+			}
+			continue
+		}
+		if !tipoSuportado(definicao.Type) {
+			return fmt.Errorf("o campo %s têm um tipo não suportado na configuração: %s", strings.Join(caminhoCampo, "."), definicao.Type)
+		}
+
+		novo := &campo{
+			caminho:   strings.Join(caminhoCampo, "."),
+			valor:     valor.Field(i),
+			variaveis: []string{nomeVariavel(prefixo, caminhoCampo...)},
+			flags:     []string{strings.Join(caminhoCampo, ".")},
+			descricao: definicao.Tag.Get("desc"),
+		}
+		for _, variavel := range strings.Split(definicao.Tag.Get("env"), ",") {
+			if variavel = strings.TrimSpace(variavel); variavel != "" {
+				novo.variaveis = append(novo.variaveis, variavel)
+			}
+		}
+		if alternativa := definicao.Tag.Get("flag"); alternativa != "" {
+			novo.flags = append(novo.flags, alternativa)
+		}
+		*campos = append(*campos, novo)
+	}
+	return nil
+}
+
+// nomeVariavel Nome da variável de ambiente de um campo, ex: ("AUTH", "servidor", "porta") -> AUTH_SERVIDOR_PORTA
+func nomeVariavel(prefixo string, caminho ...string) string {
+	partes := append([]string{}, caminho...)
+	if prefixo != "" {
+		partes = append([]string{prefixo}, partes...)
+	}
+	nome := strings.ToUpper(strings.Join(partes, "_"))
+	return strings.NewReplacer("-", "_", ".", "_").Replace(nome)
+}
+
+// aplicarFicheiro Lê o ficheiro de configuração, o formato é escolhido pela extensão
+func aplicarFicheiro(caminho string, campos []*campo, seccoes map[string]bool) error {
+	conteudo, err := ioutil.ReadFile(caminho)
+	if err != nil {
+		return fmt.Errorf("erro ao ler o ficheiro de configuração: %v", err)
+	}
+
+	mapa := make(map[string]interface{})
+	switch strings.ToLower(filepath.Ext(caminho)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(conteudo, &mapa)
+	case ".toml":
+		err = toml.Unmarshal(conteudo, &mapa)
+	default:
+		return fmt.Errorf("formato do ficheiro de configuração desconhecido (%s), use .yaml, .yml ou .toml", caminho)
+	}
+	if err != nil {
+		return fmt.Errorf("ficheiro de configuração %s inválido: %v", caminho, err)
+	}
+
+	indice := make(map[string]*campo, len(campos))
+	for _, c := range campos {
+		indice[c.caminho] = c
+	}
+	if err := aplicarMapa(mapa, "", indice, seccoes); err != nil {
+		return fmt.Errorf("ficheiro de configuração %s: %v", caminho, err)
+	}
+	return nil
+}
+
+// aplicarMapa Aplica os valores de uma secção do ficheiro, as chaves desconhecidas são um erro (ex: nomes mal escritos)
+func aplicarMapa(mapa map[string]interface{}, seccao string, indice map[string]*campo, seccoes map[string]bool) error {
+	chaves := make([]string, 0, len(mapa))
+	for chave := range mapa {
+		chaves = append(chaves, chave)
+	}
+	sort.Strings(chaves)
+
+	for _, chave := range chaves {
+		caminho := chave
+		if seccao != "" {
+			caminho = seccao + "." + chave
+		}
+
+		if c, existe := indice[caminho]; existe {
+			if err := definirValor(c.valor, mapa[chave]); err != nil {
+				return fmt.Errorf("%s: %v", caminho, err)
+			}
+			continue
+		}
+		if !seccoes[caminho] {
+			return fmt.Errorf("chave desconhecida: %s", caminho)
+		}
+		interior, ok := mapa[chave].(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s têm de ser uma secção", caminho)
+		}
+		if err := aplicarMapa(interior, caminho, indice, seccoes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validar Chama o Validar das secções, das mais interiores para a raiz
+func validar(valor reflect.Value, caminho string) error {
+	tipo := valor.Type()
+	for i := 0; i < tipo.NumField(); i++ {
+		definicao := tipo.Field(i)
+		if definicao.PkgPath != "" || definicao.Type.Kind() != reflect.Struct || definicao.Tag.Get("conf") == "-" {
+			continue
+		}
+		nome := definicao.Tag.Get("conf")
+		seccao := caminho
+		if nome != tagInline {
+			if nome == "" {
+				nome = strings.ToLower(definicao.Name)
+			}
+			if seccao != "" {
+				seccao += "."
+			}
+			seccao += nome
+		}
+		if err := validar(valor.Field(i), seccao); err != nil {
+			return err
+		}
+	}
+
+	if validador, ok := valor.Addr().Interface().(Validador); ok {
+		if err := validador.Validar(); err != nil {
+			if caminho == "" {
+				return fmt.Errorf("configuração inválida: %v", err)
+			}
+			return fmt.Errorf("configuração inválida (%s): %v", caminho, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package configuracao
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// opcoesTeste Configuração de um serviço de teste, com secções partilhadas e campos inline
+type opcoesTeste struct {
+	Servidor Servidor `conf:"servidor"`
+	Redis    Redis    `conf:"redis"`
+	Handlers struct {
+		Store  string `conf:"store" env:"TESTE_STORE_ANTIGO"`
+		Limite int    `conf:"limite"`
+	} `conf:",inline"`
+}
+
+// configTeste Defaults do serviço de teste, válidos
+func configTeste() opcoesTeste {
+	var config opcoesTeste
+	config.Servidor = Servidor{
+		Endereco:       "0.0.0.0",
+		Porta:          8000,
+		TimeoutLeitura: time.Second,
+		TimeoutEscrita: time.Second,
+		TimeoutInativo: time.Second,
+	}
+	config.Redis = Redis{Endereco: "redis", Porta: 6379, Password: "segredo"}
+	config.Handlers.Store = "redis"
+	config.Handlers.Limite = 10
+	return config
+}
+
+// ficheiroTeste Escreve o ficheiro de configuração numa pasta temporária do teste
+func ficheiroTeste(t *testing.T, nome string, conteudo string) string {
+	t.Helper()
+	caminho := filepath.Join(t.TempDir(), nome)
+	if err := os.WriteFile(caminho, []byte(conteudo), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return caminho
+}
+
+func TestCarregarCamadas(t *testing.T) {
+	ficheiro := ficheiroTeste(t, "config.yaml", `
+servidor:
+  porta: 8100
+  timeout_leitura: 5s
+  cors:
+    origens: [http://a.pt, http://b.pt]
+redis:
+  endereco: redis-ficheiro
+  db: 2
+limite: 20
+`)
+	// Cada camada sobrepõe a anterior: defaults < ficheiro < variáveis < flags
+	t.Setenv("TESTE_SERVIDOR_PORTA", "8200")
+	t.Setenv("TESTE_REDIS_DB", "3")
+	t.Setenv("TESTE_LIMITE", "30")
+	config := configTeste()
+	err := Carregar(&config, Opcoes{
+		Prefixo: "TESTE",
+		Args:    []string{"-config", ficheiro, "-limite=40", "-graceful-timeout", "7s"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	casos := map[string]struct{ valor, esperado interface{} }{
+		"default":             {config.Servidor.Endereco, "0.0.0.0"},
+		"ficheiro":            {config.Redis.Endereco, "redis-ficheiro"},
+		"duração do ficheiro": {config.Servidor.TimeoutLeitura, time.Second * 5},
+		"lista do ficheiro":   {config.Servidor.CORS.Origens, []string{"http://a.pt", "http://b.pt"}},
+		"variável":            {config.Servidor.Porta, 8200},
+		"variável e ficheiro": {config.Redis.DB, 3},
+		"flag":                {config.Handlers.Limite, 40},
+		"flag alternativa":    {config.Servidor.Desligar, time.Second * 7},
+	}
+	for nome, caso := range casos {
+		if !reflect.DeepEqual(caso.valor, caso.esperado) {
+			t.Errorf("%s: esperava %v, recebeu %v", nome, caso.esperado, caso.valor)
+		}
+	}
+}
+
+func TestCarregarVariaveis(t *testing.T) {
+	// A variável do ficheiro pode vir do ambiente, e o formato toml é escolhido pela extensão
+	t.Setenv("TESTE_CONFIG", ficheiroTeste(t, "config.toml", "store = \"ficheiro\"\n[servidor]\nporta = 8300\n"))
+	// Os nomes antigos e os da tag env só são usados sem a variável com o prefixo
+	t.Setenv("LEGADO_PORTA", "9000")
+	t.Setenv("TESTE_STORE_ANTIGO", "memoria")
+	t.Setenv("TESTE_SERVIDOR_CORS_ORIGENS", "http://a.pt, http://b.pt")
+	config := configTeste()
+	err := Carregar(&config, Opcoes{
+		Prefixo:   "TESTE",
+		Args:      []string{},
+		Variaveis: map[string]string{"servidor.porta": "LEGADO_PORTA"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Servidor.Porta != 9000 || config.Handlers.Store != "memoria" {
+		t.Fatalf("variáveis antigas não aplicadas: porta %d, store %s", config.Servidor.Porta, config.Handlers.Store)
+	}
+	if !reflect.DeepEqual(config.Servidor.CORS.Origens, []string{"http://a.pt", "http://b.pt"}) {
+		t.Fatalf("lista separada por virgulas: %v", config.Servidor.CORS.Origens)
+	}
+
+	t.Setenv("TESTE_SERVIDOR_PORTA", "9100")
+	config = configTeste()
+	if err := Carregar(&config, Opcoes{Prefixo: "TESTE", Args: []string{}, Variaveis: map[string]string{"servidor.porta": "LEGADO_PORTA"}}); err != nil {
+		t.Fatal(err)
+	}
+	if config.Servidor.Porta != 9100 {
+		t.Fatalf("a variável com o prefixo tem prioridade, porta %d", config.Servidor.Porta)
+	}
+}
+
+func TestCarregarErros(t *testing.T) {
+	casos := map[string]struct {
+		ficheiro string
+		conteudo string
+		variavel string
+		valor    string
+		erro     string
+	}{
+		"chave desconhecida":   {"config.yaml", "servidor:\n  prota: 80\n", "", "", "chave desconhecida: servidor.prota"},
+		"secção como valor":    {"config.yaml", "servidor: 80\n", "", "", "servidor têm de ser uma secção"},
+		"formato desconhecido": {"config.json", "{}", "", "", "formato do ficheiro de configuração desconhecido"},
+		"variável inválida":    {"", "", "TESTE_SERVIDOR_PORTA", "oitenta", "variável TESTE_SERVIDOR_PORTA"},
+		"duração inválida":     {"", "", "TESTE_SERVIDOR_TIMEOUT_LEITURA", "5", "duração inválida"},
+		"validação da secção":  {"", "", "TESTE_REDIS_PASSWORD", "", "configuração inválida (redis): a password do redis é obrigatória"},
+		"validação interior":   {"", "", "TESTE_SERVIDOR_CORS_ORIGENS", "ftp://a.pt", "configuração inválida (servidor.cors)"},
+	}
+	for nome, caso := range casos {
+		t.Run(nome, func(t *testing.T) {
+			args := []string{}
+			if caso.ficheiro != "" {
+				args = append(args, "-config", ficheiroTeste(t, caso.ficheiro, caso.conteudo))
+			}
+			if caso.variavel != "" {
+				t.Setenv(caso.variavel, caso.valor)
+			}
+			config := configTeste()
+			err := Carregar(&config, Opcoes{Prefixo: "TESTE", Args: args})
+			if err == nil || !strings.Contains(err.Error(), caso.erro) {
+				t.Fatalf("esperava o erro %q, recebeu %v", caso.erro, err)
+			}
+		})
+	}
+}
+
+func TestCarregarTipoNaoSuportado(t *testing.T) {
+	var config struct {
+		Mapa map[string]string `conf:"mapa"`
+	}
+	if err := Carregar(&config, Opcoes{Args: []string{}}); err == nil {
+		t.Fatal("campo com um tipo não suportado aceite")
+	}
+	if err := Carregar(config, Opcoes{Args: []string{}}); err == nil {
+		t.Fatal("configuração que não é um ponteiro aceite")
+	}
+}
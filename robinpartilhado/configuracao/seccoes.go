@@ -0,0 +1,199 @@
+package configuracao
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/autorizacao"
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/registos"
+)
+
+// Servidor Definições do servidor http de um serviço
+type Servidor struct {
+	Endereco       string        `conf:"endereco" desc:"endereço onde o servidor http escuta"`
+	Porta          int           `conf:"porta" desc:"porta do servidor http"`
+	TimeoutLeitura time.Duration `conf:"timeout_leitura" desc:"tempo máximo para ler um pedido"`
+	TimeoutEscrita time.Duration `conf:"timeout_escrita" desc:"tempo máximo para escrever a resposta"`
+	TimeoutInativo time.Duration `conf:"timeout_inativo" desc:"tempo que as conexões keep-alive ficam abertas sem pedidos"`
+	Desligar       time.Duration `conf:"desligar" flag:"graceful-timeout" desc:"tempo de espera pelas conexões abertas ao desligar o servidor"`
+	CORS           CORS          `conf:"cors"`
+	Logs           string        `conf:"logs" desc:"nível mínimo dos logs: debug, info, aviso ou erro"`
+	ConfiarProxy   bool          `conf:"confiar_proxy" desc:"usa o IP do cliente dos headers X-Forwarded-For (o último endereço) e X-Real-IP, só com um proxy de confiança à frente (ex: o gateway)"`
+}
+
+// CORS Definições de partilha de recursos cruzada
+type CORS struct {
+	Origens     []string `conf:"origens" desc:"origens que podem fazer pedidos ao serviço, separadas por virgulas"`
+	Credenciais bool     `conf:"credenciais" desc:"permite pedidos com credenciais (cookies, autenticação http)"`
+}
+
+// Morada Endereço e porta onde o servidor escuta, ex: 0.0.0.0:8081
+func (s Servidor) Morada() string {
+	return net.JoinHostPort(s.Endereco, strconv.Itoa(s.Porta))
+}
+
+// Validar Verifica a porta, os timeouts e o nível dos logs do servidor
+func (s *Servidor) Validar() error {
+	if err := portaValida(s.Porta); err != nil {
+		return err
+	}
+	if s.TimeoutLeitura <= 0 || s.TimeoutEscrita <= 0 || s.TimeoutInativo <= 0 {
+		return errors.New("os timeouts do servidor têm de ser maiores que 0")
+	}
+	if s.Desligar < 0 {
+		return errors.New("o tempo de desligar não pode ser negativo")
+	}
+	if _, err := registos.NivelDe(s.Logs); err != nil {
+		return err
+	}
+	return nil
+}
+
+// NivelLogs Nível mínimo dos logs do serviço, Info se não for indicado
+func (s Servidor) NivelLogs() registos.Nivel {
+	nivel, _ := registos.NivelDe(s.Logs)
+	return nivel
+}
+
+// Validar Verifica se as origens são urls http(s) ou "*", que não pode ser usado com credenciais
+func (c *CORS) Validar() error {
+	for _, origem := range c.Origens {
+		if origem == "*" {
+			if c.Credenciais {
+				return errors.New("a origem * não pode ser usada com credenciais")
+			}
+			continue
+		}
+		if err := urlValida(origem); err != nil {
+			return fmt.Errorf("origem %s: %v", origem, err)
+		}
+	}
+	return nil
+}
+
+// Mongo Conexão à instância mongodb do serviço
+type Mongo struct {
+	URI string `conf:"uri" desc:"uri da instância mongodb, ex: mongodb://0.0.0.0:27019/"`
+}
+
+// Validar Verifica o esquema da uri
+func (m *Mongo) Validar() error {
+	if !strings.HasPrefix(m.URI, "mongodb://") && !strings.HasPrefix(m.URI, "mongodb+srv://") {
+		return fmt.Errorf("uri mongodb inválida: %q", m.URI)
+	}
+	return nil
+}
+
+// Redis Conexão à base de dados redis
+type Redis struct {
+	Endereco string `conf:"endereco" desc:"endereço do serviço redis"`
+	Porta    int    `conf:"porta" desc:"porta do serviço redis"`
+	User     string `conf:"user" desc:"user usado na autenticação no redis"`
+	Password string `conf:"password" desc:"password do user do redis"`
+	DB       int    `conf:"db" desc:"base de dados redis"`
+}
+
+// Validar Verifica o endereço, a porta, a password e a base de dados
+func (r *Redis) Validar() error {
+	if r.Endereco == "" {
+		return errors.New("o endereço do redis é obrigatório")
+	}
+	if r.Password == "" {
+		return errors.New("a password do redis é obrigatória")
+	}
+	if err := portaValida(r.Porta); err != nil {
+		return err
+	}
+	if r.DB < 0 {
+		return errors.New("a base de dados redis não pode ser negativa")
+	}
+	return nil
+}
+
+// Autenticacao Endpoints do serviço de autenticação usados para verificar as tokens, vazios usam os endpoints default
+type Autenticacao struct {
+	JWKS        string `conf:"jwks" env:"AUTH_JWKS_URL" desc:"endpoint JWKS com as chaves de verificação das tokens"`
+	Introspecao string `conf:"introspecao" env:"AUTH_INTROSPECAO_URL" desc:"endpoint de introspeção, que indica se uma token foi revogada"`
+}
+
+// Validar Verifica os urls dos endpoints
+func (a *Autenticacao) Validar() error {
+	for _, endpoint := range []string{a.JWKS, a.Introspecao} {
+		if endpoint == "" {
+			continue
+		}
+		if err := urlValida(endpoint); err != nil {
+			return fmt.Errorf("endpoint %s: %v", endpoint, err)
+		}
+	}
+	return nil
+}
+
+// Verificador Cria o verificador das tokens emitidas pelo serviço de autenticação, os erros são escritos no logger,
+// os pedidos ao serviço de autenticação usam o transporte dado (nil usa o http.DefaultTransport)
+func (a Autenticacao) Verificador(logger *log.Logger, transporte http.RoundTripper) *autorizacao.Verificador {
+	return autorizacao.NovoVerificador(
+		autorizacao.NovasChavesJWKS(a.JWKS, logger).UsarTransporte(transporte).ChaveVerificacao,
+		autorizacao.NovaIntrospecao(a.Introspecao, logger).UsarTransporte(transporte).Ativa,
+	)
+}
+
+// URLJWKS Endpoint JWKS configurado, ou o endpoint default
+func (a Autenticacao) URLJWKS() string {
+	if a.JWKS == "" {
+		return autorizacao.URLJWKSDefault
+	}
+	return a.JWKS
+}
+
+// ContaServico Conta de serviço usada nas chamadas às actions internas dos outros serviços
+type ContaServico struct {
+	URLToken string `conf:"url_token" env:"AUTH_TOKEN_URL" desc:"endpoint do serviço de autenticação que emite as tokens de serviço"`
+	Conta    string `conf:"conta" desc:"nome da conta de serviço"`
+	Segredo  string `conf:"segredo" desc:"segredo da conta de serviço"`
+}
+
+// Validar A conta e o segredo têm de estar os dois definidos, ou nenhum
+func (c *ContaServico) Validar() error {
+	if (c.Conta == "") != (c.Segredo == "") {
+		return errors.New("a conta de serviço precisa do nome e do segredo")
+	}
+	if c.URLToken != "" {
+		if err := urlValida(c.URLToken); err != nil {
+			return fmt.Errorf("endpoint %s: %v", c.URLToken, err)
+		}
+	}
+	return nil
+}
+
+// Credenciais Cria as credenciais da conta, as tokens são pedidas só com os scopes indicados
+func (c ContaServico) Credenciais(scopes []string) *autorizacao.CredenciaisServico {
+	return autorizacao.NovasCredenciaisServico(c.URLToken, c.Conta, c.Segredo, scopes)
+}
+
+// portaValida As portas têm de estar entre 1 e 65535
+func portaValida(porta int) error {
+	if porta < 1 || porta > 65535 {
+		return fmt.Errorf("porta inválida: %d", porta)
+	}
+	return nil
+}
+
+// urlValida Os urls têm de ser http ou https, com o host
+func urlValida(texto string) error {
+	endereco, err := url.Parse(texto)
+	if err != nil {
+		return err
+	}
+	if (endereco.Scheme != "http" && endereco.Scheme != "https") || endereco.Host == "" {
+		return errors.New("têm de ser um url http ou https")
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package configuracao
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tipoDuracao os campos time.Duration são lidos no formato do time.ParseDuration, ex: "15s"
+var tipoDuracao = reflect.TypeOf(time.Duration(0))
+
+// tipoSuportado Tipos que podem ser campos (folhas) da configuração
+func tipoSuportado(tipo reflect.Type) bool {
+	switch tipo.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Slice:
+		return tipo.Elem().Kind() == reflect.String
+	}
+	return false
+}
+
+// textoValor Valor atual de um campo em texto, mostrado como default nas flags
+func textoValor(valor reflect.Value) string {
+	if valor.Type() == tipoDuracao {
+		return time.Duration(valor.Int()).String()
+	}
+	if valor.Kind() == reflect.Slice {
+		textos := make([]string, valor.Len())
+		for i := range textos {
+			textos[i] = valor.Index(i).String()
+		}
+		return strings.Join(textos, ",")
+	}
+	return fmt.Sprint(valor.Interface())
+}
+
+// definirValor Define o campo com um valor lido do ficheiro, as listas podem ser listas do ficheiro ou texto separado por virgulas
+func definirValor(valor reflect.Value, lido interface{}) error {
+	if lista, ok := lido.([]interface{}); ok {
+		if valor.Kind() != reflect.Slice {
+			return fmt.Errorf("não pode ser uma lista")
+		}
+		textos := make([]string, 0, len(lista))
+		for _, elemento := range lista {
+			textos = append(textos, fmt.Sprint(elemento))
+		}
+		valor.Set(reflect.ValueOf(textos).Convert(valor.Type()))
+		return nil
+	}
+	if _, ok := lido.(map[string]interface{}); ok {
+		return fmt.Errorf("não pode ser uma secção")
+	}
+	if lido == nil {
+		return definirTexto(valor, "")
+	}
+	return definirTexto(valor, fmt.Sprint(lido))
+}
+
+// definirTexto Converte o texto (de uma variável de ambiente, flag ou ficheiro) para o tipo do campo
+func definirTexto(valor reflect.Value, texto string) error {
+	texto = strings.TrimSpace(texto)
+
+	if valor.Type() == tipoDuracao {
+		duracao, err := time.ParseDuration(texto)
+		if err != nil {
+			return fmt.Errorf("duração inválida %q, ex: 15s, 10m, 720h", texto)
+		}
+		valor.SetInt(int64(duracao))
+		return nil
+	}
+
+	switch valor.Kind() {
+	case reflect.String:
+		valor.SetString(texto)
+	case reflect.Bool:
+		booleano, err := strconv.ParseBool(texto)
+		if err != nil {
+			return fmt.Errorf("booleano inválido %q, use true ou false", texto)
+		}
+		valor.SetBool(booleano)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		inteiro, err := strconv.ParseInt(texto, 10, valor.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("número inteiro inválido %q", texto)
+		}
+		valor.SetInt(inteiro)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		inteiro, err := strconv.ParseUint(texto, 10, valor.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("número inteiro positivo inválido %q", texto)
+		}
+		valor.SetUint(inteiro)
+	case reflect.Float32, reflect.Float64:
+		decimal, err := strconv.ParseFloat(texto, valor.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("número inválido %q", texto)
+		}
+		valor.SetFloat(decimal)
+	case reflect.Slice:
+		textos := make([]string, 0)
+		for _, elemento := range strings.Split(texto, ",") {
+			if elemento = strings.TrimSpace(elemento); elemento != "" {
+				textos = append(textos, elemento)
+			}
+		}
+		valor.Set(reflect.ValueOf(textos).Convert(valor.Type()))
+	}
+	return nil
+}
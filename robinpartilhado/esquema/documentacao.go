@@ -0,0 +1,205 @@
+package esquema
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/acoes"
+)
+
+// exemplos valores de exemplo de cada tipo JSON, nos pedidos da documentação
+var exemplos = map[string]string{"integer": "0", "number": "0", "boolean": "false", "array": "[]", "object": "{}", "": "null"}
+
+// TextoAutorizacao Descrição da autorização da action, ex: "token de um user com nivel ADMIN ou superior"
+func TextoAutorizacao(acao Acao) string {
+	autorizacao := acao.Autorizacao
+	switch {
+	case autorizacao == nil:
+		return "sem politica registada, a token não é verificada"
+	case autorizacao.Publica:
+		return "pública, não precisa de token"
+	}
+
+	partes := []string{"token de um user"}
+	if autorizacao.Nivel != "" {
+		partes = append(partes, fmt.Sprintf("com nivel %s ou superior", autorizacao.Nivel))
+	}
+	if len(autorizacao.Permissoes) > 0 {
+		partes = append(partes, fmt.Sprintf("com as permissões %s", listaCodigo(autorizacao.Permissoes)))
+	}
+	if len(autorizacao.Scopes) > 0 {
+		partes = append(partes, fmt.Sprintf("com os scopes %s", listaCodigo(autorizacao.Scopes)))
+	}
+	if autorizacao.Dono != "" {
+		partes = append(partes, fmt.Sprintf("que seja o user `%s` ou um admin", autorizacao.Dono))
+	}
+	texto := strings.Join(partes, ", ")
+	if len(autorizacao.Servicos) > 0 {
+		texto += fmt.Sprintf(", ou token de serviço com um dos scopes %s", listaCodigo(autorizacao.Servicos))
+	}
+	return texto
+}
+
+// listaCodigo Junta os valores formatados como código em Markdown, ex: "`a`, `b`"
+func listaCodigo(valores []string) string {
+	formatados := make([]string, len(valores))
+	for i, valor := range valores {
+		formatados[i] = "`" + valor + "`"
+	}
+	return strings.Join(formatados, ", ")
+}
+
+// exemploPedido Body de exemplo de uma chamada à action em JSON, com um valor do tipo de cada parametro
+func exemploPedido(acao Acao) string {
+	valores := make([]string, len(acao.Params))
+	for i, param := range acao.Params {
+		if param.Tipo == "string" {
+			valores[i] = fmt.Sprintf("%q", "<"+param.Nome+">")
+			continue
+		}
+		valores[i] = exemplos[param.Tipo]
+	}
+	return fmt.Sprintf(`{"params": [%s]}`, strings.Join(valores, ", "))
+}
+
+// Markdown Documentação das actions do esquema em Markdown: um índice, e para cada action os parametros, a autorização,
+// as keys do retorno e um pedido de exemplo
+func Markdown(esquema Esquema) string {
+	var md strings.Builder
+	fmt.Fprintf(&md, "# Actions do serviço %s\n\n", esquema.Servico)
+	md.WriteString("Gerado a partir do esquema das actions registadas no serviço (`GET /esquema/acoes.md`), não deve ser editado à mão.\n\n")
+	fmt.Fprintf(&md, "As actions são chamadas com `POST %s<action>`, com os parametros pela ordem indicada em `{\"params\": [...]}`, ", acoes.RotaJSON)
+	md.WriteString("e a token é sempre o último parametro das actions que a recebem. ")
+	fmt.Fprintf(&md, "Os erros são devolvidos numa das keys %s do retorno.\n\n", listaCodigo(acoes.ChavesErro))
+
+	md.WriteString("| Action | Autorização |\n|---|---|\n")
+	for _, acao := range esquema.Acoes {
+		fmt.Fprintf(&md, "| [%s](#%s) | %s |\n", acao.Nome, strings.ToLower(acao.Nome), TextoAutorizacao(acao))
+	}
+
+	for _, acao := range esquema.Acoes {
+		fmt.Fprintf(&md, "\n## %s\n\n", acao.Nome)
+		if acao.Descricao != "" {
+			fmt.Fprintf(&md, "%s\n\n", acao.Descricao)
+		}
+		fmt.Fprintf(&md, "**Autorização:** %s\n\n", TextoAutorizacao(acao))
+
+		if len(acao.Params) > 0 {
+			md.WriteString("| # | Parametro | Tipo JSON | Tipo Go |\n|---|---|---|---|\n")
+			for i, param := range acao.Params {
+				tipo := param.Tipo
+				if tipo == "" {
+					tipo = "qualquer"
+				}
+				fmt.Fprintf(&md, "| %d | `%s` | %s | `%s` |\n", i+1, param.Nome, tipo, param.TipoGo)
+			}
+			md.WriteString("\n")
+		}
+
+		if len(acao.Respostas) > 0 {
+			fmt.Fprintf(&md, "**Retorno:** %s\n\n", listaCodigo(acao.Respostas))
+		} else {
+			md.WriteString("**Retorno:** vazio, só com o erro se a action falhar\n\n")
+		}
+		fmt.Fprintf(&md, "    POST %s%s\n    %s\n", acoes.RotaJSON, acao.Nome, exemploPedido(acao))
+	}
+	return md.String()
+}
+
+// OpenAPI Especificação OpenAPI 3.1 das chamadas às actions em JSON, os parametros de cada action são descritos
+// como os itens (prefixItems) do array params do body
+func OpenAPI(esquema Esquema) map[string]interface{} {
+	paths := make(map[string]interface{}, len(esquema.Acoes))
+	for _, acao := range esquema.Acoes {
+		params := make([]interface{}, len(acao.Params))
+		for i, param := range acao.Params {
+			schema := map[string]interface{}{"title": param.Nome}
+			if param.Tipo != "" {
+				schema["type"] = param.Tipo
+			}
+			params[i] = schema
+		}
+
+		retorno := make(map[string]interface{}, len(acao.Respostas))
+		for _, resposta := range acao.Respostas {
+			retorno[resposta] = map[string]interface{}{}
+		}
+
+		respostas := map[string]interface{}{
+			"200": map[string]interface{}{
+				"description": "Retorno da action",
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{
+						"schema": map[string]interface{}{"type": "object", "properties": retorno},
+					},
+				},
+			},
+			"400": referenciaErro,
+			"404": referenciaErro,
+			"500": referenciaErro,
+		}
+		if acao.Token {
+			respostas["401"] = referenciaErro
+			respostas["403"] = referenciaErro
+		}
+
+		descricao := acao.Descricao
+		if descricao != "" {
+			descricao += "\n\n"
+		}
+		paths[acoes.RotaJSON+acao.Nome] = map[string]interface{}{
+			"post": map[string]interface{}{
+				"operationId": acao.Nome,
+				"summary":     acao.Nome,
+				"description": descricao + "Autorização: " + TextoAutorizacao(acao),
+				"requestBody": map[string]interface{}{
+					"required": true,
+					"content": map[string]interface{}{
+						"application/json": map[string]interface{}{
+							"schema": map[string]interface{}{
+								"type":     "object",
+								"required": []string{"params"},
+								"properties": map[string]interface{}{
+									"params": map[string]interface{}{
+										"type":        "array",
+										"prefixItems": params,
+										"minItems":    len(params),
+										"maxItems":    len(params),
+									},
+								},
+							},
+						},
+					},
+				},
+				"responses": respostas,
+			},
+		}
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.1.0",
+		"info": map[string]interface{}{
+			"title":   "Actions do serviço " + esquema.Servico,
+			"version": "1",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"responses": map[string]interface{}{
+				"Erro": map[string]interface{}{
+					"description": "A action falhou: pedido inválido ou erro da action (400), token não aceite (401), sem permissões (403), action desconhecida (404) ou erro interno (500)",
+					"content": map[string]interface{}{
+						"application/json": map[string]interface{}{
+							"schema": map[string]interface{}{
+								"type":       "object",
+								"properties": map[string]interface{}{"erro": map[string]interface{}{"type": "string"}},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// referenciaErro resposta com erro das actions, definida nos components da especificação
+var referenciaErro = map[string]interface{}{"$ref": "#/components/responses/Erro"}
@@ -0,0 +1,202 @@
+package esquema
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/autorizacao"
+)
+
+// tipoContexto tipo do primeiro parametro das actions que recebem o contexto do pedido, que não é um parametro da chamada
+var tipoContexto = reflect.TypeOf((*context.Context)(nil)).Elem()
+
+// tipoRetorno tipo devolvido pelas actions, as que devolvem outros tipos respondem com os valores na key "resultado"
+// (ver acoes.Despachante.ServeJSON)
+var tipoRetorno = reflect.TypeOf(map[string]interface{}{})
+
+// Esquema Descrição de todas as actions de um serviço, servida no /esquema e usada para gerar a documentação
+type Esquema struct {
+	Servico string `json:"servico"`
+	Acoes   []Acao `json:"acoes"`
+}
+
+// Acao Descrição de uma action: os parametros pela ordem da chamada (sem o contexto), a autorização e as keys do retorno
+type Acao struct {
+	Nome      string  `json:"nome"`
+	Descricao string  `json:"descricao,omitempty"`
+	Params    []Param `json:"params"`
+	// Token o último parametro é a token verificada pela politica da action
+	Token       bool         `json:"token"`
+	Autorizacao *Autorizacao `json:"autorizacao,omitempty"` // nil se a action não foi registada com uma politica
+	// Respostas keys do retorno sem erro, o retorno com erro têm uma das acoes.ChavesErro
+	Respostas []string `json:"respostas"`
+}
+
+// Param Parametro de uma action, Tipo é o tipo JSON do valor (vazio aceita qualquer valor) e TipoGo o tipo na função
+type Param struct {
+	Nome   string `json:"nome"`
+	Tipo   string `json:"tipo,omitempty"`
+	TipoGo string `json:"tipo_go"`
+}
+
+// Autorizacao Politica da action (ver autorizacao.Politica), com o nivel pelo nome e o dono pelo nome do parametro
+type Autorizacao struct {
+	Publica    bool     `json:"publica,omitempty"`
+	Nivel      string   `json:"nivel,omitempty"` // ROOT, ADMIN ou USER, vazio aceita qualquer user
+	Permissoes []string `json:"permissoes,omitempty"`
+	Scopes     []string `json:"scopes,omitempty"`
+	Dono       string   `json:"dono,omitempty"`     // Parametro com o user dono do recurso
+	Servicos   []string `json:"servicos,omitempty"` // Scopes das tokens de serviço aceites
+}
+
+// Descricao Partes de uma action que só existem no código fonte: o comentário, os nomes dos parametros (sem o contexto)
+// e as keys do retorno. Geradas pelo esquemagen a partir das actions registadas (ver go generate em cada serviço)
+type Descricao struct {
+	Descricao string
+	Params    []string
+	Respostas []string
+}
+
+// niveis nomes dos niveis de permissões das politicas
+var niveis = map[int]string{autorizacao.ROOT: "ROOT", autorizacao.ADMIN: "ADMIN", autorizacao.USER: "USER"}
+
+/*
+Novo Cria o esquema das actions em funcs, os tipos dos parametros vêm da função de cada action,
+a autorização das politicas registadas (ver autorizacao.Acoes), e o resto das descricoes geradas.
+Devolve também os avisos das descricoes que já não correspondem às actions, ex:
+---
+
+	esquema.Novo("userinfo", actions.FuncsStorage, acoes.Politicas, descricoesAcoes)
+
+Os avisos indicam que o ficheiro gerado está desatualizado, e que é preciso correr o go generate
+*/
+func Novo(servico string, funcs map[string]interface{}, politicas map[string]autorizacao.Politica, descricoes map[string]Descricao) (Esquema, []string) {
+	esquema := Esquema{Servico: servico, Acoes: make([]Acao, 0, len(funcs))}
+	avisos := make([]string, 0)
+
+	for nome, funcao := range funcs {
+		tipo := reflect.TypeOf(funcao)
+		if tipo == nil || tipo.Kind() != reflect.Func {
+			avisos = append(avisos, fmt.Sprintf("a action %s não é uma função", nome))
+			continue
+		}
+		acao := Acao{Nome: nome, Params: make([]Param, 0, tipo.NumIn()), Respostas: make([]string, 0)}
+
+		inicio := 0
+		if tipo.NumIn() > 0 && tipo.In(0) == tipoContexto {
+			inicio = 1
+		}
+		for i := inicio; i < tipo.NumIn(); i++ {
+			acao.Params = append(acao.Params, Param{
+				Nome:   fmt.Sprintf("param%d", i-inicio+1),
+				Tipo:   tipoJSON(tipo.In(i)),
+				TipoGo: tipo.In(i).String(),
+			})
+		}
+
+		descricao, existe := descricoes[nome]
+		switch {
+		case !existe:
+			// As actions que não foram registadas pelo serviço (ex: as de exemplo do actions.FuncsStorage) não têm descrição gerada
+			if _, registada := politicas[nome]; registada || politicas == nil {
+				avisos = append(avisos, fmt.Sprintf("a action %s não têm descrição", nome))
+			}
+		case len(descricao.Params) != len(acao.Params):
+			avisos = append(avisos, fmt.Sprintf("a descrição da action %s têm %d parametros, a função têm %d", nome, len(descricao.Params), len(acao.Params)))
+		default:
+			for i := range acao.Params {
+				acao.Params[i].Nome = descricao.Params[i]
+			}
+		}
+		acao.Descricao = descricao.Descricao
+		switch {
+		case tipo.NumOut() != 1 || tipo.Out(0) != tipoRetorno:
+			acao.Respostas = []string{"resultado"}
+		case descricao.Respostas != nil:
+			acao.Respostas = descricao.Respostas
+		}
+
+		if politica, existe := politicas[nome]; existe {
+			acao.Autorizacao = autorizacaoDe(politica, acao.Params, inicio)
+			acao.Token = !politica.Publica
+		}
+		esquema.Acoes = append(esquema.Acoes, acao)
+	}
+
+	for nome := range descricoes {
+		if _, existe := funcs[nome]; !existe {
+			avisos = append(avisos, fmt.Sprintf("a action %s têm descrição mas não está registada", nome))
+		}
+	}
+
+	sort.Slice(esquema.Acoes, func(i, j int) bool { return esquema.Acoes[i].Nome < esquema.Acoes[j].Nome })
+	sort.Strings(avisos)
+	return esquema, avisos
+}
+
+// autorizacaoDe Converte a politica para o esquema, o dono é contado a partir de 1 com o contexto (inicio é 1 se a action o receber)
+func autorizacaoDe(politica autorizacao.Politica, params []Param, inicio int) *Autorizacao {
+	resultado := &Autorizacao{
+		Publica:    politica.Publica,
+		Nivel:      niveis[politica.Perms],
+		Permissoes: politica.Permissoes,
+		Scopes:     politica.Scopes,
+		Servicos:   politica.Servicos,
+	}
+	if dono := politica.Dono - 1 - inicio; politica.Dono > 0 && dono >= 0 && dono < len(params) {
+		resultado.Dono = params[dono].Nome
+	}
+	return resultado
+}
+
+// tipoJSON Tipo JSON (como no JSON schema) dos valores aceites para o tipo, vazio para as interfaces, que aceitam qualquer valor
+func tipoJSON(tipo reflect.Type) string {
+	switch tipo.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	case reflect.Ptr:
+		return tipoJSON(tipo.Elem())
+	}
+	return ""
+}
+
+// ServeJSON Handler do /esquema, responde com o esquema em JSON
+func (esquema Esquema) ServeJSON(rw http.ResponseWriter, r *http.Request) {
+	escrever(rw, "application/json; charset=utf-8", func() ([]byte, error) { return json.MarshalIndent(esquema, "", "  ") })
+}
+
+// ServeOpenAPI Handler do /esquema/openapi.json, responde com a especificação OpenAPI das actions em JSON (ver OpenAPI)
+func (esquema Esquema) ServeOpenAPI(rw http.ResponseWriter, r *http.Request) {
+	escrever(rw, "application/json; charset=utf-8", func() ([]byte, error) { return json.MarshalIndent(OpenAPI(esquema), "", "  ") })
+}
+
+// ServeMarkdown Handler do /esquema/acoes.md, responde com a documentação das actions em Markdown (ver Markdown)
+func (esquema Esquema) ServeMarkdown(rw http.ResponseWriter, r *http.Request) {
+	escrever(rw, "text/markdown; charset=utf-8", func() ([]byte, error) { return []byte(Markdown(esquema)), nil })
+}
+
+// escrever Responde com o body gerado, ou 500 se não foi possível gerar o body
+func escrever(rw http.ResponseWriter, tipo string, gerar func() ([]byte, error)) {
+	body, err := gerar()
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", tipo)
+	rw.Write(body)
+}
@@ -0,0 +1,244 @@
+package esquema
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/autorizacao"
+)
+
+// esquemaTeste Esquema de um serviço de teste, com uma action de cada caso: com contexto e politica completa,
+// pública, sem politica e com outro retorno, sem descrição, e uma que não é uma função
+func esquemaTeste() (Esquema, []string) {
+	funcs := map[string]interface{}{
+		"Buscar": func(ctx context.Context, repo string, limite int, token string) map[string]interface{} {
+			return nil
+		},
+		"Publica": func(filtro map[string]interface{}) map[string]interface{} {
+			return nil
+		},
+		"Outra": func(ids []int, opcoes *Param, valor interface{}, ativo bool, peso float64) []string {
+			return nil
+		},
+		"SemDescricao": func(token string) map[string]interface{} {
+			return nil
+		},
+		"Invalida": 5,
+	}
+	politicas := map[string]autorizacao.Politica{
+		"Buscar":       {Perms: autorizacao.ADMIN, Permissoes: []string{"repos:ver"}, Dono: 2, Servicos: []string{"repos:ler"}},
+		"Publica":      {Publica: true},
+		"SemDescricao": {},
+	}
+	descricoes := map[string]Descricao{
+		"Buscar":   {Descricao: "Procura o repo", Params: []string{"repo", "limite", "token"}, Respostas: []string{"repos"}},
+		"Publica":  {Params: []string{"filtro", "a mais"}},
+		"Outra":    {Params: []string{"ids", "opcoes", "valor", "ativo", "peso"}, Respostas: []string{"ignorada"}},
+		"Removida": {},
+	}
+	return Novo("teste", funcs, politicas, descricoes)
+}
+
+func TestNovo(t *testing.T) {
+	esquema, avisos := esquemaTeste()
+
+	avisosEsperados := []string{
+		"a action Invalida não é uma função",
+		"a action Removida têm descrição mas não está registada",
+		"a action SemDescricao não têm descrição",
+		"a descrição da action Publica têm 2 parametros, a função têm 1",
+	}
+	if !reflect.DeepEqual(avisos, avisosEsperados) {
+		t.Fatalf("esperava os avisos %q, recebeu %q", avisosEsperados, avisos)
+	}
+
+	esperado := []Acao{
+		{
+			Nome:      "Buscar",
+			Descricao: "Procura o repo",
+			Params:    []Param{{"repo", "string", "string"}, {"limite", "integer", "int"}, {"token", "string", "string"}},
+			Token:     true,
+			Autorizacao: &Autorizacao{
+				Nivel:      "ADMIN",
+				Permissoes: []string{"repos:ver"},
+				Dono:       "repo",
+				Servicos:   []string{"repos:ler"},
+			},
+			Respostas: []string{"repos"},
+		},
+		{
+			Nome: "Outra",
+			Params: []Param{
+				{"ids", "array", "[]int"},
+				{"opcoes", "object", "*esquema.Param"},
+				{"valor", "", "interface {}"},
+				{"ativo", "boolean", "bool"},
+				{"peso", "number", "float64"},
+			},
+			// As actions que não devolvem um map respondem na key resultado
+			Respostas: []string{"resultado"},
+		},
+		{
+			// Com a descrição desatualizada os parametros ficam com os nomes genéricos
+			Nome:        "Publica",
+			Params:      []Param{{"param1", "object", "map[string]interface {}"}},
+			Autorizacao: &Autorizacao{Publica: true},
+			Respostas:   []string{},
+		},
+		{
+			Nome:        "SemDescricao",
+			Params:      []Param{{"param1", "string", "string"}},
+			Token:       true,
+			Autorizacao: &Autorizacao{},
+			Respostas:   []string{},
+		},
+	}
+	if !reflect.DeepEqual(esquema.Acoes, esperado) {
+		t.Fatalf("esquema inesperado:\n%+v\nesperava:\n%+v", esquema.Acoes, esperado)
+	}
+
+	// Sem politicas, todas as actions sem descrição são avisadas
+	_, avisos = Novo("teste", map[string]interface{}{"Ping": func() map[string]interface{} { return nil }}, nil, nil)
+	if !reflect.DeepEqual(avisos, []string{"a action Ping não têm descrição"}) {
+		t.Fatalf("avisos sem politicas: %q", avisos)
+	}
+}
+
+func TestTextoAutorizacao(t *testing.T) {
+	esquema, _ := esquemaTeste()
+	textos := make(map[string]string)
+	for _, acao := range esquema.Acoes {
+		textos[acao.Nome] = TextoAutorizacao(acao)
+	}
+
+	esperados := map[string]string{
+		"Buscar":       "token de um user, com nivel ADMIN ou superior, com as permissões `repos:ver`, que seja o user `repo` ou um admin, ou token de serviço com um dos scopes `repos:ler`",
+		"Outra":        "sem politica registada, a token não é verificada",
+		"Publica":      "pública, não precisa de token",
+		"SemDescricao": "token de um user",
+	}
+	if !reflect.DeepEqual(textos, esperados) {
+		t.Fatalf("esperava %q, recebeu %q", esperados, textos)
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	esquema, _ := esquemaTeste()
+	md := Markdown(esquema)
+
+	partes := []string{
+		"# Actions do serviço teste\n",
+		"| [Buscar](#buscar) | token de um user, com nivel ADMIN",
+		"\n## Buscar\n\nProcura o repo\n\n**Autorização:** token de um user",
+		"| 2 | `limite` | integer | `int` |\n",
+		"| 3 | `valor` | qualquer | `interface {}` |\n",
+		"**Retorno:** `repos`\n",
+		"    POST /acoes/Buscar\n    {\"params\": [\"<repo>\", 0, \"<token>\"]}\n",
+		"    {\"params\": [[], {}, null, false, 0]}\n",
+		"\n## SemDescricao\n\n**Autorização:** token de um user\n\n",
+		"**Retorno:** vazio, só com o erro se a action falhar\n",
+	}
+	for _, parte := range partes {
+		if !strings.Contains(md, parte) {
+			t.Errorf("o markdown não contêm %q:\n%s", parte, md)
+		}
+	}
+	if strings.Index(md, "## Buscar") > strings.Index(md, "## SemDescricao") {
+		t.Fatal("as actions não estão por ordem alfabética")
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	esquema, _ := esquemaTeste()
+	corpo, err := json.Marshal(OpenAPI(esquema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var especificacao struct {
+		OpenAPI string `json:"openapi"`
+		Paths   map[string]struct {
+			Post struct {
+				OperationID string `json:"operationId"`
+				Description string `json:"description"`
+				RequestBody struct {
+					Content map[string]struct {
+						Schema struct {
+							Properties struct {
+								Params struct {
+									PrefixItems []map[string]string `json:"prefixItems"`
+									MinItems    int                 `json:"minItems"`
+									MaxItems    int                 `json:"maxItems"`
+								} `json:"params"`
+							} `json:"properties"`
+						} `json:"schema"`
+					} `json:"content"`
+				} `json:"requestBody"`
+				Responses map[string]json.RawMessage `json:"responses"`
+			} `json:"post"`
+		} `json:"paths"`
+	}
+	if err := json.Unmarshal(corpo, &especificacao); err != nil {
+		t.Fatal(err)
+	}
+	if especificacao.OpenAPI != "3.1.0" || len(especificacao.Paths) != 4 {
+		t.Fatalf("especificação inesperada: %s", corpo)
+	}
+
+	buscar := especificacao.Paths["/acoes/Buscar"].Post
+	params := buscar.RequestBody.Content["application/json"].Schema.Properties.Params
+	itens := []map[string]string{{"title": "repo", "type": "string"}, {"title": "limite", "type": "integer"}, {"title": "token", "type": "string"}}
+	if !reflect.DeepEqual(params.PrefixItems, itens) || params.MinItems != 3 || params.MaxItems != 3 {
+		t.Fatalf("parametros inesperados: %+v", params)
+	}
+	if buscar.OperationID != "Buscar" || !strings.HasPrefix(buscar.Description, "Procura o repo\n\nAutorização: token de um user") {
+		t.Fatalf("operação inesperada: %+v", buscar)
+	}
+	// Os parametros sem tipo aceitam qualquer valor
+	outra := especificacao.Paths["/acoes/Outra"].Post.RequestBody.Content["application/json"].Schema.Properties.Params
+	if !reflect.DeepEqual(outra.PrefixItems[2], map[string]string{"title": "valor"}) {
+		t.Fatalf("parametro sem tipo: %v", outra.PrefixItems[2])
+	}
+
+	// Só as actions com token respondem 401 e 403
+	for nome, token := range map[string]bool{"Buscar": true, "SemDescricao": true, "Publica": false, "Outra": false} {
+		respostas := especificacao.Paths["/acoes/"+nome].Post.Responses
+		if _, existe := respostas["401"]; existe != token {
+			t.Errorf("%s: resposta 401 esperada: %v", nome, token)
+		}
+		if _, existe := respostas["403"]; existe != token {
+			t.Errorf("%s: resposta 403 esperada: %v", nome, token)
+		}
+	}
+}
+
+func TestHandlers(t *testing.T) {
+	esquema, _ := esquemaTeste()
+	casos := map[string]struct {
+		handler http.HandlerFunc
+		tipo    string
+	}{
+		"esquema":  {esquema.ServeJSON, "application/json; charset=utf-8"},
+		"openapi":  {esquema.ServeOpenAPI, "application/json; charset=utf-8"},
+		"markdown": {esquema.ServeMarkdown, "text/markdown; charset=utf-8"},
+	}
+	for nome, caso := range casos {
+		rw := httptest.NewRecorder()
+		caso.handler(rw, httptest.NewRequest(http.MethodGet, "/esquema", nil))
+		if rw.Code != http.StatusOK || rw.Header().Get("Content-Type") != caso.tipo || rw.Body.Len() == 0 {
+			t.Errorf("%s: resposta inesperada %d %s", nome, rw.Code, rw.Header().Get("Content-Type"))
+		}
+	}
+
+	// O esquema em JSON é o mesmo que o serviço descreve
+	rw := httptest.NewRecorder()
+	esquema.ServeJSON(rw, httptest.NewRequest(http.MethodGet, "/esquema", nil))
+	var lido Esquema
+	if err := json.NewDecoder(rw.Body).Decode(&lido); err != nil || !reflect.DeepEqual(lido, esquema) {
+		t.Fatalf("esquema em JSON diferente: %+v (%v)", lido, err)
+	}
+}
@@ -0,0 +1,16 @@
+module github.com/tomascpmarques/PAP/backend/robinpartilhado
+
+go 1.16
+
+require (
+	github.com/BurntSushi/toml v1.2.1
+	github.com/TomascpMarques/dynamic-querys-go v1.3.3
+	github.com/dgrijalva/jwt-go v3.2.0+incompatible
+	github.com/prometheus/client_golang v1.12.2
+	go.opentelemetry.io/otel v1.7.0
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp v1.7.0
+	go.opentelemetry.io/otel/exporters/stdout/stdouttrace v1.7.0
+	go.opentelemetry.io/otel/sdk v1.7.0
+	go.opentelemetry.io/otel/trace v1.7.0
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -0,0 +1,47 @@
+package metricas
+
+import (
+	"reflect"
+	"time"
+)
+
+// Instrumentar Substitui as actions registadas em funcs (normalmente o actions.FuncsStorage) por funções com a mesma assinatura
+// que medem cada chamada: a duração, e se a action devolveu um erro (retorno["erro"] definido) ou entrou em pânico.
+// Tem de ser chamado depois de todas as actions serem registadas
+func (metricas *Metricas) Instrumentar(funcs map[string]interface{}) {
+	for nome, acao := range funcs {
+		funcao := reflect.ValueOf(acao)
+		if funcao.Kind() != reflect.Func {
+			continue
+		}
+		funcs[nome] = metricas.instrumentarAcao(nome, funcao)
+	}
+}
+
+// instrumentarAcao Envolve a action numa função com a mesma assinatura que regista a chamada nas métricas
+func (metricas *Metricas) instrumentarAcao(nome string, funcao reflect.Value) interface{} {
+	return reflect.MakeFunc(funcao.Type(), func(params []reflect.Value) (resultados []reflect.Value) {
+		inicio := time.Now()
+		terminou := false
+		defer func() {
+			// Uma action em pânico conta como erro, o pânico continua para o handler
+			metricas.ObservarAcao(nome, time.Since(inicio), !terminou || retornoComErro(resultados))
+		}()
+		resultados = funcao.Call(params)
+		terminou = true
+		return resultados
+	}).Interface()
+}
+
+// retornoComErro Indica se o primeiro valor devolvido pela action é um map com a key "erro" definida
+func retornoComErro(resultados []reflect.Value) bool {
+	if len(resultados) == 0 {
+		return false
+	}
+	retorno, ok := resultados[0].Interface().(map[string]interface{})
+	if !ok {
+		return false
+	}
+	erro, existe := retorno["erro"]
+	return existe && erro != nil && erro != ""
+}
@@ -0,0 +1,44 @@
+package metricas
+
+import (
+	"net/http"
+	"time"
+)
+
+// transporte RoundTripper que regista a duração e o resultado das chamadas a um serviço
+type transporte struct {
+	metricas *Metricas
+	destino  string
+	base     http.RoundTripper
+}
+
+func (t *transporte) RoundTrip(pedido *http.Request) (*http.Response, error) {
+	inicio := time.Now()
+	resposta, err := t.base.RoundTrip(pedido)
+	estado := 0
+	if err == nil {
+		estado = resposta.StatusCode
+	}
+	t.metricas.ObservarHTTP(t.destino, time.Since(inicio), estado)
+	return resposta, err
+}
+
+// Transporte Envolve o transporte http (http.DefaultTransport se for nil), as chamadas feitas através dele
+// são registadas com o destino indicado (ex: "userinfo")
+func (metricas *Metricas) Transporte(destino string, base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transporte{metricas: metricas, destino: destino, base: base}
+}
+
+// Cliente Cliente http cujas chamadas são registadas com o destino indicado, com o timeout do cliente base
+// (o http.DefaultClient se for nil)
+func (metricas *Metricas) Cliente(destino string, base *http.Client) *http.Client {
+	if base == nil {
+		base = http.DefaultClient
+	}
+	cliente := *base
+	cliente.Transport = metricas.Transporte(destino, base.Transport)
+	return &cliente
+}
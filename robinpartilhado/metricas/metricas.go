@@ -0,0 +1,116 @@
+package metricas
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	// namespace prefixo dos nomes de todas as métricas dos serviços
+	namespace = "robin"
+
+	// ResultadoOk a operação terminou sem erro
+	ResultadoOk = "ok"
+	// ResultadoErro a operação falhou (erro da BD ou da conexão)
+	ResultadoErro = "erro"
+)
+
+// Metricas Métricas prometheus de um serviço: as actions chamadas, as operações na BD e as chamadas http aos outros serviços,
+// expostas no endpoint /metrics (ver Handler)
+type Metricas struct {
+	registo *prometheus.Registry
+
+	acoes       *prometheus.CounterVec
+	errosAcoes  *prometheus.CounterVec
+	duracaoAcao *prometheus.HistogramVec
+	duracaoBD   *prometheus.HistogramVec
+	duracaoHTTP *prometheus.HistogramVec
+}
+
+// Novas Cria as métricas do serviço, todas levam a label servico, com as métricas do runtime go e do processo
+func Novas(servico string) *Metricas {
+	labels := prometheus.Labels{"servico": servico}
+	metricas := &Metricas{
+		registo: prometheus.NewRegistry(),
+		acoes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Name:        "acoes_total",
+			Help:        "Número de actions chamadas, por action",
+			ConstLabels: labels,
+		}, []string{"acao"}),
+		errosAcoes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Name:        "acoes_erros_total",
+			Help:        "Número de actions que devolveram um erro (retorno[\"erro\"]), por action",
+			ConstLabels: labels,
+		}, []string{"acao"}),
+		duracaoAcao: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   namespace,
+			Name:        "acoes_duracao_segundos",
+			Help:        "Duração das actions, por action",
+			ConstLabels: labels,
+			Buckets:     prometheus.DefBuckets,
+		}, []string{"acao"}),
+		duracaoBD: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   namespace,
+			Name:        "bd_operacoes_duracao_segundos",
+			Help:        "Duração das operações na base de dados, por base de dados (mongo ou redis), operação e resultado",
+			ConstLabels: labels,
+			Buckets:     []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		}, []string{"bd", "operacao", "resultado"}),
+		duracaoHTTP: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   namespace,
+			Name:        "http_chamadas_duracao_segundos",
+			Help:        "Duração das chamadas http aos outros serviços, por destino e resultado (classe do estado http, ex: 2xx, ou erro)",
+			ConstLabels: labels,
+			Buckets:     prometheus.DefBuckets,
+		}, []string{"destino", "resultado"}),
+	}
+	metricas.registo.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		metricas.acoes,
+		metricas.errosAcoes,
+		metricas.duracaoAcao,
+		metricas.duracaoBD,
+		metricas.duracaoHTTP,
+	)
+	return metricas
+}
+
+// Handler Handler http do endpoint /metrics, no formato de texto do prometheus
+func (metricas *Metricas) Handler() http.Handler {
+	return promhttp.HandlerFor(metricas.registo, promhttp.HandlerOpts{})
+}
+
+// ObservarAcao Regista uma chamada de uma action, com a duração e se devolveu um erro
+func (metricas *Metricas) ObservarAcao(acao string, duracao time.Duration, erro bool) {
+	metricas.acoes.WithLabelValues(acao).Inc()
+	if erro {
+		metricas.errosAcoes.WithLabelValues(acao).Inc()
+	}
+	metricas.duracaoAcao.WithLabelValues(acao).Observe(duracao.Seconds())
+}
+
+// ObservarBD Regista uma operação na base de dados (ex: "mongo", "find"), err nil se terminou sem erro
+func (metricas *Metricas) ObservarBD(bd string, operacao string, duracao time.Duration, err error) {
+	resultado := ResultadoOk
+	if err != nil {
+		resultado = ResultadoErro
+	}
+	metricas.duracaoBD.WithLabelValues(bd, operacao, resultado).Observe(duracao.Seconds())
+}
+
+// ObservarHTTP Regista uma chamada http a outro serviço, estado é o estado http da resposta (0 se não houve resposta)
+func (metricas *Metricas) ObservarHTTP(destino string, duracao time.Duration, estado int) {
+	resultado := ResultadoErro
+	if estado > 0 {
+		resultado = strconv.Itoa(estado/100) + "xx"
+	}
+	metricas.duracaoHTTP.WithLabelValues(destino, resultado).Observe(duracao.Seconds())
+}
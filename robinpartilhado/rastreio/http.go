@@ -0,0 +1,109 @@
+package rastreio
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/registos"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// CampoTrace campo dos logs com o id do trace do pedido
+const CampoTrace = "trace_id"
+
+// estadoResposta Guarda o estado http escrito pelo handler
+type estadoResposta struct {
+	http.ResponseWriter
+	estado int
+}
+
+func (resposta *estadoResposta) WriteHeader(estado int) {
+	resposta.estado = estado
+	resposta.ResponseWriter.WriteHeader(estado)
+}
+
+// marcarEstado Adiciona o estado http ao span do servidor, os estados 5xx são erros
+func marcarEstado(span trace.Span, estado int) {
+	span.SetAttributes(semconv.HTTPStatusCodeKey.Int(estado))
+	if estado >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(estado))
+	}
+}
+
+// Middleware Cria um span (server) por pedido http, filho do span do serviço que fez o pedido se este enviou
+// o header traceparent. O id do trace é adicionado aos campos dos logs do pedido (ver registos.ComCampos)
+func Middleware(proximo http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := Tracer().Start(ctx, "HTTP "+r.Method+" "+r.URL.Path,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.HTTPMethodKey.String(r.Method), semconv.HTTPTargetKey.String(r.URL.RequestURI())),
+		)
+		defer span.End()
+		if span.SpanContext().HasTraceID() {
+			ctx = registos.ComCampos(ctx, CampoTrace, span.SpanContext().TraceID().String())
+		}
+
+		resposta := &estadoResposta{ResponseWriter: rw, estado: http.StatusOK}
+		proximo.ServeHTTP(resposta, r.WithContext(ctx))
+		marcarEstado(span, resposta.estado)
+	})
+}
+
+// transporte RoundTripper que cria um span (client) por chamada e envia o contexto do trace nos headers
+type transporte struct {
+	destino string
+	base    http.RoundTripper
+}
+
+func (t *transporte) RoundTrip(pedido *http.Request) (*http.Response, error) {
+	ctx, span := Tracer().Start(pedido.Context(), "HTTP "+pedido.Method+" "+t.destino,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPMethodKey.String(pedido.Method),
+			semconv.HTTPURLKey.String(pedido.URL.String()),
+			semconv.PeerServiceKey.String(t.destino),
+		),
+	)
+	defer span.End()
+
+	// O RoundTripper não pode alterar o pedido original
+	copia := pedido.Clone(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(copia.Header))
+	resposta, err := t.base.RoundTrip(copia)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return resposta, err
+	}
+	// Do lado de quem faz a chamada, as respostas 4xx também são erros
+	span.SetAttributes(semconv.HTTPStatusCodeKey.Int(resposta.StatusCode))
+	if resposta.StatusCode >= http.StatusBadRequest {
+		span.SetStatus(codes.Error, "HTTP "+strconv.Itoa(resposta.StatusCode))
+	}
+	return resposta, nil
+}
+
+// Transporte Envolve o transporte http (http.DefaultTransport se for nil), cada chamada a outro serviço (ex: "userinfo")
+// fica num span filho do span do contexto da chamada (http.NewRequestWithContext), e leva o header traceparent
+func Transporte(destino string, base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transporte{destino: destino, base: base}
+}
+
+// Cliente Cliente http cujas chamadas são rastreadas com o destino indicado, com o timeout do cliente base
+// (o http.DefaultClient se for nil)
+func Cliente(destino string, base *http.Client) *http.Client {
+	if base == nil {
+		base = http.DefaultClient
+	}
+	cliente := *base
+	cliente.Transport = Transporte(destino, base.Transport)
+	return &cliente
+}
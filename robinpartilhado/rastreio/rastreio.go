@@ -0,0 +1,166 @@
+package rastreio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// ExportadorOTLP envia os spans a um coletor OpenTelemetry por OTLP/HTTP
+	ExportadorOTLP = "otlp"
+	// ExportadorStdout escreve os spans em JSON no stdout
+	ExportadorStdout = "stdout"
+	// ExportadorFicheiro acrescenta os spans em JSON a um ficheiro, para serem vistos offline
+	ExportadorFicheiro = "ficheiro"
+
+	// nomeInstrumentacao nome do tracer usado pelos serviços
+	nomeInstrumentacao = "github.com/tomascpmarques/PAP/backend/robinpartilhado/rastreio"
+	// namespace namespace dos serviços nos recursos OpenTelemetry (service.namespace)
+	namespace = "robin"
+)
+
+// Config Exportação dos spans de um serviço, parte da configuração de cada serviço (secção rastreio)
+type Config struct {
+	Exportadores []string `conf:"exportadores" desc:"destinos dos spans, separados por virgulas: otlp, stdout ou ficheiro (vazio desliga o rastreio)"`
+	OTLP         string   `conf:"otlp" desc:"endereço (host:porta) do coletor OTLP/HTTP, vazio usa OTEL_EXPORTER_OTLP_ENDPOINT ou localhost:4318"`
+	OTLPInseguro bool     `conf:"otlp_inseguro" desc:"envia os spans ao coletor OTLP por http, sem TLS"`
+	Ficheiro     string   `conf:"ficheiro" desc:"ficheiro onde são acrescentados os spans em JSON, com o exportador ficheiro"`
+	Amostragem   float64  `conf:"amostragem" desc:"fração dos pedidos rastreados, de 0 a 1 (os pedidos de outros serviços seguem a decisão desse serviço)"`
+}
+
+// ConfigDefault Rastreio desligado, todos os pedidos são rastreados quando for ligado
+func ConfigDefault() Config {
+	return Config{Amostragem: 1}
+}
+
+// Validar Verifica os exportadores e a amostragem
+func (config *Config) Validar() error {
+	for _, exportador := range config.Exportadores {
+		switch exportador {
+		case ExportadorOTLP, ExportadorStdout:
+		case ExportadorFicheiro:
+			if config.Ficheiro == "" {
+				return errors.New("o exportador ficheiro precisa do caminho do ficheiro")
+			}
+		default:
+			return fmt.Errorf("exportador de spans desconhecido: %q (otlp, stdout ou ficheiro)", exportador)
+		}
+	}
+	if config.Amostragem < 0 || config.Amostragem > 1 {
+		return errors.New("a amostragem dos spans têm de estar entre 0 e 1")
+	}
+	return nil
+}
+
+// Configurar Define o fornecedor global dos spans do serviço, com os exportadores configurados, e a propagação W3C
+// (headers traceparent, tracestate e baggage). Sem exportadores os spans não são gravados, mas o contexto dos pedidos
+// continua a ser propagado aos outros serviços. Devolve a função que envia os spans em falta e fecha os exportadores,
+// a chamar ao desligar o serviço
+func Configurar(servico string, config Config) (func(ctx context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if len(config.Exportadores) == 0 {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	opcoes := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceNameKey.String(servico),
+			semconv.ServiceNamespaceKey.String(namespace),
+		)),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.Amostragem))),
+	}
+	var ficheiro *os.File
+	for _, nome := range config.Exportadores {
+		var exportador sdktrace.SpanExporter
+		var err error
+		switch nome {
+		case ExportadorOTLP:
+			exportador, err = otlptracehttp.New(context.Background(), opcoesOTLP(config)...)
+		case ExportadorStdout:
+			exportador, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		case ExportadorFicheiro:
+			ficheiro, err = os.OpenFile(config.Ficheiro, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0640)
+			if err == nil {
+				exportador, err = stdouttrace.New(stdouttrace.WithWriter(ficheiro))
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("exportador de spans %s: %v", nome, err)
+		}
+		opcoes = append(opcoes, sdktrace.WithBatcher(exportador))
+	}
+
+	fornecedor := sdktrace.NewTracerProvider(opcoes...)
+	otel.SetTracerProvider(fornecedor)
+	return func(ctx context.Context) error {
+		err := fornecedor.Shutdown(ctx)
+		if ficheiro != nil {
+			if errFicheiro := ficheiro.Close(); err == nil {
+				err = errFicheiro
+			}
+		}
+		return err
+	}, nil
+}
+
+// opcoesOTLP Endereço e segurança do coletor, sem endereço o exportador usa as variáveis OTEL_EXPORTER_OTLP_*
+func opcoesOTLP(config Config) []otlptracehttp.Option {
+	opcoes := make([]otlptracehttp.Option, 0, 2)
+	if config.OTLP != "" {
+		opcoes = append(opcoes, otlptracehttp.WithEndpoint(config.OTLP))
+	}
+	if config.OTLPInseguro {
+		opcoes = append(opcoes, otlptracehttp.WithInsecure())
+	}
+	return opcoes
+}
+
+// Tracer Tracer dos serviços, usa o fornecedor global (ver Configurar)
+func Tracer() trace.Tracer {
+	return otel.Tracer(nomeInstrumentacao)
+}
+
+// Terminar Termina o span de uma operação, err nil se a operação terminou sem erro
+type Terminar func(err error)
+
+// terminar Marca o span com o erro e termina-o
+func terminar(span trace.Span) Terminar {
+	return func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
+// Operacao Inicia o span de uma operação interna do serviço (ex: escrever os ficheiros de um repo), filho do span do contexto.
+// O contexto devolvido leva o span novo, e a operação é terminada com a função devolvida
+func Operacao(ctx context.Context, nome string, atributos ...attribute.KeyValue) (context.Context, Terminar) {
+	ctx, span := Tracer().Start(ctx, nome, trace.WithAttributes(atributos...))
+	return ctx, terminar(span)
+}
+
+// OperacaoBD Inicia o span (client) de uma operação na base de dados, sistema é mongodb ou redis (ver semconv.DBSystemKey),
+// bd o nome da base de dados (vazio se não houver)
+func OperacaoBD(ctx context.Context, sistema string, operacao string, bd string) (context.Context, Terminar) {
+	atributos := []attribute.KeyValue{semconv.DBSystemKey.String(sistema), semconv.DBOperationKey.String(operacao)}
+	if bd != "" {
+		atributos = append(atributos, semconv.DBNameKey.String(bd))
+	}
+	ctx, span := Tracer().Start(ctx, sistema+" "+operacao, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(atributos...))
+	return ctx, terminar(span)
+}
@@ -0,0 +1,46 @@
+package registos
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// chaveIDPedido chave do contexto onde é guardado o id do pedido
+type chaveIDPedido struct{}
+
+// chaveCampos chave do contexto onde são guardados os campos adicionados às linhas
+type chaveCampos struct{}
+
+// ComIDPedido Devolve uma cópia do contexto com o id do pedido, escrito em todas as linhas registadas com o contexto
+// e enviado no header X-Request-ID das chamadas aos outros serviços (ver Transporte)
+func ComIDPedido(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, chaveIDPedido{}, id)
+}
+
+// IDPedido Devolve o id do pedido guardado no contexto, vazio se o contexto não tiver pedido
+func IDPedido(ctx context.Context) string {
+	id, _ := ctx.Value(chaveIDPedido{}).(string)
+	return id
+}
+
+// NovoIDPedido Gera um id de pedido aleatório, 16 bytes em hexadecimal
+func NovoIDPedido() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// ComCampos Devolve uma cópia do contexto com os campos (pares chave, valor) adicionados aos que já tinha,
+// escritos em todas as linhas registadas com o contexto (ex: a action e o user)
+func ComCampos(ctx context.Context, campos ...interface{}) context.Context {
+	anteriores := CamposDe(ctx)
+	todos := append(append(make([]interface{}, 0, len(anteriores)+len(campos)), anteriores...), campos...)
+	return context.WithValue(ctx, chaveCampos{}, todos)
+}
+
+// CamposDe Devolve os campos guardados no contexto
+func CamposDe(ctx context.Context) []interface{} {
+	campos, _ := ctx.Value(chaveCampos{}).([]interface{})
+	return campos
+}
@@ -0,0 +1,117 @@
+package registos
+
+import (
+	"net/http"
+	"time"
+)
+
+// CabecalhoIDPedido header http com o id do pedido, recebido dos clientes e enviado aos outros serviços
+const CabecalhoIDPedido = "X-Request-ID"
+
+// tamanhoMaximoID ids recebidos maiores são substituidos por um id novo
+const tamanhoMaximoID = 128
+
+// caminhosSilenciosos endpoints chamados periodicamente pelos orquestradores e pelo prometheus, registados em Debug
+var caminhosSilenciosos = map[string]bool{"/healthz": true, "/readyz": true, "/metrics": true}
+
+// idValido O id recebido só é usado se for curto e só tiver caracteres imprimiveis sem espaços,
+// para um cliente não conseguir partir as linhas do log
+func idValido(id string) bool {
+	if id == "" || len(id) > tamanhoMaximoID {
+		return false
+	}
+	for _, c := range id {
+		if c <= ' ' || c > '~' || c == '"' || c == '\\' {
+			return false
+		}
+	}
+	return true
+}
+
+// respostaRegistada Guarda o estado http escrito pelo handler
+type respostaRegistada struct {
+	http.ResponseWriter
+	estado int
+}
+
+func (resposta *respostaRegistada) WriteHeader(estado int) {
+	resposta.estado = estado
+	resposta.ResponseWriter.WriteHeader(estado)
+}
+
+func (resposta *respostaRegistada) Write(conteudo []byte) (int, error) {
+	if resposta.estado == 0 {
+		resposta.estado = http.StatusOK
+	}
+	return resposta.ResponseWriter.Write(conteudo)
+}
+
+// Middleware Dá um id a cada pedido http: o do header X-Request-ID, se o cliente (ou o serviço que fez a chamada) o enviou,
+// ou um novo. O id é devolvido no mesmo header, guardado no contexto do pedido (ver IDPedido),
+// e cada pedido é registado no fim com o método, o caminho, o estado e a latência
+func Middleware(registador *Registador, proximo http.Handler) http.Handler {
+	if registador == nil {
+		registador = Padrao
+	}
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		inicio := time.Now()
+		id := r.Header.Get(CabecalhoIDPedido)
+		if !idValido(id) {
+			id = NovoIDPedido()
+		}
+		rw.Header().Set(CabecalhoIDPedido, id)
+		ctx := ComIDPedido(r.Context(), id)
+
+		resposta := &respostaRegistada{ResponseWriter: rw}
+		proximo.ServeHTTP(resposta, r.WithContext(ctx))
+		if resposta.estado == 0 {
+			resposta.estado = http.StatusOK
+		}
+
+		nivel := Info
+		if caminhosSilenciosos[r.URL.Path] && resposta.estado < http.StatusBadRequest {
+			nivel = Debug
+		}
+		registador.Registar(ctx, nivel, "pedido http",
+			"metodo", r.Method,
+			"caminho", r.URL.Path,
+			"estado", resposta.estado,
+			CampoLatencia, time.Since(inicio),
+		)
+	})
+}
+
+// transporte RoundTripper que envia o id do pedido do contexto da chamada no header X-Request-ID
+type transporte struct {
+	base http.RoundTripper
+}
+
+func (t *transporte) RoundTrip(pedido *http.Request) (*http.Response, error) {
+	id := IDPedido(pedido.Context())
+	if id == "" || pedido.Header.Get(CabecalhoIDPedido) != "" {
+		return t.base.RoundTrip(pedido)
+	}
+	// O RoundTripper não pode alterar o pedido original
+	copia := pedido.Clone(pedido.Context())
+	copia.Header.Set(CabecalhoIDPedido, id)
+	return t.base.RoundTrip(copia)
+}
+
+// Transporte Envolve o transporte http (http.DefaultTransport se for nil), as chamadas feitas com o contexto de um pedido
+// (http.NewRequestWithContext) levam o id desse pedido, para os logs dos dois serviços poderem ser relacionados
+func Transporte(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transporte{base: base}
+}
+
+// Cliente Cliente http que envia o id do pedido nas chamadas, com o timeout do cliente base (o http.DefaultClient se for nil)
+func Cliente(base *http.Client) *http.Client {
+	if base == nil {
+		base = http.DefaultClient
+	}
+	cliente := *base
+	cliente.Transport = Transporte(base.Transport)
+	return &cliente
+}
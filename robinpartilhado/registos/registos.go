@@ -0,0 +1,232 @@
+package registos
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Nivel Gravidade de uma linha de log, as linhas abaixo do nível do Registador são ignoradas
+type Nivel int32
+
+const (
+	// Debug detalhes usados só ao investigar um problema (ex: pedidos aos endpoints de saúde)
+	Debug Nivel = -4
+	// Info funcionamento normal do serviço (ex: actions chamadas)
+	Info Nivel = 0
+	// Aviso algo falhou, mas o serviço continua a responder (ex: action que devolveu um erro)
+	Aviso Nivel = 4
+	// Erro falha do serviço ou de uma dependência
+	Erro Nivel = 8
+)
+
+// Campos presentes em todas as linhas, ou adicionados pelos handlers http
+const (
+	CampoHora     = "hora"
+	CampoNivel    = "nivel"
+	CampoMensagem = "msg"
+	CampoIDPedido = "id_pedido"
+	CampoAcao     = "acao"
+	CampoUser     = "user"
+	CampoLatencia = "latencia_ms"
+	CampoErro     = "erro"
+)
+
+const (
+	// campoSemChave chave dos valores sem chave (número impar de campos)
+	campoSemChave = "!SEMCHAVE"
+	// formatoHora RFC 3339 em UTC, com milissegundos
+	formatoHora = "2006-01-02T15:04:05.000Z07:00"
+)
+
+// Padrao Registador usado quando um componente não recebe outro, escreve no stdout a partir do nível Info
+var Padrao = Novo(os.Stdout, Info)
+
+// String Nome do nível, como aparece no campo nivel
+func (nivel Nivel) String() string {
+	switch nivel {
+	case Debug:
+		return "debug"
+	case Info:
+		return "info"
+	case Aviso:
+		return "aviso"
+	case Erro:
+		return "erro"
+	}
+	return fmt.Sprintf("nivel(%d)", int32(nivel))
+}
+
+// NivelDe Converte o nome de um nível (debug, info, aviso ou erro) no Nivel, vazio é Info
+func NivelDe(nome string) (Nivel, error) {
+	switch strings.ToLower(strings.TrimSpace(nome)) {
+	case "debug":
+		return Debug, nil
+	case "", "info":
+		return Info, nil
+	case "aviso", "warn":
+		return Aviso, nil
+	case "erro", "error":
+		return Erro, nil
+	}
+	return Info, fmt.Errorf("nível de log desconhecido: %q (debug, info, aviso ou erro)", nome)
+}
+
+// saida Destino das linhas, partilhado pelos registadores derivados (ver Com) para as linhas não se misturarem
+type saida struct {
+	mutex    sync.Mutex
+	escritor io.Writer
+}
+
+/*
+Registador Logger estruturado, ao estilo do log/slog: cada linha é um objeto JSON com a hora, o nível, a mensagem
+e os campos chave/valor, ex:
+---
+
+	{"hora":"2022-05-01T10:00:00.000Z","nivel":"info","msg":"action chamada","servico":"userinfo","id_pedido":"3f0c...","acao":"BuscarInfoUtilizador","user":"tomas","latencia_ms":2.31}
+
+Os campos vêm por esta ordem: os do registador (ver Com), os do contexto (ver ComCampos), e os da chamada.
+Os erros são escritos com a sua mensagem, e os time.Duration em milissegundos
+*/
+type Registador struct {
+	saida  *saida
+	nivel  *int32
+	campos []interface{}
+}
+
+// Novo Cria um registador que escreve as linhas em escritor, a partir do nível indicado
+func Novo(escritor io.Writer, nivel Nivel) *Registador {
+	minimo := int32(nivel)
+	return &Registador{saida: &saida{escritor: escritor}, nivel: &minimo}
+}
+
+// Com Devolve um registador que adiciona os campos (pares chave, valor) a todas as linhas,
+// partilha a saída e o nível com o original
+func (registador *Registador) Com(campos ...interface{}) *Registador {
+	derivado := *registador
+	derivado.campos = append(append(make([]interface{}, 0, len(registador.campos)+len(campos)), registador.campos...), campos...)
+	return &derivado
+}
+
+// DefinirNivel Muda o nível mínimo das linhas escritas, também nos registadores derivados
+func (registador *Registador) DefinirNivel(nivel Nivel) {
+	atomic.StoreInt32(registador.nivel, int32(nivel))
+}
+
+// Ativo Indica se as linhas do nível são escritas
+func (registador *Registador) Ativo(nivel Nivel) bool {
+	return int32(nivel) >= atomic.LoadInt32(registador.nivel)
+}
+
+// Debug Escreve uma linha de nível Debug, com os campos do contexto e os indicados (pares chave, valor)
+func (registador *Registador) Debug(ctx context.Context, mensagem string, campos ...interface{}) {
+	registador.Registar(ctx, Debug, mensagem, campos...)
+}
+
+// Info Escreve uma linha de nível Info, com os campos do contexto e os indicados (pares chave, valor)
+func (registador *Registador) Info(ctx context.Context, mensagem string, campos ...interface{}) {
+	registador.Registar(ctx, Info, mensagem, campos...)
+}
+
+// Aviso Escreve uma linha de nível Aviso, com os campos do contexto e os indicados (pares chave, valor)
+func (registador *Registador) Aviso(ctx context.Context, mensagem string, campos ...interface{}) {
+	registador.Registar(ctx, Aviso, mensagem, campos...)
+}
+
+// Erro Escreve uma linha de nível Erro, com os campos do contexto e os indicados (pares chave, valor)
+func (registador *Registador) Erro(ctx context.Context, mensagem string, campos ...interface{}) {
+	registador.Registar(ctx, Erro, mensagem, campos...)
+}
+
+// Registar Escreve uma linha do nível indicado, se o nível estiver ativo
+func (registador *Registador) Registar(ctx context.Context, nivel Nivel, mensagem string, campos ...interface{}) {
+	if !registador.Ativo(nivel) {
+		return
+	}
+
+	linha := bytes.NewBufferString("{")
+	escreverCampo(linha, CampoHora, time.Now().UTC().Format(formatoHora), true)
+	escreverCampo(linha, CampoNivel, nivel.String(), false)
+	escreverCampo(linha, CampoMensagem, mensagem, false)
+	escreverCampos(linha, registador.campos)
+	if id := IDPedido(ctx); id != "" {
+		escreverCampo(linha, CampoIDPedido, id, false)
+	}
+	escreverCampos(linha, CamposDe(ctx))
+	escreverCampos(linha, campos)
+	linha.WriteString("}\n")
+
+	registador.saida.mutex.Lock()
+	defer registador.saida.mutex.Unlock()
+	registador.saida.escritor.Write(linha.Bytes())
+}
+
+// escreverCampos Escreve os pares chave, valor, uma chave sem valor fica com a chave !SEMCHAVE, tal como no slog
+func escreverCampos(linha *bytes.Buffer, campos []interface{}) {
+	for i := 0; i < len(campos); i += 2 {
+		if i+1 == len(campos) {
+			escreverCampo(linha, campoSemChave, campos[i], false)
+			break
+		}
+		chave, ok := campos[i].(string)
+		if !ok {
+			chave = fmt.Sprint(campos[i])
+		}
+		escreverCampo(linha, chave, campos[i+1], false)
+	}
+}
+
+// escreverCampo Escreve "chave":valor em JSON (sem escapar <, > e &, para as mensagens ficarem legíveis),
+// os valores que não podem ser convertidos são escritos como texto
+func escreverCampo(linha *bytes.Buffer, chave string, valor interface{}, primeiro bool) {
+	if !primeiro {
+		linha.WriteByte(',')
+	}
+	escreverJSON(linha, chave)
+	linha.WriteByte(':')
+
+	switch v := valor.(type) {
+	case error:
+		valor = v.Error()
+	case time.Duration:
+		valor = float64(v.Microseconds()) / 1000
+	}
+	escreverJSON(linha, valor)
+}
+
+// escreverJSON Escreve o valor em JSON, sem a nova linha do json.Encoder
+func escreverJSON(linha *bytes.Buffer, valor interface{}) {
+	var conteudo bytes.Buffer
+	codificador := json.NewEncoder(&conteudo)
+	codificador.SetEscapeHTML(false)
+	if err := codificador.Encode(valor); err != nil {
+		conteudo.Reset()
+		codificador.Encode(fmt.Sprint(valor))
+	}
+	linha.Write(bytes.TrimRight(conteudo.Bytes(), "\n"))
+}
+
+// escritorLog io.Writer de um log.Logger, cada mensagem passa a ser uma linha do registador
+type escritorLog struct {
+	registador *Registador
+	nivel      Nivel
+}
+
+func (escritor escritorLog) Write(mensagem []byte) (int, error) {
+	escritor.registador.Registar(context.Background(), escritor.nivel, strings.TrimRight(string(mensagem), "\n"))
+	return len(mensagem), nil
+}
+
+// Logger Devolve um *log.Logger cujas mensagens são escritas pelo registador no nível indicado, com o campo componente,
+// usado nos componentes que recebem um log.Logger (ex: http.Server.ErrorLog) e nos loggers de cada serviço
+func (registador *Registador) Logger(nivel Nivel, componente string) *log.Logger {
+	return log.New(escritorLog{registador: registador.Com("componente", componente), nivel: nivel}, "", 0)
+}
@@ -0,0 +1,170 @@
+package saude
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	// EstadoOk a dependência respondeu
+	EstadoOk = "ok"
+	// EstadoFalha a dependência não respondeu, ou respondeu com um erro
+	EstadoFalha = "falha"
+
+	// timeoutDefault tempo máximo de cada verificação, se não for indicado
+	timeoutDefault = time.Second * 2
+)
+
+// Verificacao Verifica se uma dependência do serviço está disponível (ex: ping ao mongo), nil se estiver
+type Verificacao func(ctx context.Context) error
+
+// dependencia Verificação com o nome mostrado na resposta do /readyz
+type dependencia struct {
+	nome        string
+	verificacao Verificacao
+	opcional    bool
+}
+
+// Resultado Estado de uma dependência no /readyz
+type Resultado struct {
+	Estado   string  `json:"estado"`
+	Latencia float64 `json:"latencia_ms"`
+	Erro     string  `json:"erro,omitempty"`
+	Opcional bool    `json:"opcional,omitempty"`
+}
+
+// Resposta Corpo das respostas do /healthz e do /readyz
+type Resposta struct {
+	Estado       string               `json:"estado"`
+	Dependencias map[string]Resultado `json:"dependencias,omitempty"`
+}
+
+// Saude Endpoints de liveness (/healthz) e readiness (/readyz) de um serviço
+type Saude struct {
+	timeout      time.Duration
+	dependencias []dependencia
+}
+
+// Nova Cria os endpoints de saúde, cada verificação têm no máximo timeout para responder (2s se timeout <= 0)
+func Nova(timeout time.Duration) *Saude {
+	if timeout <= 0 {
+		timeout = timeoutDefault
+	}
+	return &Saude{timeout: timeout}
+}
+
+// Adicionar Adiciona uma dependência obrigatória, o serviço não está pronto se ela falhar
+func (saude *Saude) Adicionar(nome string, verificacao Verificacao) {
+	saude.dependencias = append(saude.dependencias, dependencia{nome: nome, verificacao: verificacao})
+}
+
+// AdicionarOpcional Adiciona uma dependência mostrada no /readyz, mas cuja falha não impede o serviço de receber pedidos
+// (ex: outro serviço, usado só por algumas actions)
+func (saude *Saude) AdicionarOpcional(nome string, verificacao Verificacao) {
+	saude.dependencias = append(saude.dependencias, dependencia{nome: nome, verificacao: verificacao, opcional: true})
+}
+
+// Vivo Handler do /healthz, o processo está a responder a pedidos http, não verifica as dependências
+func (saude *Saude) Vivo(rw http.ResponseWriter, r *http.Request) {
+	escreverResposta(rw, http.StatusOK, Resposta{Estado: EstadoOk})
+}
+
+// Pronto Handler do /readyz, verifica todas as dependências em paralelo, responde 503 se uma obrigatória falhar
+func (saude *Saude) Pronto(rw http.ResponseWriter, r *http.Request) {
+	resposta := saude.Verificar(r.Context())
+	estado := http.StatusOK
+	if resposta.Estado != EstadoOk {
+		estado = http.StatusServiceUnavailable
+	}
+	escreverResposta(rw, estado, resposta)
+}
+
+// Verificar Verifica todas as dependências em paralelo, com o timeout de cada verificação
+func (saude *Saude) Verificar(ctx context.Context) Resposta {
+	resposta := Resposta{Estado: EstadoOk, Dependencias: make(map[string]Resultado, len(saude.dependencias))}
+	var mutex sync.Mutex
+	var espera sync.WaitGroup
+	for _, dep := range saude.dependencias {
+		espera.Add(1)
+		go func(dep dependencia) {
+			defer espera.Done()
+			resultado := saude.verificar(ctx, dep)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			resposta.Dependencias[dep.nome] = resultado
+			if resultado.Estado != EstadoOk && !dep.opcional {
+				resposta.Estado = EstadoFalha
+			}
+		}(dep)
+	}
+	espera.Wait()
+	return resposta
+}
+
+// verificar Corre a verificação de uma dependência e mede a latência
+func (saude *Saude) verificar(ctx context.Context, dep dependencia) Resultado {
+	ctx, cancelar := context.WithTimeout(ctx, saude.timeout)
+	defer cancelar()
+
+	inicio := time.Now()
+	err := dep.verificacao(ctx)
+	resultado := Resultado{
+		Estado:   EstadoOk,
+		Latencia: float64(time.Since(inicio).Microseconds()) / 1000,
+		Opcional: dep.opcional,
+	}
+	if err != nil {
+		resultado.Estado = EstadoFalha
+		resultado.Erro = err.Error()
+	}
+	return resultado
+}
+
+// escreverResposta Escreve a resposta em json, as respostas de saúde nunca são guardadas em cache
+func escreverResposta(rw http.ResponseWriter, estado int, resposta Resposta) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.WriteHeader(estado)
+	json.NewEncoder(rw).Encode(&resposta)
+}
+
+// VerificarHTTP Verificação de um serviço http, está disponível se o pedido GET ao endereco responder sem erro (< 400),
+// cliente nil usa o http.DefaultClient
+func VerificarHTTP(cliente *http.Client, endereco string) Verificacao {
+	if cliente == nil {
+		cliente = http.DefaultClient
+	}
+	return func(ctx context.Context) error {
+		pedido, err := http.NewRequestWithContext(ctx, http.MethodGet, endereco, nil)
+		if err != nil {
+			return err
+		}
+		resposta, err := cliente.Do(pedido)
+		if err != nil {
+			return err
+		}
+		resposta.Body.Close()
+		if resposta.StatusCode >= 400 {
+			return fmt.Errorf("%s respondeu %s", endereco, resposta.Status)
+		}
+		return nil
+	}
+}
+
+// URLSaude Endereço do /healthz de outro serviço, a partir do seu endereço base (ex: http://0.0.0.0:8001 -> http://0.0.0.0:8001/healthz),
+// só o /healthz é usado, para a falha de uma dependência não se propagar aos serviços que dependem desse
+func URLSaude(base string) string {
+	endereco, err := url.Parse(base)
+	if err != nil {
+		return base
+	}
+	endereco.Path = "/healthz"
+	endereco.RawQuery = ""
+	return endereco.String()
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/TomascpMarques/dynamic-querys-go/actions"
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/mux"
+	"github.com/rs/cors"
+	acoesdespacho "github.com/tomascpmarques/PAP/backend/robinpartilhado/acoes"
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/autorizacao"
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/ciclovida"
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/esquema"
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/metricas"
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/rastreio"
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/registos"
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/saude"
+	"github.com/tomascpmarques/PAP/backend/robinservicoauth/auditoria"
+	"github.com/tomascpmarques/PAP/backend/robinservicoauth/authhandlers"
+	"github.com/tomascpmarques/PAP/backend/robinservicoauth/loggers"
+	"github.com/tomascpmarques/PAP/backend/robinservicoauth/redishandle"
+)
+
+// As descrições das actions no /esquema (esquemagerado.go) são geradas a partir das funções registadas em registarAcoes
+//go:generate go run github.com/tomascpmarques/PAP/backend/robinpartilhado/cmd/esquemagen
+
+// App Serviço de autenticação montado a partir da configuração: o cliente redis (nil se nenhum armazenamento
+// usar o redis), o Servico com as actions, e o ciclo de vida do servidor http
+type App struct {
+	config   Config
+	redis    *redis.Client
+	metricas *metricas.Metricas
+	esquema  esquema.Esquema
+	servico  *authhandlers.Servico
+	ciclo    *ciclovida.CicloVida
+}
+
+// NovaApp Cria as dependências do serviço (cliente redis, armazenamento dos users, registo de auditoria)
+// e o servidor http, as actions ficam registadas no actions.FuncsStorage
+func NovaApp(config Config) (*App, error) {
+	loggers.Registador.DefinirNivel(config.Servidor.NivelLogs())
+	desligarRastreio, err := rastreio.Configurar("auth", config.Rastreio)
+	if err != nil {
+		return nil, err
+	}
+
+	app := &App{config: config, metricas: metricas.Novas("auth")}
+	// Setup do cliente do serviço redisDB, só se os users, o estado ou a auditoria forem guardados no redis
+	if usaRedis(config) {
+		cliente, err := redishandle.NovoClienteRedis(
+			config.Redis.Endereco,
+			strconv.Itoa(config.Redis.Porta),
+			config.Redis.Password,
+			config.Redis.User,
+			config.Redis.DB,
+		)
+		if err != nil {
+			return nil, err
+		}
+		app.redis = cliente
+		app.redis.AddHook(redishandle.HookMetricas(app.metricas))
+		app.redis.AddHook(redishandle.HookRastreio())
+	}
+
+	users, err := authhandlers.NovoUserStore(config.Handlers.UserStore, app.redis, loggers.LoginRedisLogger)
+	if err != nil {
+		return nil, err
+	}
+	estado, err := authhandlers.NovoEstado(config.Handlers.BackendEstado(), app.redis)
+	if err != nil {
+		return nil, err
+	}
+	registoAuditoria, err := auditoria.NovoRegisto(app.redis, config.Auditoria)
+	if err != nil {
+		return nil, err
+	}
+	app.servico = authhandlers.NovoServico(config.Handlers, authhandlers.Dependencias{
+		Estado:      estado,
+		Users:       users,
+		Auditoria:   registoAuditoria,
+		HTTP:        registos.Cliente(app.metricas.Cliente("userinfo", rastreio.Cliente("userinfo", nil))),
+		Logger:      loggers.LoginAuthLogger,
+		LoggerErros: loggers.LoginServerErrorLogger,
+		LoggerBD:    loggers.LoginRedisLogger,
+		Registador:  loggers.Registador,
+
+		ConfiarProxy: config.Servidor.ConfiarProxy,
+	})
+
+	app.registarAcoes()
+	servidor := &http.Server{
+		Handler:      app.handler(),                  // Gestor dos requests ao entrar no servidor
+		Addr:         config.Servidor.Morada(),       // Localização do web server, ip + port combo
+		WriteTimeout: config.Servidor.TimeoutEscrita, // Se o pedido demorar mais a escrever o conteúdo fecha a conexão
+		ReadTimeout:  config.Servidor.TimeoutLeitura, // Se o servidor demorar mais a ler o request, fecha a conexão
+		IdleTimeout:  config.Servidor.TimeoutInativo, // Quando keep-alive estiver especificado, se a próxima conec. demorar mais fecha
+		ErrorLog:     loggers.LoginServerErrorLogger, // Logger dos erros de servidor
+	}
+
+	// Ao desligar, os pedidos em curso terminam antes do varrimento das contas parar,
+	// e o registo de auditoria é fechado antes do cliente redis, os últimos spans são enviados no fim
+	app.ciclo = ciclovida.Novo(servidor, config.Servidor.Desligar, loggers.Registador.Logger(registos.Info, "servidor"))
+	app.ciclo.Tarefa(func(ctx context.Context) {
+		// As contas temporárias cujo prazo passou são expiradas em segundo plano
+		app.servico.VarrerContasPeriodicamente(ctx, config.Handlers.VarrimentoContas)
+	})
+	app.ciclo.AoDesligar("rastreio", desligarRastreio)
+	app.ciclo.AoDesligar("auditoria", func(context.Context) error {
+		return registoAuditoria.Fechar()
+	})
+	if app.redis != nil {
+		app.ciclo.AoDesligar("redis", func(context.Context) error {
+			return app.redis.Close()
+		})
+	}
+	return app, nil
+}
+
+// usaRedis Indica se algum dos armazenamentos configurados (users, estado ou auditoria) precisa do redis
+func usaRedis(config Config) bool {
+	for _, backend := range []string{config.Handlers.UserStore, config.Handlers.BackendEstado(), config.Auditoria.Tipo} {
+		if backend == "" || backend == authhandlers.BackendRedis {
+			return true
+		}
+	}
+	return false
+}
+
+// registarAcoes Mapeamento das funções desponíveis aos action requests, cada uma com a politica de autorização
+// que a token têm de cumprir
+func (app *App) registarAcoes() {
+	servico := app.servico
+	acoes := autorizacao.Acoes{Funcs: actions.FuncsStorage, Verificador: servico.Autorizacao(), Politicas: make(map[string]autorizacao.Politica)}
+	publica := autorizacao.Politica{Publica: true}
+	gerirUsers := autorizacao.Politica{Permissoes: []string{authhandlers.PermGerirUsers}}
+	gerirRoles := autorizacao.Politica{Permissoes: []string{authhandlers.PermGerirRoles}}
+
+	acoes.Registar("VerificarTokensParaReAuth", servico.VerificarTokenReAuth, publica)
+	acoes.Registar("VerificarUserExiste", servico.VerificarUserExiste, autorizacao.Politica{Perms: autorizacao.USER})
+	acoes.Registar("VerificarTokenAdmin", servico.VerificarTokenAdmin, publica)
+	acoes.Registar("VerificarTokenUser", servico.VerificarTokenUser, publica)
+	acoes.Registar("SessActualStatus", servico.SessActualStatus, autorizacao.Politica{Dono: 2})
+	acoes.Registar("AtualizarUser", servico.AtualizarUser, gerirUsers)
+	acoes.Registar("MudarPassword", servico.MudarPassword, publica)
+	acoes.Registar("ApagarUser", servico.ApagarUser, gerirUsers)
+	acoes.Registar("ListarUsers", servico.ListarUsers, autorizacao.Politica{Permissoes: []string{authhandlers.PermVerUsers}})
+	acoes.Registar("Registar", servico.Registar, gerirUsers)
+	acoes.Registar("RevogarTokens", servico.RevogarTokens, autorizacao.Politica{Perms: autorizacao.USER})
+	acoes.Registar("RenovarToken", servico.RenovarToken, publica)
+	acoes.Registar("RodarChaves", servico.RodarChaves, autorizacao.Politica{Permissoes: []string{authhandlers.PermGerirChaves}})
+	acoes.Registar("Logout", servico.Logout, publica)
+	acoes.Registar("Login", servico.Login, publica)
+
+	// Segundo fator (TOTP), as tokens são verificadas nas actions por poderem ser tokens parciais
+	acoes.Registar("IniciarTOTP", servico.IniciarTOTP, publica)
+	acoes.Registar("ConfirmarTOTP", servico.ConfirmarTOTP, publica)
+	acoes.Registar("VerificarTOTP", servico.VerificarTOTP, publica)
+	acoes.Registar("NovosCodigosRecuperacao", servico.NovosCodigosRecuperacao, autorizacao.Politica{Perms: autorizacao.USER})
+	acoes.Registar("DesativarTOTP", servico.DesativarTOTP, autorizacao.Politica{Perms: autorizacao.USER})
+
+	// Reset da password pelo próprio user
+	acoes.Registar("PedirResetPassword", servico.PedirResetPassword, publica)
+	acoes.Registar("ConcluirResetPassword", servico.ConcluirResetPassword, publica)
+	acoes.Registar("MudarEmail", servico.MudarEmail, autorizacao.Politica{Perms: autorizacao.USER})
+
+	// Falhas e bloqueios de login
+	acoes.Registar("ListarBloqueiosLogin", servico.ListarBloqueiosLogin, autorizacao.Politica{Permissoes: []string{authhandlers.PermVerUsers}})
+	acoes.Registar("DesbloquearLogin", servico.DesbloquearLogin, gerirUsers)
+
+	// Ciclo de vida das contas, os dados dos users desativados são mantidos
+	acoes.Registar("ConvidarUser", servico.ConvidarUser, gerirUsers)
+	acoes.Registar("DesativarUser", servico.DesativarUser, gerirUsers)
+	acoes.Registar("BloquearUser", servico.BloquearUser, gerirUsers)
+	acoes.Registar("ReativarUser", servico.ReativarUser, gerirUsers)
+	acoes.Registar("DefinirExpiracaoUser", servico.DefinirExpiracaoUser, gerirUsers)
+
+	// Eventos de segurança (logins, registos, permissões, revogações)
+	acoes.Registar("ConsultarAuditoria", servico.ConsultarAuditoria, autorizacao.Politica{Permissoes: []string{authhandlers.PermVerAuditoria}})
+
+	// Contas de serviço, usadas nas chamadas entre serviços, a gestão é exclusiva do ROOT
+	gerirServicos := autorizacao.Politica{Permissoes: []string{authhandlers.PermGerirServicos}}
+	acoes.Registar("CriarContaServico", servico.CriarContaServico, gerirServicos)
+	acoes.Registar("RodarSegredoServico", servico.RodarSegredoServico, gerirServicos)
+	acoes.Registar("ApagarContaServico", servico.ApagarContaServico, gerirServicos)
+	acoes.Registar("ListarContasServico", servico.ListarContasServico, gerirServicos)
+
+	// Gestão dos roles, a definição de roles é exclusiva do ROOT
+	acoes.Registar("ListarRoles", servico.ListarRoles, gerirRoles)
+	acoes.Registar("AtribuirRole", servico.AtribuirRole, gerirRoles)
+	acoes.Registar("RetirarRole", servico.RetirarRole, gerirRoles)
+	acoes.Registar("DefinirRole", servico.DefinirRole, autorizacao.Politica{Permissoes: []string{authhandlers.PermGerirAdmins}})
+
+	// Cada chamada às actions é medida, o /metrics mostra as chamadas, os erros e a duração de cada action
+	app.metricas.Instrumentar(actions.FuncsStorage)
+	app.descreverAcoes(acoes.Politicas)
+}
+
+// descreverAcoes Cria o esquema das actions servido no /esquema, as descrições desatualizadas (ver go generate) são avisadas no arranque
+func (app *App) descreverAcoes(politicas map[string]autorizacao.Politica) {
+	var avisos []string
+	app.esquema, avisos = esquema.Novo("auth", actions.FuncsStorage, politicas, descricoesAcoes)
+	for _, aviso := range avisos {
+		loggers.Registador.Aviso(context.Background(), "esquema das actions desatualizado", registos.CampoErro, aviso)
+	}
+}
+
+// handler Rotas do serviço, com as defenições de partilha de recursos cruzada
+func (app *App) handler() http.Handler {
+	router := mux.NewRouter()
+	// As actions recebem o contexto do pedido (IP do cliente), usado na proteção do login,
+	// e cada action é registada com o id do pedido, o user e a latência
+	despachante := &acoesdespacho.Despachante{
+		Funcs:        actions.FuncsStorage,
+		Registador:   loggers.Registador,
+		Utilizador:   app.servico.Autorizacao().Utilizador,
+		ConfiarProxy: app.config.Servidor.ConfiarProxy,
+	}
+	router.Handle("/", despachante)
+	// As mesmas actions com os parametros em JSON, chamadas pelo gateway REST
+	router.HandleFunc(acoesdespacho.RotaJSON+"{acao}", despachante.ServeJSON).Methods(http.MethodPost)
+	// Endpoint usado pelos outros serviços para verificar se uma token foi revogada
+	router.HandleFunc("/introspecao", app.servico.IntrospecaoHandler).Methods(http.MethodPost)
+	// Emissão das tokens das contas de serviço (client credentials)
+	router.HandleFunc("/token", app.servico.TokenServicoHandler).Methods(http.MethodPost)
+	// Chaves públicas usadas pelos outros serviços para verificar as tokens
+	router.HandleFunc("/.well-known/jwks.json", app.servico.JWKSHandler).Methods(http.MethodGet)
+	// Liveness e readiness, usados pelo docker-compose e pelos orquestradores
+	verificacoes := app.verificacoesSaude()
+	router.HandleFunc("/healthz", verificacoes.Vivo).Methods(http.MethodGet)
+	router.HandleFunc("/readyz", verificacoes.Pronto).Methods(http.MethodGet)
+	// Métricas prometheus das actions, do redis e das chamadas ao serviço userinfo
+	router.Handle("/metrics", app.metricas.Handler()).Methods(http.MethodGet)
+	// Esquema das actions (parametros, autorização e keys do retorno), e a documentação gerada a partir dele
+	router.HandleFunc("/esquema", app.esquema.ServeJSON).Methods(http.MethodGet)
+	router.HandleFunc("/esquema/openapi.json", app.esquema.ServeOpenAPI).Methods(http.MethodGet)
+	router.HandleFunc("/esquema/acoes.md", app.esquema.ServeMarkdown).Methods(http.MethodGet)
+
+	corsOptions := cors.New(cors.Options{
+		AllowedOrigins:   app.config.Servidor.CORS.Origens, // Só as origens configuradas podem fazer requests ao serviço
+		AllowCredentials: app.config.Servidor.CORS.Credenciais,
+		AllowedHeaders:   []string{"Origin", "Accept", "Content-Type", "X-Requested-With", registos.CabecalhoIDPedido},
+		ExposedHeaders:   []string{registos.CabecalhoIDPedido},
+	})
+	// O id do pedido (X-Request-ID) é dado antes do CORS, para todos os pedidos serem registados,
+	// e cada pedido fica num span, continuado a partir do header traceparent
+	return registos.Middleware(loggers.Registador, rastreio.Middleware(corsOptions.Handler(router)))
+}
+
+// verificacoesSaude Dependências verificadas no /readyz, o serviço só está pronto com o redis (se for usado),
+// o serviço userinfo só é usado nas mudanças de nome
+func (app *App) verificacoesSaude() *saude.Saude {
+	verificacoes := saude.Nova(0)
+	if app.redis != nil {
+		verificacoes.Adicionar("redis", func(ctx context.Context) error {
+			return app.redis.Ping(ctx).Err()
+		})
+	}
+	verificacoes.AdicionarOpcional("userinfo", saude.VerificarHTTP(nil, saude.URLSaude(app.config.Handlers.URLUserinfo)))
+	return verificacoes
+}
+
+// Executar Prepara a BD e serve os pedidos até o serviço ser desligado (SIGINT/SIGTERM ou fim do contexto),
+// as contas expiradas são procuradas em segundo plano enquanto o servidor estiver ativo
+func (app *App) Executar(ctx context.Context) error {
+	if err := app.servico.Iniciar(); err != nil {
+		return err
+	}
+	return app.ciclo.Executar(ctx)
+}
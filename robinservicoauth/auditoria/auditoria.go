@@ -0,0 +1,135 @@
+package auditoria
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// ResultadoSucesso a operação foi feita
+	ResultadoSucesso = "sucesso"
+	// ResultadoFalha a operação foi recusada ou falhou
+	ResultadoFalha = "falha"
+
+	// retencaoDefault tempo que os eventos são guardados, se a retenção não for configurada
+	retencaoDefault = time.Hour * 24 * 90
+	// intervaloLimpeza intervalo mínimo entre duas limpezas dos eventos mais antigos que a retenção
+	intervaloLimpeza = time.Hour
+)
+
+// Evento Operação relevante para a segurança do serviço (logins, registos, permissões, revogações, ...)
+type Evento struct {
+	ID        string                 `json:"id,omitempty"` // Atribuido pelo registo (ex: id da entrada na stream redis)
+	Momento   time.Time              `json:"momento"`
+	Tipo      string                 `json:"tipo"`
+	Ator      string                 `json:"ator,omitempty"` // User que fez a operação, vazio se não se souber (ex: login falhado)
+	Alvo      string                 `json:"alvo,omitempty"` // User ou recurso afetado pela operação
+	IP        string                 `json:"ip,omitempty"`
+	Resultado string                 `json:"resultado"`
+	Detalhes  map[string]interface{} `json:"detalhes,omitempty"`
+}
+
+// Filtro Critérios da consulta dos eventos, os campos vazios não filtram
+type Filtro struct {
+	Desde  time.Time
+	Ate    time.Time
+	Ator   string
+	Tipo   string
+	Limite int // Número máximo de eventos devolvidos, os mais recentes primeiro
+}
+
+// aceita Verifica se o evento cumpre o filtro
+func (filtro Filtro) aceita(evento Evento) bool {
+	switch {
+	case !filtro.Desde.IsZero() && evento.Momento.Before(filtro.Desde):
+		return false
+	case !filtro.Ate.IsZero() && evento.Momento.After(filtro.Ate):
+		return false
+	case filtro.Ator != "" && evento.Ator != filtro.Ator:
+		return false
+	case filtro.Tipo != "" && evento.Tipo != filtro.Tipo:
+		return false
+	}
+	return true
+}
+
+// Registo Guarda os eventos de auditoria, só acrescenta (os eventos não são alterados),
+// e apaga os eventos mais antigos que a retenção
+type Registo interface {
+	// Registar Acrescenta o evento ao registo
+	Registar(evento Evento) error
+	// Consultar Devolve os eventos que cumprem o filtro, os mais recentes primeiro
+	Consultar(filtro Filtro) ([]Evento, error)
+	// Aparar Apaga os eventos anteriores a antes, devolve o número de eventos apagados
+	Aparar(antes time.Time) (int64, error)
+	// Fechar Guarda os eventos pendentes, chamado quando o serviço desliga
+	Fechar() error
+}
+
+// limpeza Controla a aplicação da retenção, feita pelos registos no máximo uma vez por intervaloLimpeza
+type limpeza struct {
+	mutex    sync.Mutex
+	retencao time.Duration
+	ultima   time.Time
+}
+
+// devida Indica se está na altura de apagar os eventos antigos, e devolve o limite dos eventos a manter
+func (l *limpeza) devida(agora time.Time) (bool, time.Time) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.retencao <= 0 || agora.Sub(l.ultima) < intervaloLimpeza {
+		return false, time.Time{}
+	}
+	l.ultima = agora
+	return true, agora.Add(-l.retencao)
+}
+
+// Config Configuração do registo de auditoria, secção auditoria da configuração do serviço
+type Config struct {
+	Tipo     string        `conf:"tipo" env:"AUTH_AUDITORIA" desc:"onde são guardados os eventos de auditoria: redis ou ficheiro"`
+	Ficheiro string        `conf:"ficheiro" desc:"ficheiro JSONL dos eventos, com o tipo ficheiro"`
+	Retencao time.Duration `conf:"retencao" desc:"tempo que os eventos são guardados, 0 guarda sempre"`
+	Max      int64         `conf:"max" desc:"número máximo de eventos na stream redis, 0 sem limite"`
+}
+
+// ConfigDefault Eventos na stream redis, guardados durante 90 dias
+func ConfigDefault() Config {
+	return Config{Tipo: "redis", Retencao: retencaoDefault}
+}
+
+// Validar Verifica o tipo de registo e os limites
+func (config *Config) Validar() error {
+	switch config.Tipo {
+	case "", "redis":
+	case "ficheiro":
+		if config.Ficheiro == "" {
+			return errors.New("o registo de auditoria em ficheiro precisa do caminho do ficheiro")
+		}
+	default:
+		return fmt.Errorf("registo de auditoria desconhecido: %s", config.Tipo)
+	}
+	if config.Retencao < 0 || config.Max < 0 {
+		return errors.New("a retenção e o máximo de eventos não podem ser negativos")
+	}
+	return nil
+}
+
+// NovoRegisto Cria o registo de auditoria escolhido na configuração:
+//
+//	"redis" (default) - eventos na stream redis auditoria, no redis do cliente
+//	"ficheiro" - eventos em json, um por linha, acrescentados ao ficheiro config.Ficheiro
+//
+// Os eventos são guardados durante config.Retencao (0 guarda sempre)
+func NovoRegisto(cliente *redis.Client, config Config) (Registo, error) {
+	switch config.Tipo {
+	case "", "redis":
+		return NovoRegistoRedis(cliente, config.Retencao, config.Max), nil
+	case "ficheiro":
+		return NovoRegistoFicheiro(config.Ficheiro, config.Retencao)
+	}
+	return nil, fmt.Errorf("registo de auditoria desconhecido: %s", config.Tipo)
+}
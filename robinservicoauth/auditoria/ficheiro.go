@@ -0,0 +1,162 @@
+package auditoria
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// errRegistoFechado o serviço está a desligar, e o registo já não aceita eventos
+var errRegistoFechado = errors.New("registo de auditoria fechado")
+
+// RegistoFicheiro Acrescenta os eventos a um ficheiro, um evento em json por linha (JSONL)
+type RegistoFicheiro struct {
+	mutex   sync.Mutex
+	caminho string
+	limpeza *limpeza
+	fechado bool
+}
+
+// NovoRegistoFicheiro Cria o registo no ficheiro, que é criado se não existir
+func NovoRegistoFicheiro(caminho string, retencao time.Duration) (*RegistoFicheiro, error) {
+	if caminho == "" {
+		return nil, errors.New("o registo de auditoria em ficheiro precisa de AUTH_AUDITORIA_FICHEIRO")
+	}
+	ficheiro, err := os.OpenFile(caminho, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	ficheiro.Close()
+
+	return &RegistoFicheiro{caminho: caminho, limpeza: &limpeza{retencao: retencao}}, nil
+}
+
+// Registar Acrescenta o evento ao fim do ficheiro, e apaga os eventos antigos se estiver na altura
+func (registo *RegistoFicheiro) Registar(evento Evento) error {
+	conteudo, err := json.Marshal(&evento)
+	if err != nil {
+		return err
+	}
+
+	registo.mutex.Lock()
+	if registo.fechado {
+		registo.mutex.Unlock()
+		return errRegistoFechado
+	}
+	ficheiro, err := os.OpenFile(registo.caminho, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err == nil {
+		_, err = ficheiro.Write(append(conteudo, '\n'))
+		ficheiro.Close()
+	}
+	registo.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if devida, antes := registo.limpeza.devida(evento.Momento); devida {
+		_, err = registo.Aparar(antes)
+	}
+	return err
+}
+
+// Consultar Lê o ficheiro todo, e devolve os eventos que cumprem o filtro, os mais recentes primeiro
+func (registo *RegistoFicheiro) Consultar(filtro Filtro) ([]Evento, error) {
+	registo.mutex.Lock()
+	defer registo.mutex.Unlock()
+
+	eventos := make([]Evento, 0)
+	err := registo.ler(func(evento Evento) {
+		if filtro.aceita(evento) {
+			eventos = append(eventos, evento)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(eventos)-1; i < j; i, j = i+1, j-1 {
+		eventos[i], eventos[j] = eventos[j], eventos[i]
+	}
+	if filtro.Limite > 0 && len(eventos) > filtro.Limite {
+		eventos = eventos[:filtro.Limite]
+	}
+	return eventos, nil
+}
+
+// Aparar Reescreve o ficheiro só com os eventos a partir de antes, o ficheiro novo substitui o antigo
+// de uma vez (rename), para não se perderem eventos se o serviço parar a meio
+func (registo *RegistoFicheiro) Aparar(antes time.Time) (int64, error) {
+	registo.mutex.Lock()
+	defer registo.mutex.Unlock()
+
+	temporario, err := os.CreateTemp(filepath.Dir(registo.caminho), filepath.Base(registo.caminho)+".*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(temporario.Name())
+
+	escritor := bufio.NewWriter(temporario)
+	var apagados int64
+	err = registo.ler(func(evento Evento) {
+		if evento.Momento.Before(antes) {
+			apagados++
+			return
+		}
+		conteudo, _ := json.Marshal(&evento)
+		escritor.Write(append(conteudo, '\n'))
+	})
+	if err == nil {
+		err = escritor.Flush()
+	}
+	if errFechar := temporario.Close(); err == nil {
+		err = errFechar
+	}
+	if err != nil || apagados == 0 {
+		return 0, err
+	}
+	return apagados, os.Rename(temporario.Name(), registo.caminho)
+}
+
+// Fechar Espera pela escrita em curso e passa o ficheiro para o disco, os eventos registados depois são recusados
+func (registo *RegistoFicheiro) Fechar() error {
+	registo.mutex.Lock()
+	defer registo.mutex.Unlock()
+	if registo.fechado {
+		return nil
+	}
+	registo.fechado = true
+
+	ficheiro, err := os.OpenFile(registo.caminho, os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	err = ficheiro.Sync()
+	if errFechar := ficheiro.Close(); err == nil {
+		err = errFechar
+	}
+	return err
+}
+
+// ler Chama funcao para cada evento do ficheiro, pela ordem em que foram registados.
+// As linhas inválidas (ex: escrita interrompida) são ignoradas
+func (registo *RegistoFicheiro) ler(funcao func(evento Evento)) error {
+	ficheiro, err := os.Open(registo.caminho)
+	if err != nil {
+		return err
+	}
+	defer ficheiro.Close()
+
+	linhas := bufio.NewScanner(ficheiro)
+	linhas.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for linhas.Scan() {
+		var evento Evento
+		if json.Unmarshal(linhas.Bytes(), &evento) == nil {
+			funcao(evento)
+		}
+	}
+	return linhas.Err()
+}
@@ -0,0 +1,126 @@
+package auditoria
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// streamAuditoria key da stream redis com os eventos
+	streamAuditoria = "auditoria"
+	// loteConsulta número de entradas lidas da stream de cada vez, durante uma consulta
+	loteConsulta = 500
+)
+
+// RegistoRedis Guarda os eventos numa stream redis, com o evento em json no campo "evento".
+// Os ids das entradas têm o momento em milisegundos, usado nas consultas por intervalo de tempo
+type RegistoRedis struct {
+	cliente    *redis.Client
+	maxEventos int64 // Tamanho máximo aproximado da stream, 0 sem limite
+	limpeza    *limpeza
+}
+
+// NovoRegistoRedis Cria o registo na stream auditoria, os eventos mais antigos que a retenção são apagados
+func NovoRegistoRedis(cliente *redis.Client, retencao time.Duration, maxEventos int64) *RegistoRedis {
+	return &RegistoRedis{
+		cliente:    cliente,
+		maxEventos: maxEventos,
+		limpeza:    &limpeza{retencao: retencao},
+	}
+}
+
+// Registar Acrescenta o evento à stream, e apaga os eventos antigos se estiver na altura
+func (registo *RegistoRedis) Registar(evento Evento) error {
+	conteudo, err := json.Marshal(&evento)
+	if err != nil {
+		return err
+	}
+
+	err = registo.cliente.XAdd(context.Background(), &redis.XAddArgs{
+		Stream:       streamAuditoria,
+		MaxLenApprox: registo.maxEventos,
+		Values:       map[string]interface{}{"evento": string(conteudo)},
+	}).Err()
+	if err != nil {
+		return err
+	}
+
+	if devida, antes := registo.limpeza.devida(evento.Momento); devida {
+		_, err = registo.Aparar(antes)
+	}
+	return err
+}
+
+// Consultar Lê a stream do fim para o início, dentro do intervalo de tempo do filtro, até ter filtro.Limite eventos
+func (registo *RegistoRedis) Consultar(filtro Filtro) ([]Evento, error) {
+	inicio, fim := "-", "+"
+	if !filtro.Desde.IsZero() {
+		inicio = strconv.FormatInt(filtro.Desde.UnixNano()/int64(time.Millisecond), 10)
+	}
+	if !filtro.Ate.IsZero() {
+		fim = strconv.FormatInt(filtro.Ate.UnixNano()/int64(time.Millisecond), 10)
+	}
+
+	eventos := make([]Evento, 0)
+	for {
+		entradas, err := registo.cliente.XRevRangeN(context.Background(), streamAuditoria, fim, inicio, loteConsulta).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, entrada := range entradas {
+			conteudo, _ := entrada.Values["evento"].(string)
+			var evento Evento
+			if json.Unmarshal([]byte(conteudo), &evento) != nil {
+				continue
+			}
+			evento.ID = entrada.ID
+			if !filtro.aceita(evento) {
+				continue
+			}
+			eventos = append(eventos, evento)
+			if filtro.Limite > 0 && len(eventos) >= filtro.Limite {
+				return eventos, nil
+			}
+		}
+		if len(entradas) < loteConsulta {
+			return eventos, nil
+		}
+		fim = idAnterior(entradas[len(entradas)-1].ID)
+	}
+}
+
+// Aparar Apaga as entradas da stream com id anterior ao momento antes (XTRIM MINID, redis 6.2 ou superior)
+func (registo *RegistoRedis) Aparar(antes time.Time) (int64, error) {
+	minimo := strconv.FormatInt(antes.UnixNano()/int64(time.Millisecond), 10)
+	return registo.cliente.Do(context.Background(), "xtrim", streamAuditoria, "minid", minimo).Int64()
+}
+
+// Fechar Os eventos são escritos na stream no Registar, não há eventos pendentes,
+// o cliente redis é fechado por quem o criou
+func (registo *RegistoRedis) Fechar() error {
+	return nil
+}
+
+// idAnterior Devolve o id imediatamente anterior ao id da stream (<ms>-<seq>), para continuar uma leitura
+// sem repetir a última entrada
+func idAnterior(id string) string {
+	partes := strings.SplitN(id, "-", 2)
+	ms, _ := strconv.ParseUint(partes[0], 10, 64)
+	var seq uint64
+	if len(partes) == 2 {
+		seq, _ = strconv.ParseUint(partes[1], 10, 64)
+	}
+	if seq > 0 {
+		return fmt.Sprintf("%d-%d", ms, seq-1)
+	}
+	if ms == 0 {
+		return "0-0"
+	}
+	return fmt.Sprintf("%d-%d", ms-1, uint64(1<<64-1))
+}
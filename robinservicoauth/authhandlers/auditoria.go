@@ -0,0 +1,163 @@
+package authhandlers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/acoes"
+	"github.com/tomascpmarques/PAP/backend/robinservicoauth/auditoria"
+)
+
+// Tipos dos eventos de auditoria
+const (
+	EventoLogin             = "login"
+	EventoLogin2FA          = "login_2fa"
+	EventoLogout            = "logout"
+	EventoRegisto           = "registo"
+	EventoUserAlterado      = "user_alterado"
+	EventoUserApagado       = "user_apagado"
+	EventoRoleAtribuido     = "role_atribuido"
+	EventoRoleRetirado      = "role_retirado"
+	EventoRoleDefinido      = "role_definido"
+	EventoTokensRevogadas   = "tokens_revogadas"
+	EventoPasswordAlterada  = "password_alterada"
+	EventoResetPedido       = "reset_password_pedido"
+	EventoResetConcluido    = "reset_password_concluido"
+	EventoEmailAlterado     = "email_alterado"
+	EventoTOTPAtivado       = "totp_ativado"
+	EventoTOTPDesativado    = "totp_desativado"
+	EventoLoginDesbloqueado = "login_desbloqueado"
+	EventoChavesRodadas     = "chaves_rodadas"
+	EventoUserDesativado    = "user_desativado"
+	EventoUserBloqueado     = "user_bloqueado"
+	EventoUserReativado     = "user_reativado"
+	EventoUserConvidado     = "user_convidado"
+	EventoExpiracaoDefinida = "expiracao_definida"
+	EventoContaExpirada     = "conta_expirada"
+
+	EventoContaServicoCriada   = "conta_servico_criada"
+	EventoContaServicoApagada  = "conta_servico_apagada"
+	EventoSegredoServicoRodado = "segredo_servico_rodado"
+	EventoTokenServico         = "token_servico"
+)
+
+const (
+	// limiteConsultaAuditoria número de eventos devolvidos, se a consulta não indicar o limite
+	limiteConsultaAuditoria = 100
+	// maximoConsultaAuditoria número máximo de eventos devolvidos por consulta
+	maximoConsultaAuditoria = 1000
+	// atorSistema ator dos eventos feitos pelo próprio serviço
+	atorSistema = "sistema"
+)
+
+// atorToken Devolve o user dono da token (de acesso, refresh ou parcial), ou o sujeito (svc:<conta>)
+// se for uma token de serviço, vazio se a token não for válida
+func (servico *Servico) atorToken(token string) string {
+	claims, err := servico.autorizacao.Claims(token)
+	if err != nil {
+		return ""
+	}
+	if claims.Servico() {
+		return claims.Sujeito
+	}
+	return claims.User
+}
+
+// auditarAcao Regista o evento da action, chamado com defer para ver o retorno final: o resultado é falha
+// se o retorno tiver um erro (numa das keys acoes.ChavesErro). O ator é o dono da token, se não houver token (ex: login)
+// é o alvo, mas só se a operação tiver sucesso
+func (servico *Servico) auditarAcao(ctx context.Context, tipo string, token string, alvo string, retorno map[string]interface{}, detalhes map[string]interface{}) {
+	if servico.auditoria == nil {
+		return
+	}
+
+	evento := auditoria.Evento{
+		Momento:   time.Now(),
+		Tipo:      tipo,
+		Ator:      servico.atorToken(token),
+		Alvo:      alvo,
+		IP:        acoes.PedidoDe(ctx).IP,
+		Resultado: auditoria.ResultadoSucesso,
+		Detalhes:  detalhes,
+	}
+	for campo, erro := range retorno {
+		if acoes.ChaveErro(campo) && erro != nil && erro != "" {
+			evento.Resultado = auditoria.ResultadoFalha
+			if evento.Detalhes == nil {
+				evento.Detalhes = make(map[string]interface{})
+			}
+			evento.Detalhes["erro"] = fmt.Sprint(erro)
+		}
+	}
+	if token == "" && evento.Resultado == auditoria.ResultadoSucesso {
+		evento.Ator = alvo
+	}
+
+	if err := servico.auditoria.Registar(evento); err != nil {
+		servico.loggerErros.Println("Erro ao registar o evento de auditoria ", tipo, ": ", err)
+	}
+}
+
+// auditarSistema Regista um evento feito pelo próprio serviço (ex: expiração das contas), com o ator "sistema"
+func (servico *Servico) auditarSistema(tipo string, alvo string, detalhes map[string]interface{}) {
+	if servico.auditoria == nil {
+		return
+	}
+
+	evento := auditoria.Evento{
+		Momento:   time.Now(),
+		Tipo:      tipo,
+		Ator:      atorSistema,
+		Alvo:      alvo,
+		Resultado: auditoria.ResultadoSucesso,
+		Detalhes:  detalhes,
+	}
+	if err := servico.auditoria.Registar(evento); err != nil {
+		servico.loggerErros.Println("Erro ao registar o evento de auditoria ", tipo, ": ", err)
+	}
+}
+
+// ConsultarAuditoria Action que devolve os eventos de auditoria, os mais recentes primeiro,
+// exemplo de filtro: {"desde": "2021-05-01T00:00:00Z", "ate": "2021-05-02T00:00:00Z", "ator": "admin", "tipo": "login", "limite": 50}.
+// Todos os campos são opcionais, por default são devolvidos os últimos 100 eventos
+func (servico *Servico) ConsultarAuditoria(filtro map[string]interface{}, token string) (retorno map[string]interface{}) {
+	retorno = make(map[string]interface{})
+
+	if servico.auditoria == nil {
+		retorno["erro"] = "O registo de auditoria não está ativo"
+		return
+	}
+
+	consulta := auditoria.Filtro{Limite: limiteConsultaAuditoria}
+	for campo, destino := range map[string]*time.Time{"desde": &consulta.Desde, "ate": &consulta.Ate} {
+		valor, existe := filtro[campo].(string)
+		if !existe {
+			continue
+		}
+		momento, err := time.Parse(time.RFC3339, valor)
+		if err != nil {
+			retorno["erro"] = "Os campos desde e ate têm de estar no formato RFC3339, ex: 2021-05-01T00:00:00Z"
+			return
+		}
+		*destino = momento
+	}
+	consulta.Ator, _ = filtro["ator"].(string)
+	consulta.Tipo, _ = filtro["tipo"].(string)
+	if limite, ok := filtro["limite"].(float64); ok {
+		if limite < 1 || limite > maximoConsultaAuditoria {
+			retorno["erro"] = fmt.Sprintf("O limite têm de estar entre 1 e %d", maximoConsultaAuditoria)
+			return
+		}
+		consulta.Limite = int(limite)
+	}
+
+	eventos, err := servico.auditoria.Consultar(consulta)
+	if err != nil {
+		servico.loggerErros.Println("Erro ao consultar a auditoria: ", err)
+		retorno["erro"] = "Erro ao consultar os eventos de auditoria"
+		return
+	}
+	retorno["eventos"] = eventos
+	return
+}
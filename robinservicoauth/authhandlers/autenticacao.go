@@ -1,107 +1,252 @@
 package authhandlers
 
 import (
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/json"
-
-	"github.com/tomascpmarques/PAP/backend/robinservicoauth/loggers"
-	"github.com/tomascpmarques/PAP/backend/robinservicoauth/redishandle"
+	"context"
+	"errors"
+	"math"
+	"time"
 )
 
-// Chave usada para encriptar tokens de autorização do serviço
-var assinaturaSecretaServer = hmac.New(sha256.New, []byte(`SUPPER_SECRET_DEVELOPMENT_KEY`)).Sum(nil)
-
-//RedisClientDB  Setup do cliente do serviço redisDB
-var RedisClientDB = redishandle.NovoClienteRedis(
-	//os.Getenv("REDISADDRESS"),
-	//os.Getenv("AUTH_SERVER_REDIS_PORT"),
-	"0.0.0.0",              // Endereço perferido do serviço
-	"6379",                 // Porta default do redis
-	"Pg+V@j+Z9gKj88=-?dSk", // Pass do cliente admin do serv. redis
-	"admin",                // Nome do user do serviço redis
-	0,
-)
+// Iniciar Prepara a BD para o serviço, tem de ser chamado antes de servir pedidos.
+// Falha se as chaves de cifra não estiverem configuradas, ou se não conseguir ler as chaves de assinatura
+func (servico *Servico) Iniciar() error {
+	// Chave de cifra dos segredos TOTP dos users
+	chave, err := chaveTOTPConfigurada(servico.config.ChaveTOTP)
+	if err != nil {
+		return err
+	}
+	servico.chaveTOTP = chave
+
+	// Chave de cifra das chaves privadas de assinatura
+	if servico.chaveCifraChaves, err = chaveCifraChavesConfigurada(servico.config.CifraChaves); err != nil {
+		return err
+	}
+
+	// Cria os roles base (ROOT, ADMIN e USER) que ainda não existem
+	servico.InicializarRoles()
+
+	// Verifica se o utilisador admin já existe ou não
+	// Se não, cria o utilizador admin com as crdênciais default
+	servico.VerificarAdminFirstBoot()
 
-// Verifica se o utilisador admin já existe ou não
-// Se não, cria o utilizador admin com as crdênciais default
-var _ = VerificarAdminFirstBoot()
+	// Carrega as chaves RSA de assinatura das tokens, ou cria a primeira chave
+	return servico.InicializarChaves()
+}
 
 // Login Recebe dois parametros, o username e a passwd, cria uma token com esses dados e compara com o utilisador pedido
-// devolve uma token com o tempo de expiração de time.Now().Add(time.Minute * 40).Unix()
-func Login(user string, passwd string) (retorno map[string]interface{}) {
+// devolve uma token de acesso com o tempo de expiração de time.Now().Add(time.Minute * 40).Unix(),
+// e uma token de refresh, para renovar a token de acesso através do RenovarToken.
+// Os users com segundo fator recebem antes uma token parcial (ver VerificarTOTP)
+func (servico *Servico) Login(ctx context.Context, user string, passwd string) (retorno map[string]interface{}) {
 	retorno = make(map[string]interface{})
+	defer servico.auditarAcao(ctx, EventoLogin, "", user, retorno, nil)
+
+	// As falhas são contadas por user e por IP, com atraso exponencial e bloqueio temporário
+	alvos := alvosLogin(ctx, user)
+	if restante := servico.loginBloqueado(alvos); restante > 0 {
+		servico.logger.Println("Error: ", "login bloqueado para ", alvos)
+		retorno["erro"] = mensagemLoginBloqueado
+		retorno["tentar_depois"] = int64(math.Ceil(restante.Seconds()))
+		return
+	}
 
-	// Busca o registo de utilisador que se está a usar para fazer login
-	utilizadorPedido, err := GetUserParaValorStruct(user)
+	// Busca o registo de utilisador que se está a usar para fazer login,
+	// se não existir a password é comparada na mesma, para o erro e o tempo de resposta serem iguais
+	utilizadorPedido, err := servico.GetUserParaValorStruct(user)
 	if err != nil {
-		loggers.LoginAuthLogger.Println("Erro: ", err)
-		retorno["erro"] = "O utilisador pedido não existe."
-		return
+		servico.logger.Println("Erro: ", err)
+		utilizadorPedido = userComparacao
 	}
 
 	// Compára as credenciais com as do utilisador fornecido
-	if utilizadorPedido.Password != passwd {
-		loggers.LoginAuthLogger.Println("Error: ", "credeenciais inválidas")
-		retorno["erro"] = "Credenciais inválidas"
+	if !utilizadorPedido.VerificarPassword(passwd) || err != nil {
+		servico.logger.Println("Error: ", "credeenciais inválidas")
+		servico.registarFalhaLogin(alvos)
+		retorno["erro"] = mensagemCredenciaisInvalidas
+		return
+	}
+	servico.limparFalhasLogin(user)
+
+	// Contas desativadas, bloqueadas, expiradas ou por ativar não iniciam sessão,
+	// o estado só é revelado a quem têm a password
+	if err := utilizadorPedido.ContaAtiva(time.Now()); err != nil {
+		servico.logger.Println("Error: ", "login na conta inativa ", user, ": ", err)
+		retorno["erro"] = mensagemEstadoConta(err)
+		retorno["estado"] = utilizadorPedido.EstadoEfetivo(time.Now())
+		return
+	}
+
+	// Registos legacy ou com parametros de hash antigos, são atualizados com a password fornecida,
+	// sem contar como uma mudança da password
+	if utilizadorPedido.PrecisaRehash() {
+		atualizado := utilizadorPedido
+		err := atualizado.DefinirPassword(passwd)
+		atualizado.PasswordMudadaEm = utilizadorPedido.PasswordMudadaEm
+		if err != nil {
+			servico.logger.Println("Error: ", err)
+		} else if err := servico.users.Trocar(utilizadorPedido, atualizado); err == nil {
+			servico.logger.Println("Password do utilizador, ", user, ", atualizada para a hash atual")
+			utilizadorPedido = atualizado
+		}
+	}
+
+	// Registos anteriores aos roles passam a ter o role base correspondente às suas permissões
+	if len(utilizadorPedido.Roles) == 0 {
+		atualizado := utilizadorPedido
+		if err := servico.DefinirRoles(&atualizado, utilizadorPedido.RolesEfetivos()); err != nil {
+			servico.logger.Println("Error: ", err)
+		} else if err := servico.users.Trocar(utilizadorPedido, atualizado); err == nil {
+			utilizadorPedido = atualizado
+		}
+	}
+
+	// O user têm de mudar a password (i.e.: admin no primeiro boot), não se devolve a token
+	if utilizadorPedido.MudarPassword {
+		servico.logger.Println("Utilizador, ", user, ", têm de mudar a password")
+		retorno["erro"] = "É necessário mudar a password antes de iniciar sessão"
+		retorno["mudar_password"] = true
 		return
 	}
 
-	// Cria um token de utilisador a partir dos dados fornecidos
-	novaTokenLogin, err := utilizadorPedido.CriarJWTAuth().SignedString(assinaturaSecretaServer)
+	// Users com TOTP, e os administradores (obrigados a ativar o TOTP), só recebem uma token parcial,
+	// trocada pelas tokens finais no VerificarTOTP, ou no ConfirmarTOTP depois de ativarem o TOTP
+	if utilizadorPedido.TOTPAtivo() || servico.Privilegiado(utilizadorPedido) {
+		tokenParcial, err := servico.emitirTokenParcial(utilizadorPedido)
+		if err != nil {
+			servico.logger.Println("Error: ", err)
+			retorno["erro"] = err.Error()
+			return
+		}
+		if utilizadorPedido.TOTPAtivo() {
+			retorno["totp_necessario"] = true
+		} else {
+			retorno["ativar_totp"] = true
+		}
+		servico.logger.Println("Utilizador, ", user, ", precisa do segundo fator para iniciar sessão")
+		retorno["token_parcial"] = tokenParcial
+		return
+	}
+
+	// Cria a token de acesso e a token de refresh (numa familia nova) a partir dos dados fornecidos
+	novaTokenLogin, refreshToken, err := servico.EmitirTokens(utilizadorPedido, "")
 	if err != nil {
-		loggers.LoginAuthLogger.Println("Error: ", err)
-		retorno["erro"] = err
+		servico.logger.Println("Error: ", err)
+		retorno["erro"] = err.Error()
 		return
 	}
 
 	// Loga que o utilisador XXXX iniciou sessão
-	// E devolve a token, em como o utilisador está logado
-	loggers.LoginAuthLogger.Println("Utilizador, ", user, ", iniciou sessão")
+	// E devolve as tokens, em como o utilisador está logado
+	servico.logger.Println("Utilizador, ", user, ", iniciou sessão")
 	retorno["token"] = novaTokenLogin
+	retorno["refresh_token"] = refreshToken
 	return
 }
 
 // Registar utiliza os dados de utilisador base defenidos, cria e inssere na BD um utilisador novo, antes disso
-// a função verifica que quem está a fazer o pedido é o administrador do serviço, só administradores podem registar utilizadores.
+// a função verifica que quem está a fazer o pedido é o administrador do serviço, só administradores podem registar utilizadores,
+// e só o ROOT pode registar utilizadores com privilégios de administração.
 // Se todas as regras forem cumpridas, a função devolve a jwt token desse novo utilizador.
-func Registar(user string, password string, perms int, token string) (retorno map[string]interface{}) {
+func (servico *Servico) Registar(ctx context.Context, user string, password string, perms int, token string) (retorno map[string]interface{}) {
 	retorno = make(map[string]interface{})
+	defer servico.auditarAcao(ctx, EventoRegisto, token, user, retorno, map[string]interface{}{"perms": perms})
 
-	// Se a token não for igual ao do admin não se regista um user novo
-	if VerificarTokenAdmin(token) != "OK" {
-		loggers.LoginAuthLogger.Println("A token não têm permissões")
-		retorno["error"] = "A token não têm permissões"
+	if !nomeUserValido.MatchString(user) {
+		retorno["erro"] = "Nome de utilizador inválido"
 		return
 	}
+	// Limita o numero que equival ás permissões na plataforma
+	if perms < ROOT || perms > USER {
+		retorno["erro"] = "Permissões fora dos valores permitidos, entre 1 e 3"
+		return
+	}
+	if perms <= ADMIN {
+		if err := servico.exigirGestaoAdmins(token); err != nil {
+			servico.logger.Println("Error: ", "tentativa de registar um administrador sem permissões")
+			retorno["erro"] = "Só o ROOT pode registar administradores"
+			return
+		}
+	}
 
-	// Verifica se o utilisador que se quer criar já existe
-	// Se já existir, não se devolve nenhuma jwt, nem se inssere nada na BD
-	_, exists := redishandle.GetRegistoBD(&RedisClientDB, user, 0)
-	if exists != nil {
-		// Cria a struct para o novo user
-		novoUser := CriarNovoUser(user, password, perms)
+	// Cria a struct para o novo user, com a hash da password
+	novoUser, err := CriarNovoUser(user, password, perms)
+	if err != nil {
+		servico.logger.Println("Error: ", err)
+		retorno["erro"] = err.Error()
+		return
+	}
 
-		// Encodifica a info relacionada ao user, para um formato json
-		novoUserJSON, err := json.Marshal(&novoUser)
-		loggers.LoginAuthLogger.Println("Novo user: ", user)
-		if err != nil {
-			loggers.LoginAuthLogger.Println("Error: ", err)
-			retorno["error"] = err
+	// Inssere o novo utilisador na bd só se o utilisador não existir, numa só operação,
+	// dois registos em simultâneo com o mesmo nome não se podem sobrepor
+	if err := servico.users.Criar(novoUser); err != nil {
+		servico.loggerBD.Println("Erro: ", err)
+		if errors.Is(err, ErrUserExiste) {
+			retorno["erro"] = "Credenciais inválidas ou utilizador já existente"
 			return
 		}
+		retorno["erro"] = err.Error()
+		return
+	}
+	servico.logger.Println("Novo user: ", user)
+	retorno["sucesso"] = true
+	return
+}
+
+// MudarPassword Muda a password do user, depois de verificar a password atual,
+// é a única forma de um user com a password marcada para mudança voltar a poder iniciar sessão.
+// As falhas contam para o bloqueio do login, tal como no Login
+func (servico *Servico) MudarPassword(ctx context.Context, user string, passwdAtual string, passwdNova string) (retorno map[string]interface{}) {
+	retorno = make(map[string]interface{})
+	defer servico.auditarAcao(ctx, EventoPasswordAlterada, "", user, retorno, nil)
+
+	alvos := alvosLogin(ctx, user)
+	if restante := servico.loginBloqueado(alvos); restante > 0 {
+		retorno["erro"] = mensagemLoginBloqueado
+		retorno["tentar_depois"] = int64(math.Ceil(restante.Seconds()))
+		return
+	}
+
+	utilizador, err := servico.GetUserParaValorStruct(user)
+	if err != nil {
+		utilizador = userComparacao
+	}
+	if !utilizador.VerificarPassword(passwdAtual) || err != nil {
+		servico.logger.Println("Error: ", "credeenciais inválidas")
+		servico.registarFalhaLogin(alvos)
+		retorno["erro"] = mensagemCredenciaisInvalidas
+		return
+	}
+	servico.limparFalhasLogin(user)
+
+	// Contas desativadas, bloqueadas ou expiradas não podem mudar a password, como no Login
+	if err := utilizador.ContaAtiva(time.Now()); err != nil {
+		servico.logger.Println("Error: ", "mudança de password na conta inativa ", user, ": ", err)
+		retorno["erro"] = mensagemEstadoConta(err)
+		retorno["estado"] = utilizador.EstadoEfetivo(time.Now())
+		return
+	}
+
+	// A password nova não pode ser igual à atual
+	if utilizador.VerificarPassword(passwdNova) {
+		servico.logger.Println("Error: ", "a password nova é igual à atual")
+		retorno["erro"] = "A password nova têm de ser diferente da atual"
+		return
+	}
+
+	atualizado := utilizador
+	if err := atualizado.DefinirPassword(passwdNova); err != nil {
+		servico.logger.Println("Error: ", err)
+		retorno["erro"] = err.Error()
+		return
+	}
+	atualizado.MudarPassword = false
 
-		// Inssere o novo utilisador na bd se o utilisador não existir
-		redishandle.SetRegistoBD(&RedisClientDB, redishandle.RegistoRedisDB{
-			Key:    novoUser.Username,
-			Valor:  novoUserJSON,
-			Expira: 0,
-		}, 0)
-		loggers.LoginAuthLogger.Println("Registo adicionado com sucesso.")
-		retorno["sucesso"] = true
+	if err := servico.users.Trocar(utilizador, atualizado); err != nil {
+		retorno["erro"] = err.Error()
 		return
 	}
 
-	retorno["error"] = "Credenciais inválidas ou utilizador já existente"
+	servico.logger.Println("Utilizador, ", user, ", mudou a password")
+	retorno["sucesso"] = true
 	return
 }
@@ -0,0 +1,420 @@
+package authhandlers
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	// keyChavesAssinatura key do registo que guarda todas as chaves de assinatura (ativa e reformadas),
+	// as chaves privadas são guardadas cifradas com a chave configurada em chaves_cifra
+	keyChavesAssinatura = "chaves_assinatura"
+	// tamanhoChaveRSA tamanho em bits das chaves RSA geradas
+	tamanhoChaveRSA = 2048
+	// intervaloMinimoRecarga tempo minimo entre as leituras das chaves guardadas quando aparece um kid desconhecido,
+	// para tokens com kids inventados não obrigarem a ler a BD em cada pedido
+	intervaloMinimoRecarga = time.Second * 30
+	// maxTentativasRotacao número de vezes que a rotação é repetida quando outra instância altera as chaves ao mesmo tempo
+	maxTentativasRotacao = 3
+)
+
+// ErrChaveChavesEmFalta a chave de cifra das chaves de assinatura não foi configurada
+var ErrChaveChavesEmFalta = errors.New("a chave de cifra das chaves de assinatura é obrigatória (AUTH_CHAVES_CIFRA, 32 bytes em base64, ex: openssl rand -base64 32)")
+
+// ChaveAssinatura Chave RSA usada para assinar tokens, identificada pelo kid
+type ChaveAssinatura struct {
+	Kid         string    `json:"kid"`
+	PEM         string    `json:"pem,omitempty"`          // Chave privada em PKCS#1 PEM sem cifra, só nos registos antigos
+	Cifrada     string    `json:"cifrada,omitempty"`      // Chave privada em PKCS#1 DER, cifrada com AES-GCM, em base64
+	CriadaEm    time.Time `json:"criada_em"`              // Momento em que a chave foi gerada
+	ReformadaEm time.Time `json:"reformada_em,omitempty"` // Momento em que deixou de assinar tokens, zero se ainda é a ativa
+
+	privada *rsa.PrivateKey
+}
+
+// Reformada Indica se a chave já não é usada para assinar tokens novas
+func (chave ChaveAssinatura) Reformada() bool {
+	return !chave.ReformadaEm.IsZero()
+}
+
+// conjuntoChaves Chaves conhecidas pelo serviço, a ativa assina tokens, as reformadas só verificam
+type conjuntoChaves struct {
+	sync.RWMutex
+	chaves       []*ChaveAssinatura
+	recarregadas time.Time // Última leitura das chaves guardadas por causa de um kid desconhecido
+}
+
+// chaveCifraChavesConfigurada Descodifica a chave de cifra das chaves de assinatura (32 bytes em base64), obrigatória
+// pela mesma razão da chave TOTP: guardada no redis, quem lesse as chaves cifradas conseguia decifrá-las
+func chaveCifraChavesConfigurada(configurada string) ([]byte, error) {
+	return chaveCifraConfigurada(configurada, "de cifra das chaves de assinatura", ErrChaveChavesEmFalta)
+}
+
+// cifraChaves Cifra AES-GCM com a chave de cifra das chaves de assinatura
+func (servico *Servico) cifraChaves() (cipher.AEAD, error) {
+	bloco, err := aes.NewCipher(servico.chaveCifraChaves)
+	if err != nil {
+		return nil, errors.New("chave de cifra das chaves de assinatura inválida")
+	}
+	return cipher.NewGCM(bloco)
+}
+
+// cifrarChave Cifra a chave privada, o kid é autenticado com a chave, para a chave cifrada não poder ser
+// trocada por outra do mesmo registo
+func (servico *Servico) cifrarChave(chave *ChaveAssinatura) (string, error) {
+	aead, err := servico.cifraChaves()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	privada := x509.MarshalPKCS1PrivateKey(chave.privada)
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, privada, []byte(chave.Kid))), nil
+}
+
+// decifrarChave Decifra a chave privada cifrada pelo cifrarChave, ou lê o PEM sem cifra dos registos antigos
+func (servico *Servico) decifrarChave(chave *ChaveAssinatura) (*rsa.PrivateKey, error) {
+	if chave.Cifrada == "" {
+		bloco, _ := pem.Decode([]byte(chave.PEM))
+		if bloco == nil {
+			return nil, fmt.Errorf("chave %s com PEM inválido", chave.Kid)
+		}
+		return x509.ParsePKCS1PrivateKey(bloco.Bytes)
+	}
+
+	aead, err := servico.cifraChaves()
+	if err != nil {
+		return nil, err
+	}
+	dados, err := base64.StdEncoding.DecodeString(chave.Cifrada)
+	if err != nil || len(dados) < aead.NonceSize() {
+		return nil, fmt.Errorf("chave %s cifrada inválida", chave.Kid)
+	}
+	privada, err := aead.Open(nil, dados[:aead.NonceSize()], dados[aead.NonceSize():], []byte(chave.Kid))
+	if err != nil {
+		return nil, fmt.Errorf("não foi possível decifrar a chave %s, a chave de cifra está correta?", chave.Kid)
+	}
+	return x509.ParsePKCS1PrivateKey(privada)
+}
+
+// codificarChaves Converte as chaves no registo guardado na BD, com as chaves privadas cifradas
+func (servico *Servico) codificarChaves(chaves []*ChaveAssinatura) (string, error) {
+	guardadas := make([]ChaveAssinatura, len(chaves))
+	for i, chave := range chaves {
+		cifrada, err := servico.cifrarChave(chave)
+		if err != nil {
+			return "", err
+		}
+		guardadas[i] = ChaveAssinatura{Kid: chave.Kid, Cifrada: cifrada, CriadaEm: chave.CriadaEm, ReformadaEm: chave.ReformadaEm}
+	}
+	registoJSON, err := json.Marshal(guardadas)
+	return string(registoJSON), err
+}
+
+// carregarChaves Lê as chaves de assinatura guardadas na BD para memória,
+// descarta as chaves reformadas há mais tempo do que a duração da token mais longa
+func (servico *Servico) carregarChaves() ([]*ChaveAssinatura, error) {
+	_, chaves, err := servico.lerChaves()
+	return chaves, err
+}
+
+// lerChaves Lê as chaves como o carregarChaves, e devolve também o registo lido, para a rotação
+// só guardar as chaves novas se o registo não tiver sido alterado entretanto
+func (servico *Servico) lerChaves() (string, []*ChaveAssinatura, error) {
+	registo, err := servico.estado.Get(keyChavesAssinatura)
+	if err != nil {
+		return "", nil, err
+	}
+	chaves, err := servico.descodificarChaves(registo)
+	return registo, chaves, err
+}
+
+// descodificarChaves Converte o registo das chaves guardadas nas chaves de assinatura, sem as reformadas expiradas
+func (servico *Servico) descodificarChaves(registo string) ([]*ChaveAssinatura, error) {
+	var guardadas []*ChaveAssinatura
+	if err := json.Unmarshal([]byte(registo), &guardadas); err != nil {
+		return nil, err
+	}
+
+	chaves := make([]*ChaveAssinatura, 0, len(guardadas))
+	for _, chave := range guardadas {
+		if chave.Reformada() && time.Since(chave.ReformadaEm) > duracaoTokenRefresh {
+			continue
+		}
+		var err error
+		if chave.privada, err = servico.decifrarChave(chave); err != nil {
+			return nil, err
+		}
+		chaves = append(chaves, chave)
+	}
+	return chaves, nil
+}
+
+// usarChaves Substitui as chaves em memória
+func (servico *Servico) usarChaves(chaves []*ChaveAssinatura) {
+	servico.chaves.Lock()
+	servico.chaves.chaves = chaves
+	servico.chaves.Unlock()
+}
+
+// novaChaveAssinatura Gera uma chave RSA nova com um kid aleatório
+func novaChaveAssinatura() (*ChaveAssinatura, error) {
+	privada, err := rsa.GenerateKey(rand.Reader, tamanhoChaveRSA)
+	if err != nil {
+		return nil, err
+	}
+	kid, err := gerarIdentificador()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ChaveAssinatura{
+		Kid:      kid,
+		CriadaEm: time.Now(),
+		privada:  privada,
+	}, nil
+}
+
+// InicializarChaves Carrega as chaves de assinatura da BD, se não existir nenhuma chave ativa cria uma.
+// Só cria o registo das chaves se ainda não existir, os outros erros da BD são devolvidos.
+// As chaves guardadas sem cifra pelas versões anteriores são cifradas
+func (servico *Servico) InicializarChaves() error {
+	registo, chaves, err := servico.lerChaves()
+	if errors.Is(err, ErrRegistoNaoExiste) {
+		chaves, err = servico.criarChaves()
+	}
+	if err != nil {
+		return fmt.Errorf("erro ao carregar as chaves de assinatura: %w", err)
+	}
+	if err := servico.cifrarChavesAntigas(registo, chaves); err != nil {
+		return fmt.Errorf("erro ao cifrar as chaves de assinatura: %w", err)
+	}
+
+	// Todas as chaves guardadas foram reformadas
+	if len(chaves) == 0 || chaves[len(chaves)-1].Reformada() {
+		kid, err := servico.RodarChavesAssinatura()
+		if err != nil {
+			return fmt.Errorf("erro ao criar a chave de assinatura: %w", err)
+		}
+		servico.logger.Println("Chave de assinatura criada, kid: ", kid)
+		return nil
+	}
+
+	servico.usarChaves(chaves)
+	return nil
+}
+
+// criarChaves Cria o registo das chaves com uma chave nova, se outra instância o criou ao mesmo tempo usa as chaves dessa
+func (servico *Servico) criarChaves() ([]*ChaveAssinatura, error) {
+	chave, err := novaChaveAssinatura()
+	if err != nil {
+		return nil, err
+	}
+	registo, err := servico.codificarChaves([]*ChaveAssinatura{chave})
+	if err != nil {
+		return nil, err
+	}
+
+	criado, err := servico.estado.InserirSeNaoExiste(keyChavesAssinatura, registo, 0)
+	if err != nil {
+		return nil, err
+	}
+	if !criado {
+		return servico.carregarChaves()
+	}
+	servico.logger.Println("Chave de assinatura criada, kid: ", chave.Kid)
+	return []*ChaveAssinatura{chave}, nil
+}
+
+// cifrarChavesAntigas Guarda cifradas as chaves lidas do registo, se alguma estava sem cifra.
+// Se outra instância alterou o registo entretanto, as chaves já foram guardadas cifradas por essa
+func (servico *Servico) cifrarChavesAntigas(registo string, chaves []*ChaveAssinatura) error {
+	emClaro := false
+	for _, chave := range chaves {
+		emClaro = emClaro || chave.Cifrada == ""
+	}
+	if registo == "" || !emClaro {
+		return nil
+	}
+
+	novoRegisto, err := servico.codificarChaves(chaves)
+	if err != nil {
+		return err
+	}
+	err = servico.estado.TrocarSeIgual(keyChavesAssinatura, registo, novoRegisto)
+	if errors.Is(err, ErrConflitoRegisto) {
+		return nil
+	}
+	if err == nil {
+		servico.logger.Println("Chaves de assinatura guardadas sem cifra foram cifradas")
+	}
+	return err
+}
+
+// RodarChavesAssinatura Cria uma chave de assinatura nova, e reforma a atual,
+// a chave reformada continua a verificar as tokens que assinou até expirarem.
+// As chaves só são guardadas se o registo não mudou desde a leitura (compare-and-swap), senão
+// a rotação é repetida sobre as chaves novas, para não perder as chaves criadas por outra rotação
+func (servico *Servico) RodarChavesAssinatura() (string, error) {
+	nova, err := novaChaveAssinatura()
+	if err != nil {
+		return "", err
+	}
+
+	for i := 0; i < maxTentativasRotacao; i++ {
+		// Parte das chaves guardadas, outra instância do serviço pode já ter rodado as chaves
+		registo, chaves, err := servico.lerChaves()
+		if err != nil {
+			return "", err
+		}
+		for _, chave := range chaves {
+			if !chave.Reformada() {
+				chave.ReformadaEm = time.Now()
+			}
+		}
+		chaves = append(chaves, nova)
+
+		novoRegisto, err := servico.codificarChaves(chaves)
+		if err != nil {
+			return "", err
+		}
+		err = servico.estado.TrocarSeIgual(keyChavesAssinatura, registo, novoRegisto)
+		if errors.Is(err, ErrConflitoRegisto) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+
+		servico.usarChaves(chaves)
+		return nova.Kid, nil
+	}
+	return "", ErrConflitoRegisto
+}
+
+// chaveAtiva Devolve a chave usada para assinar as tokens novas (a ultima do conjunto)
+func (servico *Servico) chaveAtiva() (*ChaveAssinatura, error) {
+	servico.chaves.RLock()
+	defer servico.chaves.RUnlock()
+
+	if len(servico.chaves.chaves) == 0 || servico.chaves.chaves[len(servico.chaves.chaves)-1].Reformada() {
+		return nil, errors.New("sem chave de assinatura ativa")
+	}
+	return servico.chaves.chaves[len(servico.chaves.chaves)-1], nil
+}
+
+// procurarChave Procura a chave com o kid fornecido, entre as chaves em memória
+func (servico *Servico) procurarChave(kid string) *ChaveAssinatura {
+	servico.chaves.RLock()
+	defer servico.chaves.RUnlock()
+
+	for _, chave := range servico.chaves.chaves {
+		if chave.Kid == kid {
+			return chave
+		}
+	}
+	return nil
+}
+
+// assinarToken Assina a token com a chave ativa, e identifica a chave no header kid
+func (servico *Servico) assinarToken(token *jwt.Token) (string, error) {
+	chave, err := servico.chaveAtiva()
+	if err != nil {
+		return "", err
+	}
+	token.Header["kid"] = chave.Kid
+	return token.SignedString(chave.privada)
+}
+
+// podeRecarregarChaves Indica se as chaves guardadas podem ser lidas outra vez, no máximo uma vez a cada
+// intervaloMinimoRecarga, e marca a leitura
+func (servico *Servico) podeRecarregarChaves() bool {
+	servico.chaves.Lock()
+	defer servico.chaves.Unlock()
+
+	if time.Since(servico.chaves.recarregadas) < intervaloMinimoRecarga {
+		return false
+	}
+	servico.chaves.recarregadas = time.Now()
+	return true
+}
+
+// chaveVerificacao Devolve a chave pública para verificar a token, pelo kid no header da mesma
+func (servico *Servico) chaveVerificacao(token *jwt.Token) (interface{}, error) {
+	// valida o metodo de assinatura da key
+	if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+		return nil, fmt.Errorf("metodo de assinatura inesperado: %v", token.Header["alg"])
+	}
+	kid, _ := token.Header["kid"].(string)
+
+	chave := servico.procurarChave(kid)
+	if chave == nil && servico.podeRecarregarChaves() {
+		// A chave pode ter sido criada por outra instância do serviço
+		if chaves, err := servico.carregarChaves(); err == nil {
+			servico.usarChaves(chaves)
+			chave = servico.procurarChave(kid)
+		}
+	}
+	if chave == nil {
+		return nil, fmt.Errorf("kid desconhecido: %v", kid)
+	}
+	return &chave.privada.PublicKey, nil
+}
+
+// JWKSHandler Publica as chaves públicas de verificação no formato JWKS (RFC 7517)
+func (servico *Servico) JWKSHandler(rw http.ResponseWriter, r *http.Request) {
+	servico.chaves.RLock()
+	chaves := make([]map[string]string, 0, len(servico.chaves.chaves))
+	for _, chave := range servico.chaves.chaves {
+		chaves = append(chaves, map[string]string{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": jwt.SigningMethodRS256.Alg(),
+			"kid": chave.Kid,
+			"n":   base64.RawURLEncoding.EncodeToString(chave.privada.PublicKey.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(chave.privada.PublicKey.E)).Bytes()),
+		})
+	}
+	servico.chaves.RUnlock()
+
+	rw.Header().Set("Content-Type", "application/json")
+	// Os serviços guardam o conjunto em cache, mas devem ver uma chave nova pouco depois da rotação
+	rw.Header().Set("Cache-Control", "max-age=300")
+	if err := json.NewEncoder(rw).Encode(map[string]interface{}{"keys": chaves}); err != nil {
+		servico.loggerErros.Println("Erro: ", err)
+	}
+}
+
+// RodarChaves Action que roda as chaves de assinatura, só para o ROOT
+func (servico *Servico) RodarChaves(ctx context.Context, token string) (retorno map[string]interface{}) {
+	retorno = make(map[string]interface{})
+	defer servico.auditarAcao(ctx, EventoChavesRodadas, token, "", retorno, nil)
+
+	kid, err := servico.RodarChavesAssinatura()
+	if err != nil {
+		servico.logger.Println("Erro: ", err)
+		retorno["erro"] = "Erro ao rodar as chaves de assinatura"
+		return
+	}
+
+	servico.logger.Println("Chaves de assinatura rodadas, kid ativo: ", kid)
+	retorno["kid"] = kid
+	return
+}
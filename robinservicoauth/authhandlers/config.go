@@ -0,0 +1,60 @@
+package authhandlers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/clientes"
+	"github.com/tomascpmarques/PAP/backend/robinservicoauth/notificacoes"
+)
+
+// Config Configuração dos handlers, parte da configuração do serviço (ver NovoServico)
+type Config struct {
+	UserStore        string              `conf:"user_store" desc:"onde são guardados os users: redis ou memoria"`
+	EstadoStore      string              `conf:"estado_store" desc:"onde são guardadas as tokens, revogações, bloqueios, chaves e roles: redis ou memoria (vazio usa o mesmo do user_store)"`
+	VarrimentoContas time.Duration       `conf:"varrimento_contas" desc:"intervalo entre as procuras das contas expiradas"`
+	ChaveTOTP        string              `conf:"totp_chave" desc:"chave de cifra dos segredos TOTP, 32 bytes em base64 (obrigatória)"`
+	CifraChaves      string              `conf:"chaves_cifra" desc:"chave de cifra das chaves privadas de assinatura, 32 bytes em base64 (obrigatória)"`
+	URLUserinfo      string              `conf:"userinfo_url" desc:"endereço do serviço userinfo"`
+	Userinfo         clientes.Config     `conf:"userinfo"`
+	Notificador      notificacoes.Config `conf:"notificador"`
+}
+
+// ConfigDefault Users no redis e contas expiradas procuradas a cada 5 minutos. Sem notificador,
+// o reset de password e os convites ficam desativados até ser configurado um
+func ConfigDefault() Config {
+	return Config{
+		UserStore:        BackendRedis,
+		VarrimentoContas: intervaloVarrimentoDefault,
+		URLUserinfo:      "http://0.0.0.0:8001",
+		Userinfo:         clientes.ConfigDefault(),
+	}
+}
+
+// BackendEstado Backend do armazenamento do estado, o mesmo dos users se não for configurado
+func (config Config) BackendEstado() string {
+	if config.EstadoStore == "" {
+		return config.UserStore
+	}
+	return config.EstadoStore
+}
+
+// Validar Verifica o armazenamento dos users e do estado, e as chaves de cifra
+func (config *Config) Validar() error {
+	if config.UserStore != "" && config.UserStore != BackendRedis && config.UserStore != BackendMemoria {
+		return errors.New("backend de users desconhecido: " + config.UserStore)
+	}
+	if config.EstadoStore != "" && config.EstadoStore != BackendRedis && config.EstadoStore != BackendMemoria {
+		return errors.New("backend do estado desconhecido: " + config.EstadoStore)
+	}
+	if config.VarrimentoContas < 0 {
+		return errors.New("o intervalo do varrimento das contas não pode ser negativo")
+	}
+	if _, err := chaveTOTPConfigurada(config.ChaveTOTP); err != nil {
+		return err
+	}
+	if _, err := chaveCifraChavesConfigurada(config.CifraChaves); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,344 @@
+package authhandlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/acoes"
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/autorizacao"
+)
+
+const (
+	// prefixoContaServico prefixo das keys com o registo de cada conta de serviço
+	prefixoContaServico = "conta_servico:"
+	// duracaoTokenServico tempo de vida das tokens de serviço, os serviços pedem uma nova quando expira
+	duracaoTokenServico = time.Minute * 15
+	// contaServicoInterna conta usada pelo próprio serviço de autenticação, as suas tokens são emitidas
+	// diretamente, sem registo nem segredo
+	contaServicoInterna = "auth"
+)
+
+// scopesServicoInterno scopes das tokens usadas pelo serviço de autenticação para chamar o userinfo
+var scopesServicoInterno = []string{autorizacao.ScopeUserinfoAtualizar, autorizacao.ScopeUserinfoRenomear}
+
+// scopeValido os scopes têm o formato <serviço>:<operação>, só com letras minúsculas, números, _ e -
+var scopeValido = regexp.MustCompile(`^[a-z0-9_-]{1,32}:[a-z0-9_-]{1,32}$`)
+
+// ContaServico Conta de um serviço, usada para pedir tokens de serviço (client credentials)
+// com as quais chama as actions internas dos outros serviços
+type ContaServico struct {
+	Nome    string    `json:"nome"`
+	Segredo string    `json:"segredo,omitempty"` // Hash sha256 do segredo, o segredo em sí só é mostrado quando é criado
+	Scopes  []string  `json:"scopes"`            // Scopes que a conta pode pedir
+	Criada  time.Time `json:"criada"`
+}
+
+// hashSegredoServico Hash guardada do segredo de uma conta de serviço, o segredo é aleatório,
+// logo não precisa de uma hash lenta como as passwords
+func hashSegredoServico(segredo string) string {
+	soma := sha256.Sum256([]byte(segredo))
+	return hex.EncodeToString(soma[:])
+}
+
+// gerarSegredoServico Cria um segredo aleatório para uma conta de serviço
+func gerarSegredoServico() (string, error) {
+	segredo := make([]byte, 32)
+	if _, err := rand.Read(segredo); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(segredo), nil
+}
+
+// getContaServico Busca o registo da conta de serviço
+func (servico *Servico) getContaServico(nome string) (ContaServico, error) {
+	var conta ContaServico
+	registo, err := servico.estado.Get(prefixoContaServico + nome)
+	if err != nil {
+		return conta, err
+	}
+	err = json.Unmarshal([]byte(registo), &conta)
+	return conta, err
+}
+
+// scopesPedidos Converte os scopes separados por espaços numa lista sem repetidos, devolve false se algum for inválido
+func scopesPedidos(scopes string) ([]string, bool) {
+	lista := make([]string, 0)
+	for _, scope := range strings.Fields(scopes) {
+		if !scopeValido.MatchString(scope) {
+			return nil, false
+		}
+		if !contem(lista, scope) {
+			lista = append(lista, scope)
+		}
+	}
+	sort.Strings(lista)
+	return lista, len(lista) > 0
+}
+
+// CriarJWTServico Cria a token de serviço da conta, com os scopes indicados. A token não têm user
+// nem permissões, só é aceite nas actions que aceitam tokens de serviço com esses scopes
+func CriarJWTServico(conta string, scopes []string, jti string) *jwt.Token {
+	return jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"sub":   autorizacao.PrefixoServico + conta,
+		"scope": strings.Join(scopes, " "),
+		"iss":   autorizacao.EmissorTokens,
+		"jti":   jti,
+		"iat":   instanteEmissao(time.Now()),
+		"exp":   time.Now().Add(duracaoTokenServico).Unix(),
+	})
+}
+
+// emitirTokenServico Cria e assina uma token de serviço
+func (servico *Servico) emitirTokenServico(conta string, scopes []string) (string, error) {
+	jti, err := gerarIdentificador()
+	if err != nil {
+		return "", err
+	}
+	return servico.assinarToken(CriarJWTServico(conta, scopes, jti))
+}
+
+// tokenInterna Token de serviço do próprio serviço de autenticação, reutilizada até estar perto de expirar
+type tokenInterna struct {
+	sync.Mutex
+	token  string
+	expira time.Time
+}
+
+// TokenServicoInterna Devolve a token com que o serviço de autenticação chama as actions internas do userinfo
+func (servico *Servico) TokenServicoInterna() (string, error) {
+	servico.tokenInterna.Lock()
+	defer servico.tokenInterna.Unlock()
+	if servico.tokenInterna.token != "" && time.Until(servico.tokenInterna.expira) > time.Minute {
+		return servico.tokenInterna.token, nil
+	}
+
+	token, err := servico.emitirTokenServico(contaServicoInterna, scopesServicoInterno)
+	if err != nil {
+		return "", err
+	}
+	servico.tokenInterna.token = token
+	servico.tokenInterna.expira = time.Now().Add(duracaoTokenServico)
+	return token, nil
+}
+
+// CriarContaServico Action que cria uma conta de serviço com os scopes indicados (separados por espaços,
+// ex: "userinfo:contribuicoes userinfo:atualizar"), o segredo só é devolvido nesta resposta
+func (servico *Servico) CriarContaServico(ctx context.Context, nome string, scopes string, token string) (retorno map[string]interface{}) {
+	retorno = make(map[string]interface{})
+	defer servico.auditarAcao(ctx, EventoContaServicoCriada, token, autorizacao.PrefixoServico+nome, retorno, map[string]interface{}{"scopes": scopes})
+
+	if !nomeUserValido.MatchString(nome) || nome == contaServicoInterna {
+		retorno["erro"] = "Nome da conta de serviço inválido"
+		return
+	}
+	lista, ok := scopesPedidos(scopes)
+	if !ok {
+		retorno["erro"] = "Os scopes têm de ter o formato <serviço>:<operação>, separados por espaços"
+		return
+	}
+	segredo, err := gerarSegredoServico()
+	if err != nil {
+		servico.logger.Println("Erro: ", err)
+		retorno["erro"] = "Erro ao criar o segredo da conta de serviço"
+		return
+	}
+
+	conta, _ := json.Marshal(&ContaServico{
+		Nome:    nome,
+		Segredo: hashSegredoServico(segredo),
+		Scopes:  lista,
+		Criada:  time.Now(),
+	})
+	criada, err := servico.estado.InserirSeNaoExiste(prefixoContaServico+nome, string(conta), 0)
+	if err != nil {
+		retorno["erro"] = "Erro ao guardar a conta de serviço"
+		return
+	}
+	if !criada {
+		retorno["erro"] = "Já existe uma conta de serviço com esse nome"
+		return
+	}
+
+	servico.logger.Println("Conta de serviço criada: ", nome)
+	retorno["conta"] = nome
+	retorno["segredo"] = segredo
+	retorno["scopes"] = lista
+	return
+}
+
+// RodarSegredoServico Action que substitui o segredo da conta de serviço, e revoga as tokens emitidas com o anterior
+func (servico *Servico) RodarSegredoServico(ctx context.Context, nome string, token string) (retorno map[string]interface{}) {
+	retorno = make(map[string]interface{})
+	defer servico.auditarAcao(ctx, EventoSegredoServicoRodado, token, autorizacao.PrefixoServico+nome, retorno, nil)
+
+	conta, err := servico.getContaServico(nome)
+	if err != nil {
+		retorno["erro"] = "A conta de serviço não existe"
+		return
+	}
+	segredo, err := gerarSegredoServico()
+	if err != nil {
+		servico.logger.Println("Erro: ", err)
+		retorno["erro"] = "Erro ao criar o segredo da conta de serviço"
+		return
+	}
+
+	conta.Segredo = hashSegredoServico(segredo)
+	registo, _ := json.Marshal(&conta)
+	if _, err := servico.estado.TrocarValor(prefixoContaServico+nome, string(registo)); err != nil {
+		retorno["erro"] = "Erro ao guardar a conta de serviço"
+		return
+	}
+	servico.RevogarTokensUser(autorizacao.PrefixoServico + nome)
+
+	servico.logger.Println("Segredo da conta de serviço rodado: ", nome)
+	retorno["conta"] = nome
+	retorno["segredo"] = segredo
+	return
+}
+
+// ApagarContaServico Action que apaga a conta de serviço, e revoga as tokens emitidas para ela
+func (servico *Servico) ApagarContaServico(ctx context.Context, nome string, token string) (retorno map[string]interface{}) {
+	retorno = make(map[string]interface{})
+	defer servico.auditarAcao(ctx, EventoContaServicoApagada, token, autorizacao.PrefixoServico+nome, retorno, nil)
+
+	if _, err := servico.getContaServico(nome); err != nil {
+		retorno["erro"] = "A conta de serviço não existe"
+		return
+	}
+	if err := servico.estado.Apagar(prefixoContaServico + nome); err != nil {
+		retorno["erro"] = "Erro ao apagar a conta de serviço"
+		return
+	}
+	servico.RevogarTokensUser(autorizacao.PrefixoServico + nome)
+
+	servico.logger.Println("Conta de serviço apagada: ", nome)
+	retorno["sucesso"] = true
+	return
+}
+
+// ListarContasServico Action que devolve as contas de serviço e os seus scopes, sem os segredos
+func (servico *Servico) ListarContasServico(token string) (retorno map[string]interface{}) {
+	retorno = make(map[string]interface{})
+
+	keys, err := servico.estado.Procurar(prefixoContaServico)
+	if err != nil {
+		retorno["erro"] = "Erro ao buscar as contas de serviço"
+		return
+	}
+	sort.Strings(keys)
+
+	contas := make([]ContaServico, 0, len(keys))
+	for _, key := range keys {
+		conta, err := servico.getContaServico(strings.TrimPrefix(key, prefixoContaServico))
+		if err != nil {
+			continue
+		}
+		conta.Segredo = ""
+		contas = append(contas, conta)
+	}
+	retorno["contas"] = contas
+	return
+}
+
+// responderToken Escreve a resposta do endpoint de tokens, no formato do OAuth 2.0 (RFC 6749)
+func (servico *Servico) responderToken(rw http.ResponseWriter, estado int, resposta map[string]interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Cache-Control", "no-store")
+	if estado == http.StatusUnauthorized {
+		rw.Header().Set("WWW-Authenticate", `Basic realm="robin"`)
+	}
+	rw.WriteHeader(estado)
+	if err := json.NewEncoder(rw).Encode(resposta); err != nil {
+		servico.loggerErros.Println("Erro: ", err)
+	}
+}
+
+// TokenServicoHandler Endpoint http que emite as tokens de serviço (grant client_credentials do OAuth 2.0),
+// recebe no form (POST) o grant_type, o client_id e o client_secret (ou em HTTP Basic) e os scopes opcionais no campo scope,
+// sem scope a token têm todos os scopes da conta. Os segredos errados são contados por conta e por IP,
+// com o atraso e o bloqueio do login (429 enquanto durar), e registados na auditoria
+func (servico *Servico) TokenServicoHandler(rw http.ResponseWriter, r *http.Request) {
+	nome, segredo, basic := r.BasicAuth()
+	if !basic {
+		nome, segredo = r.PostFormValue("client_id"), r.PostFormValue("client_secret")
+	}
+
+	retorno := make(map[string]interface{})
+	ctx := acoes.ComPedido(r.Context(), acoes.NovoPedido(r, servico.confiarProxy))
+	defer servico.auditarAcao(ctx, EventoTokenServico, "", autorizacao.PrefixoServico+nome, retorno, map[string]interface{}{"scope": r.PostFormValue("scope")})
+
+	if r.PostFormValue("grant_type") != "client_credentials" {
+		retorno["erro"] = "unsupported_grant_type"
+		servico.responderToken(rw, http.StatusBadRequest, map[string]interface{}{"error": "unsupported_grant_type"})
+		return
+	}
+
+	// As falhas são contadas por conta de serviço e por IP, com os mesmos atrasos e bloqueios do login
+	alvos := alvosServico(ctx, nome)
+	if restante := servico.loginBloqueado(alvos); restante > 0 {
+		servico.logger.Println("Erro: ", "pedido de token de serviço bloqueado para ", alvos)
+		retorno["erro"] = "bloqueado"
+		rw.Header().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(restante.Seconds())), 10))
+		servico.responderToken(rw, http.StatusTooManyRequests, map[string]interface{}{
+			"error":             "invalid_client",
+			"error_description": mensagemLoginBloqueado,
+		})
+		return
+	}
+
+	conta, err := servico.getContaServico(nome)
+	if nome == "" || err != nil || subtle.ConstantTimeCompare([]byte(hashSegredoServico(segredo)), []byte(conta.Segredo)) != 1 {
+		servico.registarFalhaLogin(alvos)
+		retorno["erro"] = "invalid_client"
+		servico.responderToken(rw, http.StatusUnauthorized, map[string]interface{}{"error": "invalid_client"})
+		return
+	}
+	servico.limparFalhas(alvoServico, conta.Nome)
+
+	scopes := conta.Scopes
+	if pedidos := r.PostFormValue("scope"); pedidos != "" {
+		lista, ok := scopesPedidos(pedidos)
+		for _, scope := range lista {
+			ok = ok && contem(conta.Scopes, scope)
+		}
+		if !ok {
+			retorno["erro"] = "invalid_scope"
+			servico.responderToken(rw, http.StatusBadRequest, map[string]interface{}{
+				"error":             "invalid_scope",
+				"error_description": "A conta de serviço não pode pedir os scopes indicados",
+			})
+			return
+		}
+		scopes = lista
+	}
+
+	token, err := servico.emitirTokenServico(conta.Nome, scopes)
+	if err != nil {
+		servico.loggerErros.Println("Erro ao emitir a token de serviço: ", err)
+		retorno["erro"] = "server_error"
+		servico.responderToken(rw, http.StatusInternalServerError, map[string]interface{}{"error": "server_error"})
+		return
+	}
+
+	servico.responderToken(rw, http.StatusOK, map[string]interface{}{
+		"access_token": token,
+		"token_type":   "Bearer",
+		"expires_in":   int64(duracaoTokenServico / time.Second),
+		"scope":        strings.Join(scopes, " "),
+	})
+}
@@ -0,0 +1,65 @@
+package authhandlers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ErrRegistoNaoExiste não existe nenhum registo com a key pedida (ou já expirou).
+// Os outros erros do Estado são falhas do armazenamento, e não podem ser tratados como um registo inexistente
+var ErrRegistoNaoExiste = errors.New("o registo não existe")
+
+// ErrConflitoRegisto o registo foi alterado por outro pedido entre a leitura e a escrita
+var ErrConflitoRegisto = errors.New("o registo foi alterado por outro pedido, tente novamente")
+
+// Estado Armazenamento do estado do serviço que não são os users: tokens de refresh, revogações, falhas e bloqueios
+// de login, chaves de assinatura, roles, contas de serviço e tokens de reset. Os registos são strings com uma
+// expiração opcional, os contadores de ocorrências são janelas deslizantes e os sets não têm ordem
+type Estado interface {
+	// Get Busca o valor do registo, ErrRegistoNaoExiste se não existir
+	Get(key string) (string, error)
+	// Guardar Cria ou substitui o registo, expira == 0 não expira
+	Guardar(key string, valor string, expira time.Duration) error
+	// InserirSeNaoExiste Cria o registo só se a key não existir, devolve true se o registo foi criado
+	InserirSeNaoExiste(key string, valor string, expira time.Duration) (bool, error)
+	// TrocarValor Substitui o valor de um registo existente, mantendo a expiração, e devolve o valor anterior,
+	// numa só operação. ErrRegistoNaoExiste se não existir
+	TrocarValor(key string, valor string) (string, error)
+	// TrocarSeIgual Substitui o valor do registo, mantendo a expiração, só se o valor guardado ainda for o esperado
+	// (compare-and-swap), senão devolve ErrConflitoRegisto. ErrRegistoNaoExiste se não existir
+	TrocarSeIgual(key string, esperado string, valor string) error
+	// Consumir Busca e apaga o registo numa só operação, ErrRegistoNaoExiste se não existir (ou já foi consumido)
+	Consumir(key string) (string, error)
+	// Apagar Apaga as keys (registos, contadores ou sets), as que não existem são ignoradas
+	Apagar(keys ...string) error
+	// Procurar Devolve todas as keys começadas pelo prefixo
+	Procurar(prefixo string) ([]string, error)
+	// TempoRestante Tempo até o registo expirar, 0 se não existir ou não expirar
+	TempoRestante(key string) (time.Duration, error)
+	// RegistarOcorrencia Regista uma ocorrência no momento atual e devolve o número de ocorrências dentro da janela,
+	// o contador expira se não houver ocorrências durante a janela
+	RegistarOcorrencia(key string, janela time.Duration) (int64, error)
+	// ContarOcorrencias Número de ocorrências registadas dentro da janela
+	ContarOcorrencias(key string, janela time.Duration) (int64, error)
+	// AdicionarMembros Adiciona os membros ao set, cria o set se não existir
+	AdicionarMembros(key string, membros ...string) error
+	// Membros Devolve os membros do set, um set inexistente não têm membros
+	Membros(key string) ([]string, error)
+}
+
+// NovoEstado Cria o armazenamento do estado do backend pedido (BackendRedis ou BackendMemoria),
+// o cliente redis só é usado pelo BackendRedis
+func NovoEstado(backend string, cliente *redis.Client) (Estado, error) {
+	switch backend {
+	case BackendRedis, "":
+		if cliente == nil {
+			return nil, errors.New("o backend redis precisa de um cliente redis")
+		}
+		return NovoEstadoRedis(cliente), nil
+	case BackendMemoria:
+		return NovoEstadoMemoria(), nil
+	}
+	return nil, errors.New("backend do estado desconhecido: " + backend)
+}
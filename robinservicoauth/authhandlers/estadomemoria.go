@@ -0,0 +1,229 @@
+package authhandlers
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// registoMemoria Registo, contador de ocorrências ou set guardado pelo EstadoMemoria
+type registoMemoria struct {
+	valor       string
+	ocorrencias []time.Time
+	membros     map[string]bool
+	expira      time.Time // zero se não expirar
+}
+
+// expirado Indica se o registo já expirou no momento indicado
+func (registo *registoMemoria) expirado(agora time.Time) bool {
+	return !registo.expira.IsZero() && !agora.Before(registo.expira)
+}
+
+// EstadoMemoria Guarda o estado do serviço na memória, perde-se quando o serviço termina e não é partilhado
+// entre instâncias. Usado nos testes e em desenvolvimento, com o BackendMemoria
+type EstadoMemoria struct {
+	mutex    sync.Mutex
+	registos map[string]*registoMemoria
+}
+
+// NovoEstadoMemoria Cria um armazenamento do estado vazio
+func NovoEstadoMemoria() *EstadoMemoria {
+	return &EstadoMemoria{registos: make(map[string]*registoMemoria)}
+}
+
+// get Devolve o registo da key, apaga-o se já expirou. Tem de ser chamado com o mutex obtido
+func (estado *EstadoMemoria) get(key string, agora time.Time) (*registoMemoria, bool) {
+	registo, existe := estado.registos[key]
+	if existe && registo.expirado(agora) {
+		delete(estado.registos, key)
+		return nil, false
+	}
+	return registo, existe
+}
+
+// expiracao Momento em que um registo criado agora expira, zero se expira == 0
+func expiracao(agora time.Time, expira time.Duration) time.Time {
+	if expira <= 0 {
+		return time.Time{}
+	}
+	return agora.Add(expira)
+}
+
+// Get Busca o valor do registo, ErrRegistoNaoExiste se não existir
+func (estado *EstadoMemoria) Get(key string) (string, error) {
+	estado.mutex.Lock()
+	defer estado.mutex.Unlock()
+	registo, existe := estado.get(key, time.Now())
+	if !existe {
+		return "", ErrRegistoNaoExiste
+	}
+	return registo.valor, nil
+}
+
+// Guardar Cria ou substitui o registo, expira == 0 não expira
+func (estado *EstadoMemoria) Guardar(key string, valor string, expira time.Duration) error {
+	estado.mutex.Lock()
+	defer estado.mutex.Unlock()
+	estado.registos[key] = &registoMemoria{valor: valor, expira: expiracao(time.Now(), expira)}
+	return nil
+}
+
+// InserirSeNaoExiste Cria o registo só se a key não existir
+func (estado *EstadoMemoria) InserirSeNaoExiste(key string, valor string, expira time.Duration) (bool, error) {
+	estado.mutex.Lock()
+	defer estado.mutex.Unlock()
+	agora := time.Now()
+	if _, existe := estado.get(key, agora); existe {
+		return false, nil
+	}
+	estado.registos[key] = &registoMemoria{valor: valor, expira: expiracao(agora, expira)}
+	return true, nil
+}
+
+// TrocarValor Substitui o valor de um registo existente, mantendo a expiração, e devolve o anterior
+func (estado *EstadoMemoria) TrocarValor(key string, valor string) (string, error) {
+	estado.mutex.Lock()
+	defer estado.mutex.Unlock()
+	registo, existe := estado.get(key, time.Now())
+	if !existe {
+		return "", ErrRegistoNaoExiste
+	}
+	anterior := registo.valor
+	registo.valor = valor
+	return anterior, nil
+}
+
+// TrocarSeIgual Substitui o valor do registo, mantendo a expiração, só se ainda for o esperado
+func (estado *EstadoMemoria) TrocarSeIgual(key string, esperado string, valor string) error {
+	estado.mutex.Lock()
+	defer estado.mutex.Unlock()
+	registo, existe := estado.get(key, time.Now())
+	if !existe {
+		return ErrRegistoNaoExiste
+	}
+	if registo.valor != esperado {
+		return ErrConflitoRegisto
+	}
+	registo.valor = valor
+	return nil
+}
+
+// Consumir Busca e apaga o registo
+func (estado *EstadoMemoria) Consumir(key string) (string, error) {
+	estado.mutex.Lock()
+	defer estado.mutex.Unlock()
+	registo, existe := estado.get(key, time.Now())
+	if !existe {
+		return "", ErrRegistoNaoExiste
+	}
+	delete(estado.registos, key)
+	return registo.valor, nil
+}
+
+// Apagar Apaga as keys, as que não existem são ignoradas
+func (estado *EstadoMemoria) Apagar(keys ...string) error {
+	estado.mutex.Lock()
+	defer estado.mutex.Unlock()
+	for _, key := range keys {
+		delete(estado.registos, key)
+	}
+	return nil
+}
+
+// Procurar Devolve todas as keys começadas pelo prefixo, por ordem alfabética
+func (estado *EstadoMemoria) Procurar(prefixo string) ([]string, error) {
+	estado.mutex.Lock()
+	defer estado.mutex.Unlock()
+	agora := time.Now()
+	keys := make([]string, 0)
+	for key := range estado.registos {
+		if _, existe := estado.get(key, agora); existe && strings.HasPrefix(key, prefixo) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// TempoRestante Tempo até o registo expirar, 0 se não existir ou não expirar
+func (estado *EstadoMemoria) TempoRestante(key string) (time.Duration, error) {
+	estado.mutex.Lock()
+	defer estado.mutex.Unlock()
+	agora := time.Now()
+	registo, existe := estado.get(key, agora)
+	if !existe || registo.expira.IsZero() {
+		return 0, nil
+	}
+	return registo.expira.Sub(agora), nil
+}
+
+// RegistarOcorrencia Regista uma ocorrência agora, descarta as anteriores à janela e devolve as restantes
+func (estado *EstadoMemoria) RegistarOcorrencia(key string, janela time.Duration) (int64, error) {
+	estado.mutex.Lock()
+	defer estado.mutex.Unlock()
+	agora := time.Now()
+	registo, existe := estado.get(key, agora)
+	if !existe {
+		registo = &registoMemoria{}
+		estado.registos[key] = registo
+	}
+	registo.ocorrencias = append(ocorrenciasDesde(registo.ocorrencias, agora.Add(-janela)), agora)
+	registo.expira = agora.Add(janela)
+	return int64(len(registo.ocorrencias)), nil
+}
+
+// ContarOcorrencias Número de ocorrências dentro da janela
+func (estado *EstadoMemoria) ContarOcorrencias(key string, janela time.Duration) (int64, error) {
+	estado.mutex.Lock()
+	defer estado.mutex.Unlock()
+	agora := time.Now()
+	registo, existe := estado.get(key, agora)
+	if !existe {
+		return 0, nil
+	}
+	return int64(len(ocorrenciasDesde(registo.ocorrencias, agora.Add(-janela)))), nil
+}
+
+// ocorrenciasDesde Devolve as ocorrências posteriores ao início da janela
+func ocorrenciasDesde(ocorrencias []time.Time, inicio time.Time) []time.Time {
+	restantes := ocorrencias[:0]
+	for _, ocorrencia := range ocorrencias {
+		if ocorrencia.After(inicio) {
+			restantes = append(restantes, ocorrencia)
+		}
+	}
+	return restantes
+}
+
+// AdicionarMembros Adiciona os membros ao set da key
+func (estado *EstadoMemoria) AdicionarMembros(key string, membros ...string) error {
+	estado.mutex.Lock()
+	defer estado.mutex.Unlock()
+	registo, existe := estado.get(key, time.Now())
+	if !existe {
+		registo = &registoMemoria{}
+		estado.registos[key] = registo
+	}
+	if registo.membros == nil {
+		registo.membros = make(map[string]bool)
+	}
+	for _, membro := range membros {
+		registo.membros[membro] = true
+	}
+	return nil
+}
+
+// Membros Devolve os membros do set da key, por ordem alfabética
+func (estado *EstadoMemoria) Membros(key string) ([]string, error) {
+	estado.mutex.Lock()
+	defer estado.mutex.Unlock()
+	membros := make([]string, 0)
+	if registo, existe := estado.get(key, time.Now()); existe {
+		for membro := range registo.membros {
+			membros = append(membros, membro)
+		}
+	}
+	sort.Strings(membros)
+	return membros, nil
+}
@@ -0,0 +1,129 @@
+package authhandlers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/tomascpmarques/PAP/backend/robinservicoauth/redishandle"
+)
+
+// EstadoRedis Guarda o estado do serviço no redis, cada registo na sua key (ex: refresh:<jti>),
+// os contadores de ocorrências em sorted sets e os sets em sets redis
+type EstadoRedis struct {
+	cliente *redis.Client
+}
+
+// NovoEstadoRedis Cria o armazenamento do estado no redis do cliente fornecido
+func NovoEstadoRedis(cliente *redis.Client) *EstadoRedis {
+	return &EstadoRedis{cliente: cliente}
+}
+
+// erroEstado Converte os erros de registo inexistente do redishandle no ErrRegistoNaoExiste
+func erroEstado(err error) error {
+	if errors.Is(err, redishandle.ErrSemRegisto) {
+		return ErrRegistoNaoExiste
+	}
+	return err
+}
+
+// Get Busca o valor do registo, ErrRegistoNaoExiste se não existir
+func (estado *EstadoRedis) Get(key string) (string, error) {
+	valor, err := redishandle.GetRegistoBD(estado.cliente, key, 0)
+	if err != nil {
+		return "", erroEstado(err)
+	}
+	return valor, nil
+}
+
+// Guardar Cria ou substitui o registo, expira == 0 não expira
+func (estado *EstadoRedis) Guardar(key string, valor string, expira time.Duration) error {
+	return estado.cliente.Set(context.Background(), key, valor, expira).Err()
+}
+
+// InserirSeNaoExiste Cria o registo só se a key não existir (SETNX)
+func (estado *EstadoRedis) InserirSeNaoExiste(key string, valor string, expira time.Duration) (bool, error) {
+	return redishandle.InserirSeNaoExisteBD(estado.cliente, redishandle.RegistoRedisDB{Key: key, Valor: valor, Expira: expira})
+}
+
+// TrocarValor Substitui o valor de um registo existente e devolve o anterior (ver redishandle.TrocarValorRegistoBD)
+func (estado *EstadoRedis) TrocarValor(key string, valor string) (string, error) {
+	anterior, err := redishandle.TrocarValorRegistoBD(estado.cliente, key, valor)
+	return anterior, erroEstado(err)
+}
+
+// TrocarSeIgual Substitui o valor do registo numa transação (WATCH/MULTI), só se ainda for o esperado
+func (estado *EstadoRedis) TrocarSeIgual(key string, esperado string, valor string) error {
+	ctx := context.Background()
+	err := redishandle.TransacaoBD(estado.cliente, func(tx *redis.Tx) error {
+		atual, err := tx.Get(ctx, key).Result()
+		if err == redis.Nil {
+			return ErrRegistoNaoExiste
+		}
+		if err != nil {
+			return err
+		}
+		if atual != esperado {
+			return ErrConflitoRegisto
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, valor, redis.KeepTTL)
+			return nil
+		})
+		return err
+	}, key)
+	if errors.Is(err, redishandle.ErrConflitoRegisto) {
+		return ErrConflitoRegisto
+	}
+	return err
+}
+
+// Consumir Busca e apaga o registo numa só operação (ver redishandle.ConsumirRegistoBD)
+func (estado *EstadoRedis) Consumir(key string) (string, error) {
+	valor, err := redishandle.ConsumirRegistoBD(estado.cliente, key)
+	return valor, erroEstado(err)
+}
+
+// Apagar Apaga as keys, as que não existem são ignoradas
+func (estado *EstadoRedis) Apagar(keys ...string) error {
+	return redishandle.ApagarKeysBD(estado.cliente, keys...)
+}
+
+// Procurar Devolve todas as keys começadas pelo prefixo, com SCAN
+func (estado *EstadoRedis) Procurar(prefixo string) ([]string, error) {
+	return redishandle.ProcurarKeysBD(estado.cliente, redishandle.EscaparPadraoBD(prefixo)+"*")
+}
+
+// TempoRestante Tempo até o registo expirar, 0 se não existir ou não expirar
+func (estado *EstadoRedis) TempoRestante(key string) (time.Duration, error) {
+	restante, err := estado.cliente.PTTL(context.Background(), key).Result()
+	if err != nil {
+		return 0, err
+	}
+	if restante < 0 {
+		return 0, nil
+	}
+	return restante, nil
+}
+
+// RegistarOcorrencia Regista uma ocorrência no sorted set da key (ver redishandle.RegistarOcorrenciaBD)
+func (estado *EstadoRedis) RegistarOcorrencia(key string, janela time.Duration) (int64, error) {
+	return redishandle.RegistarOcorrenciaBD(estado.cliente, key, janela)
+}
+
+// ContarOcorrencias Número de ocorrências do sorted set da key dentro da janela
+func (estado *EstadoRedis) ContarOcorrencias(key string, janela time.Duration) (int64, error) {
+	return redishandle.ContarOcorrenciasBD(estado.cliente, key, janela)
+}
+
+// AdicionarMembros Adiciona os membros ao set da key
+func (estado *EstadoRedis) AdicionarMembros(key string, membros ...string) error {
+	return redishandle.AdicionarMembrosBD(estado.cliente, key, membros...)
+}
+
+// Membros Devolve os membros do set da key
+func (estado *EstadoRedis) Membros(key string) ([]string, error) {
+	return redishandle.BuscarMembrosBD(estado.cliente, key)
+}
@@ -0,0 +1,334 @@
+package authhandlers
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Estados da conta de um user
+const (
+	// EstadoAtivo a conta pode iniciar sessão
+	EstadoAtivo = "ativo"
+	// EstadoPendente a conta foi criada por convite, e fica ativa quando o user define a password
+	EstadoPendente = "pendente"
+	// EstadoDesativado a conta foi desativada por um administrador, os dados do user (ex: userinfo) são mantidos
+	EstadoDesativado = "desativado"
+	// EstadoBloqueado a conta foi bloqueada por um administrador (ex: suspeita de acesso indevido)
+	EstadoBloqueado = "bloqueado"
+	// EstadoExpirado o prazo da conta temporária passou
+	EstadoExpirado = "expirado"
+)
+
+var (
+	// ErrContaPendente a conta ainda não foi ativada pelo user
+	ErrContaPendente = errors.New("a conta ainda não foi ativada")
+	// ErrContaDesativada a conta foi desativada
+	ErrContaDesativada = errors.New("a conta está desativada")
+	// ErrContaBloqueada a conta foi bloqueada
+	ErrContaBloqueada = errors.New("a conta está bloqueada")
+	// ErrContaExpirada o prazo da conta passou
+	ErrContaExpirada = errors.New("a conta expirou")
+)
+
+// errosEstados erro devolvido pelo ContaAtiva para cada estado inativo
+var errosEstados = map[string]error{
+	EstadoPendente:   ErrContaPendente,
+	EstadoDesativado: ErrContaDesativada,
+	EstadoBloqueado:  ErrContaBloqueada,
+	EstadoExpirado:   ErrContaExpirada,
+}
+
+// intervaloVarrimentoDefault intervalo entre as procuras das contas expiradas, se não for configurado
+const intervaloVarrimentoDefault = time.Minute * 5
+
+// EstadoEfetivo Devolve o estado da conta no momento agora, uma conta cujo prazo já passou está expirada,
+// mesmo que o varrimento ainda não lhe tenha mudado o estado
+func (user User) EstadoEfetivo(agora time.Time) string {
+	estado := user.Estado
+	if estado == "" {
+		estado = EstadoAtivo
+	}
+	if estado == EstadoAtivo && user.ExpiraEm != nil && !agora.Before(*user.ExpiraEm) {
+		return EstadoExpirado
+	}
+	return estado
+}
+
+// ContaAtiva Verifica se a conta pode iniciar sessão e usar as suas tokens, devolve o erro do estado se não puder
+func (user User) ContaAtiva(agora time.Time) error {
+	estado := user.EstadoEfetivo(agora)
+	if estado == EstadoAtivo {
+		return nil
+	}
+	if err, existe := errosEstados[estado]; existe {
+		return err
+	}
+	return ErrContaDesativada
+}
+
+// mensagemEstadoConta Mensagem devolvida ao user quando a conta não está ativa
+func mensagemEstadoConta(err error) string {
+	switch err {
+	case ErrContaPendente:
+		return "A conta ainda não foi ativada, defina a password com a token que recebeu"
+	case ErrContaExpirada:
+		return "A conta expirou, contacte um administrador"
+	case ErrContaBloqueada:
+		return "A conta está bloqueada, contacte um administrador"
+	}
+	return "A conta está desativada, contacte um administrador"
+}
+
+// registarLogin Guarda o momento do login no registo do user, só se o registo não tiver mudado entretanto
+func (servico *Servico) registarLogin(user User) {
+	agora := time.Now()
+	novo := user
+	novo.UltimoLogin = &agora
+	if err := servico.users.Trocar(user, novo); err != nil {
+		servico.logger.Println("Erro ao registar o login de ", user.Username, ": ", err)
+	}
+}
+
+// ultimoRootAtivo Indica se o user é o único ROOT com a conta ativa, a plataforma não pode ficar sem um ROOT que inicie sessão
+func (servico *Servico) ultimoRootAtivo(user string) bool {
+	membros, err := servico.users.Listar(RoleRoot)
+	if err != nil {
+		return true
+	}
+	for _, membro := range membros {
+		if membro == user {
+			continue
+		}
+		if root, err := servico.users.Get(membro); err == nil && root.ContaAtiva(time.Now()) == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// alterarEstadoConta Muda o estado da conta do user, e revoga as tokens do user se a conta deixar de estar ativa.
+// Só o ROOT pode alterar as contas dos administradores, e o último ROOT ativo não pode ser desativado
+func (servico *Servico) alterarEstadoConta(user string, estado string, motivo string, token string) map[string]interface{} {
+	retorno := make(map[string]interface{})
+
+	utilizador, err := servico.GetUserParaValorStruct(user)
+	if err != nil {
+		retorno["erro"] = "Sem registo para <" + user + ">"
+		return retorno
+	}
+	if servico.Privilegiado(utilizador) {
+		if err := servico.exigirGestaoAdmins(token); err != nil {
+			servico.logger.Println("Error: ", "tentativa de alterar o estado de um administrador sem permissões")
+			retorno["erro"] = "Só o ROOT pode alterar o estado dos administradores"
+			return retorno
+		}
+	}
+	if estado != EstadoAtivo && contem(utilizador.RolesEfetivos(), RoleRoot) && servico.ultimoRootAtivo(user) {
+		retorno["erro"] = "Não é possivél desativar o último ROOT ativo"
+		return retorno
+	}
+	if estado == EstadoAtivo && utilizador.ExpiraEm != nil && !time.Now().Before(*utilizador.ExpiraEm) {
+		retorno["erro"] = "O prazo da conta já passou, defina primeiro uma nova expiração (DefinirExpiracaoUser)"
+		return retorno
+	}
+
+	novo := utilizador
+	novo.Estado = estado
+	novo.MotivoEstado = motivo
+	if err := servico.users.Trocar(utilizador, novo); err != nil {
+		servico.logger.Println("Error: ", err)
+		retorno["erro"] = err.Error()
+		return retorno
+	}
+	if estado != EstadoAtivo {
+		servico.RevogarTokensUser(user)
+	}
+
+	servico.logger.Println("Conta do utilizador, ", user, ", passou ao estado ", estado)
+	retorno["estado"] = estado
+	return retorno
+}
+
+// DesativarUser Action que desativa a conta do user, sem apagar os seus dados (ex: a informação no serviço userinfo),
+// as sessões do user terminam e a conta pode voltar a ser ativada com o ReativarUser
+func (servico *Servico) DesativarUser(ctx context.Context, user string, motivo string, token string) (retorno map[string]interface{}) {
+	retorno = servico.alterarEstadoConta(user, EstadoDesativado, motivo, token)
+	servico.auditarAcao(ctx, EventoUserDesativado, token, user, retorno, map[string]interface{}{"motivo": motivo})
+	return
+}
+
+// BloquearUser Action que bloqueia a conta do user (ex: suspeita de acesso indevido), como o DesativarUser
+func (servico *Servico) BloquearUser(ctx context.Context, user string, motivo string, token string) (retorno map[string]interface{}) {
+	retorno = servico.alterarEstadoConta(user, EstadoBloqueado, motivo, token)
+	servico.auditarAcao(ctx, EventoUserBloqueado, token, user, retorno, map[string]interface{}{"motivo": motivo})
+	return
+}
+
+// ReativarUser Action que volta a ativar a conta desativada, bloqueada ou expirada do user,
+// as contas expiradas precisam antes de um prazo novo (ou de deixarem de expirar)
+func (servico *Servico) ReativarUser(ctx context.Context, user string, token string) (retorno map[string]interface{}) {
+	retorno = servico.alterarEstadoConta(user, EstadoAtivo, "", token)
+	servico.auditarAcao(ctx, EventoUserReativado, token, user, retorno, nil)
+	return
+}
+
+// DefinirExpiracaoUser Action que define o prazo da conta (temporária) do user, no formato RFC3339
+// (ex: "2021-07-31T23:59:59Z"), ou "nunca" para a conta deixar de expirar. Não reativa as contas já expiradas
+func (servico *Servico) DefinirExpiracaoUser(ctx context.Context, user string, expira string, token string) (retorno map[string]interface{}) {
+	retorno = make(map[string]interface{})
+	defer servico.auditarAcao(ctx, EventoExpiracaoDefinida, token, user, retorno, map[string]interface{}{"expira": expira})
+
+	var prazo *time.Time
+	if expira != "nunca" {
+		momento, err := time.Parse(time.RFC3339, expira)
+		if err != nil {
+			retorno["erro"] = "A expiração têm de estar no formato RFC3339 (ex: 2021-07-31T23:59:59Z), ou ser \"nunca\""
+			return
+		}
+		prazo = &momento
+	}
+
+	utilizador, err := servico.GetUserParaValorStruct(user)
+	if err != nil {
+		retorno["erro"] = "Sem registo para <" + user + ">"
+		return
+	}
+	if servico.Privilegiado(utilizador) {
+		if err := servico.exigirGestaoAdmins(token); err != nil {
+			retorno["erro"] = "Só o ROOT pode alterar o estado dos administradores"
+			return
+		}
+	}
+
+	novo := utilizador
+	novo.ExpiraEm = prazo
+	if err := servico.users.Trocar(utilizador, novo); err != nil {
+		servico.logger.Println("Error: ", err)
+		retorno["erro"] = err.Error()
+		return
+	}
+
+	retorno["expira_em"] = prazo
+	retorno["estado"] = novo.EstadoEfetivo(time.Now())
+	return
+}
+
+// ConvidarUser Action que cria a conta do user no estado pendente, com uma password aleatória, e lhe envia
+// pelo notificador uma token para definir a password (ConcluirResetPassword), que ativa a conta.
+// Só o ROOT pode convidar utilizadores com privilégios de administração
+func (servico *Servico) ConvidarUser(ctx context.Context, user string, email string, perms int, token string) (retorno map[string]interface{}) {
+	retorno = make(map[string]interface{})
+	defer servico.auditarAcao(ctx, EventoUserConvidado, token, user, retorno, map[string]interface{}{"perms": perms})
+
+	// Sem notificador o convite nunca chegava ao user, e a conta ficava pendente para sempre
+	if servico.notificador == nil {
+		retorno["erro"] = mensagemSemNotificador
+		return
+	}
+	if !nomeUserValido.MatchString(user) {
+		retorno["erro"] = "Nome de utilizador inválido"
+		return
+	}
+	if !emailValido(email) {
+		retorno["erro"] = "Email inválido"
+		return
+	}
+	if perms < ROOT || perms > USER {
+		retorno["erro"] = "Permissões fora dos valores permitidos, entre 1 e 3"
+		return
+	}
+	if perms <= ADMIN {
+		if err := servico.exigirGestaoAdmins(token); err != nil {
+			retorno["erro"] = "Só o ROOT pode convidar administradores"
+			return
+		}
+	}
+	// A password aleatória nunca é conhecida, o user define a sua com a token do convite
+	passwordInicial, err := gerarSegredoServico()
+	if err != nil {
+		retorno["erro"] = "Erro ao criar a conta"
+		return
+	}
+	novoUser, err := CriarNovoUser(user, passwordInicial, perms)
+	if err != nil {
+		retorno["erro"] = err.Error()
+		return
+	}
+	novoUser.Email = email
+	novoUser.Estado = EstadoPendente
+	if err := servico.users.Criar(novoUser); err != nil {
+		servico.loggerBD.Println("Erro: ", err)
+		if errors.Is(err, ErrUserExiste) {
+			retorno["erro"] = "O utilizador já existe"
+			return
+		}
+		retorno["erro"] = err.Error()
+		return
+	}
+	if err := servico.enviarTokenReset(novoUser); err != nil {
+		servico.logger.Println("Erro ao enviar o convite para ", user, ": ", err)
+		retorno["erro"] = "A conta foi criada, mas o convite não foi enviado, use o PedirResetPassword para o reenviar"
+		return
+	}
+
+	servico.logger.Println("Utilizador, ", user, ", convidado")
+	retorno["estado"] = EstadoPendente
+	return
+}
+
+// VarrerContasExpiradas Passa ao estado expirado as contas ativas cujo prazo já passou, e revoga as suas tokens,
+// devolve o número de contas expiradas
+func (servico *Servico) VarrerContasExpiradas(agora time.Time) (int, error) {
+	nomes, err := servico.users.Listar("")
+	if err != nil {
+		return 0, err
+	}
+
+	expiradas := 0
+	for _, nome := range nomes {
+		utilizador, err := servico.users.Get(nome)
+		if err != nil || utilizador.Estado == EstadoExpirado || utilizador.EstadoEfetivo(agora) != EstadoExpirado {
+			continue
+		}
+
+		novo := utilizador
+		novo.Estado = EstadoExpirado
+		novo.MotivoEstado = "O prazo da conta passou"
+		if err := servico.users.Trocar(utilizador, novo); err != nil {
+			// O registo mudou entretanto (ex: expiração alterada), a conta é vista no próximo varrimento
+			servico.logger.Println("Erro ao expirar a conta de ", nome, ": ", err)
+			continue
+		}
+		servico.RevogarTokensUser(nome)
+		servico.auditarSistema(EventoContaExpirada, nome, map[string]interface{}{"expira_em": utilizador.ExpiraEm})
+		expiradas++
+	}
+	return expiradas, nil
+}
+
+// VarrerContasPeriodicamente Procura as contas expiradas a cada intervalo (intervaloVarrimentoDefault se intervalo <= 0),
+// até o contexto terminar
+func (servico *Servico) VarrerContasPeriodicamente(ctx context.Context, intervalo time.Duration) {
+	if intervalo <= 0 {
+		intervalo = intervaloVarrimentoDefault
+	}
+	relogio := time.NewTicker(intervalo)
+	defer relogio.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case agora := <-relogio.C:
+			expiradas, err := servico.VarrerContasExpiradas(agora)
+			if err != nil {
+				servico.loggerErros.Println("Erro ao procurar as contas expiradas: ", err)
+				continue
+			}
+			if expiradas > 0 {
+				servico.logger.Println("Contas expiradas: ", expiradas)
+			}
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package authhandlers
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// versaoHashAtual versão dos parametros de hash usada para novas passwords,
+// registos com versões anteriores são atualizados no próximo login com sucesso
+const versaoHashAtual = 1
+
+// ParametrosHash Guarda os parametros argon2id usados para criar a hash da password de um user
+type ParametrosHash struct {
+	Versao      int    `json:"versao"`
+	Memoria     uint32 `json:"memoria"`     // Memória usada pelo argon2id em KiB
+	Iteracoes   uint32 `json:"iteracoes"`   // Número de passagens sobre a memória
+	Paralelismo uint8  `json:"paralelismo"` // Número de threads usadas
+	TamanhoHash uint32 `json:"tamanho"`     // Tamanho da hash em bytes
+	Salt        string `json:"salt"`        // Salt do user, em base64
+}
+
+// parametrosPorVersao Parametros argon2id para cada versão de hash suportada
+var parametrosPorVersao = map[int]ParametrosHash{
+	1: {
+		Versao:      1,
+		Memoria:     64 * 1024,
+		Iteracoes:   1,
+		Paralelismo: 4,
+		TamanhoHash: 32,
+	},
+}
+
+// GerarHashPassword Cria uma hash argon2id para a password fornecida, com um salt novo,
+// devolve a hash em base64 e os parametros usados para a criar
+func GerarHashPassword(password string) (string, *ParametrosHash, error) {
+	params := parametrosPorVersao[versaoHashAtual]
+
+	// Salt aleatório e único para cada password
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", nil, err
+	}
+	params.Salt = base64.RawStdEncoding.EncodeToString(salt)
+
+	hash := argon2.IDKey([]byte(password), salt, params.Iteracoes, params.Memoria, params.Paralelismo, params.TamanhoHash)
+	return base64.RawStdEncoding.EncodeToString(hash), &params, nil
+}
+
+// DefinirPassword Substitui a password do user pela hash da password fornecida
+func (user *User) DefinirPassword(password string) error {
+	if password == "" {
+		return errors.New("a password não pode ser vazia")
+	}
+
+	hash, params, err := GerarHashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	agora := time.Now()
+	user.Password = hash
+	user.Hash = params
+	user.PasswordMudadaEm = &agora
+	return nil
+}
+
+// VerificarPassword Compara a password fornecida com a guardada no registo do user,
+// os registos sem parametros de hash (legacy) são comparados diretamente
+func (user User) VerificarPassword(password string) bool {
+	// Registo legacy, a password está guardada tal como foi enviada pelo cliente
+	if user.Hash == nil {
+		return subtle.ConstantTimeCompare([]byte(user.Password), []byte(password)) == 1
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(user.Hash.Salt)
+	if err != nil {
+		return false
+	}
+	hashGuardada, err := base64.RawStdEncoding.DecodeString(user.Password)
+	if err != nil {
+		return false
+	}
+
+	hash := argon2.IDKey([]byte(password), salt, user.Hash.Iteracoes, user.Hash.Memoria, user.Hash.Paralelismo, user.Hash.TamanhoHash)
+	return subtle.ConstantTimeCompare(hash, hashGuardada) == 1
+}
+
+// PrecisaRehash Indica se a password do user foi guardada sem hash ou com parametros desatualizados
+func (user User) PrecisaRehash() bool {
+	return user.Hash == nil || user.Hash.Versao < versaoHashAtual
+}
@@ -0,0 +1,184 @@
+package authhandlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/autorizacao"
+)
+
+const (
+	// duracaoTokenAcesso tempo de vida das tokens de acesso devolvidas no login
+	duracaoTokenAcesso = time.Minute * 40
+	// duracaoTokenRefresh tempo de vida das tokens de refresh, renovado em cada rotação
+	duracaoTokenRefresh = time.Hour * 24 * 7
+
+	// prefixoRefresh prefixo das keys que guardam o estado de cada token de refresh
+	prefixoRefresh = "refresh:"
+	// prefixoFamiliaRevogada prefixo das keys que marcam uma familia de tokens de refresh como revogada
+	prefixoFamiliaRevogada = "refresh_familia_revogada:"
+
+	// refreshUsado valor guardado no registo de uma token de refresh depois de ser usada
+	refreshUsado = "usado"
+)
+
+// gerarIdentificador Cria um identificador aleatório em hex, usado nos jti e nas familias de tokens
+func gerarIdentificador() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// CriarJWTRefresh Cria a token de refresh do user, pertencente à familia de tokens e com o jti indicados
+func (user User) CriarJWTRefresh(familia string, jti string) *jwt.Token {
+	return jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"user": user.Username,
+		"iss":  "Robin-Servico-Auth",
+		"typ":  "reauth",
+		"fam":  familia,
+		"jti":  jti,
+		"iat":  instanteEmissao(time.Now()),
+		"exp":  time.Now().Add(duracaoTokenRefresh).Unix(),
+	})
+}
+
+// EmitirTokens Cria uma token de acesso e uma token de refresh para o user, se a conta estiver ativa,
+// a token de refresh é guardada na BD e fica associada à familia indicada (ou a uma nova se familia == "", i.e. um login)
+func (servico *Servico) EmitirTokens(user User, familia string) (acesso string, refresh string, err error) {
+	if err := user.ContaAtiva(time.Now()); err != nil {
+		return "", "", err
+	}
+	if familia == "" {
+		if familia, err = gerarIdentificador(); err != nil {
+			return "", "", err
+		}
+		defer func() {
+			if err == nil {
+				servico.registarLogin(user)
+			}
+		}()
+	}
+	// Cada token têm o seu jti, para poderem ser revogadas em separado
+	jti, err := gerarIdentificador()
+	if err != nil {
+		return "", "", err
+	}
+	jtiAcesso, err := gerarIdentificador()
+	if err != nil {
+		return "", "", err
+	}
+
+	acesso, err = servico.assinarToken(servico.CriarJWTAuth(user, jtiAcesso, familia))
+	if err != nil {
+		return "", "", err
+	}
+	refresh, err = servico.assinarToken(user.CriarJWTRefresh(familia, jti))
+	if err != nil {
+		return "", "", err
+	}
+
+	// Guarda a familia da token de refresh, o registo expira ao mesmo tempo que a token
+	if err := servico.estado.Guardar(prefixoRefresh+jti, familia, duracaoTokenRefresh); err != nil {
+		return "", "", err
+	}
+
+	return acesso, refresh, nil
+}
+
+// RevogarFamiliaRefresh Marca todas as tokens de refresh da familia como revogadas
+func (servico *Servico) RevogarFamiliaRefresh(familia string) error {
+	err := servico.estado.Guardar(prefixoFamiliaRevogada+familia, strconv.FormatInt(time.Now().Unix(), 10), duracaoTokenRefresh)
+	if err != nil {
+		servico.loggerBD.Println("Erro ao revogar a familia de tokens ", familia, ": ", err)
+	}
+	return err
+}
+
+// familiaRevogada Verifica se a familia de tokens de refresh foi revogada, uma falha na leitura conta como revogada
+func (servico *Servico) familiaRevogada(familia string) bool {
+	_, err := servico.estado.Get(prefixoFamiliaRevogada + familia)
+	if err != nil && err != ErrRegistoNaoExiste {
+		servico.loggerBD.Println("Erro ao verificar a revogação da familia ", familia, ": ", err)
+	}
+	return err != ErrRegistoNaoExiste
+}
+
+// claimsTokenRefresh Valida a token de refresh e verifica que têm as claims usadas na rotação
+func (servico *Servico) claimsTokenRefresh(refreshToken string) (autorizacao.Claims, error) {
+	claims, err := servico.autorizacao.Refresh(refreshToken)
+	if err != nil {
+		return autorizacao.Claims{}, err
+	}
+	if claims.JTI == "" || claims.Familia == "" || claims.User == "" {
+		return autorizacao.Claims{}, errors.New("token de refresh sem jti, familia ou user")
+	}
+	return claims, nil
+}
+
+// RenovarToken Troca uma token de refresh válida por uma token de acesso nova e uma token de refresh nova (rotação).
+// Se uma token de refresh já usada for apresentada outra vez, toda a familia dessa token é revogada
+func (servico *Servico) RenovarToken(refreshToken string) (retorno map[string]interface{}) {
+	retorno = make(map[string]interface{})
+
+	claims, err := servico.claimsTokenRefresh(refreshToken)
+	if err != nil {
+		servico.logger.Println("Erro: ", err)
+		retorno["erro"] = "Token de refresh inválida ou expirada"
+		return
+	}
+	jti, familia, user := claims.JTI, claims.Familia, claims.User
+
+	if servico.familiaRevogada(familia) || servico.TokenRevogada(claims) {
+		servico.logger.Println("Token de refresh de uma familia revogada, user: ", user)
+		retorno["erro"] = "Token de refresh revogada"
+		return
+	}
+
+	// Marca a token como usada e busca o estado anterior, numa só operação
+	anterior, err := servico.estado.TrocarValor(prefixoRefresh+jti, refreshUsado)
+	if err != nil {
+		servico.logger.Println("Erro: ", err)
+		retorno["erro"] = "Token de refresh inválida ou expirada"
+		return
+	}
+
+	// A token já tinha sido usada, alguém está a reutilizar uma token antiga
+	if anterior == refreshUsado {
+		servico.RevogarFamiliaRefresh(familia)
+		servico.logger.Println("Reutilização de token de refresh detetada, familia revogada, user: ", user)
+		retorno["erro"] = "Token de refresh revogada"
+		return
+	}
+
+	utilizador, err := servico.GetUserParaValorStruct(user)
+	if err != nil {
+		servico.logger.Println("Erro: ", err)
+		retorno["erro"] = "Token de refresh inválida ou expirada"
+		return
+	}
+
+	// Os administradores sem TOTP (ex: sessões anteriores à obrigatoriedade) têm de voltar a iniciar sessão
+	if servico.Privilegiado(utilizador) && !utilizador.TOTPAtivo() {
+		servico.RevogarFamiliaRefresh(familia)
+		retorno["erro"] = "É necessário ativar o TOTP, inicie sessão novamente"
+		return
+	}
+
+	acesso, refresh, err := servico.EmitirTokens(utilizador, familia)
+	if err != nil {
+		servico.logger.Println("Erro: ", err)
+		retorno["erro"] = "Erro ao criar as tokens"
+		return
+	}
+
+	servico.logger.Println("Tokens renovadas para o utilizador, ", user)
+	retorno["token"] = acesso
+	retorno["refresh_token"] = refresh
+	return
+}
@@ -1,138 +1,287 @@
 package authhandlers
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
-	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
 
 	"github.com/tomascpmarques/PAP/backend/robinservicoauth/loggers"
-	"github.com/tomascpmarques/PAP/backend/robinservicoauth/redishandle"
 )
 
-// AtualizarUser atualiza os dados dos utilizador fornecido, depois de verificar a token fornecida
-func AtualizarUser(user string, userInfo map[string]interface{}, token string) map[string]interface{} {
-	returnVal := make(map[string]interface{})
+// nomeUserValido os nomes dos users só podem ter letras, números, _ . @ e -
+var nomeUserValido = regexp.MustCompile(`^[A-Za-z0-9_.@-]{1,64}$`)
 
-	if VerificarTokenAdmin(token) != "OK" {
-		loggers.LoginAuthLogger.Println("Token inválida.")
-		returnVal["err"] = "Token inválida ou expirada"
-		return returnVal
-	}
+// AtualizarUser atualiza os dados dos utilizador fornecido, depois de verificar a token fornecida,
+// só o ROOT pode alterar utilizadores com privilégios de administração ou dar esses privilégios.
+// O registo é substituido numa só transação, que falha se o registo mudar entretanto ou se o nome novo já existir,
+// e a mudança de nome é propagada ao serviço userinfo (se falhar, o nome volta ao anterior)
+func (servico *Servico) AtualizarUser(ctx context.Context, user string, userInfo map[string]interface{}, token string) map[string]interface{} {
+	returnVal := make(map[string]interface{})
+	defer servico.auditarAcao(ctx, EventoUserAlterado, token, user, returnVal, camposAlterados(userInfo))
 
-	userAtualizar, err := GetUserParaValorStruct(user)
+	userAtualizar, err := servico.GetUserParaValorStruct(user)
 	if err != nil {
-		loggers.LoginAuthLogger.Println("Erro: ", "Sem registo para <", user, ">")
+		servico.logger.Println("Erro: ", "Sem registo para <", user, ">")
 		returnVal["erro"] = ("Sem registo para <" + user + ">")
 		return returnVal
 	}
+	userAnterior := userAtualizar
+	rolesAntigos := userAtualizar.RolesEfetivos()
+	privilegiado := servico.Privilegiado(userAtualizar)
 
 	// Verifica se os dados passados nos param, são novos ou not null, só depois é que os atualiza
 	if userInfo["user"] != nil && userInfo["user"] != userAtualizar.Username {
-		userAtualizar.Username = userInfo["user"].(string)
+		novoNome, ok := userInfo["user"].(string)
+		if !ok || !nomeUserValido.MatchString(novoNome) {
+			returnVal["erro"] = "Nome de utilizador inválido"
+			return returnVal
+		}
+		userAtualizar.Username = novoNome
 	}
-	if userInfo["pass"] != nil && userInfo["pass"] != userAtualizar.Password {
-		userAtualizar.Password = userInfo["pass"].(string)
+	if userInfo["pass"] != nil {
+		pass, ok := userInfo["pass"].(string)
+		if !ok {
+			returnVal["erro"] = "A password têm de ser uma string"
+			return returnVal
+		}
+		if err := userAtualizar.DefinirPassword(pass); err != nil {
+			servico.logger.Println("Error: ", err)
+			returnVal["erro"] = err.Error()
+			return returnVal
+		}
 	}
-	if userInfo["perms"] != nil && userInfo["perms"] != userAtualizar.Permissoes {
+	if userInfo["perms"] != nil {
+		perms, ok := userInfo["perms"].(float64)
 		/* Limita o numero que equival ás permissões na plataforma*/
-		if int(userInfo["perms"].(float64)) <= 1 && int(userInfo["perms"].(float64)) >= 3 {
-			loggers.LoginAuthLogger.Println("Error: ", "Permissões fora dos valores permitidos, entre 1 e 3")
-			returnVal["error"] = "Permissões fora dos valores permitidos, entre 1 e 3"
+		if !ok || int(perms) < ROOT || int(perms) > USER {
+			servico.logger.Println("Error: ", "Permissões fora dos valores permitidos, entre 1 e 3")
+			returnVal["erro"] = "Permissões fora dos valores permitidos, entre 1 e 3"
+			return returnVal
+		}
+		// As permissões passam a ser dadas só pelo role base correspondente
+		if err := servico.DefinirRoles(&userAtualizar, []string{roleDoNivel(int(perms))}); err != nil {
+			servico.logger.Println("Error: ", err)
+			returnVal["erro"] = err.Error()
 			return returnVal
 		}
-		userAtualizar.Permissoes = int(userInfo["perms"].(float64))
+		privilegiado = privilegiado || int(perms) <= ADMIN
 	}
 
-	userAtualizadoJSON, err := json.Marshal(&userAtualizar)
-	if err != nil {
-		loggers.LoginAuthLogger.Println("Error: ", err)
-		returnVal["error"] = err
+	if privilegiado {
+		if err := servico.exigirGestaoAdmins(token); err != nil {
+			servico.logger.Println("Error: ", "tentativa de alterar um administrador sem permissões")
+			returnVal["erro"] = "Só o ROOT pode alterar administradores"
+			return returnVal
+		}
+	}
+	rolesNovos := userAtualizar.RolesEfetivos()
+	if contem(rolesAntigos, RoleRoot) && (!contem(rolesNovos, RoleRoot) || userAtualizar.Username != user) && servico.ultimoRoot(user) {
+		returnVal["erro"] = "Não é possivél alterar os roles ou o nome do último ROOT"
 		return returnVal
 	}
 
-	// Apaga o registo, para poder ser insserido o novo registo atualizado
-	err = redishandle.DelRegistoBD(&RedisClientDB, user)
-	if err != nil {
-		loggers.LoginAuthLogger.Println("Error: ", err)
-		returnVal["error"] = err
+	// Substitui o registo (e os membros dos roles) numa só operação
+	novoNome := userAtualizar.Username
+	if err := servico.users.Trocar(userAnterior, userAtualizar); err != nil {
+		servico.logger.Println("Error: ", err)
+		if errors.Is(err, ErrUserExiste) {
+			returnVal["erro"] = "Já existe um utilizador com o nome <" + novoNome + ">"
+			return returnVal
+		}
+		returnVal["erro"] = err.Error()
 		return returnVal
 	}
 
-	// Insserção do registo
-	redishandle.SetRegistoBD(&RedisClientDB, redishandle.RegistoRedisDB{
-		Key:    userAtualizar.Username,
-		Valor:  userAtualizadoJSON,
-		Expira: 0,
-	}, 0)
+	if novoNome != user {
+		if err := servico.renomearUserinfo(ctx, user, novoNome); err != nil {
+			servico.logger.Println("Error: ", err)
+			// Os dois serviços não podem ficar com nomes diferentes para o mesmo user
+			if errReverter := servico.users.Trocar(userAtualizar, userAnterior); errReverter != nil {
+				servico.loggerErros.Println("Erro ao reverter a mudança de nome de ", user, " para ", novoNome, ": ", errReverter)
+				returnVal["erro"] = fmt.Sprintf("Estado inconsistente: o user foi renomeado para <%s> mas o serviço userinfo "+
+					"continua com o nome <%s>, e não foi possivél reverter a mudança (%v, %v)", novoNome, user, err, errReverter)
+				return returnVal
+			}
+			returnVal["erro"] = "Erro ao mudar o nome no serviço userinfo: " + err.Error()
+			return returnVal
+		}
+	}
+	if userInfo["perms"] != nil || userInfo["pass"] != nil || novoNome != user {
+		// As tokens já emitidas têm as permissões ou o nome antigos, ou foram obtidas com a password antiga
+		servico.RevogarTokensUser(user)
+	}
 
 	returnVal["Menssagem"] = "Sucesso ao alterar dados."
 	return returnVal
 }
 
-// ApagarUser, apaga um user da bd , pelo id especificado
-func ApagarUser(userID string, token string) (retorno map[string]interface{}) {
+// ApagarUser, apaga um user da bd , pelo id especificado, só o ROOT pode apagar administradores,
+// e o último ROOT não pode ser apagado
+func (servico *Servico) ApagarUser(ctx context.Context, userID string, token string) (retorno map[string]interface{}) {
 	retorno = make(map[string]interface{})
+	defer servico.auditarAcao(ctx, EventoUserApagado, token, userID, retorno, nil)
 
-	if VerificarTokenAdmin(token) != "OK" {
-		loggers.LoginAuthLogger.Println("Token inválida.")
-		retorno["err"] = "Token inválida ou expirada"
+	utilizador, err := servico.GetUserParaValorStruct(userID)
+	if err != nil {
+		retorno["error"] = "Sem registo para <" + userID + ">"
+		return
+	}
+	if servico.Privilegiado(utilizador) {
+		if err := servico.exigirGestaoAdmins(token); err != nil {
+			servico.logger.Println("Error: ", "tentativa de apagar um administrador sem permissões")
+			retorno["error"] = "Só o ROOT pode apagar administradores"
+			return
+		}
+	}
+	if contem(utilizador.RolesEfetivos(), RoleRoot) && servico.ultimoRoot(userID) {
+		retorno["error"] = "Não é possivél apagar o último ROOT"
 		return
 	}
 
-	// Apaga o registo, para poder ser insserido o novo registo atualizado
-	err := redishandle.DelRegistoBD(&RedisClientDB, userID)
-	if err != nil {
-		loggers.LoginAuthLogger.Println("Error: ", err)
-		retorno["error"] = err
+	// Apaga o registo, e retira o user dos membros dos roles
+	if err := servico.users.Apagar(userID); err != nil {
+		servico.logger.Println("Error: ", err)
+		retorno["error"] = err.Error()
 		return
 	}
 
+	// As tokens já emitidas para o user apagado deixam de ser aceites
+	servico.RevogarTokensUser(userID)
+
 	retorno["status"] = "Sucesso!"
 	return
 }
 
-// SessActualStatus Atualiza a mensagem de status
-func SessActualStatus(usrNome string, status string) (retorno map[string]interface{}) {
+const (
+	// limitePaginaUsers número de users por página, se o pedido não indicar o limite
+	limitePaginaUsers = 50
+	// limiteMaximoPaginaUsers número máximo de users por página
+	limiteMaximoPaginaUsers = 500
+)
+
+// ResumoUser Dados do user que podem ser mostrados, sem a hash da password nem o segredo do segundo fator
+func (user User) ResumoUser() map[string]interface{} {
+	return map[string]interface{}{
+		"user":             user.Username,
+		"email":            user.Email,
+		"roles":            user.RolesEfetivos(),
+		"perms":            user.Permissoes,
+		"mudar_password":   user.MudarPassword,
+		"totp_ativo":       user.TOTPAtivo(),
+		"estado":           user.EstadoEfetivo(time.Now()),
+		"motivo_estado":    user.MotivoEstado,
+		"expira_em":        user.ExpiraEm,
+		"criado_em":        user.CriadoEm,
+		"ultimo_login":     user.UltimoLogin,
+		"passwd_mudada_em": user.PasswordMudadaEm,
+	}
+}
+
+// ListarUsers Action que devolve uma página dos users, exemplo de pesquisa: {"prefixo": "adm", "role": "ADMIN", "limite": 20}.
+// Todos os campos são opcionais, a próxima página é pedida com o "cursor" devolvido, que é "0" na última página.
+// Com o backend redis as páginas podem ter um pouco mais users que o limite
+func (servico *Servico) ListarUsers(pesquisa map[string]interface{}, token string) (retorno map[string]interface{}) {
 	retorno = make(map[string]interface{})
 
-	// Mongodb query para atualizar o status do user
-	updateQuery := "{\"status\": \"" + status + "\"}"
-	// DynamicGoQuery body para conssumir o endpoint do serviço userinfo
-	action := fmt.Sprintf("action:\n\"%s\":\n\"%s\",\n%s,", "UpdateInfoUtilizador", usrNome, updateQuery)
+	var cursor uint64
+	switch valor := pesquisa["cursor"].(type) {
+	case string:
+		c, err := strconv.ParseUint(valor, 10, 64)
+		if err != nil {
+			retorno["erro"] = "Cursor inválido"
+			return
+		}
+		cursor = c
+	case float64:
+		cursor = uint64(valor)
+	}
 
-	// Utilização do endpoint UpdateInfoUtilizador, exposto em http://0.0.0.0:8001
-	resp, err := http.Post("http://0.0.0.0:8001", "text/plain", bytes.NewBufferString(action))
-	if err != nil {
-		loggers.LoginAuthLogger.Println("Error: ", err)
-		retorno["error"] = err
-		return
+	limite := int64(limitePaginaUsers)
+	if valor, ok := pesquisa["limite"].(float64); ok {
+		if valor < 1 || valor > limiteMaximoPaginaUsers {
+			retorno["erro"] = fmt.Sprintf("O limite têm de estar entre 1 e %d", limiteMaximoPaginaUsers)
+			return
+		}
+		limite = int64(valor)
 	}
-	defer resp.Body.Close()
-	bodyContentBytes, err := ioutil.ReadAll(resp.Body)
+
+	prefixo, _ := pesquisa["prefixo"].(string)
+	role, _ := pesquisa["role"].(string)
+	if role != "" {
+		if _, err := servico.GetRole(role); err != nil {
+			retorno["erro"] = err.Error()
+			return
+		}
+	}
+
+	users, proximo, err := servico.users.Pesquisar(cursor, prefixo, role, limite)
 	if err != nil {
-		loggers.LoginAuthLogger.Println("Error: ", err)
-		retorno["error"] = "Erro ao ler o conteudo da response do seviço userinfo"
+		loggers.LoginOperacoesBDLogger.Println("Erro: ", err)
+		retorno["erro"] = "Erro ao buscar os users"
 		return
 	}
 
-	loggers.LoginResolverLogger.Printf("Update status: %v", string(bodyContentBytes))
-	retorno["sucesso"] = "Campo atualizado!"
+	resumos := make([]map[string]interface{}, 0, len(users))
+	for _, user := range users {
+		resumos = append(resumos, user.ResumoUser())
+	}
+	retorno["users"] = resumos
+	retorno["cursor"] = strconv.FormatUint(proximo, 10)
 	return
 }
 
-func VerificarUserExiste(userName string, token string) (retorno map[string]interface{}) {
+// camposAlterados Nomes dos campos pedidos numa alteração do user, para a auditoria (sem os valores, ex: da password)
+func camposAlterados(userInfo map[string]interface{}) map[string]interface{} {
+	campos := make([]string, 0, len(userInfo))
+	for campo := range userInfo {
+		campos = append(campos, campo)
+	}
+	sort.Strings(campos)
+	return map[string]interface{}{"campos": campos}
+}
+
+// renomearUserinfo Muda o nome do user no serviço userinfo, com a token de serviço do serviço de autenticação
+func (servico *Servico) renomearUserinfo(ctx context.Context, nomeAntigo string, nomeNovo string) error {
+	token, err := servico.TokenServicoInterna()
+	if err != nil {
+		return err
+	}
+	_, err = servico.userinfo.RenomearUtilizador(ctx, nomeAntigo, nomeNovo, token)
+	return err
+}
+
+// SessActualStatus Atualiza a mensagem de status do user, a token têm de ser do próprio user ou de um admin.
+// O serviço userinfo é chamado com a token de serviço do serviço de autenticação
+func (servico *Servico) SessActualStatus(ctx context.Context, usrNome string, status string, token string) (retorno map[string]interface{}) {
 	retorno = make(map[string]interface{})
 
-	if VerificarTokenUser(token) != "OK" {
-		loggers.LoginAuthLogger.Println("Token inválida ou expirada.")
-		retorno["err"] = "Token inválida ou expirada"
+	tokenServico, err := servico.TokenServicoInterna()
+	if err != nil {
+		servico.logger.Println("Error: ", err)
+		retorno["error"] = "Erro ao emitir a token de serviço"
 		return
 	}
 
-	if !redishandle.BuscarKeysVerificarResultado(context.Background(), &RedisClientDB, userName) {
+	// Atualiza o status do user no serviço userinfo
+	if _, err := servico.userinfo.UpdateInfoUtilizador(ctx, usrNome, map[string]interface{}{"status": status}, tokenServico); err != nil {
+		servico.logger.Println("Error: ", err)
+		retorno["error"] = "Erro ao atualizar o status no serviço userinfo: " + err.Error()
+		return
+	}
+
+	retorno["sucesso"] = "Campo atualizado!"
+	return
+}
+
+// VerificarUserExiste Verifica se já existe um user com o nome fornecido
+func (servico *Servico) VerificarUserExiste(userName string, token string) (retorno map[string]interface{}) {
+	retorno = make(map[string]interface{})
+
+	if _, err := servico.users.Get(userName); err != nil {
 		loggers.LoginOperacoesBDLogger.Println("Sem registo para a key fornecida, pode ser usada")
 		retorno["existe"] = false
 		return
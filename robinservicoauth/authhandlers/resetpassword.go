@@ -0,0 +1,215 @@
+package authhandlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/mail"
+	"time"
+
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/autorizacao"
+	"github.com/tomascpmarques/PAP/backend/robinservicoauth/notificacoes"
+)
+
+const (
+	// prefixoResetPassword prefixo das keys com a hash de cada token de reset, o valor é o username
+	prefixoResetPassword = "reset_password:"
+	// prefixoResetPasswordUser prefixo das keys com a hash da última token de reset do user
+	prefixoResetPasswordUser = "reset_password_user:"
+	// prefixoPedidosReset prefixo dos contadores de pedidos de reset, por user e por IP
+	prefixoPedidosReset = "pedidos_reset:"
+
+	// duracaoTokenReset tempo de vida das tokens de reset
+	duracaoTokenReset = time.Minute * 30
+	// janelaPedidosReset janela (deslizante) dos limites de pedidos de reset
+	janelaPedidosReset = time.Hour
+)
+
+// mensagemPedidoReset resposta de todos os pedidos de reset, não indica se o user existe
+const mensagemPedidoReset = "Se o utilizador existir, vai receber as instruções para mudar a password"
+
+// limitesPedidosReset pedidos de reset permitidos dentro da janela, por tipo de alvo
+var limitesPedidosReset = map[string]int64{
+	alvoUser: 3,
+	alvoIP:   10,
+}
+
+// carregarNotificador Cria o notificador configurado, nil se não houver nenhum ou não for possível criá-lo:
+// sem notificador o PedirResetPassword e o ConvidarUser são recusados, as tokens nunca vão para o log sem ser pedido
+func (servico *Servico) carregarNotificador(config notificacoes.Config) notificacoes.Notificador {
+	notificador, err := notificacoes.NovoNotificador(servico.logger, config)
+	if err != nil {
+		servico.loggerErros.Println("Aviso: o reset de password e os convites estão desativados: ", err)
+		return nil
+	}
+	if config.Tipo == "log" {
+		servico.loggerErros.Println("Aviso: as tokens de reset e dos convites são escritas no log, só para desenvolvimento")
+	}
+	return notificador
+}
+
+// mensagemSemNotificador erro das actions que entregam tokens aos users, quando não existe notificador
+const mensagemSemNotificador = "O envio de mensagens aos utilizadores não está configurado"
+
+// hashTokenReset Hash guardada de uma token de reset, a token em sí só é conhecida pelo user
+func hashTokenReset(token string) string {
+	soma := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(soma[:])
+}
+
+// emailValido Verifica se o email é só um endereço válido (sem nome, ex: "Nome <email>")
+func emailValido(email string) bool {
+	endereco, err := mail.ParseAddress(email)
+	return err == nil && endereco.Address == email
+}
+
+// limitePedidosReset Regista o pedido e indica se algum dos alvos passou o limite de pedidos
+func (servico *Servico) limitePedidosReset(alvos map[string]string) bool {
+	excedido := false
+	for tipo, id := range alvos {
+		pedidos, err := servico.estado.RegistarOcorrencia(prefixoPedidosReset+tipo+":"+id, janelaPedidosReset)
+		if err != nil || pedidos > limitesPedidosReset[tipo] {
+			excedido = true
+		}
+	}
+	return excedido
+}
+
+// enviarTokenReset Cria uma token de reset para o user, que substitui a anterior, e envia-a pelo notificador
+func (servico *Servico) enviarTokenReset(utilizador User) error {
+	if servico.notificador == nil {
+		return notificacoes.ErrSemNotificador
+	}
+	user := utilizador.Username
+	aleatorio := make([]byte, 32)
+	if _, err := rand.Read(aleatorio); err != nil {
+		return err
+	}
+	token := hex.EncodeToString(aleatorio)
+	hash := hashTokenReset(token)
+
+	// Só a última token pedida é válida
+	if anterior, err := servico.estado.Get(prefixoResetPasswordUser + user); err == nil {
+		servico.estado.Apagar(prefixoResetPassword + anterior)
+	}
+	if err := servico.estado.Guardar(prefixoResetPassword+hash, user, duracaoTokenReset); err != nil {
+		return err
+	}
+	if err := servico.estado.Guardar(prefixoResetPasswordUser+user, hash, duracaoTokenReset); err != nil {
+		return err
+	}
+
+	destino := notificacoes.Destinatario{User: user, Email: utilizador.Email}
+	return servico.notificador.EnviarResetPassword(destino, token, time.Now().Add(duracaoTokenReset))
+}
+
+// PedirResetPassword Action que cria uma token de reset para o user e a envia pelo notificador.
+// A resposta é sempre a mesma, exista ou não o user, e os pedidos são limitados por user e por IP
+func (servico *Servico) PedirResetPassword(ctx context.Context, user string) (retorno map[string]interface{}) {
+	retorno = map[string]interface{}{"sucesso": true, "mensagem": mensagemPedidoReset}
+	defer func() { servico.auditarAcao(ctx, EventoResetPedido, "", user, retorno, nil) }()
+
+	if servico.notificador == nil {
+		retorno = map[string]interface{}{"erro": mensagemSemNotificador}
+		return
+	}
+
+	if servico.limitePedidosReset(alvosLogin(ctx, user)) {
+		servico.logger.Println("Error: ", "limite de pedidos de reset excedido para ", user)
+		return
+	}
+	utilizador, err := servico.GetUserParaValorStruct(user)
+	if err != nil {
+		return
+	}
+
+	if err := servico.enviarTokenReset(utilizador); err != nil {
+		servico.logger.Println("Erro ao enviar o reset de password para ", user, ": ", err)
+		return
+	}
+	servico.logger.Println("Reset de password pedido para o utilizador, ", user)
+	return
+}
+
+// ConcluirResetPassword Action que muda a password do user da token de reset, a token só pode ser usada uma vez.
+// As sessões do user são revogadas, e os bloqueios de login do user são levantados
+func (servico *Servico) ConcluirResetPassword(ctx context.Context, tokenReset string, passwdNova string) (retorno map[string]interface{}) {
+	retorno = make(map[string]interface{})
+
+	// O user só é conhecido depois de consumir a token
+	var user string
+	defer func() { servico.auditarAcao(ctx, EventoResetConcluido, "", user, retorno, nil) }()
+
+	// Busca e apaga o registo na mesma operação, uma token usada ou expirada não existe
+	hash := hashTokenReset(tokenReset)
+	user, err := servico.estado.Consumir(prefixoResetPassword + hash)
+	if err != nil {
+		servico.logger.Println("Error: ", "token de reset inválida")
+		retorno["erro"] = "Token de reset inválida ou expirada"
+		return
+	}
+	servico.estado.Apagar(prefixoResetPasswordUser + user)
+
+	utilizador, err := servico.GetUserParaValorStruct(user)
+	if err != nil {
+		retorno["erro"] = "Token de reset inválida ou expirada"
+		return
+	}
+	atualizado := utilizador
+	if err := atualizado.DefinirPassword(passwdNova); err != nil {
+		retorno["erro"] = err.Error()
+		return
+	}
+	atualizado.MudarPassword = false
+	// As contas criadas por convite ficam ativas quando o user define a password
+	if atualizado.Estado == EstadoPendente {
+		atualizado.Estado = EstadoAtivo
+	}
+	if err := servico.users.Trocar(utilizador, atualizado); err != nil {
+		retorno["erro"] = err.Error()
+		return
+	}
+	servico.RevogarTokensUser(user)
+	servico.limparFalhasLogin(user)
+
+	servico.logger.Println("Password do utilizador, ", user, ", mudada por reset")
+	retorno["sucesso"] = true
+	return
+}
+
+// MudarEmail Action que muda o email do user, usado para lhe enviar as tokens de reset da password.
+// Pode ser pedido pelo próprio user ou com a permissão users:gerir, os emails dos administradores
+// só podem ser mudados pelo ROOT, senão um admin podia receber o reset da password do ROOT
+func (servico *Servico) MudarEmail(ctx context.Context, user string, email string, token string) (retorno map[string]interface{}) {
+	retorno = make(map[string]interface{})
+	defer servico.auditarAcao(ctx, EventoEmailAlterado, token, user, retorno, nil)
+
+	if !emailValido(email) {
+		retorno["erro"] = "Email inválido"
+		return
+	}
+	utilizador, err := servico.GetUserParaValorStruct(user)
+	if err != nil {
+		retorno["erro"] = "Sem registo para <" + user + ">"
+		return
+	}
+
+	permissao := PermGerirUsers
+	if servico.Privilegiado(utilizador) {
+		permissao = PermGerirAdmins
+	}
+	if _, err := servico.autorizacao.Exigir(token, autorizacao.Alguma(autorizacao.User(user), autorizacao.Permite(permissao))); err != nil {
+		retorno["erro"] = err
+		return
+	}
+
+	atualizado := utilizador
+	atualizado.Email = email
+	if err := servico.users.Trocar(utilizador, atualizado); err != nil {
+		retorno["erro"] = err.Error()
+		return
+	}
+	retorno["sucesso"] = true
+	return
+}
@@ -0,0 +1,177 @@
+package authhandlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/autorizacao"
+)
+
+const (
+	// prefixoJTIRevogado prefixo das keys que marcam uma token (pelo seu jti) como revogada
+	prefixoJTIRevogado = "revogada:"
+	// prefixoUserRevogado prefixo das keys que guardam o momento a partir do qual as tokens de um user são válidas
+	prefixoUserRevogado = "revogado_user:"
+)
+
+// RevogarJTI Revoga a token com o jti indicado, o registo só existe enquanto a token não expira
+func (servico *Servico) RevogarJTI(jti string, exp int64) error {
+	restante := time.Until(time.Unix(exp, 0))
+	if jti == "" || restante <= 0 {
+		return nil
+	}
+
+	err := servico.estado.Guardar(prefixoJTIRevogado+jti, strconv.FormatInt(exp, 10), restante)
+	if err != nil {
+		servico.loggerBD.Println("Erro ao revogar a token ", jti, ": ", err)
+	}
+	return err
+}
+
+// RevogarTokensUser Revoga todas as tokens (acesso e refresh) emitidas até agora para o user,
+// o registo dura tanto como a token com o tempo de vida mais longo
+func (servico *Servico) RevogarTokensUser(user string) error {
+	err := servico.estado.Guardar(prefixoUserRevogado+user, time.Now().Format(time.RFC3339Nano), duracaoTokenRefresh)
+	if err != nil {
+		servico.loggerBD.Println("Erro ao revogar as tokens de ", user, ": ", err)
+	}
+	return err
+}
+
+// momentoRevogacao Lê o momento de uma revogação das tokens de um user, as tokens emitidas antes são revogadas.
+// Os registos antigos guardam só os segundos, e revogam também as tokens emitidas no resto desse segundo
+func momentoRevogacao(registo string) (time.Time, error) {
+	if segundos, err := strconv.ParseInt(registo, 10, 64); err == nil {
+		return time.Unix(segundos+1, 0), nil
+	}
+	return time.Parse(time.RFC3339Nano, registo)
+}
+
+// TokenRevogada Verifica se a token com as claims fornecidas foi revogada, pelo seu jti, pela familia
+// de tokens do login (logout ou reutilização de uma token de refresh), ou por todas as tokens do user
+// (ou da conta de serviço) terem sido revogadas depois da sua emissão.
+// Se não for possível ler as revogações (ex: falha do redis) a token é considerada revogada
+func (servico *Servico) TokenRevogada(claims autorizacao.Claims) bool {
+	if claims.JTI != "" {
+		if _, err := servico.estado.Get(prefixoJTIRevogado + claims.JTI); err != ErrRegistoNaoExiste {
+			if err != nil {
+				servico.loggerBD.Println("Erro ao verificar a revogação da token ", claims.JTI, ": ", err)
+			}
+			return true
+		}
+	}
+	if claims.Familia != "" && servico.familiaRevogada(claims.Familia) {
+		return true
+	}
+
+	titular := claims.User
+	if claims.Servico() {
+		titular = claims.Sujeito
+	}
+	// As tokens das contas que deixaram de estar ativas (ex: expiradas antes do varrimento) não são aceites
+	if !claims.Servico() && servico.users != nil {
+		user, err := servico.users.Get(claims.User)
+		if err != nil && err != ErrUserNaoExiste {
+			servico.loggerBD.Println("Erro ao verificar o estado da conta de ", claims.User, ": ", err)
+			return true
+		}
+		if err == nil && user.ContaAtiva(time.Now()) != nil {
+			return true
+		}
+	}
+
+	revogadoEm, err := servico.estado.Get(prefixoUserRevogado + titular)
+	if err == ErrRegistoNaoExiste {
+		return false
+	}
+	if err != nil {
+		servico.loggerBD.Println("Erro ao verificar a revogação das tokens de ", titular, ": ", err)
+		return true
+	}
+	momento, err := momentoRevogacao(revogadoEm)
+	if err != nil {
+		return true
+	}
+
+	// Tokens sem iat são anteriores a este mecanismo, logo foram emitidas antes da revogação
+	return claims.Emitida.Before(momento)
+}
+
+// Logout Revoga a token de acesso fornecida e a familia de tokens de refresh emitida no mesmo login
+func (servico *Servico) Logout(ctx context.Context, token string) (retorno map[string]interface{}) {
+	retorno = make(map[string]interface{})
+	defer servico.auditarAcao(ctx, EventoLogout, token, servico.atorToken(token), retorno, nil)
+
+	claims, err := servico.autorizacao.Acesso(token)
+	if err != nil {
+		servico.logger.Println("Erro: ", err)
+		retorno["erro"] = err
+		return
+	}
+
+	if err := servico.RevogarJTI(claims.JTI, claims.Expira.Unix()); err != nil {
+		retorno["erro"] = "Erro ao terminar a sessão"
+		return
+	}
+	if claims.Familia != "" {
+		if err := servico.RevogarFamiliaRefresh(claims.Familia); err != nil {
+			retorno["erro"] = "Erro ao terminar a sessão"
+			return
+		}
+	}
+
+	servico.logger.Println("Utilizador, ", claims.User, ", terminou sessão")
+	retorno["sucesso"] = true
+	return
+}
+
+// RevogarTokens Revoga todas as tokens emitidas para o user, pode ser pedido pelo próprio user
+// ou por quem tenha a permissão tokens:revogar
+func (servico *Servico) RevogarTokens(ctx context.Context, user string, token string) (retorno map[string]interface{}) {
+	retorno = make(map[string]interface{})
+	defer servico.auditarAcao(ctx, EventoTokensRevogadas, token, user, retorno, nil)
+
+	regra := autorizacao.Alguma(autorizacao.User(user), autorizacao.Permite(PermRevogarTokens))
+	if _, err := servico.autorizacao.Exigir(token, regra); err != nil {
+		retorno["erro"] = err
+		return
+	}
+
+	if err := servico.RevogarTokensUser(user); err != nil {
+		retorno["erro"] = "Erro ao revogar as tokens"
+		return
+	}
+
+	servico.logger.Println("Todas as tokens do utilizador, ", user, ", foram revogadas")
+	retorno["sucesso"] = true
+	return
+}
+
+// IntrospecaoHandler Endpoint http usado pelos outros serviços para saber se uma token continua ativa,
+// recebe a token no campo "token" de um form (POST) e responde com {"ativa": bool},
+// nas tokens de serviço a resposta têm também a conta e os scopes
+func (servico *Servico) IntrospecaoHandler(rw http.ResponseWriter, r *http.Request) {
+	resposta := map[string]interface{}{"ativa": false}
+
+	claims, err := servico.autorizacao.Claims(r.PostFormValue("token"))
+	if err == nil && !servico.TokenRevogada(claims) {
+		resposta["ativa"] = true
+		resposta["user"] = claims.User
+		if claims.Servico() {
+			resposta["servico"] = claims.ContaServico()
+			resposta["scope"] = strings.Join(claims.Scopes, " ")
+		}
+		resposta["exp"] = claims.Expira.Unix()
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	// A resposta muda quando a token é revogada, não pode ficar em cache de proxies
+	rw.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(rw).Encode(resposta); err != nil {
+		servico.loggerErros.Println("Erro: ", err)
+	}
+}
@@ -0,0 +1,395 @@
+package authhandlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"regexp"
+
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/autorizacao"
+)
+
+const (
+	// keyRoles key do set com os nomes de todos os roles existentes
+	keyRoles = "roles"
+	// prefixoRole prefixo das keys que guardam a definição de cada role
+	prefixoRole = "role:"
+	// prefixoMembrosRole prefixo das keys dos sets com os users que têm cada role
+	prefixoMembrosRole = "membros_role:"
+)
+
+const (
+	// RoleRoot role dos utilizadores com nivel ROOT, têm todas as permissões e não pode ser alterado
+	RoleRoot = "ROOT"
+	// RoleAdmin role dos administradores da plataforma
+	RoleAdmin = "ADMIN"
+	// RoleUser role base de todos os utilizadores
+	RoleUser = "USER"
+)
+
+const (
+	// PermVerUsers permite consultar os registos dos users
+	PermVerUsers = "users:ver"
+	// PermGerirUsers permite registar, alterar e apagar users sem privilégios de administração
+	PermGerirUsers = "users:gerir"
+	// PermGerirRoles permite consultar os roles, e atribuir ou retirar roles sem privilégios de administração
+	PermGerirRoles = "roles:gerir"
+	// PermRevogarTokens permite revogar as tokens de qualquer user
+	PermRevogarTokens = "tokens:revogar"
+	// PermGerirAdmins permite gerir os administradores e definir roles, exclusiva do ROOT
+	PermGerirAdmins = "admins:gerir"
+	// PermGerirChaves permite rodar as chaves de assinatura das tokens, exclusiva do ROOT
+	PermGerirChaves = "chaves:gerir"
+	// PermVerAuditoria permite consultar os eventos de auditoria
+	PermVerAuditoria = "auditoria:ver"
+	// PermGerirServicos permite gerir as contas de serviço usadas nas chamadas entre serviços, exclusiva do ROOT
+	PermGerirServicos = "servicos:gerir"
+)
+
+// PermissoesExistentes todas as permissões reconhecidas pelo serviço
+var PermissoesExistentes = []string{PermVerUsers, PermGerirUsers, PermGerirRoles, PermRevogarTokens, PermGerirAdmins, PermGerirChaves, PermVerAuditoria, PermGerirServicos}
+
+// permissoesRoot permissões que só o role ROOT pode ter
+var permissoesRoot = []string{PermGerirAdmins, PermGerirChaves, PermGerirServicos}
+
+// nomeRoleValido os nomes dos roles só podem ter letras, números, _ e -
+var nomeRoleValido = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// ErrRoleInexistente o role pedido não está definido
+var ErrRoleInexistente = errors.New("o role pedido não existe")
+
+// Role Conjunto de permissões que pode ser atribuido a vários users
+type Role struct {
+	Nome       string   `json:"nome"`
+	Nivel      int      `json:"nivel"` // ROOT, ADMIN ou USER, é o valor da claim perms das tokens
+	Permissoes []string `json:"permissoes"`
+}
+
+// rolesBase roles criados no arranque do serviço, o ROOT é sempre reposto com todas as permissões
+var rolesBase = []Role{
+	{Nome: RoleRoot, Nivel: ROOT, Permissoes: PermissoesExistentes},
+	{Nome: RoleAdmin, Nivel: ADMIN, Permissoes: []string{PermVerUsers, PermGerirUsers, PermGerirRoles, PermRevogarTokens, PermVerAuditoria}},
+	{Nome: RoleUser, Nivel: USER, Permissoes: []string{}},
+}
+
+// Privilegiado Indica se o role dá privilégios de administração, só o ROOT o pode atribuir ou retirar
+func (role Role) Privilegiado() bool {
+	return role.Nivel <= ADMIN
+}
+
+// contem Verifica se o valor existe na lista
+func contem(lista []string, valor string) bool {
+	for _, v := range lista {
+		if v == valor {
+			return true
+		}
+	}
+	return false
+}
+
+// roleDoNivel Nome do role base correspondente ao nivel de permissões
+func roleDoNivel(nivel int) string {
+	switch nivel {
+	case ROOT:
+		return RoleRoot
+	case ADMIN:
+		return RoleAdmin
+	default:
+		return RoleUser
+	}
+}
+
+// GetRole Busca a definição do role pelo nome
+func (servico *Servico) GetRole(nome string) (Role, error) {
+	registo, err := servico.estado.Get(prefixoRole + nome)
+	if err != nil {
+		return Role{}, ErrRoleInexistente
+	}
+
+	var role Role
+	if err := json.Unmarshal([]byte(registo), &role); err != nil {
+		servico.loggerBD.Println("Erro: ", err)
+		return Role{}, err
+	}
+	return role, nil
+}
+
+// guardarRole Guarda a definição do role, e adiciona-o ao set dos roles existentes
+func (servico *Servico) guardarRole(role Role) error {
+	roleJSON, err := json.Marshal(&role)
+	if err != nil {
+		servico.loggerBD.Println("Erro: ", err)
+		return err
+	}
+
+	if err := servico.estado.Guardar(prefixoRole+role.Nome, string(roleJSON), 0); err != nil {
+		servico.loggerBD.Println("Erro: ", err)
+		return err
+	}
+	return servico.estado.AdicionarMembros(keyRoles, role.Nome)
+}
+
+// InicializarRoles Cria os roles base que ainda não existem, o role ROOT é sempre reposto
+func (servico *Servico) InicializarRoles() bool {
+	for _, role := range rolesBase {
+		if _, err := servico.GetRole(role.Nome); err == nil && role.Nome != RoleRoot {
+			continue
+		}
+		if err := servico.guardarRole(role); err != nil {
+			servico.loggerBD.Println("Erro ao criar o role ", role.Nome, ": ", err)
+			return false
+		}
+	}
+	return true
+}
+
+// PermissoesRoles Junta as permissões de todos os roles, e devolve o nivel mais elevado entre eles.
+// Os roles que não existem são ignorados
+func (servico *Servico) PermissoesRoles(roles []string) (nivel int, permissoes []string) {
+	nivel = USER
+	permissoes = make([]string, 0)
+	for _, nome := range roles {
+		role, err := servico.GetRole(nome)
+		if err != nil {
+			continue
+		}
+		if role.Nivel < nivel {
+			nivel = role.Nivel
+		}
+		for _, permissao := range role.Permissoes {
+			if !contem(permissoes, permissao) {
+				permissoes = append(permissoes, permissao)
+			}
+		}
+	}
+	return nivel, permissoes
+}
+
+// RolesEfetivos Roles do user, os registos anteriores aos roles têm o role base correspondente às suas permissões
+func (user User) RolesEfetivos() []string {
+	if len(user.Roles) > 0 {
+		return user.Roles
+	}
+	return []string{roleDoNivel(user.Permissoes)}
+}
+
+// DefinirRoles Substitui os roles do user, todos têm de existir, e atualiza o seu nivel de permissões
+func (servico *Servico) DefinirRoles(user *User, roles []string) error {
+	if len(roles) == 0 {
+		return errors.New("o user têm de ter pelo menos um role")
+	}
+	for _, role := range roles {
+		if _, err := servico.GetRole(role); err != nil {
+			return err
+		}
+	}
+
+	user.Roles = roles
+	user.Permissoes, _ = servico.PermissoesRoles(roles)
+	return nil
+}
+
+// Privilegiado Indica se algum dos roles do user dá privilégios de administração
+func (servico *Servico) Privilegiado(user User) bool {
+	nivel, _ := servico.PermissoesRoles(user.RolesEfetivos())
+	return nivel <= ADMIN
+}
+
+// ultimoRoot Indica se o user é o único com o role ROOT, nesse caso não pode perder o role nem ser apagado.
+// Se não for possivél consultar os membros assume-se que é o último
+func (servico *Servico) ultimoRoot(user string) bool {
+	membros, err := servico.users.Listar(RoleRoot)
+	if err != nil {
+		return true
+	}
+	return contem(membros, user) && len(membros) <= 1
+}
+
+// exigirGestaoAdmins Verifica que a token têm a permissão de gerir administradores,
+// necessária para qualquer alteração que envolva users ou roles com privilégios de administração
+func (servico *Servico) exigirGestaoAdmins(token string) error {
+	_, err := servico.autorizacao.Exigir(token, autorizacao.Permite(PermGerirAdmins))
+	return err
+}
+
+// ListarRoles Action que devolve todos os roles, com as suas permissões e membros
+func (servico *Servico) ListarRoles(token string) (retorno map[string]interface{}) {
+	retorno = make(map[string]interface{})
+
+	nomes, err := servico.estado.Membros(keyRoles)
+	if err != nil {
+		retorno["erro"] = "Erro ao buscar os roles"
+		return
+	}
+
+	roles := make([]map[string]interface{}, 0, len(nomes))
+	for _, nome := range nomes {
+		role, err := servico.GetRole(nome)
+		if err != nil {
+			continue
+		}
+		membros, _ := servico.users.Listar(nome)
+		roles = append(roles, map[string]interface{}{
+			"nome":       role.Nome,
+			"nivel":      role.Nivel,
+			"permissoes": role.Permissoes,
+			"membros":    membros,
+		})
+	}
+
+	retorno["roles"] = roles
+	retorno["permissoes"] = PermissoesExistentes
+	return
+}
+
+// AtribuirRole Action que dá o role ao user, os roles de administração só podem ser atribuidos pelo ROOT
+func (servico *Servico) AtribuirRole(ctx context.Context, user string, role string, token string) (retorno map[string]interface{}) {
+	retorno = make(map[string]interface{})
+	defer servico.auditarAcao(ctx, EventoRoleAtribuido, token, user, retorno, map[string]interface{}{"role": role})
+
+	roleAtribuir, err := servico.GetRole(role)
+	if err != nil {
+		retorno["erro"] = err.Error()
+		return
+	}
+	if roleAtribuir.Privilegiado() {
+		if err := servico.exigirGestaoAdmins(token); err != nil {
+			servico.logger.Println("Erro: ", "tentativa de atribuir o role ", role, " sem permissões")
+			retorno["erro"] = "Só o ROOT pode atribuir roles de administração"
+			return
+		}
+	}
+
+	utilizador, err := servico.GetUserParaValorStruct(user)
+	if err != nil {
+		retorno["erro"] = "Sem registo para <" + user + ">"
+		return
+	}
+
+	antigos := utilizador.RolesEfetivos()
+	if contem(antigos, role) {
+		retorno["erro"] = "O user já têm o role pedido"
+		return
+	}
+	novos := append(append([]string{}, antigos...), role)
+	atualizado := utilizador
+	if err := servico.DefinirRoles(&atualizado, novos); err != nil {
+		retorno["erro"] = err.Error()
+		return
+	}
+	// Só substitui o registo se não mudou desde a leitura, senão perdia-se a outra alteração
+	if err := servico.users.Trocar(utilizador, atualizado); err != nil {
+		retorno["erro"] = err.Error()
+		return
+	}
+
+	servico.logger.Println("Role ", role, " atribuido ao utilizador, ", user)
+	retorno["roles"] = novos
+	return
+}
+
+// RetirarRole Action que retira o role ao user, os roles de administração só podem ser retirados pelo ROOT,
+// e o último ROOT não pode perder o role. As tokens do user são revogadas, por terem as permissões antigas
+func (servico *Servico) RetirarRole(ctx context.Context, user string, role string, token string) (retorno map[string]interface{}) {
+	retorno = make(map[string]interface{})
+	defer servico.auditarAcao(ctx, EventoRoleRetirado, token, user, retorno, map[string]interface{}{"role": role})
+
+	roleRetirar, err := servico.GetRole(role)
+	if err != nil {
+		retorno["erro"] = err.Error()
+		return
+	}
+	if roleRetirar.Privilegiado() {
+		if err := servico.exigirGestaoAdmins(token); err != nil {
+			servico.logger.Println("Erro: ", "tentativa de retirar o role ", role, " sem permissões")
+			retorno["erro"] = "Só o ROOT pode retirar roles de administração"
+			return
+		}
+	}
+
+	utilizador, err := servico.GetUserParaValorStruct(user)
+	if err != nil {
+		retorno["erro"] = "Sem registo para <" + user + ">"
+		return
+	}
+
+	antigos := utilizador.RolesEfetivos()
+	if !contem(antigos, role) {
+		retorno["erro"] = "O user não têm o role pedido"
+		return
+	}
+	if role == RoleRoot && servico.ultimoRoot(user) {
+		retorno["erro"] = "Não é possivél retirar o role ao último ROOT"
+		return
+	}
+
+	novos := make([]string, 0, len(antigos))
+	for _, r := range antigos {
+		if r != role {
+			novos = append(novos, r)
+		}
+	}
+	atualizado := utilizador
+	if err := servico.DefinirRoles(&atualizado, novos); err != nil {
+		retorno["erro"] = err.Error()
+		return
+	}
+	if err := servico.users.Trocar(utilizador, atualizado); err != nil {
+		retorno["erro"] = err.Error()
+		return
+	}
+	servico.RevogarTokensUser(user)
+
+	servico.logger.Println("Role ", role, " retirado ao utilizador, ", user)
+	retorno["roles"] = novos
+	return
+}
+
+// DefinirRole Action que cria ou altera as permissões de um role, exemplo: {"nome": "GESTOR", "permissoes": ["users:ver"]}.
+// Os roles novos têm o nivel USER, o ROOT não pode ser alterado, e as permissões exclusivas do ROOT não podem ser dadas.
+// As tokens dos membros do role são revogadas, por terem as permissões antigas
+func (servico *Servico) DefinirRole(ctx context.Context, definicao map[string]interface{}, token string) (retorno map[string]interface{}) {
+	retorno = make(map[string]interface{})
+
+	nome, _ := definicao["nome"].(string)
+	defer servico.auditarAcao(ctx, EventoRoleDefinido, token, nome, retorno, map[string]interface{}{"permissoes": definicao["permissoes"]})
+	if !nomeRoleValido.MatchString(nome) {
+		retorno["erro"] = "Nome do role inválido"
+		return
+	}
+	if nome == RoleRoot {
+		retorno["erro"] = "O role ROOT não pode ser alterado"
+		return
+	}
+
+	lista, _ := definicao["permissoes"].([]interface{})
+	permissoes := make([]string, 0, len(lista))
+	for _, valor := range lista {
+		permissao, _ := valor.(string)
+		if !contem(PermissoesExistentes, permissao) || contem(permissoesRoot, permissao) {
+			retorno["erro"] = "Permissão inválida ou exclusiva do ROOT: " + permissao
+			return
+		}
+		if !contem(permissoes, permissao) {
+			permissoes = append(permissoes, permissao)
+		}
+	}
+
+	role := Role{Nome: nome, Nivel: USER, Permissoes: permissoes}
+	if existente, err := servico.GetRole(nome); err == nil {
+		role.Nivel = existente.Nivel
+	}
+	if err := servico.guardarRole(role); err != nil {
+		retorno["erro"] = err.Error()
+		return
+	}
+
+	membros, _ := servico.users.Listar(nome)
+	for _, membro := range membros {
+		servico.RevogarTokensUser(membro)
+	}
+
+	servico.logger.Println("Role ", nome, " definido com as permissões: ", permissoes)
+	retorno["role"] = role
+	return
+}
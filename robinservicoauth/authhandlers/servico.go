@@ -0,0 +1,104 @@
+package authhandlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/autorizacao"
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/clientes"
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/clientes/userinfo"
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/registos"
+	"github.com/tomascpmarques/PAP/backend/robinservicoauth/auditoria"
+	"github.com/tomascpmarques/PAP/backend/robinservicoauth/loggers"
+	"github.com/tomascpmarques/PAP/backend/robinservicoauth/notificacoes"
+)
+
+// Dependencias Recursos externos usados pelo serviço, criados no main (ou nos testes)
+type Dependencias struct {
+	Estado      Estado                   // Tokens, revogações, bloqueios, chaves, roles e contas de serviço
+	Users       UserStore                // Armazenamento dos users
+	Auditoria   auditoria.Registo        // Registo dos eventos de segurança, nil não regista
+	Notificador notificacoes.Notificador // Entrega das tokens de reset e convites, nil usa o da configuração (ou nenhum)
+	HTTP        *http.Client             // Chamadas ao serviço userinfo, nil usa o http.DefaultClient
+	Logger      *log.Logger              // Eventos do serviço, nil usa o loggers.LoginAuthLogger
+	LoggerErros *log.Logger              // Erros do serviço, nil usa o loggers.LoginServerErrorLogger
+	LoggerBD    *log.Logger              // Erros da BD, nil usa o loggers.LoginRedisLogger
+	Registador  *registos.Registador     // Logs estruturados com os dados do pedido, nil usa o loggers.Registador
+	// ConfiarProxy os handlers http que não passam pelo Despachante usam o IP do cliente dos headers do proxy,
+	// com a mesma configuração do Despachante (ver acoes.Despachante.ConfiarProxy)
+	ConfiarProxy bool
+}
+
+// Servico Serviço de autenticação, as actions e os handlers http são métodos do Servico
+type Servico struct {
+	config      Config
+	estado      Estado
+	users       UserStore
+	auditoria   auditoria.Registo
+	notificador notificacoes.Notificador
+	logger      *log.Logger
+	loggerErros *log.Logger
+	loggerBD    *log.Logger
+	registador  *registos.Registador
+	// confiarProxy o IP do cliente dos handlers http é lido dos headers do proxy
+	confiarProxy bool
+
+	// autorizacao Verificador das tokens emitidas por este serviço, com as chaves de assinatura locais
+	// e a revogação guardada na BD
+	autorizacao *autorizacao.Verificador
+	// chaveTOTP chave AES-256 usada para cifrar os segredos TOTP guardados nos registos dos users, carregada no Iniciar
+	chaveTOTP []byte
+	// chaveCifraChaves chave AES-256 usada para cifrar as chaves privadas de assinatura guardadas, carregada no Iniciar
+	chaveCifraChaves []byte
+	// userinfo cliente das actions do serviço userinfo
+	userinfo     *userinfo.Cliente
+	chaves       conjuntoChaves
+	tokenInterna tokenInterna
+}
+
+// NovoServico Cria o serviço com a configuração e as dependências dadas, não acede à BD (ver Iniciar)
+func NovoServico(config Config, deps Dependencias) *Servico {
+	servico := &Servico{
+		config:      config,
+		estado:      deps.Estado,
+		users:       deps.Users,
+		auditoria:   deps.Auditoria,
+		notificador: deps.Notificador,
+		logger:      deps.Logger,
+		loggerErros: deps.LoggerErros,
+		loggerBD:    deps.LoggerBD,
+		registador:  deps.Registador,
+
+		confiarProxy: deps.ConfiarProxy,
+	}
+	if servico.logger == nil {
+		servico.logger = loggers.LoginAuthLogger
+	}
+	if servico.loggerErros == nil {
+		servico.loggerErros = loggers.LoginServerErrorLogger
+	}
+	if servico.loggerBD == nil {
+		servico.loggerBD = loggers.LoginRedisLogger
+	}
+	if servico.registador == nil {
+		servico.registador = loggers.Registador
+	}
+	if servico.notificador == nil {
+		servico.notificador = servico.carregarNotificador(config.Notificador)
+	}
+	urlUserinfo := config.URLUserinfo
+	if urlUserinfo == "" {
+		urlUserinfo = ConfigDefault().URLUserinfo
+	}
+	servico.userinfo = userinfo.Novo(clientes.Novo(urlUserinfo, deps.HTTP, config.Userinfo))
+
+	servico.autorizacao = autorizacao.NovoVerificador(servico.chaveVerificacao, func(_ string, claims autorizacao.Claims) bool {
+		return !servico.TokenRevogada(claims)
+	})
+	return servico
+}
+
+// Autorizacao Verificador das tokens emitidas por este serviço, usado no registo das actions
+func (servico *Servico) Autorizacao() *autorizacao.Verificador {
+	return servico.autorizacao
+}
@@ -0,0 +1,646 @@
+package authhandlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/acoes"
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/autorizacao"
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/clientes"
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/clientes/userinfo"
+)
+
+// novoServicoTeste Serviço com os users e o estado em memória, sem redis nem auditoria, já iniciado
+// (roles base, admin do primeiro boot e chave de assinatura)
+func novoServicoTeste(t *testing.T) *Servico {
+	t.Helper()
+	chave := make([]byte, 32)
+	if _, err := rand.Read(chave); err != nil {
+		t.Fatal(err)
+	}
+	config := ConfigDefault()
+	config.UserStore = BackendMemoria
+	config.ChaveTOTP = base64.StdEncoding.EncodeToString(chave)
+	if _, err := rand.Read(chave); err != nil {
+		t.Fatal(err)
+	}
+	config.CifraChaves = base64.StdEncoding.EncodeToString(chave)
+
+	descartar := log.New(io.Discard, "", 0)
+	servico := NovoServico(config, Dependencias{
+		Estado:      NovoEstadoMemoria(),
+		Users:       NovoUserStoreMemoria(),
+		Logger:      descartar,
+		LoggerErros: descartar,
+		LoggerBD:    descartar,
+	})
+	if err := servico.Iniciar(); err != nil {
+		t.Fatal(err)
+	}
+	return servico
+}
+
+// criarUserTeste Guarda um user ativo com a password e o nivel dados
+func criarUserTeste(t *testing.T, servico *Servico, nome string, password string, perms int) User {
+	t.Helper()
+	user, err := CriarNovoUser(nome, password, perms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := servico.GuardarUser(user); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// tokenTeste Emite as tokens do user sem passar pelo login (ex: admins, que precisam do TOTP no login)
+func tokenTeste(t *testing.T, servico *Servico, nome string) string {
+	t.Helper()
+	user, err := servico.GetUserParaValorStruct(nome)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acesso, _, err := servico.EmitirTokens(user, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return acesso
+}
+
+// exigirSemErro Falha o teste se o retorno da action tiver um erro
+func exigirSemErro(t *testing.T, retorno map[string]interface{}) {
+	t.Helper()
+	for _, chave := range []string{"erro", "error"} {
+		if erro, existe := retorno[chave]; existe {
+			t.Fatalf("erro inesperado: %v", erro)
+		}
+	}
+}
+
+// exigirErro Falha o teste se o retorno da action não tiver um erro
+func exigirErro(t *testing.T, retorno map[string]interface{}) {
+	t.Helper()
+	if retorno["erro"] == nil && retorno["error"] == nil {
+		t.Fatalf("esperava um erro, retorno: %v", retorno)
+	}
+}
+
+func TestLogin(t *testing.T) {
+	servico := novoServicoTeste(t)
+	criarUserTeste(t, servico, "ana", "segredo-da-ana", USER)
+
+	retorno := servico.Login(context.Background(), "ana", "segredo-da-ana")
+	exigirSemErro(t, retorno)
+	token, _ := retorno["token"].(string)
+	claims, err := servico.Autorizacao().Acesso(token)
+	if err != nil {
+		t.Fatalf("token de acesso inválida: %v", err)
+	}
+	if claims.User != "ana" || claims.Perms != USER {
+		t.Fatalf("claims inesperadas: %+v", claims)
+	}
+	if _, err := servico.Autorizacao().Refresh(retorno["refresh_token"].(string)); err != nil {
+		t.Fatalf("token de refresh inválida: %v", err)
+	}
+}
+
+func TestLoginCredenciaisInvalidas(t *testing.T) {
+	servico := novoServicoTeste(t)
+	criarUserTeste(t, servico, "ana", "segredo-da-ana", USER)
+
+	for _, caso := range []struct{ user, password string }{
+		{"ana", "errada"},
+		{"inexistente", "segredo-da-ana"},
+	} {
+		retorno := servico.Login(context.Background(), caso.user, caso.password)
+		if retorno["erro"] != mensagemCredenciaisInvalidas || retorno["token"] != nil {
+			t.Fatalf("login de %s: esperava %q, retorno: %v", caso.user, mensagemCredenciaisInvalidas, retorno)
+		}
+	}
+}
+
+func TestLoginBloqueio(t *testing.T) {
+	servico := novoServicoTeste(t)
+	criarUserTeste(t, servico, "ana", "segredo-da-ana", USER)
+
+	// Depois do limite de atraso, as tentativas seguintes são recusadas mesmo com a password certa
+	for i := int64(0); i < limitesFalhasLogin[alvoUser].atraso; i++ {
+		servico.Login(context.Background(), "ana", "errada")
+	}
+	retorno := servico.Login(context.Background(), "ana", "segredo-da-ana")
+	if retorno["erro"] != mensagemLoginBloqueado || retorno["tentar_depois"] == nil {
+		t.Fatalf("esperava o login bloqueado, retorno: %v", retorno)
+	}
+
+	exigirSemErro(t, servico.DesbloquearLogin(context.Background(), alvoUser, "ana", ""))
+	exigirSemErro(t, servico.Login(context.Background(), "ana", "segredo-da-ana"))
+}
+
+func TestLoginContaInativa(t *testing.T) {
+	servico := novoServicoTeste(t)
+	user := criarUserTeste(t, servico, "ana", "segredo-da-ana", USER)
+	user.Estado = EstadoDesativado
+	if err := servico.GuardarUser(user); err != nil {
+		t.Fatal(err)
+	}
+
+	retorno := servico.Login(context.Background(), "ana", "segredo-da-ana")
+	exigirErro(t, retorno)
+	if retorno["token"] != nil {
+		t.Fatalf("uma conta desativada não pode receber tokens: %v", retorno)
+	}
+}
+
+func TestRegistar(t *testing.T) {
+	servico := novoServicoTeste(t)
+	criarUserTeste(t, servico, "gestor", "segredo-do-gestor", ADMIN)
+	tokenAdmin := tokenTeste(t, servico, "gestor")
+	tokenRoot := tokenTeste(t, servico, "admin")
+
+	exigirSemErro(t, servico.Registar(context.Background(), "rui", "segredo-do-rui", USER, tokenAdmin))
+	exigirSemErro(t, servico.Login(context.Background(), "rui", "segredo-do-rui"))
+
+	// Nomes repetidos ou inválidos, permissões fora dos limites, e administradores registados sem ser pelo ROOT
+	exigirErro(t, servico.Registar(context.Background(), "rui", "outra", USER, tokenAdmin))
+	exigirErro(t, servico.Registar(context.Background(), "rui silva", "segredo", USER, tokenAdmin))
+	exigirErro(t, servico.Registar(context.Background(), "eva", "segredo", 0, tokenAdmin))
+	exigirErro(t, servico.Registar(context.Background(), "eva", "segredo", ADMIN, tokenAdmin))
+	exigirSemErro(t, servico.Registar(context.Background(), "eva", "segredo", ADMIN, tokenRoot))
+}
+
+func TestAtualizarUser(t *testing.T) {
+	servico := novoServicoTeste(t)
+	criarUserTeste(t, servico, "ana", "segredo-da-ana", USER)
+	criarUserTeste(t, servico, "gestor", "segredo-do-gestor", ADMIN)
+	tokenAdmin := tokenTeste(t, servico, "gestor")
+	tokenAna := tokenTeste(t, servico, "ana")
+
+	exigirErro(t, servico.AtualizarUser(context.Background(), "ana", map[string]interface{}{"pass": 1234}, tokenAdmin))
+	exigirErro(t, servico.AtualizarUser(context.Background(), "ana", map[string]interface{}{"perms": float64(ADMIN)}, tokenAdmin))
+
+	// A mudança da password revoga as tokens anteriores
+	exigirSemErro(t, servico.AtualizarUser(context.Background(), "ana", map[string]interface{}{"pass": "nova-da-ana"}, tokenAdmin))
+	if _, err := servico.Autorizacao().Acesso(tokenAna); err == nil {
+		t.Fatal("a token anterior à mudança da password continua aceite")
+	}
+	exigirErro(t, servico.Login(context.Background(), "ana", "segredo-da-ana"))
+	exigirSemErro(t, servico.Login(context.Background(), "ana", "nova-da-ana"))
+}
+
+func TestRegistarConcorrente(t *testing.T) {
+	servico := novoServicoTeste(t)
+	tokenAdmin := tokenTeste(t, servico, "admin")
+
+	// Dos registos em simultâneo com o mesmo nome, só um cria o user
+	var grupo sync.WaitGroup
+	var criados int32
+	for i := 0; i < 5; i++ {
+		grupo.Add(1)
+		go func() {
+			defer grupo.Done()
+			if servico.Registar(context.Background(), "ana", "segredo-da-ana", USER, tokenAdmin)["sucesso"] == true {
+				atomic.AddInt32(&criados, 1)
+			}
+		}()
+	}
+	grupo.Wait()
+	if atomic.LoadInt32(&criados) != 1 {
+		t.Fatalf("esperava 1 registo, foram criados %d", atomic.LoadInt32(&criados))
+	}
+}
+
+// usersSemReversao UserStore em que só a primeira troca funciona, as seguintes falham como um redis em baixo
+type usersSemReversao struct {
+	*UserStoreMemoria
+	trocas int
+}
+
+func (users *usersSemReversao) Trocar(anterior User, novo User) error {
+	users.trocas++
+	if users.trocas > 1 {
+		return errors.New("ligação recusada")
+	}
+	return users.UserStoreMemoria.Trocar(anterior, novo)
+}
+
+func TestAtualizarUserReversaoFalhada(t *testing.T) {
+	servico := novoServicoTeste(t)
+	criarUserTeste(t, servico, "ana", "segredo-da-ana", USER)
+	tokenAdmin := tokenTeste(t, servico, "admin")
+
+	userinfoEmBaixo := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer userinfoEmBaixo.Close()
+	servico.userinfo = userinfo.Novo(clientes.Novo(userinfoEmBaixo.URL, nil, clientes.Config{Timeout: time.Second, Tentativas: 1}))
+	servico.users = &usersSemReversao{UserStoreMemoria: servico.users.(*UserStoreMemoria)}
+
+	// O userinfo falha e a reversão do nome também, o erro indica que os serviços ficaram inconsistentes
+	retorno := servico.AtualizarUser(context.Background(), "ana", map[string]interface{}{"user": "beatriz"}, tokenAdmin)
+	erro, _ := retorno["erro"].(string)
+	if !strings.Contains(erro, "inconsistente") {
+		t.Fatalf("esperava o erro de estado inconsistente, retorno: %v", retorno)
+	}
+}
+
+func TestRenovarToken(t *testing.T) {
+	servico := novoServicoTeste(t)
+	criarUserTeste(t, servico, "ana", "segredo-da-ana", USER)
+	login := servico.Login(context.Background(), "ana", "segredo-da-ana")
+	exigirSemErro(t, login)
+	refresh := login["refresh_token"].(string)
+
+	renovado := servico.RenovarToken(refresh)
+	exigirSemErro(t, renovado)
+	if renovado["refresh_token"] == refresh {
+		t.Fatal("a token de refresh não foi rodada")
+	}
+
+	// Reutilizar a token de refresh antiga revoga toda a familia, incluindo a token nova
+	exigirErro(t, servico.RenovarToken(refresh))
+	exigirErro(t, servico.RenovarToken(renovado["refresh_token"].(string)))
+}
+
+func TestLogout(t *testing.T) {
+	servico := novoServicoTeste(t)
+	criarUserTeste(t, servico, "ana", "segredo-da-ana", USER)
+	login := servico.Login(context.Background(), "ana", "segredo-da-ana")
+	exigirSemErro(t, login)
+
+	exigirSemErro(t, servico.Logout(context.Background(), login["token"].(string)))
+	if _, err := servico.Autorizacao().Acesso(login["token"].(string)); err == nil {
+		t.Fatal("a token continua aceite depois do logout")
+	}
+	exigirErro(t, servico.RenovarToken(login["refresh_token"].(string)))
+}
+
+func TestRevogacaoFamilia(t *testing.T) {
+	servico := novoServicoTeste(t)
+	criarUserTeste(t, servico, "ana", "segredo-da-ana", USER)
+	login := servico.Login(context.Background(), "ana", "segredo-da-ana")
+	exigirSemErro(t, login)
+	renovada := servico.RenovarToken(login["refresh_token"].(string))
+	exigirSemErro(t, renovada)
+
+	// A reutilização da token de refresh revoga a familia, incluindo as tokens de acesso já emitidas
+	exigirErro(t, servico.RenovarToken(login["refresh_token"].(string)))
+	for _, token := range []interface{}{login["token"], renovada["token"]} {
+		if _, err := servico.Autorizacao().Acesso(token.(string)); err == nil {
+			t.Fatal("token de acesso aceite depois da revogação da familia")
+		}
+	}
+}
+
+func TestRevogacaoMesmoSegundo(t *testing.T) {
+	servico := novoServicoTeste(t)
+	criarUserTeste(t, servico, "ana", "segredo-da-ana", USER)
+	antiga := tokenTeste(t, servico, "ana")
+	time.Sleep(time.Millisecond * 2)
+	if err := servico.RevogarTokensUser("ana"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond * 2)
+
+	// As tokens emitidas logo depois da revogação, no mesmo segundo, são aceites
+	if _, err := servico.Autorizacao().Acesso(antiga); err == nil {
+		t.Fatal("token emitida antes da revogação aceite")
+	}
+	if _, err := servico.Autorizacao().Acesso(tokenTeste(t, servico, "ana")); err != nil {
+		t.Fatalf("token emitida depois da revogação recusada: %v", err)
+	}
+
+	// Os registos antigos, em segundos, revogam o segundo inteiro
+	claims := autorizacao.Claims{User: "ana", Emitida: time.Unix(100, int64(time.Millisecond*999))}
+	if err := servico.estado.Guardar(prefixoUserRevogado+"ana", "100", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if !servico.TokenRevogada(claims) {
+		t.Fatal("token emitida no segundo da revogação antiga aceite")
+	}
+}
+
+// estadoIndisponivel Estado em que todas as leituras falham, como um redis em baixo
+type estadoIndisponivel struct {
+	*EstadoMemoria
+}
+
+func (estadoIndisponivel) Get(string) (string, error) {
+	return "", errors.New("ligação recusada")
+}
+
+func (estadoIndisponivel) TempoRestante(string) (time.Duration, error) {
+	return 0, errors.New("ligação recusada")
+}
+
+func TestFalhaEstadoRecusa(t *testing.T) {
+	servico := novoServicoTeste(t)
+	criarUserTeste(t, servico, "ana", "segredo-da-ana", USER)
+	login := servico.Login(context.Background(), "ana", "segredo-da-ana")
+	exigirSemErro(t, login)
+	claims, err := servico.Autorizacao().Refresh(login["refresh_token"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Sem acesso às revogações e aos bloqueios, as tokens e os logins são recusados
+	servico.estado = estadoIndisponivel{servico.estado.(*EstadoMemoria)}
+	if !servico.TokenRevogada(claims) {
+		t.Fatal("a token foi aceite sem ler as revogações")
+	}
+	if !servico.familiaRevogada(claims.Familia) {
+		t.Fatal("a familia foi aceite sem ler as revogações")
+	}
+	exigirErro(t, servico.RenovarToken(login["refresh_token"].(string)))
+	exigirErro(t, servico.Login(context.Background(), "ana", "segredo-da-ana"))
+}
+
+func TestAtribuirRetirarRole(t *testing.T) {
+	servico := novoServicoTeste(t)
+	criarUserTeste(t, servico, "ana", "segredo-da-ana", USER)
+	tokenRoot := tokenTeste(t, servico, "admin")
+
+	exigirSemErro(t, servico.AtribuirRole(context.Background(), "ana", RoleAdmin, tokenRoot))
+	exigirErro(t, servico.AtribuirRole(context.Background(), "ana", RoleAdmin, tokenRoot))
+	membros, _ := servico.users.Listar(RoleAdmin)
+	if !contem(membros, "ana") {
+		t.Fatalf("a ana não está entre os membros do role: %v", membros)
+	}
+
+	exigirSemErro(t, servico.RetirarRole(context.Background(), "ana", RoleAdmin, tokenRoot))
+	if user, _ := servico.users.Get("ana"); contem(user.RolesEfetivos(), RoleAdmin) || user.Permissoes != USER {
+		t.Fatalf("o role não foi retirado: %+v", user)
+	}
+}
+
+func TestTOTPReutilizado(t *testing.T) {
+	servico := novoServicoTeste(t)
+	criarUserTeste(t, servico, "ana", "segredo-da-ana", USER)
+	login := servico.Login(context.Background(), "ana", "segredo-da-ana")
+	exigirSemErro(t, login)
+
+	inscricao := servico.IniciarTOTP(login["token"].(string))
+	exigirSemErro(t, inscricao)
+	segredo, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(inscricao["segredo"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	passo := time.Now().Unix() / periodoTOTP
+	exigirSemErro(t, servico.ConfirmarTOTP(context.Background(), codigoTOTP(segredo, passo), login["token"].(string)))
+
+	// O código usado na confirmação não pode completar um login
+	parcial := servico.Login(context.Background(), "ana", "segredo-da-ana")
+	exigirSemErro(t, parcial)
+	exigirErro(t, servico.VerificarTOTP(context.Background(), codigoTOTP(segredo, passo), parcial["token_parcial"].(string)))
+
+	// Dois logins simultâneos com o mesmo código: só um deles recebe as tokens
+	tokensParciais := make([]string, 2)
+	for i := range tokensParciais {
+		parcial := servico.Login(context.Background(), "ana", "segredo-da-ana")
+		exigirSemErro(t, parcial)
+		tokensParciais[i] = parcial["token_parcial"].(string)
+	}
+	codigo := codigoTOTP(segredo, passo+1)
+	resultados := make([]map[string]interface{}, len(tokensParciais))
+	var espera sync.WaitGroup
+	for i, tokenParcial := range tokensParciais {
+		espera.Add(1)
+		go func(i int, tokenParcial string) {
+			defer espera.Done()
+			resultados[i] = servico.VerificarTOTP(context.Background(), codigo, tokenParcial)
+		}(i, tokenParcial)
+	}
+	espera.Wait()
+
+	aceites := 0
+	for _, resultado := range resultados {
+		if resultado["token"] != nil {
+			aceites++
+		}
+	}
+	if aceites != 1 {
+		t.Fatalf("o mesmo código foi aceite %d vezes: %v", aceites, resultados)
+	}
+}
+
+func TestChavesOutraInstancia(t *testing.T) {
+	servico := novoServicoTeste(t)
+	descartar := log.New(io.Discard, "", 0)
+	outra := NovoServico(servico.config, Dependencias{
+		Estado:      servico.estado,
+		Users:       servico.users,
+		Logger:      descartar,
+		LoggerErros: descartar,
+		LoggerBD:    descartar,
+	})
+	if err := outra.Iniciar(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Uma chave rodada pela outra instância é lida na primeira token com o kid novo
+	if _, err := outra.RodarChavesAssinatura(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := servico.Autorizacao().Acesso(tokenTeste(t, outra, "admin")); err != nil {
+		t.Fatalf("token assinada com a chave nova recusada: %v", err)
+	}
+
+	// Mas as chaves guardadas só voltam a ser lidas depois do intervaloMinimoRecarga
+	if _, err := outra.RodarChavesAssinatura(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := servico.Autorizacao().Acesso(tokenTeste(t, outra, "admin")); err == nil {
+		t.Fatal("as chaves guardadas foram lidas outra vez antes do intervalo minimo")
+	}
+}
+
+func TestRotacoesConcorrentes(t *testing.T) {
+	servico := novoServicoTeste(t)
+
+	// Nenhuma das rotações em simultâneo pode perder a chave criada pelas outras
+	var grupo sync.WaitGroup
+	kids := make(chan string, maxTentativasRotacao)
+	for i := 0; i < maxTentativasRotacao; i++ {
+		grupo.Add(1)
+		go func() {
+			defer grupo.Done()
+			kid, err := servico.RodarChavesAssinatura()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			kids <- kid
+		}()
+	}
+	grupo.Wait()
+	close(kids)
+
+	chaves, err := servico.carregarChaves()
+	if err != nil {
+		t.Fatal(err)
+	}
+	guardadas := make(map[string]bool)
+	for _, chave := range chaves {
+		guardadas[chave.Kid] = true
+	}
+	for kid := range kids {
+		if !guardadas[kid] {
+			t.Fatalf("a chave %s foi perdida por outra rotação", kid)
+		}
+	}
+}
+
+func TestChavesCifradas(t *testing.T) {
+	servico := novoServicoTeste(t)
+	registo, err := servico.estado.Get(keyChavesAssinatura)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(registo, "PRIVATE KEY") {
+		t.Fatal("a chave privada foi guardada sem cifra")
+	}
+
+	// Os registos antigos, com o PEM sem cifra, são lidos e cifrados no arranque
+	chave, err := servico.chaveAtiva()
+	if err != nil {
+		t.Fatal(err)
+	}
+	antiga := []ChaveAssinatura{{
+		Kid:      chave.Kid,
+		PEM:      string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(chave.privada)})),
+		CriadaEm: chave.CriadaEm,
+	}}
+	registoJSON, err := json.Marshal(antiga)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := servico.estado.Guardar(keyChavesAssinatura, string(registoJSON), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := servico.InicializarChaves(); err != nil {
+		t.Fatal(err)
+	}
+	if registo, _ := servico.estado.Get(keyChavesAssinatura); strings.Contains(registo, "PRIVATE KEY") {
+		t.Fatal("a chave antiga não foi cifrada")
+	}
+	if ativa, err := servico.chaveAtiva(); err != nil || ativa.Kid != chave.Kid {
+		t.Fatal("a chave antiga deixou de ser a ativa")
+	}
+
+	// Sem a chave de cifra certa as chaves guardadas não são lidas
+	servico.chaveCifraChaves = make([]byte, 32)
+	if err := servico.InicializarChaves(); err == nil {
+		t.Fatal("as chaves foram lidas com outra chave de cifra")
+	}
+}
+
+func TestInicializarChavesFalhaEstado(t *testing.T) {
+	servico := novoServicoTeste(t)
+
+	// Uma falha da BD não pode ser tratada como a falta de chaves
+	servico.estado = estadoIndisponivel{servico.estado.(*EstadoMemoria)}
+	if err := servico.InicializarChaves(); err == nil {
+		t.Fatal("as chaves foram inicializadas sem ler a BD")
+	}
+}
+
+func TestEstadoErrosAutorizacao(t *testing.T) {
+	servico := novoServicoTeste(t)
+	criarUserTeste(t, servico, "ana", "segredo-da-ana", USER)
+	tokenAna := tokenTeste(t, servico, "ana")
+
+	if estado := acoes.Estado(servico.IniciarTOTP("invalida")); estado != http.StatusUnauthorized {
+		t.Fatalf("token inválida: esperava %d, recebeu %d", http.StatusUnauthorized, estado)
+	}
+	if estado := acoes.Estado(servico.DesativarTOTP(context.Background(), "admin", tokenAna)); estado != http.StatusForbidden {
+		t.Fatalf("sem permissões: esperava %d, recebeu %d", http.StatusForbidden, estado)
+	}
+}
+
+func TestSemNotificador(t *testing.T) {
+	servico := novoServicoTeste(t)
+	criarUserTeste(t, servico, "ana", "segredo-da-ana", USER)
+	tokenRoot := tokenTeste(t, servico, "admin")
+
+	// Sem notificador configurado as tokens não são criadas, nem escritas no log
+	exigirErro(t, servico.PedirResetPassword(context.Background(), "ana"))
+	exigirErro(t, servico.ConvidarUser(context.Background(), "rui", "rui@exemplo.pt", USER, tokenRoot))
+	if _, err := servico.users.Get("rui"); err != ErrUserNaoExiste {
+		t.Fatalf("a conta do convite foi criada sem notificador: %v", err)
+	}
+}
+
+// pedirTokenServico Pede uma token ao TokenServicoHandler com as credenciais no form, devolve o estado http
+func pedirTokenServico(servico *Servico, conta string, segredo string) int {
+	return pedirTokenServicoProxy(servico, conta, segredo, "")
+}
+
+// pedirTokenServicoProxy Pede a token de serviço como o pedirTokenServico, com o IP do cliente no X-Forwarded-For
+func pedirTokenServicoProxy(servico *Servico, conta string, segredo string, ip string) int {
+	form := url.Values{"grant_type": {"client_credentials"}, "client_id": {conta}, "client_secret": {segredo}}
+	pedido := httptest.NewRequest(http.MethodPost, "/token", strings.NewReader(form.Encode()))
+	pedido.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if ip != "" {
+		pedido.Header.Set("X-Forwarded-For", ip)
+	}
+	resposta := httptest.NewRecorder()
+	servico.TokenServicoHandler(resposta, pedido)
+	return resposta.Code
+}
+
+func TestTokenServicoBloqueio(t *testing.T) {
+	servico := novoServicoTeste(t)
+	criada := servico.CriarContaServico(context.Background(), "relatorios", autorizacao.ScopeUserinfoContribuicoes, tokenTeste(t, servico, "admin"))
+	exigirSemErro(t, criada)
+	segredo := criada["segredo"].(string)
+
+	if estado := pedirTokenServico(servico, "relatorios", segredo); estado != http.StatusOK {
+		t.Fatalf("esperava %d, recebeu %d", http.StatusOK, estado)
+	}
+	for i := int64(0); i < limitesFalhasLogin[alvoServico].atraso; i++ {
+		if estado := pedirTokenServico(servico, "relatorios", "errado"); estado != http.StatusUnauthorized {
+			t.Fatalf("segredo errado: esperava %d, recebeu %d", http.StatusUnauthorized, estado)
+		}
+	}
+	// Depois do limite de atraso, até o segredo certo é recusado
+	if estado := pedirTokenServico(servico, "relatorios", segredo); estado != http.StatusTooManyRequests {
+		t.Fatalf("conta bloqueada: esperava %d, recebeu %d", http.StatusTooManyRequests, estado)
+	}
+
+	exigirSemErro(t, servico.DesbloquearLogin(context.Background(), alvoServico, "relatorios", ""))
+	if estado := pedirTokenServico(servico, "relatorios", segredo); estado != http.StatusOK {
+		t.Fatalf("conta desbloqueada: esperava %d, recebeu %d", http.StatusOK, estado)
+	}
+}
+
+func TestTokenServicoIPProxy(t *testing.T) {
+	servico := novoServicoTeste(t)
+	servico.confiarProxy = true
+
+	// Atrás do gateway, as falhas são contadas para o IP do cliente e não para o IP do gateway
+	if estado := pedirTokenServicoProxy(servico, "inexistente", "errado", "203.0.113.7"); estado != http.StatusUnauthorized {
+		t.Fatalf("esperava %d, recebeu %d", http.StatusUnauthorized, estado)
+	}
+	falhas, err := servico.estado.ContarOcorrencias(prefixoFalhasLogin+alvoIP+":203.0.113.7", janelaFalhasLogin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if falhas != 1 {
+		t.Fatalf("esperava 1 falha do IP do cliente, foram contadas %d", falhas)
+	}
+}
@@ -0,0 +1,199 @@
+package authhandlers
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/acoes"
+)
+
+const (
+	// prefixoFalhasLogin prefixo dos sorted sets com os momentos das falhas de login, por user ou por IP
+	prefixoFalhasLogin = "falhas_login:"
+	// prefixoBloqueioLogin prefixo das keys que bloqueiam o login de um user ou IP enquanto existirem
+	prefixoBloqueioLogin = "bloqueio_login:"
+
+	// alvoUser tipo dos contadores de falhas por username
+	alvoUser = "user"
+	// alvoIP tipo dos contadores de falhas por IP do cliente
+	alvoIP = "ip"
+	// alvoServico tipo dos contadores de falhas por conta de serviço (client_id do endpoint /token)
+	alvoServico = "servico"
+
+	// janelaFalhasLogin só as falhas dentro desta janela (deslizante) contam para o bloqueio
+	janelaFalhasLogin = time.Minute * 15
+	// duracaoBloqueioLogin duração do bloqueio quando o limite de falhas é atingido
+	duracaoBloqueioLogin = time.Minute * 30
+	// atrasoMaximoLogin valor máximo do atraso exponencial entre tentativas
+	atrasoMaximoLogin = time.Minute * 5
+)
+
+const (
+	// mensagemCredenciaisInvalidas erro devolvido em todas as falhas de login, não indica se o user existe
+	mensagemCredenciaisInvalidas = "Credenciais inválidas"
+	// mensagemLoginBloqueado erro devolvido enquanto o user ou o IP estiverem bloqueados
+	mensagemLoginBloqueado = "Demasiadas tentativas falhadas, tente mais tarde"
+)
+
+// limitesFalhas número de falhas na janela a partir do qual se aplica o atraso exponencial, e o bloqueio
+type limitesFalhas struct {
+	atraso   int64
+	bloqueio int64
+}
+
+// limitesFalhasLogin limites por tipo de alvo, os IPs têm limites maiores por poderem ser partilhados por vários users
+var limitesFalhasLogin = map[string]limitesFalhas{
+	alvoUser:    {atraso: 3, bloqueio: 10},
+	alvoIP:      {atraso: 10, bloqueio: 50},
+	alvoServico: {atraso: 3, bloqueio: 10},
+}
+
+// userComparacao user com uma password aleatória, usado para verificar a password quando o user não existe,
+// para o tempo de resposta ser igual ao de um user existente
+var userComparacao = func() User {
+	var user User
+	password, _ := gerarIdentificador()
+	user.DefinirPassword("comparacao:" + password)
+	return user
+}()
+
+// alvosLogin Devolve os alvos dos contadores de falhas para o pedido, tipo -> identificador
+func alvosLogin(ctx context.Context, user string) map[string]string {
+	alvos := map[string]string{alvoUser: user}
+	if ip := acoes.PedidoDe(ctx).IP; ip != "" {
+		alvos[alvoIP] = ip
+	}
+	return alvos
+}
+
+// alvosServico Devolve os alvos dos contadores de falhas de um pedido ao endpoint /token, pela conta de serviço e pelo IP
+func alvosServico(ctx context.Context, conta string) map[string]string {
+	alvos := make(map[string]string)
+	if conta != "" {
+		alvos[alvoServico] = conta
+	}
+	if ip := acoes.PedidoDe(ctx).IP; ip != "" {
+		alvos[alvoIP] = ip
+	}
+	return alvos
+}
+
+// loginBloqueado Devolve o tempo restante do bloqueio mais longo entre os alvos, 0 se nenhum estiver bloqueado.
+// Se não for possível ler os bloqueios o login é recusado, com o atraso máximo
+func (servico *Servico) loginBloqueado(alvos map[string]string) time.Duration {
+	var restante time.Duration
+	for tipo, id := range alvos {
+		r, err := servico.estado.TempoRestante(prefixoBloqueioLogin + tipo + ":" + id)
+		if err != nil {
+			servico.loggerBD.Println("Erro ao verificar o bloqueio do ", tipo, " <", id, ">: ", err)
+			r = atrasoMaximoLogin
+		}
+		if r > restante {
+			restante = r
+		}
+	}
+	return restante
+}
+
+// atrasoFalhas Duração do bloqueio depois de um número de falhas: nenhum abaixo do limite de atraso,
+// o dobro por cada falha acima desse limite (até atrasoMaximoLogin), e duracaoBloqueioLogin no limite de bloqueio
+func atrasoFalhas(falhas int64, limites limitesFalhas) time.Duration {
+	switch {
+	case falhas >= limites.bloqueio:
+		return duracaoBloqueioLogin
+	case falhas >= limites.atraso:
+		atraso := time.Second * time.Duration(math.Pow(2, float64(falhas-limites.atraso)))
+		if atraso > atrasoMaximoLogin {
+			return atrasoMaximoLogin
+		}
+		return atraso
+	}
+	return 0
+}
+
+// registarFalhaLogin Conta a falha para todos os alvos, e bloqueia os que passaram os limites
+func (servico *Servico) registarFalhaLogin(alvos map[string]string) {
+	for tipo, id := range alvos {
+		falhas, err := servico.estado.RegistarOcorrencia(prefixoFalhasLogin+tipo+":"+id, janelaFalhasLogin)
+		if err != nil {
+			continue
+		}
+
+		atraso := atrasoFalhas(falhas, limitesFalhasLogin[tipo])
+		if atraso == 0 {
+			continue
+		}
+		if err := servico.estado.Guardar(prefixoBloqueioLogin+tipo+":"+id, strconv.FormatInt(falhas, 10), atraso); err != nil {
+			servico.loggerBD.Println("Erro ao bloquear o login do ", tipo, " <", id, ">: ", err)
+			continue
+		}
+		if atraso == duracaoBloqueioLogin {
+			servico.logger.Println("Login bloqueado para o ", tipo, " <", id, ">, depois de ", falhas, " falhas")
+		}
+	}
+}
+
+// limparFalhasLogin Apaga os contadores e o bloqueio do user, depois de um login com sucesso.
+// Os contadores do IP são mantidos, senão um atacante podia limpá-los com a sua própria conta
+func (servico *Servico) limparFalhasLogin(user string) {
+	servico.limparFalhas(alvoUser, user)
+}
+
+// limparFalhas Apaga o contador de falhas e o bloqueio do alvo
+func (servico *Servico) limparFalhas(tipo string, id string) error {
+	return servico.estado.Apagar(prefixoFalhasLogin+tipo+":"+id, prefixoBloqueioLogin+tipo+":"+id)
+}
+
+// ListarBloqueiosLogin Action que devolve, para cada user e IP com falhas de login recentes,
+// o número de falhas dentro da janela e o tempo restante de bloqueio em segundos
+func (servico *Servico) ListarBloqueiosLogin(token string) (retorno map[string]interface{}) {
+	retorno = make(map[string]interface{})
+
+	alvos := make(map[string]map[string]interface{})
+	for _, prefixo := range []string{prefixoFalhasLogin, prefixoBloqueioLogin} {
+		keys, err := servico.estado.Procurar(prefixo)
+		if err != nil {
+			retorno["erro"] = "Erro ao buscar as tentativas de login"
+			return
+		}
+		for _, key := range keys {
+			alvo := strings.TrimPrefix(key, prefixo)
+			if _, existe := alvos[alvo]; existe {
+				continue
+			}
+
+			falhas, _ := servico.estado.ContarOcorrencias(prefixoFalhasLogin+alvo, janelaFalhasLogin)
+			restante, _ := servico.estado.TempoRestante(prefixoBloqueioLogin + alvo)
+			alvos[alvo] = map[string]interface{}{
+				"falhas":             falhas,
+				"bloqueado":          restante > 0,
+				"bloqueado_segundos": int64(math.Ceil(restante.Seconds())),
+			}
+		}
+	}
+
+	retorno["tentativas"] = alvos
+	return
+}
+
+// DesbloquearLogin Action que apaga as falhas e o bloqueio de login do alvo, tipo é "user", "ip" ou "servico"
+func (servico *Servico) DesbloquearLogin(ctx context.Context, tipo string, id string, token string) (retorno map[string]interface{}) {
+	retorno = make(map[string]interface{})
+	defer servico.auditarAcao(ctx, EventoLoginDesbloqueado, token, tipo+":"+id, retorno, nil)
+
+	if _, existe := limitesFalhasLogin[tipo]; !existe {
+		retorno["erro"] = "Tipo de alvo inválido, tem de ser user, ip ou servico"
+		return
+	}
+	if err := servico.limparFalhas(tipo, id); err != nil {
+		retorno["erro"] = err.Error()
+		return
+	}
+
+	servico.logger.Println("Login desbloqueado para o ", tipo, " <", id, ">")
+	retorno["sucesso"] = true
+	return
+}
@@ -1,22 +1,19 @@
 package authhandlers
 
 import (
-	"encoding/json"
-	"fmt"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
-	"github.com/tomascpmarques/PAP/backend/robinservicoauth/loggers"
-	"github.com/tomascpmarques/PAP/backend/robinservicoauth/redishandle"
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/autorizacao"
 )
 
 const (
-	// ROOT utilizador com as permissões mais elevadas
-	ROOT = iota + 1 // ! ainda não foi implementado este utilizador, valor 1
-	// ADMIN neste momento o tipo de utilizador com mais previlégios, valor 2
-	ADMIN
+	// ROOT utilizador com as permissões mais elevadas, o único que gere admins e chaves, valor 1
+	ROOT = autorizacao.ROOT
+	// ADMIN administrador da plataforma, valor 2
+	ADMIN = autorizacao.ADMIN
 	// USER previlégios básicos, valor 3
-	USER
+	USER = autorizacao.USER
 )
 
 /*
@@ -28,168 +25,149 @@ const (
 
 // User - Epecifica os dados que definem um utilizador
 type User struct {
-	JWT        string `json:"jwt,omitempty"`
-	Username   string `json:"user,omitempty"`
-	Password   string `json:"passwd,omitempty"`
-	Permissoes int    `json:"perms,omitempty"`
+	JWT           string          `json:"jwt,omitempty"`
+	Username      string          `json:"user,omitempty"`
+	Email         string          `json:"email,omitempty"`        // Usado para enviar as tokens de reset da password
+	Password      string          `json:"passwd,omitempty"`       // Hash argon2id da password (ou a password em sí nos registos legacy)
+	Permissoes    int             `json:"perms,omitempty"`        // Nivel mais elevado entre os roles do user
+	Roles         []string        `json:"roles,omitempty"`        // Roles do user, vazio nos registos anteriores aos roles
+	Hash          *ParametrosHash `json:"hash,omitempty"`         // Parametros da hash, nil nos registos legacy
+	MudarPassword bool            `json:"mudar_passwd,omitempty"` // Obriga o user a mudar a password antes de poder iniciar sessão
+	TOTP          *ConfigTOTP     `json:"totp,omitempty"`         // Segundo fator, nil se o user nunca o ativou
+
+	// Ciclo de vida da conta, os campos estão vazios nos registos anteriores aos estados
+	Estado           string     `json:"estado,omitempty"`           // EstadoAtivo se vazio
+	MotivoEstado     string     `json:"motivo_estado,omitempty"`    // Indicado por quem desativou ou bloqueou a conta
+	ExpiraEm         *time.Time `json:"expira_em,omitempty"`        // Contas temporárias, nil se a conta não expira
+	CriadoEm         *time.Time `json:"criado_em,omitempty"`        // Momento do registo
+	UltimoLogin      *time.Time `json:"ultimo_login,omitempty"`     // Último login com sucesso (tokens emitidas numa familia nova)
+	PasswordMudadaEm *time.Time `json:"passwd_mudada_em,omitempty"` // Última vez que a password foi definida
 }
 
-// CriarNovoUser através de um username, password e permissões cria e devolve um novo utilizador (struct)
-func CriarNovoUser(user string, password string, perms int) User {
-	return User{
+// CriarNovoUser através de um username, password e permissões cria e devolve um novo utilizador (struct),
+// com o role base correspondente às permissões, a password é guardada como uma hash argon2id
+func CriarNovoUser(user string, password string, perms int) (User, error) {
+	agora := time.Now()
+	novoUser := User{
 		Username:   user,
-		Password:   password,
 		Permissoes: perms,
+		Roles:      []string{roleDoNivel(perms)},
+		Estado:     EstadoAtivo,
+		CriadoEm:   &agora,
 	}
+	if err := novoUser.DefinirPassword(password); err != nil {
+		return User{}, err
+	}
+	return novoUser, nil
+}
+
+// instanteEmissao Momento de emissão das tokens (iat), em segundos com a precisão dos milissegundos,
+// para as revogações distinguirem as tokens emitidas antes e depois no mesmo segundo
+func instanteEmissao(agora time.Time) float64 {
+	return float64(agora.UnixMilli()) / 1000
 }
 
 type UserFuncs interface {
-	CriarJWTAuth() *jwt.Token
+	CriarJWTAuth(jti string, familia string) *jwt.Token
 }
 
-// CriarJWTAuth Cria as JWT Token para cada utilisador, a partir dos dados da struct User
-func (user User) CriarJWTAuth() *jwt.Token {
-	jwtAuth := jwt.NewWithClaims(jwt.SigningMethodHS512, jwt.MapClaims{
-		"user":  user.Username,
-		"perms": user.Permissoes,
-		"iss":   "Robin-Servico-Auth",
-		"exp": time.Now().Add(time.Hour * 9).Unix(),
+// CriarJWTAuth Cria as JWT Token para cada utilisador, a partir dos dados da struct User,
+// o jti identifica a token para poder ser revogada, e a familia liga-a às tokens de refresh do mesmo login.
+// O nivel e as permissões são calculados a partir dos roles atuais do user
+func (servico *Servico) CriarJWTAuth(user User, jti string, familia string) *jwt.Token {
+	nivel, permissoes := servico.PermissoesRoles(user.RolesEfetivos())
+	jwtAuth := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"user":       user.Username,
+		"perms":      nivel,
+		"roles":      user.RolesEfetivos(),
+		"permissoes": permissoes,
+		"iss":        "Robin-Servico-Auth",
+		"jti":        jti,
+		"fam":        familia,
+		"iat":        instanteEmissao(time.Now()),
+		"exp":        time.Now().Add(duracaoTokenAcesso).Unix(),
 	})
 	return jwtAuth
 }
 
-// GetUserParaValorStruct Busca um utilisador pelo nome na base de dados
-func GetUserParaValorStruct(username string) (User, error) {
-	// Busca o registo correspondente ao user passado nos parametros
-	userCompare, err := redishandle.GetRegistoBD(&RedisClientDB, username, 0)
+// GetUserParaValorStruct Busca um utilisador pelo nome no armazenamento de users
+func (servico *Servico) GetUserParaValorStruct(username string) (User, error) {
+	registo, err := servico.users.Get(username)
 	if err != nil {
-		loggers.LoginRedisLogger.Println("Erro: ", err)
+		servico.loggerBD.Println("Erro: ", err)
 		return User{}, err
 	}
+	return registo, nil
+}
 
-	// Cria a estrutura User para o registo, descodifica o conteúdo de valores json
-	var registo User
-	err = json.Unmarshal([]byte(userCompare), &registo)
-	if err != nil {
-		loggers.LoginRedisLogger.Println("Erro: ", err)
-		return User{}, err
+// GuardarUser Guarda o user no armazenamento de users, com o username como key
+func (servico *Servico) GuardarUser(user User) error {
+	if err := servico.users.Guardar(user); err != nil {
+		servico.loggerBD.Println("Erro: ", err)
+		return err
 	}
-
-	return registo, nil
+	return nil
 }
 
 // VerificarAdminFirstBoot verifica se o utilizador admin da backend robin existe, se não existir cria esse user
-// com as credenciais default
-func VerificarAdminFirstBoot() bool {
+// com as credenciais default, já com hash, e obriga a que a password seja mudada no primeiro login.
+// O admin é o ROOT inicial, se ainda não houver nenhum ROOT o admin existente recebe esse role
+func (servico *Servico) VerificarAdminFirstBoot() bool {
 	// Tenta encontrar o registo do admin, se não o encontrar cria-o
-	_, err := redishandle.GetRegistoBD(&RedisClientDB, "admin", 0)
+	admin, err := servico.GetUserParaValorStruct("admin")
 	if err != nil {
-		loggers.LoginAuthLogger.Println("O utilizador administrador não existe...")
+		servico.logger.Println("O utilizador administrador não existe...")
 		// Cria a struct de utilisador para o admin
-		admin := CriarNovoUser("admin", "027aede4e00bfe45724dc54c740fa6d57109dc1ba661edf99f93728f6c7371e4", 2)
-		registoUserJSON, err := json.Marshal(&admin)
+		admin, err := CriarNovoUser("admin", "027aede4e00bfe45724dc54c740fa6d57109dc1ba661edf99f93728f6c7371e4", ROOT)
 		if err != nil {
-			loggers.LoginRedisLogger.Println("Erro: ", err)
+			servico.loggerBD.Println("Erro: ", err)
 			return false
 		}
-		// Inssere o administrador
-		redishandle.SetRegistoBD(&RedisClientDB, redishandle.RegistoRedisDB{
-			Key:    admin.Username,
-			Valor:  registoUserJSON,
-			Expira: 0,
-		}, 0)
+		admin.MudarPassword = true
 
+		// Inssere o administrador
+		if err := servico.GuardarUser(admin); err != nil {
+			return false
+		}
 		return true
 	}
-	return false
-}
 
-// VerificarTokenUser verifica se a token passada é válida, logo vê se já expirou
-// se o modo de assinatura é o correto, e se o emissor é o servidor de autenticação
-func VerificarTokenUser(userToken string) string {
-	token, err := jwt.Parse(userToken, func(token *jwt.Token) (interface{}, error) {
-		// valida o metodo de assinatura da key
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("metodo de assinatura inesperado: %v", token.Header["alg"])
+	roots, err := servico.users.Listar(RoleRoot)
+	if err == nil && len(roots) == 0 {
+		if err := servico.DefinirRoles(&admin, []string{RoleRoot}); err != nil {
+			servico.loggerBD.Println("Erro: ", err)
+			return false
 		}
-		// assinaturaSecretaServer é o []byte que contem o segredo de assinatura
-		return assinaturaSecretaServer, nil
-	})
-	// Se a token for assinada por outro metodo ou a key for diferente dá erro
-	if err != nil {
-		return fmt.Sprint(err)
-	}
-
-	// Verifica que a token é válida e assinada pelo servidor de login
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid && claims["iss"] == "Robin-Servico-Auth" {
-		return "OK"
-	}
-	return "Token inválida ou expirada"
-}
-
-// VerificarTokenAdmin verifica tudo o que a função VerificarTokenUser verifica,
-// e ainda verifica se o utilisador é o administrador
-func VerificarTokenAdmin(userToken string) string {
-	token, err := jwt.Parse(userToken, func(token *jwt.Token) (interface{}, error) {
-		// valida o metodo de assinatura da key
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("metodo de assinatura inesperado: %v", token.Header["alg"])
+		if err := servico.GuardarUser(admin); err != nil {
+			return false
 		}
-
-		// hmacSampleSecret é o []byte que contem o segredo de assinatura
-		return assinaturaSecretaServer, nil
-	})
-	// Se a token for assinada por outro metodo ou a key for diferente dá erro
-	if err != nil {
-		return fmt.Sprint(err)
+		servico.logger.Println("Sem utilizadores ROOT, o utilizador admin recebeu o role ROOT")
 	}
+	return false
+}
 
-	// Verifica que a token é válida e assinada pelo servidor de login
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid && claims["iss"] == "Robin-Servico-Auth" &&
-		claims["perms"].(float64) == 2 {
-		return "OK"
+// VerificarTokenUser Action que verifica se a token de acesso é válida (assinatura, expiração, emissor e revogação),
+// devolve "OK" ou o motivo da token não ser aceite
+func (servico *Servico) VerificarTokenUser(userToken string) string {
+	if _, err := servico.autorizacao.Acesso(userToken); err != nil {
+		return err.Error()
 	}
-	return "Token inválida ou expirada"
+	return "OK"
 }
 
-// DevolveTokenClaims Devolve os valores do body da token (claims)
-func DevolveTokenClaims(userToken string) map[string]interface{} {
-	token, err := jwt.Parse(userToken, func(token *jwt.Token) (interface{}, error) {
-		// valida o metodo de assinatura da key
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, nil
-		}
-		// hmacSampleSecret é o []byte que contem o segredo de assinatura
-		return assinaturaSecretaServer, nil
-	})
-	// Se a token for assinada por outro metodo ou a key for diferente dá erro
-	if err != nil {
-		return nil
+// VerificarTokenAdmin Action que verifica tudo o que a função VerificarTokenUser verifica,
+// e ainda verifica se o utilisador é administrador
+func (servico *Servico) VerificarTokenAdmin(userToken string) string {
+	if _, err := servico.autorizacao.Exigir(userToken, autorizacao.Permissao(ADMIN)); err != nil {
+		return err.Error()
 	}
-
-	return token.Claims.(jwt.MapClaims)
+	return "OK"
 }
 
 // VerificarTokenReAuth Verifica a token de reload de autenticação do user
-func VerificarTokenReAuth(reAuthToken string, tokenAuth string) string {
-	token, err := jwt.Parse(reAuthToken, func(token *jwt.Token) (interface{}, error) {
-		// valida o metodo de assinatura da key
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("metodo de assinatura inesperado: %v", token.Header["alg"])
-		}
-
-		// hmacSampleSecret é o []byte que contem o segredo de assinatura
-		return assinaturaSecretaServer, nil
-	})
-	// Se a token for assinada por outro metodo ou a key for diferente dá erro
-	if err != nil {
-		return fmt.Sprint(err)
-	}
-
-	// Verifica que a token é válida e assinada pelo servidor de login
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid && claims["iss"] == "Robin-Servico-Auth" &&
-		claims["typ"] == "reauth" {
-		return "OK"
+func (servico *Servico) VerificarTokenReAuth(reAuthToken string, tokenAuth string) string {
+	if _, err := servico.autorizacao.Refresh(reAuthToken); err != nil {
+		return err.Error()
 	}
-	return "Token inválida ou expirada"
+	return "OK"
 }
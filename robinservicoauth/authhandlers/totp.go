@@ -0,0 +1,465 @@
+package authhandlers
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/autorizacao"
+)
+
+const (
+	// digitosTOTP número de digitos dos códigos TOTP
+	digitosTOTP = 6
+	// periodoTOTP duração de cada código TOTP, em segundos
+	periodoTOTP = 30
+	// tamanhoSegredoTOTP tamanho do segredo partilhado com a app de autenticação, em bytes (RFC 4226 recomenda 160 bits)
+	tamanhoSegredoTOTP = 20
+	// emissorTOTP nome da plataforma mostrado na app de autenticação
+	emissorTOTP = "Robin"
+
+	// numeroCodigosRecuperacao códigos de recuperação gerados quando o TOTP é ativado
+	numeroCodigosRecuperacao = 10
+	// duracaoTokenParcial tempo de vida das tokens parciais, para completar o login com o segundo fator
+	duracaoTokenParcial = time.Minute * 5
+)
+
+// ErrChaveTOTPEmFalta a chave de cifra dos segredos TOTP não foi configurada
+var ErrChaveTOTPEmFalta = errors.New("a chave TOTP é obrigatória (AUTH_TOTP_CHAVE, 32 bytes em base64, ex: openssl rand -base64 32)")
+
+// ConfigTOTP Segundo fator do user, guardado no seu registo
+type ConfigTOTP struct {
+	Segredo            string   `json:"segredo"`                       // Segredo cifrado com AES-GCM, em base64
+	Ativo              bool     `json:"ativo"`                         // Falso enquanto a inscrição não for confirmada com um código
+	CodigosRecuperacao []string `json:"codigos_recuperacao,omitempty"` // Hashes sha256 dos códigos de recuperação por usar
+	UltimoPasso        int64    `json:"ultimo_passo,omitempty"`        // Passo do último código aceite, os códigos não podem ser reutilizados
+}
+
+// chaveTOTPConfigurada Descodifica a chave de cifra configurada (32 bytes em base64). A chave é obrigatória:
+// se estivesse guardada no redis, junto dos segredos cifrados, quem lesse a BD conseguia decifrá-los
+func chaveTOTPConfigurada(configurada string) ([]byte, error) {
+	return chaveCifraConfigurada(configurada, "TOTP", ErrChaveTOTPEmFalta)
+}
+
+// chaveCifraConfigurada Descodifica uma chave AES-256 configurada em base64, emFalta se não foi configurada
+func chaveCifraConfigurada(configurada string, nome string, emFalta error) ([]byte, error) {
+	if configurada == "" {
+		return nil, emFalta
+	}
+	chave, err := base64.StdEncoding.DecodeString(configurada)
+	if err != nil || len(chave) != 32 {
+		return nil, fmt.Errorf("a chave %s têm de ter 32 bytes em base64", nome)
+	}
+	return chave, nil
+}
+
+// comTOTPCopiado Devolve o user com uma cópia da configuração TOTP, para a validação de um código alterar a cópia
+// e o registo lido continuar igual ao guardado (ver UserStore.Trocar)
+func (user User) comTOTPCopiado() User {
+	if user.TOTP != nil {
+		copia := *user.TOTP
+		copia.CodigosRecuperacao = append([]string(nil), user.TOTP.CodigosRecuperacao...)
+		user.TOTP = &copia
+	}
+	return user
+}
+
+// cifraTOTP Cifra AES-GCM com a chave dos segredos TOTP
+func (servico *Servico) cifraTOTP() (cipher.AEAD, error) {
+	bloco, err := aes.NewCipher(servico.chaveTOTP)
+	if err != nil {
+		return nil, errors.New("chave de cifra TOTP inválida")
+	}
+	return cipher.NewGCM(bloco)
+}
+
+// cifrarSegredo Cifra o segredo TOTP, devolve o nonce e o texto cifrado em base64
+func (servico *Servico) cifrarSegredo(segredo []byte) (string, error) {
+	aead, err := servico.cifraTOTP()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, segredo, nil)), nil
+}
+
+// decifrarSegredo Decifra um segredo TOTP cifrado pelo cifrarSegredo
+func (servico *Servico) decifrarSegredo(cifrado string) ([]byte, error) {
+	aead, err := servico.cifraTOTP()
+	if err != nil {
+		return nil, err
+	}
+	dados, err := base64.StdEncoding.DecodeString(cifrado)
+	if err != nil || len(dados) < aead.NonceSize() {
+		return nil, errors.New("segredo TOTP inválido")
+	}
+	return aead.Open(nil, dados[:aead.NonceSize()], dados[aead.NonceSize():], nil)
+}
+
+// codigoTOTP Calcula o código do passo indicado (RFC 6238, HMAC-SHA1 com truncagem dinâmica da RFC 4226)
+func codigoTOTP(segredo []byte, passo int64) string {
+	contador := make([]byte, 8)
+	binary.BigEndian.PutUint64(contador, uint64(passo))
+
+	mac := hmac.New(sha1.New, segredo)
+	mac.Write(contador)
+	soma := mac.Sum(nil)
+
+	deslocamento := soma[len(soma)-1] & 0x0f
+	valor := binary.BigEndian.Uint32(soma[deslocamento:deslocamento+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", digitosTOTP, valor%uint32(math.Pow10(digitosTOTP)))
+}
+
+// TOTPAtivo Indica se o user têm o segundo fator ativo
+func (user User) TOTPAtivo() bool {
+	return user.TOTP != nil && user.TOTP.Ativo
+}
+
+// validarCodigoTOTP Verifica o código TOTP, aceita o passo anterior e o seguinte para tolerar diferenças de relógio.
+// Um código aceite não pode ser usado outra vez, o registo do user têm de ser guardado depois
+func (servico *Servico) validarCodigoTOTP(user *User, codigo string) bool {
+	if user.TOTP == nil {
+		return false
+	}
+	segredo, err := servico.decifrarSegredo(user.TOTP.Segredo)
+	if err != nil {
+		servico.logger.Println("Erro: ", err)
+		return false
+	}
+
+	passoAtual := time.Now().Unix() / periodoTOTP
+	for passo := passoAtual - 1; passo <= passoAtual+1; passo++ {
+		if passo <= user.TOTP.UltimoPasso {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(codigoTOTP(segredo, passo)), []byte(codigo)) == 1 {
+			user.TOTP.UltimoPasso = passo
+			return true
+		}
+	}
+	return false
+}
+
+// hashCodigoRecuperacao Hash guardada de um código de recuperação, ignora maiúsculas, espaços e hífens
+func hashCodigoRecuperacao(codigo string) string {
+	normalizado := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(codigo))
+	soma := sha256.Sum256([]byte(normalizado))
+	return hex.EncodeToString(soma[:])
+}
+
+// gerarCodigosRecuperacao Cria os códigos de recuperação, devolve os códigos (mostrados uma única vez ao user) e as suas hashes
+func gerarCodigosRecuperacao() (codigos []string, hashes []string, err error) {
+	for i := 0; i < numeroCodigosRecuperacao; i++ {
+		aleatorio := make([]byte, 5)
+		if _, err := rand.Read(aleatorio); err != nil {
+			return nil, nil, err
+		}
+		codigo := hex.EncodeToString(aleatorio)
+		codigo = codigo[:5] + "-" + codigo[5:]
+		codigos = append(codigos, codigo)
+		hashes = append(hashes, hashCodigoRecuperacao(codigo))
+	}
+	return codigos, hashes, nil
+}
+
+// usarCodigoRecuperacao Verifica o código de recuperação e, se for válido, remove-o dos códigos do user
+func (user *User) usarCodigoRecuperacao(codigo string) bool {
+	if user.TOTP == nil {
+		return false
+	}
+	hash := hashCodigoRecuperacao(codigo)
+	for i, guardada := range user.TOTP.CodigosRecuperacao {
+		if subtle.ConstantTimeCompare([]byte(guardada), []byte(hash)) == 1 {
+			user.TOTP.CodigosRecuperacao = append(user.TOTP.CodigosRecuperacao[:i], user.TOTP.CodigosRecuperacao[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// CriarJWTParcial Cria a token parcial do user, que só permite completar o login com o segundo fator
+func (user User) CriarJWTParcial(jti string) *jwt.Token {
+	return jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"user": user.Username,
+		"iss":  "Robin-Servico-Auth",
+		"typ":  autorizacao.TipoParcial,
+		"jti":  jti,
+		"iat":  instanteEmissao(time.Now()),
+		"exp":  time.Now().Add(duracaoTokenParcial).Unix(),
+	})
+}
+
+// emitirTokenParcial Cria e assina a token parcial do user
+func (servico *Servico) emitirTokenParcial(user User) (string, error) {
+	jti, err := gerarIdentificador()
+	if err != nil {
+		return "", err
+	}
+	return servico.assinarToken(user.CriarJWTParcial(jti))
+}
+
+// claimsInscricaoTOTP Aceita uma token de acesso ou uma token parcial, os admins sem TOTP só recebem
+// uma token parcial no login, e têm de a usar para ativar o TOTP
+func (servico *Servico) claimsInscricaoTOTP(token string) (claims autorizacao.Claims, parcial bool, err error) {
+	if claims, err = servico.autorizacao.Acesso(token); err == nil {
+		return claims, false, nil
+	}
+	claims, err = servico.autorizacao.Parcial(token)
+	return claims, true, err
+}
+
+// IniciarTOTP Action que cria um segredo TOTP novo para o user da token, devolve o segredo em base32
+// e o uri otpauth:// para a app de autenticação. O TOTP só fica ativo depois do ConfirmarTOTP
+func (servico *Servico) IniciarTOTP(token string) (retorno map[string]interface{}) {
+	retorno = make(map[string]interface{})
+
+	claims, _, err := servico.claimsInscricaoTOTP(token)
+	if err != nil {
+		retorno["erro"] = err
+		return
+	}
+	utilizador, err := servico.GetUserParaValorStruct(claims.User)
+	if err != nil {
+		retorno["erro"] = "Sem registo para <" + claims.User + ">"
+		return
+	}
+	if utilizador.TOTPAtivo() {
+		retorno["erro"] = "O TOTP já está ativo"
+		return
+	}
+
+	segredo := make([]byte, tamanhoSegredoTOTP)
+	if _, err := rand.Read(segredo); err != nil {
+		retorno["erro"] = "Erro ao criar o segredo TOTP"
+		return
+	}
+	cifrado, err := servico.cifrarSegredo(segredo)
+	if err != nil {
+		servico.logger.Println("Erro: ", err)
+		retorno["erro"] = "Erro ao criar o segredo TOTP"
+		return
+	}
+	atualizado := utilizador
+	atualizado.TOTP = &ConfigTOTP{Segredo: cifrado}
+	if err := servico.users.Trocar(utilizador, atualizado); err != nil {
+		retorno["erro"] = err.Error()
+		return
+	}
+
+	segredoBase32 := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(segredo)
+	retorno["segredo"] = segredoBase32
+	retorno["uri"] = fmt.Sprintf("otpauth://totp/%s:%s?secret=%s&issuer=%s&algorithm=SHA1&digits=%d&period=%d",
+		url.PathEscape(emissorTOTP), url.PathEscape(utilizador.Username), segredoBase32, url.QueryEscape(emissorTOTP), digitosTOTP, periodoTOTP)
+	return
+}
+
+// ConfirmarTOTP Action que ativa o TOTP do user da token, depois de verificar um código da app de autenticação.
+// Devolve os códigos de recuperação, e se a token for parcial, as tokens finais do login
+func (servico *Servico) ConfirmarTOTP(ctx context.Context, codigo string, token string) (retorno map[string]interface{}) {
+	retorno = make(map[string]interface{})
+	defer servico.auditarAcao(ctx, EventoTOTPAtivado, token, servico.atorToken(token), retorno, nil)
+
+	claims, parcial, err := servico.claimsInscricaoTOTP(token)
+	if err != nil {
+		retorno["erro"] = err
+		return
+	}
+	alvos := alvosLogin(ctx, claims.User)
+	if restante := servico.loginBloqueado(alvos); restante > 0 {
+		retorno["erro"] = mensagemLoginBloqueado
+		retorno["tentar_depois"] = int64(math.Ceil(restante.Seconds()))
+		return
+	}
+
+	utilizador, err := servico.GetUserParaValorStruct(claims.User)
+	if err != nil || utilizador.TOTP == nil || utilizador.TOTP.Ativo {
+		retorno["erro"] = "Não existe nenhuma inscrição TOTP por confirmar"
+		return
+	}
+	atualizado := utilizador.comTOTPCopiado()
+	if !servico.validarCodigoTOTP(&atualizado, codigo) {
+		servico.registarFalhaLogin(alvos)
+		retorno["erro"] = "Código inválido"
+		return
+	}
+
+	codigos, hashes, err := gerarCodigosRecuperacao()
+	if err != nil {
+		retorno["erro"] = "Erro ao criar os códigos de recuperação"
+		return
+	}
+	atualizado.TOTP.Ativo = true
+	atualizado.TOTP.CodigosRecuperacao = hashes
+	// Um pedido simultâneo com o mesmo código já alterou o registo, só um deles é aceite
+	if err := servico.users.Trocar(utilizador, atualizado); err != nil {
+		retorno["erro"] = err.Error()
+		return
+	}
+	utilizador = atualizado
+	servico.limparFalhasLogin(claims.User)
+	servico.logger.Println("TOTP ativado para o utilizador, ", claims.User)
+	retorno["codigos_recuperacao"] = codigos
+
+	// Inscrição obrigatória feita durante o login, completa o login
+	if parcial {
+		servico.RevogarJTI(claims.JTI, claims.Expira.Unix())
+		acesso, refresh, err := servico.EmitirTokens(utilizador, "")
+		if err != nil {
+			retorno["erro"] = err.Error()
+			return
+		}
+		retorno["token"] = acesso
+		retorno["refresh_token"] = refresh
+	}
+	return
+}
+
+// VerificarTOTP Action que completa o login de um user com TOTP, troca a token parcial devolvida pelo Login
+// pelas tokens finais, se o código (TOTP ou de recuperação) for válido
+func (servico *Servico) VerificarTOTP(ctx context.Context, codigo string, tokenParcial string) (retorno map[string]interface{}) {
+	retorno = make(map[string]interface{})
+	defer servico.auditarAcao(ctx, EventoLogin2FA, tokenParcial, servico.atorToken(tokenParcial), retorno, nil)
+
+	claims, err := servico.autorizacao.Parcial(tokenParcial)
+	if err != nil {
+		retorno["erro"] = err
+		return
+	}
+	alvos := alvosLogin(ctx, claims.User)
+	if restante := servico.loginBloqueado(alvos); restante > 0 {
+		retorno["erro"] = mensagemLoginBloqueado
+		retorno["tentar_depois"] = int64(math.Ceil(restante.Seconds()))
+		return
+	}
+
+	utilizador, err := servico.GetUserParaValorStruct(claims.User)
+	if err != nil || !utilizador.TOTPAtivo() {
+		retorno["erro"] = "O TOTP não está ativo"
+		return
+	}
+
+	recuperacao := false
+	atualizado := utilizador.comTOTPCopiado()
+	if !servico.validarCodigoTOTP(&atualizado, codigo) {
+		if recuperacao = atualizado.usarCodigoRecuperacao(codigo); !recuperacao {
+			servico.logger.Println("Error: ", "código TOTP inválido para o utilizador, ", claims.User)
+			servico.registarFalhaLogin(alvos)
+			retorno["erro"] = "Código inválido"
+			return
+		}
+	}
+	// Guarda o passo usado, ou o código de recuperação gasto, só se o registo não mudou desde a leitura:
+	// dois pedidos simultâneos com o mesmo código não podem ser ambos aceites
+	if err := servico.users.Trocar(utilizador, atualizado); err != nil {
+		servico.logger.Println("Error: ", "código TOTP do utilizador, ", claims.User, ", usado por outro pedido: ", err)
+		retorno["erro"] = "Código inválido"
+		return
+	}
+	utilizador = atualizado
+	servico.limparFalhasLogin(claims.User)
+	servico.RevogarJTI(claims.JTI, claims.Expira.Unix())
+
+	acesso, refresh, err := servico.EmitirTokens(utilizador, "")
+	if err != nil {
+		retorno["erro"] = err.Error()
+		return
+	}
+
+	servico.logger.Println("Utilizador, ", claims.User, ", iniciou sessão com o segundo fator")
+	retorno["token"] = acesso
+	retorno["refresh_token"] = refresh
+	if recuperacao {
+		retorno["codigos_recuperacao_restantes"] = len(utilizador.TOTP.CodigosRecuperacao)
+	}
+	return
+}
+
+// NovosCodigosRecuperacao Action que substitui os códigos de recuperação do user da token,
+// depois de verificar um código TOTP atual
+func (servico *Servico) NovosCodigosRecuperacao(codigo string, token string) (retorno map[string]interface{}) {
+	retorno = make(map[string]interface{})
+
+	claims, err := servico.autorizacao.Acesso(token)
+	if err != nil {
+		retorno["erro"] = err
+		return
+	}
+	utilizador, err := servico.GetUserParaValorStruct(claims.User)
+	if err != nil || !utilizador.TOTPAtivo() {
+		retorno["erro"] = "O TOTP não está ativo"
+		return
+	}
+	atualizado := utilizador.comTOTPCopiado()
+	if !servico.validarCodigoTOTP(&atualizado, codigo) {
+		retorno["erro"] = "Código inválido"
+		return
+	}
+
+	codigos, hashes, err := gerarCodigosRecuperacao()
+	if err != nil {
+		retorno["erro"] = "Erro ao criar os códigos de recuperação"
+		return
+	}
+	atualizado.TOTP.CodigosRecuperacao = hashes
+	if err := servico.users.Trocar(utilizador, atualizado); err != nil {
+		retorno["erro"] = err.Error()
+		return
+	}
+
+	retorno["codigos_recuperacao"] = codigos
+	return
+}
+
+// DesativarTOTP Action que remove o TOTP do user e revoga as suas tokens (ex: perda do dispositivo).
+// Um user sem privilégios pode desativar o seu próprio TOTP, o dos outros users precisa da permissão users:gerir,
+// e o dos administradores (que voltam a ter de ativar o TOTP no login seguinte) só pode ser removido pelo ROOT
+func (servico *Servico) DesativarTOTP(ctx context.Context, user string, token string) (retorno map[string]interface{}) {
+	retorno = make(map[string]interface{})
+	defer servico.auditarAcao(ctx, EventoTOTPDesativado, token, user, retorno, nil)
+
+	utilizador, err := servico.GetUserParaValorStruct(user)
+	if err != nil {
+		retorno["erro"] = "Sem registo para <" + user + ">"
+		return
+	}
+
+	regra := autorizacao.Alguma(autorizacao.User(user), autorizacao.Permite(PermGerirUsers))
+	if servico.Privilegiado(utilizador) {
+		regra = autorizacao.Permite(PermGerirAdmins)
+	}
+	if _, err := servico.autorizacao.Exigir(token, regra); err != nil {
+		retorno["erro"] = err
+		return
+	}
+
+	atualizado := utilizador
+	atualizado.TOTP = nil
+	if err := servico.users.Trocar(utilizador, atualizado); err != nil {
+		retorno["erro"] = err.Error()
+		return
+	}
+	servico.RevogarTokensUser(user)
+
+	servico.logger.Println("TOTP desativado para o utilizador, ", user)
+	retorno["sucesso"] = true
+	return
+}
@@ -0,0 +1,72 @@
+package authhandlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// BackendRedis os users são guardados no redis, um registo json por user com o username como key
+	BackendRedis = "redis"
+	// BackendMemoria os users são guardados na memória do serviço, e perdem-se quando este termina
+	BackendMemoria = "memoria"
+)
+
+var (
+	// ErrUserNaoExiste não existe nenhum user com o nome pedido
+	ErrUserNaoExiste = errors.New("o utilizador não existe")
+	// ErrUserExiste já existe um user com o nome pedido
+	ErrUserExiste = errors.New("já existe um utilizador com o nome pedido")
+	// ErrConflitoUser o user foi alterado por outro pedido entre a leitura e a escrita
+	ErrConflitoUser = errors.New("o utilizador foi alterado por outro pedido, tente novamente")
+)
+
+// UserStore Armazenamento dos registos dos users. Também mantém o índice dos membros de cada role,
+// atualizado na mesma operação que o registo do user
+type UserStore interface {
+	// Get Busca o user pelo nome, ErrUserNaoExiste se não existir
+	Get(username string) (User, error)
+	// Guardar Cria ou substitui o registo do user
+	Guardar(user User) error
+	// Criar Cria o registo do user só se ainda não existir nenhum user com o mesmo nome, senão devolve ErrUserExiste
+	Criar(user User) error
+	// Apagar Apaga o registo do user, ErrUserNaoExiste se não existir
+	Apagar(username string) error
+	// Listar Devolve os nomes dos users, só os membros do role se role não for ""
+	Listar(role string) ([]string, error)
+	// Pesquisar Devolve uma página de users a começar no cursor (0 na primeira página), só os users com o nome
+	// começado pelo prefixo, e só os membros do role se role não for "". Devolve também o cursor da página seguinte, 0 na última
+	Pesquisar(cursor uint64, prefixo string, role string, limite int64) ([]User, uint64, error)
+	// Trocar Substitui o user anterior pelo novo (compare-and-swap), só se o registo guardado ainda for igual ao anterior,
+	// senão devolve ErrConflitoUser. Se o nome mudar, o nome novo não pode existir (ErrUserExiste)
+	Trocar(anterior User, novo User) error
+}
+
+// NovoUserStore Cria o armazenamento de users do backend pedido (BackendRedis ou BackendMemoria),
+// o cliente redis e o logger só são usados pelo BackendRedis
+func NovoUserStore(backend string, cliente *redis.Client, logger *log.Logger) (UserStore, error) {
+	switch backend {
+	case BackendRedis, "":
+		if cliente == nil {
+			return nil, errors.New("o backend redis precisa de um cliente redis")
+		}
+		store := NovoUserStoreRedis(cliente, logger)
+		if _, err := store.MigrarRegistos(); err != nil {
+			return nil, err
+		}
+		return store, nil
+	case BackendMemoria:
+		return NovoUserStoreMemoria(), nil
+	}
+	return nil, errors.New("backend de users desconhecido: " + backend)
+}
+
+// registoIgual Indica se dois users têm o mesmo registo, comparando a sua codificação em json
+func registoIgual(a User, b User) bool {
+	registoA, errA := json.Marshal(&a)
+	registoB, errB := json.Marshal(&b)
+	return errA == nil && errB == nil && string(registoA) == string(registoB)
+}
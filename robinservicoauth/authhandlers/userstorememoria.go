@@ -0,0 +1,152 @@
+package authhandlers
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// UserStoreMemoria Guarda os users na memória do serviço, codificados em json como no redis,
+// para os users devolvidos não partilharem dados com os guardados. Os membros dos roles são
+// calculados a partir dos registos
+type UserStoreMemoria struct {
+	mutex    sync.RWMutex
+	registos map[string][]byte
+}
+
+// NovoUserStoreMemoria Cria um armazenamento de users vazio
+func NovoUserStoreMemoria() *UserStoreMemoria {
+	return &UserStoreMemoria{registos: make(map[string][]byte)}
+}
+
+// Get Busca o user pelo nome, ErrUserNaoExiste se não existir
+func (store *UserStoreMemoria) Get(username string) (User, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	return store.get(username)
+}
+
+// get Descodifica o registo do user, tem de ser chamado com o mutex obtido
+func (store *UserStoreMemoria) get(username string) (User, error) {
+	registo, existe := store.registos[username]
+	if !existe {
+		return User{}, ErrUserNaoExiste
+	}
+	var user User
+	err := json.Unmarshal(registo, &user)
+	return user, err
+}
+
+// Guardar Cria ou substitui o registo do user
+func (store *UserStoreMemoria) Guardar(user User) error {
+	registo, err := json.Marshal(&user)
+	if err != nil {
+		return err
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.registos[user.Username] = registo
+	return nil
+}
+
+// Criar Cria o registo do user, ErrUserExiste se já existir
+func (store *UserStoreMemoria) Criar(user User) error {
+	registo, err := json.Marshal(&user)
+	if err != nil {
+		return err
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if _, existe := store.registos[user.Username]; existe {
+		return ErrUserExiste
+	}
+	store.registos[user.Username] = registo
+	return nil
+}
+
+// Apagar Apaga o registo do user, ErrUserNaoExiste se não existir
+func (store *UserStoreMemoria) Apagar(username string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if _, existe := store.registos[username]; !existe {
+		return ErrUserNaoExiste
+	}
+	delete(store.registos, username)
+	return nil
+}
+
+// Listar Devolve os nomes dos users por ordem alfabética, só os membros do role se role não for ""
+func (store *UserStoreMemoria) Listar(role string) ([]string, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	users := make([]string, 0, len(store.registos))
+	for username := range store.registos {
+		if role != "" {
+			user, err := store.get(username)
+			if err != nil || !contem(user.RolesEfetivos(), role) {
+				continue
+			}
+		}
+		users = append(users, username)
+	}
+	sort.Strings(users)
+	return users, nil
+}
+
+// Pesquisar Devolve uma página de users por ordem alfabética, o cursor é a posição do primeiro user da página
+func (store *UserStoreMemoria) Pesquisar(cursor uint64, prefixo string, role string, limite int64) ([]User, uint64, error) {
+	nomes, _ := store.Listar(role)
+
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	users := make([]User, 0, limite)
+	posicao := uint64(0)
+	for _, nome := range nomes {
+		if !strings.HasPrefix(nome, prefixo) {
+			continue
+		}
+		posicao++
+		if posicao <= cursor {
+			continue
+		}
+		if int64(len(users)) == limite {
+			return users, posicao - 1, nil
+		}
+		if user, err := store.get(nome); err == nil {
+			users = append(users, user)
+		}
+	}
+	return users, 0, nil
+}
+
+// Trocar Substitui o user anterior pelo novo, só se o registo guardado ainda for igual ao anterior
+// e o nome novo (se mudar) não existir
+func (store *UserStoreMemoria) Trocar(anterior User, novo User) error {
+	registo, err := json.Marshal(&novo)
+	if err != nil {
+		return err
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	atual, err := store.get(anterior.Username)
+	if err != nil {
+		return err
+	}
+	if !registoIgual(atual, anterior) {
+		return ErrConflitoUser
+	}
+	if novo.Username != anterior.Username {
+		if _, existe := store.registos[novo.Username]; existe {
+			return ErrUserExiste
+		}
+		delete(store.registos, anterior.Username)
+	}
+	store.registos[novo.Username] = registo
+	return nil
+}
@@ -0,0 +1,268 @@
+package authhandlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/tomascpmarques/PAP/backend/robinservicoauth/redishandle"
+)
+
+// prefixoUser prefixo das keys dos registos dos users, user:<username>
+const prefixoUser = "user:"
+
+// UserStoreRedis Guarda os users no redis, um registo json por user na key user:<username>,
+// e os membros de cada role nos sets membros_role:<role> (índice secundário por role)
+type UserStoreRedis struct {
+	cliente *redis.Client
+	logger  *log.Logger
+}
+
+// NovoUserStoreRedis Cria o armazenamento de users no redis do cliente fornecido, os erros são escritos no logger
+func NovoUserStoreRedis(cliente *redis.Client, logger *log.Logger) *UserStoreRedis {
+	return &UserStoreRedis{cliente: cliente, logger: logger}
+}
+
+// Get Busca o user pelo nome, ErrUserNaoExiste se não existir
+func (store *UserStoreRedis) Get(username string) (User, error) {
+	user, _, err := store.getRegisto(username)
+	return user, err
+}
+
+// getRegisto Busca o user pelo nome, devolve também o registo tal como está guardado
+func (store *UserStoreRedis) getRegisto(username string) (User, string, error) {
+	registo, err := store.cliente.Get(context.Background(), prefixoUser+username).Result()
+	if err == redis.Nil {
+		return User{}, "", ErrUserNaoExiste
+	}
+	if err != nil {
+		store.logger.Println("Erro: ", err)
+		return User{}, "", err
+	}
+
+	var user User
+	if err := json.Unmarshal([]byte(registo), &user); err != nil {
+		store.logger.Println("Erro: ", err)
+		return User{}, "", err
+	}
+	return user, registo, nil
+}
+
+// Guardar Cria ou substitui o registo do user, os sets de membros dos roles são atualizados na mesma transação
+func (store *UserStoreRedis) Guardar(user User) error {
+	ctx := context.Background()
+	registo, err := json.Marshal(&user)
+	if err != nil {
+		store.logger.Println("Erro: ", err)
+		return err
+	}
+
+	return redishandle.TransacaoBD(store.cliente, func(tx *redis.Tx) error {
+		var antigos []string
+		if anterior, err := tx.Get(ctx, prefixoUser+user.Username).Result(); err == nil {
+			var userAnterior User
+			if json.Unmarshal([]byte(anterior), &userAnterior) == nil {
+				antigos = userAnterior.RolesEfetivos()
+			}
+		} else if err != redis.Nil {
+			return err
+		}
+
+		_, err := tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, prefixoUser+user.Username, registo, 0)
+			operacoesMembrosRoles(pipe, user.Username, user.Username, antigos, user.RolesEfetivos())
+			return nil
+		})
+		return err
+	}, prefixoUser+user.Username)
+}
+
+// Criar Cria o registo do user e acrescenta-o aos sets de membros dos roles numa só transação,
+// que só é aplicada se a key do user continuar sem registo
+func (store *UserStoreRedis) Criar(user User) error {
+	ctx := context.Background()
+	registo, err := json.Marshal(&user)
+	if err != nil {
+		store.logger.Println("Erro: ", err)
+		return err
+	}
+
+	err = redishandle.TransacaoBD(store.cliente, func(tx *redis.Tx) error {
+		existe, err := tx.Exists(ctx, prefixoUser+user.Username).Result()
+		if err != nil {
+			return err
+		}
+		if existe > 0 {
+			return ErrUserExiste
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, prefixoUser+user.Username, registo, 0)
+			operacoesMembrosRoles(pipe, user.Username, user.Username, nil, user.RolesEfetivos())
+			return nil
+		})
+		return err
+	}, prefixoUser+user.Username)
+	if err == redishandle.ErrConflitoRegisto {
+		return ErrUserExiste
+	}
+	return err
+}
+
+// Apagar Apaga o registo do user e retira-o dos sets de membros dos roles, numa só transação
+func (store *UserStoreRedis) Apagar(username string) error {
+	ctx := context.Background()
+	return redishandle.TransacaoBD(store.cliente, func(tx *redis.Tx) error {
+		registo, err := tx.Get(ctx, prefixoUser+username).Result()
+		if err == redis.Nil {
+			return ErrUserNaoExiste
+		}
+		if err != nil {
+			return err
+		}
+		var user User
+		if err := json.Unmarshal([]byte(registo), &user); err != nil {
+			return err
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, prefixoUser+username)
+			operacoesMembrosRoles(pipe, username, username, user.RolesEfetivos(), nil)
+			return nil
+		})
+		return err
+	}, prefixoUser+username)
+}
+
+// Listar Devolve os membros do role, ou todos os users se role for ""
+func (store *UserStoreRedis) Listar(role string) ([]string, error) {
+	if role != "" {
+		return redishandle.BuscarMembrosBD(store.cliente, prefixoMembrosRole+role)
+	}
+
+	keys, err := redishandle.ProcurarKeysBD(store.cliente, prefixoUser+"*")
+	if err != nil {
+		return nil, err
+	}
+	users := make([]string, 0, len(keys))
+	for _, key := range keys {
+		users = append(users, strings.TrimPrefix(key, prefixoUser))
+	}
+	return users, nil
+}
+
+// Pesquisar Devolve uma página de users com SCAN sobre as keys user:<prefixo>*, ou com SSCAN sobre o set
+// dos membros do role. A página pode ter um pouco mais que limite users (ver redishandle.PaginaKeysBD)
+func (store *UserStoreRedis) Pesquisar(cursor uint64, prefixo string, role string, limite int64) ([]User, uint64, error) {
+	padrao := redishandle.EscaparPadraoBD(prefixo) + "*"
+
+	var nomes []string
+	var err error
+	if role != "" {
+		nomes, cursor, err = redishandle.PaginaMembrosBD(store.cliente, prefixoMembrosRole+role, cursor, padrao, limite)
+	} else {
+		var keys []string
+		keys, cursor, err = redishandle.PaginaKeysBD(store.cliente, cursor, prefixoUser+padrao, limite)
+		for _, key := range keys {
+			nomes = append(nomes, strings.TrimPrefix(key, prefixoUser))
+		}
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	users := make([]User, 0, len(nomes))
+	for _, nome := range nomes {
+		// O índice dos roles pode ter nomes de users apagados entretanto
+		if user, err := store.Get(nome); err == nil {
+			users = append(users, user)
+		}
+	}
+	return users, cursor, nil
+}
+
+// Trocar Substitui o user anterior pelo novo numa só transação (ver redishandle.TrocarRegistoBD),
+// só se o registo guardado ainda for igual ao anterior e o nome novo (se mudar) não existir
+func (store *UserStoreRedis) Trocar(anterior User, novo User) error {
+	atual, registoAtual, err := store.getRegisto(anterior.Username)
+	if err != nil {
+		return err
+	}
+	if !registoIgual(atual, anterior) {
+		return ErrConflitoUser
+	}
+	registoNovo, err := json.Marshal(&novo)
+	if err != nil {
+		return err
+	}
+
+	err = redishandle.TrocarRegistoBD(store.cliente, prefixoUser+anterior.Username, registoAtual, redishandle.RegistoRedisDB{
+		Key:   prefixoUser + novo.Username,
+		Valor: string(registoNovo),
+	}, func(pipe redis.Pipeliner) {
+		operacoesMembrosRoles(pipe, anterior.Username, novo.Username, atual.RolesEfetivos(), novo.RolesEfetivos())
+	})
+	switch err {
+	case redishandle.ErrRegistoExiste:
+		return ErrUserExiste
+	case redishandle.ErrConflitoRegisto:
+		return ErrConflitoUser
+	}
+	return err
+}
+
+// operacoesMembrosRoles Acrescenta à transação as escritas que atualizam os sets de membros dos roles,
+// o user sai dos sets dos roles antigos e entra nos dos novos (com o nome novo, se mudar)
+func operacoesMembrosRoles(pipe redis.Pipeliner, nomeAntigo string, nomeNovo string, antigos []string, novos []string) {
+	ctx := context.Background()
+	for _, role := range antigos {
+		pipe.SRem(ctx, prefixoMembrosRole+role, nomeAntigo)
+	}
+	for _, role := range novos {
+		pipe.SAdd(ctx, prefixoMembrosRole+role, nomeNovo)
+	}
+}
+
+// MigrarRegistos Move os registos dos users guardados antes do namespace user: (com o username como key)
+// para as keys user:<username>, e adiciona-os aos sets dos membros dos roles. Devolve o número de users movidos
+func (store *UserStoreRedis) MigrarRegistos() (int, error) {
+	ctx := context.Background()
+	keys, err := redishandle.ProcurarKeysBD(store.cliente, "*")
+	if err != nil {
+		return 0, err
+	}
+
+	movidos := 0
+	for _, key := range keys {
+		// Os registos legacy são as strings json com o username igual à key e uma password
+		if strings.Contains(key, ":") || store.cliente.Type(ctx, key).Val() != "string" {
+			continue
+		}
+		registo, err := store.cliente.Get(ctx, key).Result()
+		if err != nil {
+			continue
+		}
+		var user User
+		if json.Unmarshal([]byte(registo), &user) != nil || user.Username != key || user.Password == "" {
+			continue
+		}
+
+		err = redishandle.TrocarRegistoBD(store.cliente, key, registo, redishandle.RegistoRedisDB{
+			Key:   prefixoUser + key,
+			Valor: registo,
+		}, func(pipe redis.Pipeliner) {
+			operacoesMembrosRoles(pipe, key, key, nil, user.RolesEfetivos())
+		})
+		if err != nil {
+			store.logger.Println("Erro ao migrar o user ", key, ": ", err)
+			continue
+		}
+		movidos++
+	}
+	if movidos > 0 {
+		store.logger.Println("Registos de users movidos para o namespace ", prefixoUser, ": ", movidos)
+	}
+	return movidos, nil
+}
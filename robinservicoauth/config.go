@@ -0,0 +1,58 @@
+package main
+
+import (
+	"time"
+
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/configuracao"
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/rastreio"
+	"github.com/tomascpmarques/PAP/backend/robinservicoauth/auditoria"
+	"github.com/tomascpmarques/PAP/backend/robinservicoauth/authhandlers"
+)
+
+// PrefixoConfig prefixo das variáveis de ambiente do serviço, ex: AUTH_SERVIDOR_PORTA
+const PrefixoConfig = "AUTH"
+
+// Config Configuração do serviço de autenticação, os valores default são sobrepostos pelo ficheiro (-config),
+// pelas variáveis de ambiente e pelas flags (ver configuracao.Carregar)
+type Config struct {
+	Servidor  configuracao.Servidor `conf:"servidor"`
+	Rastreio  rastreio.Config       `conf:"rastreio"`
+	Redis     configuracao.Redis    `conf:"redis"`
+	Auditoria auditoria.Config      `conf:"auditoria"`
+	Handlers  authhandlers.Config   `conf:",inline"`
+}
+
+// configDefault Configuração usada em desenvolvimento local, sem ficheiro nem variáveis.
+// A password do redis não têm default, têm de ser configurada (AUTH_REDIS_PASSWORD)
+func configDefault() Config {
+	return Config{
+		Servidor: configuracao.Servidor{
+			Endereco:       "0.0.0.0",
+			Porta:          8081,
+			TimeoutLeitura: time.Second * 2,
+			TimeoutEscrita: time.Second * 2,
+			TimeoutInativo: time.Second * 4,
+			Desligar:       time.Second * 15,
+			CORS:           configuracao.CORS{Origens: []string{"http://localhost:8080"}},
+		},
+		Rastreio: rastreio.ConfigDefault(),
+		Redis: configuracao.Redis{
+			Endereco: "0.0.0.0",
+			Porta:    6379,
+			User:     "admin",
+		},
+		Auditoria: auditoria.ConfigDefault(),
+		Handlers:  authhandlers.ConfigDefault(),
+	}
+}
+
+// variaveisAntigas Variáveis de ambiente usadas antes da configuração centralizada (ex: no docker-compose),
+// lidas quando a variável AUTH_* correspondente não está definida
+var variaveisAntigas = map[string]string{
+	"servidor.porta": "LOGIN_SERV_PORT",
+	"redis.endereco": "REDISADDRESS",
+	"redis.porta":    "AUTH_SERVER_REDIS_PORT",
+	"redis.user":     "REDIS_USER1_NAME",
+	"redis.password": "REDIS_USER1_PASS",
+	"redis.db":       "REDISDB",
+}
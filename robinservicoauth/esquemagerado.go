@@ -0,0 +1,204 @@
+// Code generated by esquemagen a partir das actions registadas. DO NOT EDIT.
+
+package main
+
+import "github.com/tomascpmarques/PAP/backend/robinpartilhado/esquema"
+
+// descricoesAcoes Descrição, parametros e keys do retorno de cada action registada, tiradas do código fonte
+var descricoesAcoes = map[string]esquema.Descricao{
+	"ApagarContaServico": {
+		Descricao: "Action que apaga a conta de serviço, e revoga as tokens emitidas para ela",
+		Params:    []string{"nome", "token"},
+		Respostas: []string{"sucesso"},
+	},
+	"ApagarUser": {
+		Descricao: "apaga um user da bd , pelo id especificado, só o ROOT pode apagar administradores, e o último ROOT não pode ser apagado",
+		Params:    []string{"userID", "token"},
+		Respostas: []string{"status"},
+	},
+	"AtribuirRole": {
+		Descricao: "Action que dá o role ao user, os roles de administração só podem ser atribuidos pelo ROOT",
+		Params:    []string{"user", "role", "token"},
+		Respostas: []string{"roles"},
+	},
+	"AtualizarUser": {
+		Descricao: "atualiza os dados dos utilizador fornecido, depois de verificar a token fornecida, só o ROOT pode alterar utilizadores com privilégios de administração ou dar esses privilégios. O registo é substituido numa só transação, que falha se o registo mudar entretanto ou se o nome novo já existir, e a mudança de nome é propagada ao serviço userinfo (se falhar, o nome volta ao anterior)",
+		Params:    []string{"user", "userInfo", "token"},
+		Respostas: []string{"Menssagem"},
+	},
+	"BloquearUser": {
+		Descricao: "Action que bloqueia a conta do user (ex: suspeita de acesso indevido), como o DesativarUser",
+		Params:    []string{"user", "motivo", "token"},
+		Respostas: []string{"estado"},
+	},
+	"ConcluirResetPassword": {
+		Descricao: "Action que muda a password do user da token de reset, a token só pode ser usada uma vez. As sessões do user são revogadas, e os bloqueios de login do user são levantados",
+		Params:    []string{"tokenReset", "passwdNova"},
+		Respostas: []string{"sucesso"},
+	},
+	"ConfirmarTOTP": {
+		Descricao: "Action que ativa o TOTP do user da token, depois de verificar um código da app de autenticação. Devolve os códigos de recuperação, e se a token for parcial, as tokens finais do login",
+		Params:    []string{"codigo", "token"},
+		Respostas: []string{"tentar_depois", "codigos_recuperacao", "token", "refresh_token"},
+	},
+	"ConsultarAuditoria": {
+		Descricao: "Action que devolve os eventos de auditoria, os mais recentes primeiro, exemplo de filtro: {\"desde\": \"2021-05-01T00:00:00Z\", \"ate\": \"2021-05-02T00:00:00Z\", \"ator\": \"admin\", \"tipo\": \"login\", \"limite\": 50}. Todos os campos são opcionais, por default são devolvidos os últimos 100 eventos",
+		Params:    []string{"filtro", "token"},
+		Respostas: []string{"eventos"},
+	},
+	"ConvidarUser": {
+		Descricao: "Action que cria a conta do user no estado pendente, com uma password aleatória, e lhe envia pelo notificador uma token para definir a password (ConcluirResetPassword), que ativa a conta. Só o ROOT pode convidar utilizadores com privilégios de administração",
+		Params:    []string{"user", "email", "perms", "token"},
+		Respostas: []string{"estado"},
+	},
+	"CriarContaServico": {
+		Descricao: "Action que cria uma conta de serviço com os scopes indicados (separados por espaços, ex: \"userinfo:contribuicoes userinfo:atualizar\"), o segredo só é devolvido nesta resposta",
+		Params:    []string{"nome", "scopes", "token"},
+		Respostas: []string{"conta", "segredo", "scopes"},
+	},
+	"DefinirExpiracaoUser": {
+		Descricao: "Action que define o prazo da conta (temporária) do user, no formato RFC3339 (ex: \"2021-07-31T23:59:59Z\"), ou \"nunca\" para a conta deixar de expirar. Não reativa as contas já expiradas",
+		Params:    []string{"user", "expira", "token"},
+		Respostas: []string{"expira_em", "estado"},
+	},
+	"DefinirRole": {
+		Descricao: "Action que cria ou altera as permissões de um role, exemplo: {\"nome\": \"GESTOR\", \"permissoes\": [\"users:ver\"]}. Os roles novos têm o nivel USER, o ROOT não pode ser alterado, e as permissões exclusivas do ROOT não podem ser dadas. As tokens dos membros do role são revogadas, por terem as permissões antigas",
+		Params:    []string{"definicao", "token"},
+		Respostas: []string{"role"},
+	},
+	"DesativarTOTP": {
+		Descricao: "Action que remove o TOTP do user e revoga as suas tokens (ex: perda do dispositivo). Um user sem privilégios pode desativar o seu próprio TOTP, o dos outros users precisa da permissão users:gerir, e o dos administradores (que voltam a ter de ativar o TOTP no login seguinte) só pode ser removido pelo ROOT",
+		Params:    []string{"user", "token"},
+		Respostas: []string{"sucesso"},
+	},
+	"DesativarUser": {
+		Descricao: "Action que desativa a conta do user, sem apagar os seus dados (ex: a informação no serviço userinfo), as sessões do user terminam e a conta pode voltar a ser ativada com o ReativarUser",
+		Params:    []string{"user", "motivo", "token"},
+		Respostas: []string{"estado"},
+	},
+	"DesbloquearLogin": {
+		Descricao: "Action que apaga as falhas e o bloqueio de login do alvo, tipo é \"user\" ou \"ip\"",
+		Params:    []string{"tipo", "id", "token"},
+		Respostas: []string{"sucesso"},
+	},
+	"IniciarTOTP": {
+		Descricao: "Action que cria um segredo TOTP novo para o user da token, devolve o segredo em base32 e o uri otpauth:// para a app de autenticação. O TOTP só fica ativo depois do ConfirmarTOTP",
+		Params:    []string{"token"},
+		Respostas: []string{"segredo", "uri"},
+	},
+	"ListarBloqueiosLogin": {
+		Descricao: "Action que devolve, para cada user e IP com falhas de login recentes, o número de falhas dentro da janela e o tempo restante de bloqueio em segundos",
+		Params:    []string{"token"},
+		Respostas: []string{"tentativas"},
+	},
+	"ListarContasServico": {
+		Descricao: "Action que devolve as contas de serviço e os seus scopes, sem os segredos",
+		Params:    []string{"token"},
+		Respostas: []string{"contas"},
+	},
+	"ListarRoles": {
+		Descricao: "Action que devolve todos os roles, com as suas permissões e membros",
+		Params:    []string{"token"},
+		Respostas: []string{"roles", "permissoes"},
+	},
+	"ListarUsers": {
+		Descricao: "Action que devolve uma página dos users, exemplo de pesquisa: {\"prefixo\": \"adm\", \"role\": \"ADMIN\", \"limite\": 20}. Todos os campos são opcionais, a próxima página é pedida com o \"cursor\" devolvido, que é \"0\" na última página. Com o backend redis as páginas podem ter um pouco mais users que o limite",
+		Params:    []string{"pesquisa", "token"},
+		Respostas: []string{"users", "cursor"},
+	},
+	"Login": {
+		Descricao: "Recebe dois parametros, o username e a passwd, cria uma token com esses dados e compara com o utilisador pedido devolve uma token de acesso com o tempo de expiração de time.Now().Add(time.Minute * 40).Unix(), e uma token de refresh, para renovar a token de acesso através do RenovarToken. Os users com segundo fator recebem antes uma token parcial (ver VerificarTOTP)",
+		Params:    []string{"user", "passwd"},
+		Respostas: []string{"tentar_depois", "estado", "mudar_password", "totp_necessario", "ativar_totp", "token_parcial", "token", "refresh_token"},
+	},
+	"Logout": {
+		Descricao: "Revoga a token de acesso fornecida e a familia de tokens de refresh emitida no mesmo login",
+		Params:    []string{"token"},
+		Respostas: []string{"sucesso"},
+	},
+	"MudarEmail": {
+		Descricao: "Action que muda o email do user, usado para lhe enviar as tokens de reset da password. Pode ser pedido pelo próprio user ou com a permissão users:gerir, os emails dos administradores só podem ser mudados pelo ROOT, senão um admin podia receber o reset da password do ROOT",
+		Params:    []string{"user", "email", "token"},
+		Respostas: []string{"sucesso"},
+	},
+	"MudarPassword": {
+		Descricao: "Muda a password do user, depois de verificar a password atual, é a única forma de um user com a password marcada para mudança voltar a poder iniciar sessão. As falhas contam para o bloqueio do login, tal como no Login",
+		Params:    []string{"user", "passwdAtual", "passwdNova"},
+		Respostas: []string{"tentar_depois", "sucesso"},
+	},
+	"NovosCodigosRecuperacao": {
+		Descricao: "Action que substitui os códigos de recuperação do user da token, depois de verificar um código TOTP atual",
+		Params:    []string{"codigo", "token"},
+		Respostas: []string{"codigos_recuperacao"},
+	},
+	"PedirResetPassword": {
+		Descricao: "Action que cria uma token de reset para o user e a envia pelo notificador. A resposta é sempre a mesma, exista ou não o user, e os pedidos são limitados por user e por IP",
+		Params:    []string{"user"},
+		Respostas: []string{"sucesso", "mensagem"},
+	},
+	"ReativarUser": {
+		Descricao: "Action que volta a ativar a conta desativada, bloqueada ou expirada do user, as contas expiradas precisam antes de um prazo novo (ou de deixarem de expirar)",
+		Params:    []string{"user", "token"},
+		Respostas: []string{"estado"},
+	},
+	"Registar": {
+		Descricao: "utiliza os dados de utilisador base defenidos, cria e inssere na BD um utilisador novo, antes disso a função verifica que quem está a fazer o pedido é o administrador do serviço, só administradores podem registar utilizadores, e só o ROOT pode registar utilizadores com privilégios de administração. Se todas as regras forem cumpridas, a função devolve a jwt token desse novo utilizador.",
+		Params:    []string{"user", "password", "perms", "token"},
+		Respostas: []string{"sucesso"},
+	},
+	"RenovarToken": {
+		Descricao: "Troca uma token de refresh válida por uma token de acesso nova e uma token de refresh nova (rotação). Se uma token de refresh já usada for apresentada outra vez, toda a familia dessa token é revogada",
+		Params:    []string{"refreshToken"},
+		Respostas: []string{"token", "refresh_token"},
+	},
+	"RetirarRole": {
+		Descricao: "Action que retira o role ao user, os roles de administração só podem ser retirados pelo ROOT, e o último ROOT não pode perder o role. As tokens do user são revogadas, por terem as permissões antigas",
+		Params:    []string{"user", "role", "token"},
+		Respostas: []string{"roles"},
+	},
+	"RevogarTokens": {
+		Descricao: "Revoga todas as tokens emitidas para o user, pode ser pedido pelo próprio user ou por quem tenha a permissão tokens:revogar",
+		Params:    []string{"user", "token"},
+		Respostas: []string{"sucesso"},
+	},
+	"RodarChaves": {
+		Descricao: "Action que roda as chaves de assinatura, só para o ROOT",
+		Params:    []string{"token"},
+		Respostas: []string{"kid"},
+	},
+	"RodarSegredoServico": {
+		Descricao: "Action que substitui o segredo da conta de serviço, e revoga as tokens emitidas com o anterior",
+		Params:    []string{"nome", "token"},
+		Respostas: []string{"conta", "segredo"},
+	},
+	"SessActualStatus": {
+		Descricao: "Atualiza a mensagem de status do user, a token têm de ser do próprio user ou de um admin. O serviço userinfo é chamado com a token de serviço do serviço de autenticação",
+		Params:    []string{"usrNome", "status", "token"},
+		Respostas: []string{"sucesso"},
+	},
+	"VerificarTOTP": {
+		Descricao: "Action que completa o login de um user com TOTP, troca a token parcial devolvida pelo Login pelas tokens finais, se o código (TOTP ou de recuperação) for válido",
+		Params:    []string{"codigo", "tokenParcial"},
+		Respostas: []string{"tentar_depois", "token", "refresh_token", "codigos_recuperacao_restantes"},
+	},
+	"VerificarTokenAdmin": {
+		Descricao: "Action que verifica tudo o que a função VerificarTokenUser verifica, e ainda verifica se o utilisador é administrador",
+		Params:    []string{"userToken"},
+		Respostas: []string{},
+	},
+	"VerificarTokenUser": {
+		Descricao: "Action que verifica se a token de acesso é válida (assinatura, expiração, emissor e revogação), devolve \"OK\" ou o motivo da token não ser aceite",
+		Params:    []string{"userToken"},
+		Respostas: []string{},
+	},
+	"VerificarTokensParaReAuth": {
+		Descricao: "Verifica a token de reload de autenticação do user",
+		Params:    []string{"reAuthToken", "tokenAuth"},
+		Respostas: []string{},
+	},
+	"VerificarUserExiste": {
+		Descricao: "Verifica se já existe um user com o nome fornecido",
+		Params:    []string{"userName", "token"},
+		Respostas: []string{"existe"},
+	},
+}
@@ -8,4 +8,9 @@ require (
 	github.com/go-redis/redis/v8 v8.8.3
 	github.com/gorilla/mux v1.8.0
 	github.com/rs/cors v1.7.0
+	github.com/tomascpmarques/PAP/backend/robinpartilhado v0.0.0
+	go.opentelemetry.io/otel/internal/metric v0.27.0 // indirect
+	golang.org/x/crypto v0.0.0-20210513164829-c07d793c2f9a
 )
+
+replace github.com/tomascpmarques/PAP/backend/robinpartilhado => ../robinpartilhado
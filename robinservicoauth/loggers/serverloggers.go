@@ -1,24 +1,29 @@
 package loggers
 
 import (
-	"log"
 	"os"
+
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/registos"
 )
 
+// Registador - registador estruturado do serviço, escreve as linhas em JSON no stdout, todas com o campo servico.
+// Os loggers abaixo escrevem através dele, cada um com o campo componente
+var Registador = registos.Novo(os.Stdout, registos.Info).Com("servico", "auth")
+
 // LoginResolverLogger - loger para os resolvers da schema GraphQL
-var LoginResolverLogger = log.New(os.Stdout, "Auth-Resolver....(*) ", log.LstdFlags)
+var LoginResolverLogger = Registador.Logger(registos.Info, "resolver")
 
 // LoginRedisLogger - logger para o o tratamento e criação do cliente que liga ao serviço redis
-var LoginRedisLogger = log.New(os.Stdout, "Redis-Setup......[*] ", log.LstdFlags)
+var LoginRedisLogger = Registador.Logger(registos.Info, "redis")
 
 // LoginDbFuncsLogger - logger para o handeling de funções relacionadas á bd
-var LoginDbFuncsLogger = log.New(os.Stdout, "DBIndexing.......<*> ", log.LstdFlags)
+var LoginDbFuncsLogger = Registador.Logger(registos.Info, "bd-indexacao")
 
 // LoginOperacoesBDLogger - logger para as operações relacionadas á bd
-var LoginOperacoesBDLogger = log.New(os.Stdout, "Operações-BD.....|*| ", log.LstdFlags)
+var LoginOperacoesBDLogger = Registador.Logger(registos.Info, "operacoes-bd")
 
 // LoginServerErrorLogger - Logger para erros do servidor http
-var LoginServerErrorLogger = log.New(os.Stdout, "Server-Error-Log !*! ", log.LstdFlags)
+var LoginServerErrorLogger = Registador.Logger(registos.Erro, "servidor")
 
 // LoginAuthLogger - Logger para as funções de autenticação
-var LoginAuthLogger = log.New(os.Stdout, "Login-Auth...... !*! ", log.LstdFlags)
+var LoginAuthLogger = Registador.Logger(registos.Info, "autenticacao")
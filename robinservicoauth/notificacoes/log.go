@@ -0,0 +1,36 @@
+package notificacoes
+
+import (
+	"errors"
+	"log"
+	"os"
+	"time"
+)
+
+// NotificadorLog Escreve as mensagens num logger em vez de as enviar, só para desenvolvimento local:
+// as tokens de reset e dos convites ficam em claro no log
+type NotificadorLog struct {
+	Logger   *log.Logger
+	URLReset string // Link das mensagens de reset, com %s no lugar da token
+}
+
+// NovoNotificadorFicheiro Cria um NotificadorLog que acrescenta as mensagens ao ficheiro
+func NovoNotificadorFicheiro(caminho string, urlReset string) (*NotificadorLog, error) {
+	if caminho == "" {
+		return nil, errors.New("o caminho do ficheiro de notificações não está definido")
+	}
+	ficheiro, err := os.OpenFile(caminho, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &NotificadorLog{
+		Logger:   log.New(ficheiro, "", log.LstdFlags),
+		URLReset: urlReset,
+	}, nil
+}
+
+// EnviarResetPassword Escreve a mensagem de reset no logger
+func (notificador *NotificadorLog) EnviarResetPassword(destino Destinatario, token string, expira time.Time) error {
+	notificador.Logger.Printf("Reset de password para <%s> (%s):\n%s", destino.User, destino.Email, mensagemResetPassword(destino, token, expira, notificador.URLReset))
+	return nil
+}
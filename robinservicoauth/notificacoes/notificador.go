@@ -0,0 +1,105 @@
+package notificacoes
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Destinatario User a quem a notificação é enviada
+type Destinatario struct {
+	User  string
+	Email string // Vazio se o user não tiver email registado
+}
+
+// ErrSemNotificador a configuração não escolhe nenhum notificador, as tokens de reset e os convites não podem ser entregues
+var ErrSemNotificador = errors.New("nenhum notificador configurado (AUTH_NOTIFICADOR)")
+
+// Notificador Entrega as mensagens do serviço de autenticação aos users
+type Notificador interface {
+	// EnviarResetPassword Envia ao user a token de reset da password, válida até expira
+	EnviarResetPassword(destino Destinatario, token string, expira time.Time) error
+}
+
+// mensagemResetPassword Texto da mensagem de reset, com o link se urlReset estiver definido (%s é substituído pela token)
+func mensagemResetPassword(destino Destinatario, token string, expira time.Time, urlReset string) string {
+	var mensagem strings.Builder
+	fmt.Fprintf(&mensagem, "Olá %s,\n\nFoi pedido um reset da password da sua conta Robin.\n", destino.User)
+	if urlReset != "" {
+		fmt.Fprintf(&mensagem, "Para definir uma password nova, abra o link: %s\n", fmt.Sprintf(urlReset, token))
+	} else {
+		fmt.Fprintf(&mensagem, "Token de reset: %s\n", token)
+	}
+	fmt.Fprintf(&mensagem, "O pedido expira às %s, e só pode ser usado uma vez.\n", expira.Format("15:04 02/01/2006"))
+	mensagem.WriteString("Se não pediu o reset, ignore esta mensagem.\n")
+	return mensagem.String()
+}
+
+// Config Configuração do notificador, secção notificador da configuração do serviço
+type Config struct {
+	Tipo     string     `conf:"tipo" env:"AUTH_NOTIFICADOR" desc:"como são entregues as mensagens aos users: smtp, ficheiro ou log (só desenvolvimento), vazio desativa o reset e os convites"`
+	Ficheiro string     `conf:"ficheiro" desc:"ficheiro onde são acrescentadas as mensagens, com o tipo ficheiro"`
+	URLReset string     `conf:"url_reset" env:"AUTH_RESET_URL" desc:"link enviado nas mensagens de reset, com %s no lugar da token"`
+	SMTP     ConfigSMTP `conf:"smtp"`
+}
+
+// ConfigSMTP Servidor de email usado pelo notificador smtp
+type ConfigSMTP struct {
+	Host      string `conf:"host" env:"AUTH_SMTP_HOST" desc:"servidor smtp"`
+	Porta     string `conf:"porta" env:"AUTH_SMTP_PORTA" desc:"porta do servidor smtp"`
+	User      string `conf:"user" env:"AUTH_SMTP_USER" desc:"user do servidor smtp, vazio sem autenticação"`
+	Pass      string `conf:"pass" env:"AUTH_SMTP_PASS" desc:"password do user do servidor smtp"`
+	Remetente string `conf:"remetente" env:"AUTH_SMTP_REMETENTE" desc:"endereço de onde são enviados os emails"`
+}
+
+// Validar Verifica o tipo de notificador e os campos que esse tipo precisa
+func (config *Config) Validar() error {
+	switch config.Tipo {
+	case "", "log":
+	case "ficheiro":
+		if config.Ficheiro == "" {
+			return errors.New("o notificador em ficheiro precisa do caminho do ficheiro")
+		}
+	case "smtp":
+		if config.SMTP.Host == "" || config.SMTP.Porta == "" || config.SMTP.Remetente == "" {
+			return errors.New("o notificador smtp precisa do host, da porta e do remetente")
+		}
+	default:
+		return fmt.Errorf("notificador desconhecido: %s", config.Tipo)
+	}
+	if config.URLReset != "" && strings.Count(config.URLReset, "%s") != 1 {
+		return errors.New("o link de reset têm de ter um %s, substituído pela token")
+	}
+	return nil
+}
+
+// NovoNotificador Cria o notificador escolhido na configuração:
+//
+//	"smtp" - envia as mensagens por email, pelo servidor config.SMTP
+//	"ficheiro" - acrescenta as mensagens ao ficheiro config.Ficheiro
+//	"log" - escreve as mensagens no logger, só para desenvolvimento local: as tokens ficam em claro nos logs
+//
+// Sem tipo devolve o ErrSemNotificador, o "log" nunca é usado sem ser pedido.
+// O config.URLReset (ex: "http://localhost:8080/reset?token=%s") é o link enviado nas mensagens de reset
+func NovoNotificador(logger *log.Logger, config Config) (Notificador, error) {
+	switch config.Tipo {
+	case "":
+		return nil, ErrSemNotificador
+	case "log":
+		return &NotificadorLog{Logger: logger, URLReset: config.URLReset}, nil
+	case "ficheiro":
+		return NovoNotificadorFicheiro(config.Ficheiro, config.URLReset)
+	case "smtp":
+		return &NotificadorSMTP{
+			Servidor:  config.SMTP.Host,
+			Porta:     config.SMTP.Porta,
+			User:      config.SMTP.User,
+			Password:  config.SMTP.Pass,
+			Remetente: config.SMTP.Remetente,
+			URLReset:  config.URLReset,
+		}, nil
+	}
+	return nil, fmt.Errorf("notificador desconhecido: %s", config.Tipo)
+}
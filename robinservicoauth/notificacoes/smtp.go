@@ -0,0 +1,44 @@
+package notificacoes
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// NotificadorSMTP Envia as mensagens por email, através de um servidor SMTP
+type NotificadorSMTP struct {
+	Servidor  string
+	Porta     string
+	User      string // Vazio se o servidor não precisar de autenticação
+	Password  string
+	Remetente string
+	URLReset  string // Link das mensagens de reset, com %s no lugar da token
+}
+
+// enviar Envia o email ao destinatário
+func (notificador *NotificadorSMTP) enviar(destino Destinatario, assunto string, corpo string) error {
+	if destino.Email == "" {
+		return errors.New("o user " + destino.User + " não têm email registado")
+	}
+	// Impede que os valores acrescentem headers ao email
+	if strings.ContainsAny(destino.Email+assunto, "\r\n") {
+		return errors.New("email ou assunto inválidos")
+	}
+
+	var auth smtp.Auth
+	if notificador.User != "" {
+		auth = smtp.PlainAuth("", notificador.User, notificador.Password, notificador.Servidor)
+	}
+	mensagem := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s",
+		notificador.Remetente, destino.Email, assunto, corpo)
+	return smtp.SendMail(net.JoinHostPort(notificador.Servidor, notificador.Porta), auth, notificador.Remetente, []string{destino.Email}, []byte(mensagem))
+}
+
+// EnviarResetPassword Envia a mensagem de reset para o email do user
+func (notificador *NotificadorSMTP) EnviarResetPassword(destino Destinatario, token string, expira time.Time) error {
+	return notificador.enviar(destino, "Reset da password Robin", mensagemResetPassword(destino, token, expira, notificador.URLReset))
+}
@@ -2,8 +2,8 @@ package redishandle
 
 import (
 	"context"
-	"os"
-	"strconv"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -11,10 +11,12 @@ import (
 )
 
 const (
-	defaultPassword  = "Pg+V@j+Z9gKj88=-?dSk" // Palavra passe do user admin da bd redis
-	defaultUsername  = "admin"                // user para a conexão á base de dados, não o utilisador admin do sistema
-	defaultRedisPort = "6379"                 // porta base onde o serviçio redis está exposto
+	defaultUsername  = "admin" // user para a conexão á base de dados, não o utilisador admin do sistema
+	defaultRedisPort = "6379"  // porta base onde o serviçio redis está exposto
 	defaultDB        = 0
+
+	esperaRedis        = time.Second * 40 // tempo máximo que o client-setup espera pela BD
+	intervaloPingRedis = time.Second      // intervalo entre os pings enquanto a BD não responde
 )
 
 // DefClienteRedis -
@@ -26,46 +28,31 @@ type DefClienteRedis struct {
 	DB       int    // Base de dados a usar para as operações de base de dados
 }
 
-//AddressRed endereço do serviço redis
-var AddressRed = os.Getenv("AUTH_SERVER_REDIS_PORT")
-
-//PortRed porta onde o serviço redis está a correr
-var PortRed = os.Getenv("REDISPORT")
-
-//PasswordRed password para a autenticação na redis bd
-var PasswordRed = os.Getenv("REDIS_USER1_PASS")
-
-// UserRed Utilisador a utilizar na autenticação no serviço redis
-var UserRed = os.Getenv("REDIS_USER1_NAME")
-
-// DBRed a base de dados a concetar pelo cliente
-var DBRed, _ = strconv.Atoi(os.Getenv("REDISDB"))
-
 var redisLogger = loggers.LoginResolverLogger
 
 /*
-NovoClienteRedis Cria um novo cliente redis para conectar ao serviço redis
+NovoClienteRedis Cria um novo cliente redis para conectar ao serviço redis, e espera que o serviço responda
 ---
 Params:
 	addres - String Endereço onde o serviçoo está a correr
 	port - String Porta onde o serviço está desponível
 	db - Int Indica se vai usar a data-base default do redis
+Devolve um erro se a password não for fornecida, ou se o redis não responder dentro de esperaRedis
 */
-func NovoClienteRedis(addres, port, password, username string, db int) redis.Client {
+func NovoClienteRedis(addres, port, password, username string, db int) (*redis.Client, error) {
+	// A password não têm valor default, o redis guarda as chaves e os users do serviço
+	if password == "" {
+		return nil, errors.New("a password do redis é obrigatória")
+	}
 	// Verifica as variaveis env passadas e define valores default
 	// se não forem defenidos valores por vars env
 	if port == "" {
 		port = defaultRedisPort
 	}
-	if password == "" {
-		password = defaultPassword
-	}
 	if username == "" {
-		password = defaultUsername
+		username = defaultUsername
 	}
 
-	// Sleep ajuda a que a redis-bd inicie antes de tentar conectar
-	time.Sleep(time.Second * 10)
 	// aplica as defenições passadas nos argumentos da função
 	client := redis.NewClient(&redis.Options{
 		Addr:     string(addres + ":" + port),
@@ -74,16 +61,23 @@ func NovoClienteRedis(addres, port, password, username string, db int) redis.Cli
 		DB:       db,
 	})
 
-	// Define o tempo máximo que o client-setup deve esperar pela BD
-	cntx, cancel := context.WithDeadline(context.Background(), time.Now().Add(time.Second*40))
-	// verifica se o cliente está UP e funcional
-	_, err := client.Ping(cntx).Result()
+	// O redis pode ainda estar a iniciar (ex: no docker-compose), o ping é repetido até ao fim da espera
+	cntx, cancel := context.WithTimeout(context.Background(), esperaRedis)
 	defer cancel()
-	if err != nil {
+	for {
+		err := client.Ping(cntx).Err()
+		if err == nil {
+			break
+		}
 		redisLogger.Printf("[!] Erro: %v", err)
-		redisLogger.Fatal()
+		select {
+		case <-cntx.Done():
+			client.Close()
+			return nil, fmt.Errorf("o redis em %s não respondeu: %w", addres+":"+port, err)
+		case <-time.After(intervaloPingRedis):
+		}
 	}
 
 	redisLogger.Println("[$] Cliente Redis Criado")
-	return *client
+	return client, nil
 }
@@ -0,0 +1,60 @@
+package redishandle
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/metricas"
+)
+
+// chaveInicio Chave do contexto com o momento em que o comando foi enviado
+type chaveInicio struct{}
+
+// hookMetricas Hook do cliente redis que regista a duração e o resultado de cada comando (get, hset, ...) e de cada pipeline
+type hookMetricas struct {
+	metricas *metricas.Metricas
+}
+
+// HookMetricas Hook para adicionar ao cliente redis (redis.Client.AddHook), com os comandos registados nas métricas do serviço
+func HookMetricas(m *metricas.Metricas) redis.Hook {
+	return &hookMetricas{metricas: m}
+}
+
+func (hook *hookMetricas) BeforeProcess(ctx context.Context, _ redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, chaveInicio{}, time.Now()), nil
+}
+
+func (hook *hookMetricas) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	hook.observar(ctx, cmd.Name(), cmd.Err())
+	return nil
+}
+
+func (hook *hookMetricas) BeforeProcessPipeline(ctx context.Context, _ []redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, chaveInicio{}, time.Now()), nil
+}
+
+func (hook *hookMetricas) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	var err error
+	for _, cmd := range cmds {
+		if cmd.Err() != nil && !errors.Is(cmd.Err(), redis.Nil) {
+			err = cmd.Err()
+			break
+		}
+	}
+	hook.observar(ctx, "pipeline", err)
+	return nil
+}
+
+// observar Regista o comando, uma key que não existe (redis.Nil) não é um erro
+func (hook *hookMetricas) observar(ctx context.Context, operacao string, err error) {
+	inicio, ok := ctx.Value(chaveInicio{}).(time.Time)
+	if !ok {
+		return
+	}
+	if errors.Is(err, redis.Nil) {
+		err = nil
+	}
+	hook.metricas.ObservarBD("redis", operacao, time.Since(inicio), err)
+}
@@ -0,0 +1,60 @@
+package redishandle
+
+import (
+	"context"
+	"errors"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/rastreio"
+)
+
+// chaveTerminar Chave do contexto com a função que termina o span do comando
+type chaveTerminar struct{}
+
+// hookRastreio Hook do cliente redis que cria um span por comando (get, hset, ...) e por pipeline,
+// filho do span do contexto do comando
+type hookRastreio struct{}
+
+// HookRastreio Hook para adicionar ao cliente redis (redis.Client.AddHook), com os comandos rastreados (ver rastreio.OperacaoBD)
+func HookRastreio() redis.Hook {
+	return hookRastreio{}
+}
+
+func (hookRastreio) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	ctx, terminar := rastreio.OperacaoBD(ctx, "redis", cmd.Name(), "")
+	return context.WithValue(ctx, chaveTerminar{}, terminar), nil
+}
+
+func (hookRastreio) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	terminarComando(ctx, cmd.Err())
+	return nil
+}
+
+func (hookRastreio) BeforeProcessPipeline(ctx context.Context, _ []redis.Cmder) (context.Context, error) {
+	ctx, terminar := rastreio.OperacaoBD(ctx, "redis", "pipeline", "")
+	return context.WithValue(ctx, chaveTerminar{}, terminar), nil
+}
+
+func (hookRastreio) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	var err error
+	for _, cmd := range cmds {
+		if cmd.Err() != nil && !errors.Is(cmd.Err(), redis.Nil) {
+			err = cmd.Err()
+			break
+		}
+	}
+	terminarComando(ctx, err)
+	return nil
+}
+
+// terminarComando Termina o span do comando, uma key que não existe (redis.Nil) não é um erro
+func terminarComando(ctx context.Context, err error) {
+	terminar, ok := ctx.Value(chaveTerminar{}).(rastreio.Terminar)
+	if !ok {
+		return
+	}
+	if errors.Is(err, redis.Nil) {
+		err = nil
+	}
+	terminar(err)
+}
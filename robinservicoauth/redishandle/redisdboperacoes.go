@@ -5,7 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"regexp"
+	"strings"
 	"strconv"
+	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/tomascpmarques/PAP/backend/robinservicoauth/loggers"
@@ -69,8 +71,7 @@ func GetRegistoBD(cr *redis.Client, keyDoRegisto string, debugg int) (string, er
 	registo, getErr := cr.Get(context.Background(), keyDoRegisto).Result()
 	if getErr != nil {
 		operacoesBDLogger.Printf("[!] Erro ao buscar pelo registo de key <%v> : %v", keyDoRegisto, getErr)
-		erroNaProcura := "Sem registo para id: " + keyDoRegisto
-		return "null", errors.New(erroNaProcura)
+		return "null", erroProcura(keyDoRegisto, getErr)
 	}
 	operacoesBDLogger.Printf("[$] ID do Registo <%v>:", keyDoRegisto)
 	if debugg == 1 {
@@ -81,25 +82,62 @@ func GetRegistoBD(cr *redis.Client, keyDoRegisto string, debugg int) (string, er
 }
 
 /*
-BuscarKeysVerificarResultado - Procura e devolve as keys relacionadas ao tipo de registo fornecido
-							   existentes na redisDB utilizada, pelo client redis fornecido.
+PaginaKeysBD - Devolve uma página das keys que correspondem ao padrão, com SCAN (não bloqueia o redis como o KEYS).
+			   As chamadas ao SCAN são repetidas até haver pelo menos limite keys ou a procura terminar,
+			   por isso a página pode ter um pouco mais que limite keys.
 ---
 Params
-	contexto context.Context - contexto a executar a função
-	clienteRedis *redis.Client - cliente ligado a uma redisDB a utilisar
-	tiporegisto string - o tipo de registo associado ás keys procuradas
+	cr - redis.Client / cliente redis a usar
+	cursor - uint64 / cursor devolvido pela página anterior, 0 na primeira
+	padrao - string / padrão das keys (ex: user:*)
+	limite - int64 / número de keys pretendido
+Retorna as keys e o cursor da página seguinte, 0 quando não há mais keys
 */
-func BuscarKeysVerificarResultado(contexto context.Context, clienteRedis *redis.Client, key string) bool {
-	// Retorna só a lista com as keys do tipo de registo especificado
-	// se o valor passado for "" retorna todas as keys
-	keys := clienteRedis.Keys(contexto, key).Val()
-	// Veridfica se têm algum registo na DB alvo
-	if len(keys) == 0 {
-		operacoesBDLogger.Printf("[?] Sem registos ou keys associados para: %v\n", key)
-		return false
+func PaginaKeysBD(cr *redis.Client, cursor uint64, padrao string, limite int64) ([]string, uint64, error) {
+	return paginaBD(cursor, limite, func(cursor uint64) ([]string, uint64, error) {
+		return cr.Scan(context.Background(), cursor, padrao, limite).Result()
+	})
+}
+
+/*
+PaginaMembrosBD - Devolve uma página dos membros do set que correspondem ao padrão, com SSCAN (ver PaginaKeysBD)
+---
+Params
+	cr - redis.Client / cliente redis a usar
+	key - string / key do set
+	cursor - uint64 / cursor devolvido pela página anterior, 0 na primeira
+	padrao - string / padrão dos membros (ex: adm*)
+	limite - int64 / número de membros pretendido
+*/
+func PaginaMembrosBD(cr *redis.Client, key string, cursor uint64, padrao string, limite int64) ([]string, uint64, error) {
+	return paginaBD(cursor, limite, func(cursor uint64) ([]string, uint64, error) {
+		return cr.SScan(context.Background(), key, cursor, padrao, limite).Result()
+	})
+}
+
+// paginaBD Repete a procura até ter limite resultados ou o cursor voltar a 0
+func paginaBD(cursor uint64, limite int64, procura func(cursor uint64) ([]string, uint64, error)) ([]string, uint64, error) {
+	resultados := make([]string, 0, limite)
+	for {
+		pagina, proximo, err := procura(cursor)
+		if err != nil {
+			operacoesBDLogger.Printf("[!] Erro ao procurar a página no cursor <%v> : %v", cursor, err)
+			return nil, 0, err
+		}
+		resultados = append(resultados, pagina...)
+		cursor = proximo
+		if cursor == 0 || int64(len(resultados)) >= limite {
+			return resultados, cursor, nil
+		}
 	}
+}
+
+// caracteresPadrao caracteres com significado especial nos padrões do SCAN/KEYS
+var caracteresPadrao = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
 
-	return true
+// EscaparPadraoBD Escapa o texto para ser usado literalmente num padrão do SCAN, ex: num prefixo
+func EscaparPadraoBD(texto string) string {
+	return caracteresPadrao.Replace(texto)
 }
 
 /*
@@ -116,3 +154,319 @@ func ConversaoIDStringInt(conteudo string) int {
 	}
 	return keyInt
 }
+
+// scriptTrocarValor Substitui o valor de uma key existente, mantendo o tempo de expiração, e devolve o valor anterior
+var scriptTrocarValor = redis.NewScript(`
+local anterior = redis.call('GET', KEYS[1])
+if anterior then
+	redis.call('SET', KEYS[1], ARGV[1], 'KEEPTTL')
+end
+return anterior`)
+
+/*
+TrocarValorRegistoBD - Substitui, de forma atómica, o valor de um registo existente e devolve o valor anterior.
+					   O tempo de expiração do registo é mantido, se o registo não existir devolve um erro.
+---
+Params
+	cr - redis.Client / cliente redis a usar
+	keyDoRegisto - string / key do registo a alterar
+	valor - interface{} / novo valor do registo
+*/
+func TrocarValorRegistoBD(cr *redis.Client, keyDoRegisto string, valor interface{}) (string, error) {
+	anterior, err := scriptTrocarValor.Run(context.Background(), cr, []string{keyDoRegisto}, valor).Text()
+	if err != nil {
+		operacoesBDLogger.Printf("[!] Erro ao trocar o valor do registo de key <%v> : %v", keyDoRegisto, err)
+		return "", erroProcura(keyDoRegisto, err)
+	}
+	operacoesBDLogger.Printf("[$] Valor do registo <%v> trocado", keyDoRegisto)
+	return anterior, nil
+}
+
+/*
+AdicionarMembrosBD - Adiciona os membros fornecidos ao set guardado na key, cria o set se não existir.
+---
+Params
+	cr - redis.Client / cliente redis a usar
+	key - string / key do set
+	membros - []string / membros a adicionar
+*/
+func AdicionarMembrosBD(cr *redis.Client, key string, membros ...string) error {
+	valores := make([]interface{}, len(membros))
+	for i, membro := range membros {
+		valores[i] = membro
+	}
+	if err := cr.SAdd(context.Background(), key, valores...).Err(); err != nil {
+		operacoesBDLogger.Printf("[!] Erro ao adicionar membros ao set <%v> : %v", key, err)
+		return err
+	}
+	return nil
+}
+
+/*
+RemoverMembrosBD - Remove os membros fornecidos do set guardado na key, o set é apagado quando fica vazio.
+---
+Params
+	cr - redis.Client / cliente redis a usar
+	key - string / key do set
+	membros - []string / membros a remover
+*/
+func RemoverMembrosBD(cr *redis.Client, key string, membros ...string) error {
+	valores := make([]interface{}, len(membros))
+	for i, membro := range membros {
+		valores[i] = membro
+	}
+	if err := cr.SRem(context.Background(), key, valores...).Err(); err != nil {
+		operacoesBDLogger.Printf("[!] Erro ao remover membros do set <%v> : %v", key, err)
+		return err
+	}
+	return nil
+}
+
+/*
+BuscarMembrosBD - Devolve todos os membros do set guardado na key, um set inexistente não têm membros.
+---
+Params
+	cr - redis.Client / cliente redis a usar
+	key - string / key do set
+*/
+func BuscarMembrosBD(cr *redis.Client, key string) ([]string, error) {
+	membros, err := cr.SMembers(context.Background(), key).Result()
+	if err != nil {
+		operacoesBDLogger.Printf("[!] Erro ao buscar os membros do set <%v> : %v", key, err)
+		return nil, err
+	}
+	return membros, nil
+}
+
+/*
+RegistarOcorrenciaBD - Regista uma ocorrência no momento atual, num sorted set usado como janela deslizante,
+					   apaga as ocorrências mais antigas que a janela e devolve o número de ocorrências na janela.
+---
+Params
+	cr - redis.Client / cliente redis a usar
+	key - string / key do sorted set
+	janela - time.Duration / duração da janela, o set expira se não houver ocorrências durante esse tempo
+*/
+func RegistarOcorrenciaBD(cr *redis.Client, key string, janela time.Duration) (int64, error) {
+	agora := time.Now()
+	pipe := cr.TxPipeline()
+	pipe.ZAdd(context.Background(), key, &redis.Z{Score: float64(agora.UnixNano()), Member: agora.UnixNano()})
+	pipe.ZRemRangeByScore(context.Background(), key, "-inf", strconv.FormatInt(agora.Add(-janela).UnixNano(), 10))
+	contagem := pipe.ZCard(context.Background(), key)
+	pipe.Expire(context.Background(), key, janela)
+	if _, err := pipe.Exec(context.Background()); err != nil {
+		operacoesBDLogger.Printf("[!] Erro ao registar ocorrência em <%v> : %v", key, err)
+		return 0, err
+	}
+	return contagem.Val(), nil
+}
+
+/*
+ContarOcorrenciasBD - Devolve o número de ocorrências registadas por RegistarOcorrenciaBD dentro da janela.
+---
+Params
+	cr - redis.Client / cliente redis a usar
+	key - string / key do sorted set
+	janela - time.Duration / duração da janela
+*/
+func ContarOcorrenciasBD(cr *redis.Client, key string, janela time.Duration) (int64, error) {
+	inicio := strconv.FormatInt(time.Now().Add(-janela).UnixNano(), 10)
+	contagem, err := cr.ZCount(context.Background(), key, "("+inicio, "+inf").Result()
+	if err != nil {
+		operacoesBDLogger.Printf("[!] Erro ao contar as ocorrências em <%v> : %v", key, err)
+		return 0, err
+	}
+	return contagem, nil
+}
+
+/*
+TempoRestanteBD - Devolve o tempo até o registo expirar, 0 se o registo não existir ou não tiver expiração.
+---
+Params
+	cr - redis.Client / cliente redis a usar
+	key - string / key do registo
+*/
+func TempoRestanteBD(cr *redis.Client, key string) time.Duration {
+	restante, err := cr.PTTL(context.Background(), key).Result()
+	if err != nil || restante < 0 {
+		return 0
+	}
+	return restante
+}
+
+/*
+ApagarKeysBD - Apaga as keys fornecidas, ao contrário do DelRegistoBD as keys que não existem são ignoradas.
+---
+Params
+	cr - redis.Client / cliente redis a usar
+	keys - []string / keys a apagar
+*/
+func ApagarKeysBD(cr *redis.Client, keys ...string) error {
+	if err := cr.Del(context.Background(), keys...).Err(); err != nil {
+		operacoesBDLogger.Printf("[!] Erro ao apagar as keys %v : %v", keys, err)
+		return err
+	}
+	return nil
+}
+
+/*
+ProcurarKeysBD - Devolve todas as keys que correspondem ao padrão, usa SCAN para não bloquear a BD como o KEYS.
+---
+Params
+	cr - redis.Client / cliente redis a usar
+	padrao - string / padrão das keys (ex: "prefixo:*")
+*/
+func ProcurarKeysBD(cr *redis.Client, padrao string) ([]string, error) {
+	keys := make([]string, 0)
+	iter := cr.Scan(context.Background(), 0, padrao, 100).Iterator()
+	for iter.Next(context.Background()) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		operacoesBDLogger.Printf("[!] Erro ao procurar as keys <%v> : %v", padrao, err)
+		return nil, err
+	}
+	return keys, nil
+}
+
+/*
+InserirSeNaoExisteBD - Inssere o registo só se a key ainda não existir, devolve true se o registo foi insserido.
+---
+Params
+	cr - redis.Client / cliente redis a usar
+	registo - RegistoRedisDB / registo a insserir
+*/
+func InserirSeNaoExisteBD(cr *redis.Client, registo RegistoRedisDB) (bool, error) {
+	inserido, err := cr.SetNX(context.Background(), registo.Key, registo.Valor, registo.Expira).Result()
+	if err != nil {
+		operacoesBDLogger.Printf("[!] Erro ao insserir o registo <%v> : %v", registo.Key, err)
+		return false, err
+	}
+	return inserido, nil
+}
+
+// scriptConsumirRegisto Devolve o valor de uma key e apaga-a, numa só operação
+var scriptConsumirRegisto = redis.NewScript(`
+local valor = redis.call('GET', KEYS[1])
+if valor then
+	redis.call('DEL', KEYS[1])
+end
+return valor`)
+
+/*
+ConsumirRegistoBD - Busca e apaga um registo de forma atómica, para registos que só podem ser usados uma vez.
+					Se o registo não existir (ou já tiver sido consumido) devolve um erro.
+---
+Params
+	cr - redis.Client / cliente redis a usar
+	keyDoRegisto - string / key do registo a consumir
+*/
+func ConsumirRegistoBD(cr *redis.Client, keyDoRegisto string) (string, error) {
+	valor, err := scriptConsumirRegisto.Run(context.Background(), cr, []string{keyDoRegisto}).Text()
+	if err != nil {
+		operacoesBDLogger.Printf("[!] Erro ao consumir o registo de key <%v> : %v", keyDoRegisto, err)
+		return "", erroProcura(keyDoRegisto, err)
+	}
+	return valor, nil
+}
+
+// ErrSemRegisto a key pedida não existe, os outros erros das procuras são erros da ligação à BD
+var ErrSemRegisto = errors.New("sem registo para a key pedida")
+
+// erroProcura Devolve um erro que embrulha o ErrSemRegisto se a key não existir (redis.Nil),
+// para quem chama distinguir um registo inexistente de uma falha da BD (ver errors.Is)
+func erroProcura(key string, err error) error {
+	if err == redis.Nil {
+		return fmt.Errorf("%w: %s", ErrSemRegisto, key)
+	}
+	return fmt.Errorf("erro ao procurar o registo %s: %w", key, err)
+}
+
+var (
+	// ErrRegistoExiste já existe um registo com a key de destino
+	ErrRegistoExiste = errors.New("já existe um registo com a key pedida")
+	// ErrConflitoRegisto o registo foi alterado por outro pedido durante a operação
+	ErrConflitoRegisto = errors.New("o registo foi alterado por outro pedido, tente novamente")
+)
+
+// maxTentativasTransacao número de vezes que uma transação é repetida quando as keys observadas mudam
+const maxTentativasTransacao = 3
+
+/*
+TransacaoBD - Executa a função numa transação otimista: as keys são observadas (WATCH) e as escritas feitas
+			  pela função num tx.TxPipelined (MULTI/EXEC) só são aplicadas se nenhuma key mudar entretanto.
+			  A transação é repetida até maxTentativasTransacao vezes, depois devolve ErrConflitoRegisto.
+---
+Params
+	cr - redis.Client / cliente redis a usar
+	funcao - func(*redis.Tx) error / leituras e escritas da transação
+	keys - []string / keys a observar
+*/
+func TransacaoBD(cr *redis.Client, funcao func(tx *redis.Tx) error, keys ...string) error {
+	for i := 0; i < maxTentativasTransacao; i++ {
+		err := cr.Watch(context.Background(), funcao, keys...)
+		if err != redis.TxFailedErr {
+			return err
+		}
+		operacoesBDLogger.Printf("[?] Transação sobre %v repetida, as keys foram alteradas", keys)
+	}
+	return ErrConflitoRegisto
+}
+
+/*
+TrocarRegistoBD - Substitui o registo em keyAtual pelo registo novo (que pode ter outra key, ex: mudança de nome),
+				  numa só transação. Só é aplicado se o valor atual for igual ao valorEsperado (compare-and-swap),
+				  e se a key nova for diferente, esta não pode existir. As operacoes (pode ser nil) são
+				  acrescentadas à mesma transação, ex: atualizar índices do registo.
+---
+Params
+	cr - redis.Client / cliente redis a usar
+	keyAtual - string / key do registo a substituir
+	valorEsperado - string / valor lido antes da alteração
+	novo - RegistoRedisDB / registo que substitui o atual
+	operacoes - func(redis.Pipeliner) / outras escritas a fazer na mesma transação
+*/
+func TrocarRegistoBD(cr *redis.Client, keyAtual string, valorEsperado string, novo RegistoRedisDB, operacoes func(pipe redis.Pipeliner)) error {
+	ctx := context.Background()
+	keys := []string{keyAtual}
+	if novo.Key != keyAtual {
+		keys = append(keys, novo.Key)
+	}
+
+	err := TransacaoBD(cr, func(tx *redis.Tx) error {
+		atual, err := tx.Get(ctx, keyAtual).Result()
+		if err != nil {
+			return errors.New("Sem registo para id: " + keyAtual)
+		}
+		if atual != valorEsperado {
+			return ErrConflitoRegisto
+		}
+		if novo.Key != keyAtual {
+			existe, err := tx.Exists(ctx, novo.Key).Result()
+			if err != nil {
+				return err
+			}
+			if existe > 0 {
+				return ErrRegistoExiste
+			}
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			if novo.Key != keyAtual {
+				pipe.Del(ctx, keyAtual)
+			}
+			pipe.Set(ctx, novo.Key, novo.Valor, novo.Expira)
+			if operacoes != nil {
+				operacoes(pipe)
+			}
+			return nil
+		})
+		return err
+	}, keys...)
+	if err != nil {
+		operacoesBDLogger.Printf("[!] Erro ao trocar o registo <%v> por <%v> : %v", keyAtual, novo.Key, err)
+		return err
+	}
+	operacoesBDLogger.Printf("[+] Registo <%v> substituido por <%v>", keyAtual, novo.Key)
+	return nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"time"
+
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/configuracao"
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/rastreio"
+	"github.com/tomascpmarques/PAP/backend/robinservicodocumentacao/endpointfuncs"
+)
+
+// PrefixoConfig prefixo das variáveis de ambiente do serviço, ex: DOC_SERVIDOR_PORTA
+const PrefixoConfig = "DOC"
+
+// Config Configuração do serviço de documentação, os valores default são sobrepostos pelo ficheiro (-config),
+// pelas variáveis de ambiente e pelas flags (ver configuracao.Carregar)
+type Config struct {
+	Servidor  configuracao.Servidor `conf:"servidor"`
+	Rastreio  rastreio.Config       `conf:"rastreio"`
+	Endpoints endpointfuncs.Config  `conf:",inline"`
+}
+
+// configDefault Configuração usada em desenvolvimento local, sem ficheiro nem variáveis
+func configDefault() Config {
+	return Config{
+		Servidor: configuracao.Servidor{
+			Endereco:       "0.0.0.0",
+			Porta:          8118,
+			TimeoutLeitura: time.Second * 2,
+			TimeoutEscrita: time.Second * 3,
+			TimeoutInativo: time.Second * 5,
+			Desligar:       time.Second * 15,
+			CORS: configuracao.CORS{
+				Origens:     []string{"http://localhost:8080"},
+				Credenciais: false,
+			},
+		},
+		Rastreio:  rastreio.ConfigDefault(),
+		Endpoints: endpointfuncs.ConfigDefault(),
+	}
+}
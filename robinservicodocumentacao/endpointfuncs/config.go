@@ -0,0 +1,25 @@
+package endpointfuncs
+
+import (
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/clientes"
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/configuracao"
+)
+
+// Config Configuração das actions, parte da configuração do serviço
+type Config struct {
+	Mongo       configuracao.Mongo        `conf:"mongo"`
+	Auth        configuracao.Autenticacao `conf:"auth"`
+	Servico     configuracao.ContaServico `conf:"servico"`
+	URLUserinfo string                    `conf:"userinfo_url" desc:"endereço do serviço userinfo, onde são registadas as contribuições"`
+	Userinfo    clientes.Config           `conf:"userinfo"`
+}
+
+// ConfigDefault Instância mongo local, os endpoints default do serviço de autenticação e o serviço userinfo local,
+// com o timeout e as tentativas default das chamadas
+func ConfigDefault() Config {
+	return Config{
+		Mongo:       configuracao.Mongo{URI: "mongodb://0.0.0.0:27020/"},
+		URLUserinfo: "http://0.0.0.0:8001",
+		Userinfo:    clientes.ConfigDefault(),
+	}
+}
@@ -1,21 +1,16 @@
 package ficheiros
 
 import (
-	"bytes"
 	"context"
 	"crypto/sha256"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
-	"net/http"
 	"reflect"
 	"strings"
 	"time"
 
-	"github.com/tomascpmarques/PAP/backend/robinservicodocumentacao/endpointfuncs"
-	"github.com/tomascpmarques/PAP/backend/robinservicodocumentacao/endpointfuncs/repos"
-	"github.com/tomascpmarques/PAP/backend/robinservicodocumentacao/loggers"
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/clientes/userinfo"
 	"github.com/tomascpmarques/PAP/backend/robinservicodocumentacao/resolvedschema"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -31,15 +26,15 @@ type MongoDBOperation struct {
 }
 
 // Setup Evita mais lihas desnecessárias e repetitivas para poder-se usar a coleção necessaria
-func SetupColecao(dbName, collName string) (defs MongoDBOperation) {
-	defs.Colecao = endpointfuncs.MongoClient.Database(dbName).Collection(collName)
+func (servico *Servico) SetupColecao(dbName, collName string) (defs MongoDBOperation) {
+	defs.Colecao = servico.Mongo.Database(dbName).Collection(collName)
 	defs.Cntxt, defs.CancelFunc = context.WithTimeout(context.Background(), time.Second*10)
 	return
 }
 
-func AdicionarContribuicaoRepo(ficheiroStruct *resolvedschema.FicheiroConteudo, usr string) error {
+func (servico *Servico) AdicionarContribuicaoRepo(ficheiroStruct *resolvedschema.FicheiroConteudo, usr string) error {
 	// Setup da coleção a usar nas operções
-	colecao := SetupColecao("documentacao", "repos")
+	colecao := servico.SetupColecao("documentacao", "repos")
 	colecao.Filter = bson.M{"nome": ficheiroStruct.Path[1]}
 
 	// Get repo especifico da BD
@@ -108,7 +103,7 @@ func VerifPathValido(meta *resolvedschema.FicheiroMetaData) error {
 	return nil
 }
 
-func MetaDataBaseValida(metaData map[string]interface{}) error {
+func (servico *Servico) MetaDataBaseValida(metaData map[string]interface{}) error {
 	campos := []string{
 		"nome",
 		"autor",
@@ -135,7 +130,7 @@ func MetaDataBaseValida(metaData map[string]interface{}) error {
 	// Define o filtro a usar na procura de informação na BD
 	filter := bson.M{"hash": meta.Hash}
 	// Documento e repo onde procurar o repo
-	collection := endpointfuncs.MongoClient.Database("documentacao").Collection("files-meta-data")
+	collection := servico.Mongo.Database("documentacao").Collection("files-meta-data")
 	cntx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 
 	// Procura por um registo com a mesma hash (registo igual)
@@ -146,7 +141,7 @@ func MetaDataBaseValida(metaData map[string]interface{}) error {
 	}
 
 	// Procura por um ficheiro com o mesmo path, o path é praticamente o identificador absoluto do ficheiro
-	if path := GetMetaDataFicheiro(map[string]interface{}{"path": meta.Path}).Path; !reflect.ValueOf(path).IsZero() {
+	if path := servico.GetMetaDataFicheiro(map[string]interface{}{"path": meta.Path}).Path; !reflect.ValueOf(path).IsZero() {
 		return errors.New("não foi possivél criar o ficheiro pedido, esse path já existe")
 	}
 
@@ -155,9 +150,9 @@ func MetaDataBaseValida(metaData map[string]interface{}) error {
 
 // GetMetaDataPorCampo Busca meta data de um ficheiro e devolve o mesmo na struct resolvedschema.FicheiroMetaData
 // Busca a meta data através de um campo e valor do mesmo, especificado na sua chamada
-func GetMetaDataFicheiro(campos map[string]interface{}) (meta resolvedschema.FicheiroMetaData) {
+func (servico *Servico) GetMetaDataFicheiro(campos map[string]interface{}) (meta resolvedschema.FicheiroMetaData) {
 	// Documento e Coleção onde procurar a meta data
-	operacoesDB := SetupColecao("documentacao", "files-meta-data")
+	operacoesDB := servico.SetupColecao("documentacao", "files-meta-data")
 	operacoesDB.Filter = campos
 
 	// Procura na BD do registo pedido
@@ -174,9 +169,9 @@ func GetMetaDataFicheiro(campos map[string]interface{}) (meta resolvedschema.Fic
 }
 
 // ApagarMetaDataFicheiro Apaga o ficheiro em que a hash é a mesma que a passada nos parametros
-func ApagarMetaDataFicheiro(hash string) error {
+func (servico *Servico) ApagarMetaDataFicheiro(hash string) error {
 	// Documento e Coleção onde procurar a meta data
-	operacoesDB := SetupColecao("documentacao", "files-meta-data")
+	operacoesDB := servico.SetupColecao("documentacao", "files-meta-data")
 	operacoesDB.Filter = bson.M{"hash": hash}
 
 	// Procura na BD do registo pedido
@@ -190,9 +185,9 @@ func ApagarMetaDataFicheiro(hash string) error {
 	return nil
 }
 
-func ApagarFicheiroMetaRepo(hash string, user string) error {
+func (servico *Servico) ApagarFicheiroMetaRepo(hash string, user string) error {
 	// Documento e Coleção onde procurar a meta data
-	operacoesDB := SetupColecao("documentacao", "repos")
+	operacoesDB := servico.SetupColecao("documentacao", "repos")
 	cntx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 
 	// Query para apagar o ficheiro que conicide com a hash: hash
@@ -213,14 +208,14 @@ func ApagarFicheiroMetaRepo(hash string, user string) error {
 }
 
 // RepoInserirMetaFileInfo Atualiza o array de ficheiros que pertence ao repo especificado
-func RepoInserirMetaFileInfo(repoNome string, meta *resolvedschema.FicheiroMetaData) error {
+func (servico *Servico) RepoInserirMetaFileInfo(repoNome string, meta *resolvedschema.FicheiroMetaData) error {
 	if meta.Path[1] != repoNome {
 		return errors.New("caminho do ficheiro não coincide com o do repositorio")
 	}
 	// Combinação de nome do ficheiro e do seu path
 	ficheiroNomePath := map[string]interface{}{"nome": meta.Nome, "path": meta.Path, "hash": meta.Hash}
 
-	operacoesDB := SetupColecao("documentacao", "repos")
+	operacoesDB := servico.SetupColecao("documentacao", "repos")
 	operacoesDB.Filter = bson.M{"nome": repoNome}
 
 	err := operacoesDB.Colecao.FindOneAndUpdate(operacoesDB.Cntxt, operacoesDB.Filter, bson.M{"$push": bson.M{"ficheiros": ficheiroNomePath}})
@@ -232,8 +227,8 @@ func RepoInserirMetaFileInfo(repoNome string, meta *resolvedschema.FicheiroMetaD
 
 	// Verifica se o autor deste ficheiro é diferente do autor do repo,
 	// Se sim, adiciona este utilizador À lista dos contribuidores
-	repoAutor := repos.GetRepoPorCampo("nome", repoNome).Autor
-	if err := VerificaNovoContribuidor(meta.Autor, repoAutor, repoNome); err != nil {
+	repoAutor := servico.repos.GetRepoPorCampo("nome", repoNome).Autor
+	if err := servico.VerificaNovoContribuidor(meta.Autor, repoAutor, repoNome); err != nil {
 		return err
 	}
 
@@ -242,9 +237,9 @@ func RepoInserirMetaFileInfo(repoNome string, meta *resolvedschema.FicheiroMetaD
 
 // VerificaNovoContribuidor Se o ficheiro a insserir no repo for de autoria de um user,
 //							que não é o autor do repo, adiciona esse user aos contribuidores
-func VerificaNovoContribuidor(ficheiroAutor string, repoAutor string, repoNome string) error {
+func (servico *Servico) VerificaNovoContribuidor(ficheiroAutor string, repoAutor string, repoNome string) error {
 	if ficheiroAutor != repoAutor {
-		operacoesBD := SetupColecao("documentacao", "repos")
+		operacoesBD := servico.SetupColecao("documentacao", "repos")
 		operacoesBD.Filter = bson.M{"nome": repoNome}
 
 		err := operacoesBD.Colecao.FindOneAndUpdate(operacoesBD.Cntxt, operacoesBD.Filter, bson.M{"$push": bson.M{"contribuidores": ficheiroAutor}})
@@ -269,30 +264,19 @@ func CriarMetaHash(metaData map[string]interface{}) (string, error) {
 }
 
 // VerificarRepoExiste Verifica se o repositório com este nome existe
-func VerificarRepoExiste(repoNome string) bool {
-	return !reflect.ValueOf(repos.GetRepoPorCampo("nome", repoNome)).IsZero()
+func (servico *Servico) VerificarRepoExiste(repoNome string) bool {
+	return !reflect.ValueOf(servico.repos.GetRepoPorCampo("nome", repoNome)).IsZero()
 }
 
-func ModificarContrbFileInRepoUsrInfo(opDef string, usrNome string, repoAutor string, nomeFicheiro string, token string) error {
-	fileAddSpecific := fmt.Sprintf(`{"user": "%s","repo": "%s", "file": "%s"}`, usrNome, repoAutor, nomeFicheiro)
-	// Mongodb query para atualizar o status do user
-	adicionarQuery := fmt.Sprintf("\"%s\",\n%s,\n\"%s\",", opDef, fileAddSpecific, token)
-	// DynamicGoQuery body para conssumir o endpoint do serviço userinfo
-	action := fmt.Sprintf("action:\nfuncs:\n\"ModificarContribuicoes\":\n%s", adicionarQuery)
-
-	// Utilização do endpoint UpdateInfoUtilizador, exposto em http://0.0.0.0:8001
-	resp, err := http.Post("http://0.0.0.0:8001", "text/plain", bytes.NewBufferString(action))
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-	bodyContentBytes, err := ioutil.ReadAll(resp.Body)
+// ModificarContrbFileInRepoUsrInfo Adiciona (opDef "add") ou remove (opDef "rmv") o ficheiro das contribuições do user, no sistema da user-info
+func (servico *Servico) ModificarContrbFileInRepoUsrInfo(ctx context.Context, opDef string, usrNome string, repoAutor string, nomeFicheiro string, token string) error {
+	// As contribuições são alteradas com a token de serviço, se estiver configurada
+	token, err := servico.TokenUserinfo(token)
 	if err != nil {
 		return err
 	}
-
-	loggers.ResolverLogger.Printf("ModificarContribuicoes status: %v\n", string(bodyContentBytes))
-	return nil
+	contribuicao := userinfo.Contribuicao{User: usrNome, Repo: repoAutor, File: nomeFicheiro}
+	return servico.Userinfo.ModificarContribuicoes(ctx, opDef, contribuicao, token)
 }
 
 func ConteudoRecebidoCheckSum(ficheiro *resolvedschema.FicheiroConteudo) error {
@@ -5,25 +5,21 @@ import (
 	"reflect"
 	"time"
 
-	"github.com/tomascpmarques/PAP/backend/robinservicodocumentacao/endpointfuncs"
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/autorizacao"
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/rastreio"
 	"github.com/tomascpmarques/PAP/backend/robinservicodocumentacao/endpointfuncs/reposfiles"
 	"github.com/tomascpmarques/PAP/backend/robinservicodocumentacao/loggers"
 	"github.com/tomascpmarques/PAP/backend/robinservicodocumentacao/resolvedschema"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 //  CriarFicheiroMetaData Cria a meta data de um ficheiro, para prepara o upload de conteúdo
-func CriarFicheiroMetaData(ficheiroMetaData map[string]interface{}, token string) (retorno map[string]interface{}) {
+func (servico *Servico) CriarFicheiroMetaData(ctx context.Context, ficheiroMetaData map[string]interface{}, token string) (retorno map[string]interface{}) {
 	retorno = make(map[string]interface{})
 
-	// if endpointfuncs.VerificarTokenUser(token) != "OK" {
-	// 	loggers.OperacoesBDLogger.Println("Erro: A token fornecida é inválida ou expirou")
-	// 	retorno["erro"] = "A token fornecida é inválida ou expirou"
-	// 	return
-	// }
-
 	// Verificar se o repo a inserir a meta-info existe
-	if !VerificarRepoExiste(ficheiroMetaData["reponome"].(string)) {
+	if !servico.VerificarRepoExiste(ficheiroMetaData["reponome"].(string)) {
 		loggers.OperacoesBDLogger.Println("O repo fornecido não existe, não se pode criar o ficheiro")
 		retorno["erro"] = "O repo fornecido não existe, não se pode criar o ficheiro"
 		return
@@ -32,14 +28,14 @@ func CriarFicheiroMetaData(ficheiroMetaData map[string]interface{}, token string
 	// Criação da hash para a meta info do ficheiro
 	metaHash, err := CriarMetaHash(ficheiroMetaData)
 	if err != nil {
-		loggers.ServerErrorLogger.Println("Erro ao criar hash para meta data: ", err)
+		servico.LoggerErros.Println("Erro ao criar hash para meta data: ", err)
 		retorno["erro"] = "Erro ao criar hash para meta data fornecida"
 		return
 	}
 	ficheiroMetaData["hash"] = metaHash
 	// Verificar a validade da meta-info fornecida
-	if err := MetaDataBaseValida(ficheiroMetaData); err != nil {
-		loggers.ServerErrorLogger.Println(err.Error())
+	if err := servico.MetaDataBaseValida(ficheiroMetaData); err != nil {
+		servico.LoggerErros.Println(err.Error())
 		retorno["erro"] = err.Error()
 		return
 	}
@@ -49,36 +45,39 @@ func CriarFicheiroMetaData(ficheiroMetaData map[string]interface{}, token string
 	ficheiro := resolvedschema.FicheiroMetaDataParaStruct(&ficheiroMetaData)
 
 	// Get the mongo colection
-	mongoCollection := endpointfuncs.MongoClient.Database("documentacao").Collection("files-meta-data")
-	cntx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	mongoCollection := servico.Mongo.Database("documentacao").Collection("files-meta-data")
+	cntx, cancel := context.WithTimeout(ctx, time.Second*10)
 
 	// Inser a meta data do file na bd respetiva para esses dados i.e: files-meta-data
 	insserido, err := mongoCollection.InsertOne(cntx, ficheiro, options.InsertOne())
 	defer cancel()
 	if err != nil || !reflect.ValueOf(insserido.InsertedID).IsValid() {
-		loggers.ServerErrorLogger.Println("Erro ao insserir o registo na BD: ", err)
+		servico.LoggerErros.Println("Erro ao insserir o registo na BD: ", err)
 		retorno["erro"] = "Erro ao insserir o registo na BD"
 		return
 	}
 
 	// Insere o nome e o path do novo ficheiro, no repo onde a meta data do fiche. especificado
-	err = RepoInserirMetaFileInfo(ficheiro.RepoNome, &ficheiro)
+	err = servico.RepoInserirMetaFileInfo(ficheiro.RepoNome, &ficheiro)
 	if err != nil {
-		loggers.ServerErrorLogger.Println("Erro: ", err)
+		servico.LoggerErros.Println("Erro: ", err)
 		retorno["erro"] = err
 		return
 	}
 
 	// Adiciona o ficheiro ás contribuições do user no serviço user-info
-	if err := ModificarContrbFileInRepoUsrInfo("add", ficheiro.Autor, ficheiroMetaData["reponome"].(string), ficheiro.Nome, token); err != nil {
-		loggers.ServerErrorLogger.Println("Erro: ", err)
-		retorno["erro"] = err
+	if err := servico.ModificarContrbFileInRepoUsrInfo(ctx, "add", ficheiro.Autor, ficheiroMetaData["reponome"].(string), ficheiro.Nome, token); err != nil {
+		servico.LoggerErros.Println("Erro: ", err)
+		retorno["erro"] = err.Error()
 		return
 	}
 
 	// Cria o ficheiro em local-storage após a criação da meta-data correspondente
-	if err := reposfiles.CriarFicheiro_repo(&ficheiro); err != nil {
-		loggers.ServerErrorLogger.Println("Erro: ", err)
+	_, terminar := rastreio.Operacao(ctx, "criar ficheiro em storage", attribute.String("repo", ficheiro.RepoNome), attribute.String("ficheiro", ficheiro.Nome))
+	err = reposfiles.CriarFicheiro_repo(&ficheiro)
+	terminar(err)
+	if err != nil {
+		servico.LoggerErros.Println("Erro: ", err)
 		retorno["erro"] = err
 		return
 	}
@@ -88,20 +87,15 @@ func CriarFicheiroMetaData(ficheiroMetaData map[string]interface{}, token string
 	return
 }
 
-func BuscarMetaData(campos map[string]interface{}, token string) (retorno map[string]interface{}) {
+// BuscarMetaData Busca a meta data do ficheiro que corresponde aos campos fornecidos
+func (servico *Servico) BuscarMetaData(campos map[string]interface{}, token string) (retorno map[string]interface{}) {
 	retorno = make(map[string]interface{})
 
-	// if endpointfuncs.VerificarTokenUser(token) != "OK" {
-	// 	loggers.OperacoesBDLogger.Println("Erro: A token fornecida é inválida ou expirou")
-	// 	retorno["erro"] = "A token fornecida é inválida ou expirou"
-	// 	return
-	// }
-
 	// Busca a meta data que corresponde aos campos dados
 	// De um só registo
-	metaData := GetMetaDataFicheiro(campos)
+	metaData := servico.GetMetaDataFicheiro(campos)
 	if reflect.ValueOf(metaData).IsZero() {
-		loggers.ServerErrorLogger.Println("Erro: Sem meta data para esse ficheiro")
+		servico.LoggerErros.Println("Erro: Sem meta data para esse ficheiro")
 		retorno["erro"] = "Sem meta data para esse ficheiro"
 		return
 	}
@@ -112,62 +106,65 @@ func BuscarMetaData(campos map[string]interface{}, token string) (retorno map[st
 }
 
 // ApagarFicheiroMetaData Apaga a meta data referente a um ficheiro
-func ApagarFicheiroMetaData(campos map[string]interface{}, token string) (retorno map[string]interface{}) {
+func (servico *Servico) ApagarFicheiroMetaData(ctx context.Context, campos map[string]interface{}, token string) (retorno map[string]interface{}) {
 	retorno = make(map[string]interface{})
 
-	// Verificação de igualdade entre request user, e file autor
-	// if endpointfuncs.VerificarTokenUserSpecif(token, campos["autor"].(string)) != "OK" || endpointfuncs.VerificarTokenAdmin(token) != "OK" {
-	// 	loggers.ServerErrorLogger.Println("Erro: Este utilizador não têm permissões para esta operação, ou token expirada")
-	// 	retorno["erro"] = "Este utilizador não têm permissões para esta operação, ou token expirada"
-	// 	return
-	// }
+	// Verificação de igualdade entre request user, e file autor (ou um admin)
+	autor, _ := campos["autor"].(string)
+	if _, err := servico.Autorizacao.Exigir(token, autorizacao.DonoOuAdmin(autor)); err != nil {
+		servico.LoggerErros.Println("Erro: Este utilizador não têm permissões para esta operação, ou token expirada")
+		retorno["erro"] = autorizacao.SemPermissoes("Este utilizador não têm permissões para esta operação, ou token expirada")
+		return
+	}
 
 	// Cria a hash dos campos fornecidos para procurar a meta data respetiva
 	metaHash, err := CriarMetaHash(campos)
 	if err != nil {
-		loggers.ServerErrorLogger.Println("Erro ao criar hash para meta data: ", err)
+		servico.LoggerErros.Println("Erro ao criar hash para meta data: ", err)
 		retorno["erro"] = "Erro ao criar hash para meta data fornecida"
 		return
 	}
 
 	// Busca a meta data que corresponde aos campos dados, de um só registo
-	ficheiroMetaData := GetMetaDataFicheiro(campos)
+	ficheiroMetaData := servico.GetMetaDataFicheiro(campos)
 	if reflect.ValueOf(ficheiroMetaData).IsZero() {
-		loggers.ServerErrorLogger.Println("Erro: Sem meta data para esse ficheiro")
+		servico.LoggerErros.Println("Erro: Sem meta data para esse ficheiro")
 		retorno["erro"] = "Sem meta data para esse ficheiro"
 		return
 	}
 
 	// Apaga o ficheiro de local storage
+	_, terminar := rastreio.Operacao(ctx, "apagar ficheiro de storage", attribute.String("repo", ficheiroMetaData.RepoNome), attribute.String("ficheiro", ficheiroMetaData.Nome))
 	err = reposfiles.ApagarFicheiro_repo(&ficheiroMetaData)
+	terminar(err)
 	if err != nil {
-		loggers.ServerErrorLogger.Println("Erro: Sem meta data para esse ficheiro para podêlo apagar do repo")
+		servico.LoggerErros.Println("Erro: Sem meta data para esse ficheiro para podêlo apagar do repo")
 		retorno["erro"] = "Sem meta data para esse ficheiro para podêlo apagar do repo"
 		return
 	}
 
 	// Apaga o ficheiro que contêm o campo "hash" igual ao fornecido
 	// Na bd da meta data
-	err = ApagarMetaDataFicheiro(metaHash)
+	err = servico.ApagarMetaDataFicheiro(metaHash)
 	if err != nil {
-		loggers.ServerErrorLogger.Println("Erro: Não foi possivél apagar este ficheiro: ", err)
+		servico.LoggerErros.Println("Erro: Não foi possivél apagar este ficheiro: ", err)
 		retorno["erro"] = "Não foi possivél apagar este ficheiro"
 		return
 	}
 
 	// Apaga o ficheiro que contêm o campo "hash" igual ao fornecido, no repositório indicado no mongoDB
-	err = ApagarFicheiroMetaRepo(metaHash, campos["autor"].(string))
+	err = servico.ApagarFicheiroMetaRepo(metaHash, campos["autor"].(string))
 	if err != nil {
-		loggers.ServerErrorLogger.Println("Não foi possivél apagar um ficheiro devido ao erro: ", err)
+		servico.LoggerErros.Println("Não foi possivél apagar um ficheiro devido ao erro: ", err)
 		retorno["erro"] = "Não foi possivél apagar este ficheiro"
 		return
 	}
 
 	// Remove o ficheiro das contribuições do user no sistema user-info
-	err = ModificarContrbFileInRepoUsrInfo("rmv", campos["autor"].(string), campos["reponome"].(string), campos["nome"].(string), token)
+	err = servico.ModificarContrbFileInRepoUsrInfo(ctx, "rmv", campos["autor"].(string), campos["reponome"].(string), campos["nome"].(string), token)
 	if err != nil {
-		loggers.ServerErrorLogger.Println("Erro: ", err)
-		retorno["erro"] = err
+		servico.LoggerErros.Println("Erro: ", err)
+		retorno["erro"] = err.Error()
 		return
 	}
 
@@ -175,19 +172,13 @@ func ApagarFicheiroMetaData(campos map[string]interface{}, token string) (retorn
 	return
 }
 
-func InserirConteudoFicheiro(contntMeta map[string]interface{}, token string) (retorno map[string]interface{}) {
+// InserirConteudoFicheiro Escreve o conteúdo no ficheiro, depois de verificar a hash do conteúdo, e adiciona o ficheiro às contribuições do user
+func (servico *Servico) InserirConteudoFicheiro(contntMeta map[string]interface{}, token string) (retorno map[string]interface{}) {
 	retorno = make(map[string]interface{})
 
-	// Verificação de igualdade entre request user, e file autor
-	if endpointfuncs.VerificarTokenUser(token) != "OK" {
-		loggers.ServerErrorLogger.Println("Erro: Este utilizador não têm permissões para esta operação, ou token expirada")
-		retorno["erro"] = "Este utilizador não têm permissões para esta operação, ou token expirada"
-		return
-	}
-
 	ficheiroStruct := resolvedschema.FicheiroConteudoParaStruct(&contntMeta)
 	if ficheiroStruct.Nome != ficheiroStruct.Path[len(ficheiroStruct.Path)-1] {
-		loggers.ServerErrorLogger.Println("Erro: o nome do ficheiro não corresponde ao nome no path")
+		servico.LoggerErros.Println("Erro: o nome do ficheiro não corresponde ao nome no path")
 		retorno["erro"] = "O nome do ficheiro não corresponde ao nome no path"
 		return
 	}
@@ -195,24 +186,28 @@ func InserirConteudoFicheiro(contntMeta map[string]interface{}, token string) (r
 	// Verificação da check sum do ficheiro
 	err := ConteudoRecebidoCheckSum(&ficheiroStruct)
 	if err != nil {
-		loggers.ServerErrorLogger.Println("Erro: ", err.Error())
+		servico.LoggerErros.Println("Erro: ", err.Error())
 		retorno["erro"] = err.Error()
 		return
 	}
 
 	// Get user from token, para evitar registo que includam o user
-	tokenClaims := endpointfuncs.DevolveTokenClaims(token)
-	usr := reflect.ValueOf(tokenClaims["user"]).String()
+	claims, err := servico.Autorizacao.Acesso(token)
+	if err != nil {
+		servico.LoggerErros.Println("Erro: ", err)
+		retorno["erro"] = err
+		return
+	}
 
-	if err := AdicionarContribuicaoRepo(&ficheiroStruct, usr); err != nil {
-		loggers.ServerErrorLogger.Println("Erro: ", err.Error())
+	if err := servico.AdicionarContribuicaoRepo(&ficheiroStruct, claims.User); err != nil {
+		servico.LoggerErros.Println("Erro: ", err.Error())
 		retorno["erro"] = err.Error()
 		return
 	}
 
 	// Inserção do conteudo de ficheiro recebido, no ficheiro pré-criado correspondente
 	if err := reposfiles.AdicionarConteudoFicheiro_file(&ficheiroStruct); err != nil {
-		loggers.ServerErrorLogger.Println("Erro: ", err.Error())
+		servico.LoggerErros.Println("Erro: ", err.Error())
 		retorno["erro"] = err.Error()
 		return
 	}
@@ -223,20 +218,14 @@ func InserirConteudoFicheiro(contntMeta map[string]interface{}, token string) (r
 }
 
 // BuscarConteudoFicheiro Busca um ficheiro lê o seu conteudo e devolve oa user
-func BuscarConteudoFicheiro(campos map[string]interface{}, token string) (retorno map[string]interface{}) {
+func (servico *Servico) BuscarConteudoFicheiro(campos map[string]interface{}, token string) (retorno map[string]interface{}) {
 	retorno = make(map[string]interface{})
 	var err error
 
-	// if endpointfuncs.VerificarTokenUser(token) != "OK" {
-	// 	loggers.OperacoesBDLogger.Println("Erro: A token fornecida é inválida ou expirou")
-	// 	retorno["erro"] = "A token fornecida é inválida ou expirou"
-	// 	return
-	// }
-
 	// Converte o query para um ficheiro meta info
 	ficheiroContMeta := resolvedschema.FicheiroMetaDataParaStruct(&campos)
 	if !reflect.ValueOf(ficheiroContMeta).IsValid() {
-		loggers.ServerErrorLogger.Println("Erro: Não foi possível converter o query para o ficheiro, numa struct")
+		servico.LoggerErros.Println("Erro: Não foi possível converter o query para o ficheiro, numa struct")
 		retorno["erro"] = "Não fomos capazaes de concluir o request"
 		return
 	}
@@ -244,7 +233,7 @@ func BuscarConteudoFicheiro(campos map[string]interface{}, token string) (retorn
 	// Coloca o conteudo, hash, etc, na response
 	retorno["conteudo"], err = reposfiles.GetConteudoFicheiro_file(&ficheiroContMeta)
 	if err != nil {
-		loggers.ServerErrorLogger.Println("Erro: Não foi possível ler o ficheiro: ", err)
+		servico.LoggerErros.Println("Erro: Não foi possível ler o ficheiro: ", err)
 		retorno["erro"] = "Não fomos capazaes de concluir o request " + err.Error()
 		return
 	}
@@ -254,15 +243,10 @@ func BuscarConteudoFicheiro(campos map[string]interface{}, token string) (retorn
 	return
 }
 
-func VerificarFicheiroExiste(params map[string]interface{}, token string) (retorno map[string]interface{}) {
+// VerificarFicheiroExiste Verifica se o ficheiro especificado pelos campos fornecidos existe no repo
+func (servico *Servico) VerificarFicheiroExiste(params map[string]interface{}, token string) (retorno map[string]interface{}) {
 	retorno = make(map[string]interface{})
 
-	// if endpointfuncs.VerificarTokenUser(token) != "OK" {
-	// 	loggers.OperacoesBDLogger.Println("Erro: A token fornecida é inválida ou expirou")
-	// 	retorno["erro"] = "A token fornecida é inválida ou expirou"
-	// 	return
-	// }
-
 	file := resolvedschema.FicheiroMetaDataParaStruct(&params)
 	if !(reflect.ValueOf(file).IsValid()) {
 		loggers.DocsStorage.Println("Erro: Erro ao converter o path fornecido para meta info")
@@ -0,0 +1,18 @@
+package ficheiros
+
+import (
+	"github.com/tomascpmarques/PAP/backend/robinservicodocumentacao/endpointfuncs"
+	"github.com/tomascpmarques/PAP/backend/robinservicodocumentacao/endpointfuncs/repos"
+)
+
+// Servico Actions dos ficheiros, com as dependências partilhadas do serviço
+// e os repositórios, onde são verificados os autores
+type Servico struct {
+	*endpointfuncs.Servico
+	repos *repos.Servico
+}
+
+// NovoServico Cria as actions dos ficheiros com as dependências dadas
+func NovoServico(base *endpointfuncs.Servico, repositorios *repos.Servico) *Servico {
+	return &Servico{Servico: base, repos: repositorios}
+}
@@ -7,26 +7,22 @@ import (
 	"strings"
 	"time"
 
-	"github.com/tomascpmarques/PAP/backend/robinservicodocumentacao/endpointfuncs"
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/autorizacao"
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/rastreio"
 	"github.com/tomascpmarques/PAP/backend/robinservicodocumentacao/endpointfuncs/reposfiles"
 	"github.com/tomascpmarques/PAP/backend/robinservicodocumentacao/loggers"
 	"github.com/tomascpmarques/PAP/backend/robinservicodocumentacao/mongodbhandle"
 	"github.com/tomascpmarques/PAP/backend/robinservicodocumentacao/resolvedschema"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // CriarRepositorio Cria um repo para guardar a informação relativa a um tema e/ou tarefa
-func CriarRepositorio(repoInfo map[string]interface{}, token string) (retorno map[string]interface{}) {
+func (servico *Servico) CriarRepositorio(ctx context.Context, repoInfo map[string]interface{}, token string) (retorno map[string]interface{}) {
 	retorno = make(map[string]interface{})
 
-	if endpointfuncs.VerificarTokenUser(token) != "OK" {
-		loggers.OperacoesBDLogger.Println("Erro: A token fornecida é inválida ou expirou")
-		retorno["erro"] = "A token fornecida é inválida ou expirou"
-		return retorno
-	}
-
 	// Get the mongo colection
-	operacoesColl := endpointfuncs.MongoClient.Database("documentacao").Collection("repos")
+	operacoesColl := servico.Mongo.Database("documentacao").Collection("repos")
 
 	// Verifica se a info base é enviada pela front-end de uma maneira correta
 	if err := VerificarInfoBaseRepo(repoInfo); err != nil {
@@ -41,7 +37,7 @@ func CriarRepositorio(repoInfo map[string]interface{}, token string) (retorno ma
 	repo.Nome = strings.Trim(repo.Nome, ` .,-:;\|!"#$%&/()=£§{[]}'?«»<>`)
 
 	// Verifica se o repo que queremos inserir, já existe ou não
-	if repoExiste := GetRepoPorCampo("nome", repo.Nome); !(reflect.ValueOf(repoExiste).IsZero()) {
+	if repoExiste := servico.GetRepoPorCampo("nome", repo.Nome); !(reflect.ValueOf(repoExiste).IsZero()) {
 		loggers.DbFuncsLogger.Println("Não foi possivél criar o repositório pedido: ", repo.Nome, ".Já existe um com esse nome")
 		retorno["erro"] = ("Não foi possivél criar o repositório pedido, devido ao nome ser igual a um existente")
 		return
@@ -59,13 +55,17 @@ func CriarRepositorio(repoInfo map[string]interface{}, token string) (retorno ma
 	}
 
 	// Adiciona o repo às contribuições no perfíl do user, na sua lista de contribuições
-	if AdicionarContrbRepoUsrInfo(&repo, token) != nil {
+	if servico.AdicionarContrbRepoUsrInfo(ctx, &repo, token) != nil {
 		loggers.DbFuncsLogger.Println("Não foi possivél inserir o repo na user-info")
 		retorno["erro"] = ("Não foi possivél inserir o repo na user-info")
 		return
 	}
 
-	if err := reposfiles.CriarRepositorio_repo(&repo); err != nil {
+	// A criação das pastas do repo fica num span próprio, dentro do span da action
+	_, terminar := rastreio.Operacao(ctx, "criar repo em storage", attribute.String("repo", repo.Nome))
+	err = reposfiles.CriarRepositorio_repo(&repo)
+	terminar(err)
+	if err != nil {
 		loggers.DbFuncsLogger.Println("Não foi possivél criar o repo em storage: ", err)
 		retorno["erro"] = ("Não foi possivél criar o repo em storage")
 		return
@@ -77,18 +77,12 @@ func CriarRepositorio(repoInfo map[string]interface{}, token string) (retorno ma
 }
 
 // BuscarRepositorio Busca um repositório existente, e devolve a sua estrutura/conteúdos
-func BuscarRepositorio(campos map[string]interface{}, token string) (retorno map[string]interface{}) {
+func (servico *Servico) BuscarRepositorio(campos map[string]interface{}, token string) (retorno map[string]interface{}) {
 	retorno = make(map[string]interface{})
 	//fmt.Println("AND NOW THE TIME: ", time.Now().Local().Format("2006/01/02 15:04:05"))
 
-	if endpointfuncs.VerificarTokenUser(token) != "OK" {
-		loggers.OperacoesBDLogger.Println("Erro: A token fornecida é inválida ou expirou")
-		retorno["erro"] = "A token fornecida é inválida ou expirou"
-		return retorno
-	}
-
 	// Busca o repositório por um campo especifico, e o valor esperado nesse campo
-	repositorio := GetRepoPorCampo("nome", campos["nome"].(string))
+	repositorio := servico.GetRepoPorCampo("nome", campos["nome"].(string))
 
 	// Se o resultado da busca for nil, devolve umas menssagens de erro
 	if reflect.ValueOf(repositorio).IsZero() {
@@ -103,18 +97,12 @@ func BuscarRepositorio(campos map[string]interface{}, token string) (retorno map
 }
 
 // DropRepositorio Busca o repo especificado pelos campos passados (o nome é obrigatorio), e apaga o mesmo, se esse pedido for feito pelo autor do repo
-func DropRepositorio(campos map[string]interface{}, token string) (retorno map[string]interface{}) {
+func (servico *Servico) DropRepositorio(ctx context.Context, campos map[string]interface{}, token string) (retorno map[string]interface{}) {
 	retorno = make(map[string]interface{})
 
-	if endpointfuncs.VerificarTokenUser(token) != "OK" {
-		loggers.ServerErrorLogger.Println("Erro: A token fornecida é inválida ou expirou")
-		retorno["erro"] = "A token fornecida é inválida ou expirou"
-		return
-	}
-
 	fmt.Println(campos)
 	// Busca o repositório para se poder comparar o autor com o user que fez o pedido
-	repositorio := GetRepoPorCampo("nome", campos["nome"].(string))
+	repositorio := servico.GetRepoPorCampo("nome", campos["nome"].(string))
 	// Se o resultado da busca for nil, devolve umas menssagens de erro
 	if reflect.ValueOf(repositorio).IsZero() {
 		loggers.OperacoesBDLogger.Println("Não foi possivél encontrar o repositório pedido")
@@ -122,36 +110,39 @@ func DropRepositorio(campos map[string]interface{}, token string) (retorno map[s
 		return
 	}
 
-	// Verificação de igualdade entre request user, e repo autor
-	if endpointfuncs.VerificarTokenUserSpecif(token, repositorio.Autor) != "OK" {
-		loggers.ServerErrorLogger.Println("Erro: Este utilizador não têm permissões para esta operação")
-		retorno["erro"] = "Este utilizador não têm permissões para esta operação"
+	// Verificação de igualdade entre request user, e repo autor (ou um admin)
+	if _, err := servico.Autorizacao.Exigir(token, autorizacao.DonoOuAdmin(repositorio.Autor)); err != nil {
+		servico.LoggerErros.Println("Erro: Este utilizador não têm permissões para esta operação")
+		retorno["erro"] = autorizacao.SemPermissoes("Este utilizador não têm permissões para esta operação")
 		return
 	}
 
 	// Drop do repo pedido
-	if err := DropRepoPorNome(campos["nome"].(string)); err != nil {
-		loggers.ServerErrorLogger.Println("Erro: Este utilizador não têm permissões para esta operação")
+	if err := servico.DropRepoPorNome(campos["nome"].(string)); err != nil {
+		servico.LoggerErros.Println("Erro: Este utilizador não têm permissões para esta operação")
 		retorno["erro"] = "Este utilizador não têm permissões para esta operação"
 		return
 	}
 
 	// Apaga todos os ficheiros meta que estejam ligados a este repo
-	if err := RepoDropFicheirosMeta(campos["nome"].(string)); err != nil {
-		loggers.ServerErrorLogger.Println("Erro: Ou o repo não tinha ficheiros ou ouve complicações para apagar esses ficheiros")
+	if err := servico.RepoDropFicheirosMeta(campos["nome"].(string)); err != nil {
+		servico.LoggerErros.Println("Erro: Ou o repo não tinha ficheiros ou ouve complicações para apagar esses ficheiros")
 		retorno["erro"] = "Ou o repo não tinha ficheiros ou ouve complicações para apagar esses ficheiros"
 		return
 	}
 
 	// Remove o repo das contrbuições do user, no sistema do user-info
-	if err := RemoverContrbRepoUsrInfo(&repositorio, token); err != nil {
-		loggers.ServerErrorLogger.Println("Erro: ", err)
+	if err := servico.RemoverContrbRepoUsrInfo(ctx, &repositorio, token); err != nil {
+		servico.LoggerErros.Println("Erro: ", err)
 		retorno["erro"] = "Erro ao tentar apagar a informação de repositorios por completo"
 		return
 	}
 
-	if err := reposfiles.ApagarRepositorio_repo(&repositorio); err != nil {
-		loggers.ServerErrorLogger.Println("Erro: ", err)
+	_, terminar := rastreio.Operacao(ctx, "apagar repo de storage", attribute.String("repo", repositorio.Nome))
+	err := reposfiles.ApagarRepositorio_repo(&repositorio)
+	terminar(err)
+	if err != nil {
+		servico.LoggerErros.Println("Erro: ", err)
 		retorno["erro"] = "Erro ao tentar apagar o repo de storage"
 		return
 	}
@@ -161,17 +152,11 @@ func DropRepositorio(campos map[string]interface{}, token string) (retorno map[s
 	return
 }
 
-func UpdateRepositorio(campos map[string]interface{}, updateQuery map[string]interface{}, token string) (retorno map[string]interface{}) {
+func (servico *Servico) UpdateRepositorio(campos map[string]interface{}, updateQuery map[string]interface{}, token string) (retorno map[string]interface{}) {
 	retorno = make(map[string]interface{})
 
-	// if endpointfuncs.VerificarTokenUser(token) != "OK" {
-	// 	loggers.ServerErrorLogger.Println("Erro: A token fornecida é inválida ou expirou")
-	// 	retorno["erro"] = "A token fornecida é inválida ou expirou"
-	// 	return
-	// }
-
 	// Busca o repositório para se poder comparar o autor com o user que fez o pedido
-	repositorio := GetRepoPorCampo("nome", campos["nome"].(string))
+	repositorio := servico.GetRepoPorCampo("nome", campos["nome"].(string))
 	// Se o resultado da busca for nil, devolve umas menssagens de erro
 	if reflect.ValueOf(repositorio).IsZero() {
 		loggers.OperacoesBDLogger.Println("Não foi possivél encontrar o repositório pedido")
@@ -179,17 +164,17 @@ func UpdateRepositorio(campos map[string]interface{}, updateQuery map[string]int
 		return
 	}
 
-	// Verificação de igualdade entre request user, e repo autor
-	// if endpointfuncs.VerificarTokenUserSpecif(token, repositorio.Autor) != "OK" {
-	// 	loggers.ServerErrorLogger.Println("Erro: Este utilizador não têm permissões para esta operação")
-	// 	retorno["erro"] = "Este utilizador não têm permissões para esta operação"
-	// 	return
-	// }
+	// Verificação de igualdade entre request user, e repo autor (ou um admin)
+	if _, err := servico.Autorizacao.Exigir(token, autorizacao.DonoOuAdmin(repositorio.Autor)); err != nil {
+		servico.LoggerErros.Println("Erro: Este utilizador não têm permissões para esta operação")
+		retorno["erro"] = autorizacao.SemPermissoes("Este utilizador não têm permissões para esta operação")
+		return
+	}
 
 	// Atualiza a informação do repositório com as informações passadas nos paramêtros da func
-	atualizacoes := UpdateRepositorioPorNome(campos["nome"].(string), bson.M{"$set": updateQuery}) // i.e: {"$set":{"autor": "efefef"}},
+	atualizacoes := servico.UpdateRepositorioPorNome(campos["nome"].(string), bson.M{"$set": updateQuery}) // i.e: {"$set":{"autor": "efefef"}},
 	if atualizacoes == nil {
-		loggers.ServerErrorLogger.Println("Erro ao atualizar os valores pedidos")
+		servico.LoggerErros.Println("Erro ao atualizar os valores pedidos")
 		retorno["erro"] = "Erro ao atualizar os valores pedidos"
 		return
 	}
@@ -199,19 +184,13 @@ func UpdateRepositorio(campos map[string]interface{}, updateQuery map[string]int
 }
 
 // BuscarUserRepos Busca todos os repos que o user, criou ou fez contribuições
-func BuscarUserRepos(nomeUsr string, token string) (retorno map[string]interface{}) {
+func (servico *Servico) BuscarUserRepos(nomeUsr string, token string) (retorno map[string]interface{}) {
 	retorno = make(map[string]interface{})
 
-	// if endpointfuncs.VerificarTokenUser(token) != "OK" {
-	// 	loggers.ServerErrorLogger.Println("Erro: A token fornecida é inválida ou expirou")
-	// 	retorno["erro"] = "A token fornecida é inválida ou expirou"
-	// 	return
-	// }
-
 	// Busca todos os repositórios em que o user é autor
-	repos, err := BuscarReposPorUserNome(nomeUsr)
+	repos, err := servico.BuscarReposPorUserNome(nomeUsr)
 	if err != nil {
-		loggers.ServerErrorLogger.Println("Erro: ", err)
+		servico.LoggerErros.Println("Erro: ", err)
 		retorno["erro"] = err.Error()
 		return
 	}
@@ -229,29 +208,27 @@ func BuscarUserRepos(nomeUsr string, token string) (retorno map[string]interface
 }
 
 // BuscarTodosOsReposNotTokenUsr Retorna todos os repos existentes na BD
-func BuscarTodosOsReposNotTokenUsr(token string) (retorno map[string]interface{}) {
+func (servico *Servico) BuscarTodosOsReposNotTokenUsr(token string) (retorno map[string]interface{}) {
 	retorno = make(map[string]interface{})
 
-	// Verifica se o user está logado
-	if endpointfuncs.VerificarTokenUser(token) != "OK" {
-		loggers.ServerErrorLogger.Println("Erro: A token fornecida é inválida ou expirou")
-		retorno["erro"] = "A token fornecida é inválida ou expirou"
+	// Get user from token, para evitar registo que includam o user
+	claims, err := servico.Autorizacao.Acesso(token)
+	if err != nil {
+		servico.LoggerErros.Println("Erro: ", err)
+		retorno["erro"] = err
 		return
 	}
-
-	// Get user from token, para evitar registo que includam o user
-	tokenClaims := endpointfuncs.DevolveTokenClaims(token)
-	usr := reflect.ValueOf(tokenClaims["user"]).String()
+	usr := claims.User
 
 	// Documento e repo onde procurar o repo
-	collection := endpointfuncs.MongoClient.Database("documentacao").Collection("repos")
+	collection := servico.Mongo.Database("documentacao").Collection("repos")
 	cntx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 
 	// Procura todos os registos que não sejam de autoria do user fornecido na token
 	results, err := collection.Find(cntx, bson.M{"autor": bson.M{"$ne": usr}})
 	defer cancel()
 	if err != nil {
-		loggers.ServerErrorLogger.Println("Erro: ", err)
+		servico.LoggerErros.Println("Erro: ", err)
 		retorno["erro"] = err.Error()
 		return
 	}
@@ -261,7 +238,7 @@ func BuscarTodosOsReposNotTokenUsr(token string) (retorno map[string]interface{}
 	err = results.All(cntx, &reposStruct)
 	defer cancel()
 	if err != nil {
-		loggers.ServerErrorLogger.Println("Erro: ", err)
+		servico.LoggerErros.Println("Erro: ", err)
 		retorno["erro"] = err.Error()
 		return
 	}
@@ -1,17 +1,14 @@
 package repos
 
 import (
-	"bytes"
 	"context"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"log"
-	"net/http"
 	"reflect"
 	"time"
 
-	"github.com/tomascpmarques/PAP/backend/robinservicodocumentacao/endpointfuncs"
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/clientes/userinfo"
 	"github.com/tomascpmarques/PAP/backend/robinservicodocumentacao/loggers"
 	"github.com/tomascpmarques/PAP/backend/robinservicodocumentacao/resolvedschema"
 	"go.mongodb.org/mongo-driver/bson"
@@ -21,9 +18,9 @@ import (
 
 // GetRepoPorCampo Busca um repo e devolveo na struct resolvedschema.Repositorio
 // Busca o repositório através de um campo e valor do mesmo, especificado na sua chamada
-func GetRepoPorCampo(campo string, valor interface{}) (repo resolvedschema.Repositorio) {
+func (servico *Servico) GetRepoPorCampo(campo string, valor interface{}) (repo resolvedschema.Repositorio) {
 	// Documento e repo onde procurar o repo
-	collection := endpointfuncs.MongoClient.Database("documentacao").Collection("repos")
+	collection := servico.Mongo.Database("documentacao").Collection("repos")
 	cntx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 
 	// Procura na BD do registo pedido
@@ -41,11 +38,11 @@ func GetRepoPorCampo(campo string, valor interface{}) (repo resolvedschema.Repos
 }
 
 // DropRepoPorNome Larga um repositorio pelo seu nome
-func DropRepoPorNome(repoNome string) (erro error) {
+func (servico *Servico) DropRepoPorNome(repoNome string) (erro error) {
 	// Define o filtro a usar na procura de informação na BD
 	filter := bson.M{"nome": repoNome}
 	// Documento e repo onde procurar o repo
-	collection := endpointfuncs.MongoClient.Database("documentacao").Collection("repos")
+	collection := servico.Mongo.Database("documentacao").Collection("repos")
 	cntx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 
 	// Depois de apagar o registo, a var err,
@@ -57,8 +54,8 @@ func DropRepoPorNome(repoNome string) (erro error) {
 }
 
 // RepoDropFicheirosMeta Apaga todos os ficheiros dentro do repo com o nome especificado em repoNome
-func RepoDropFicheirosMeta(repoNome string) error {
-	collection := endpointfuncs.MongoClient.Database("documentacao").Collection("files-meta-data")
+func (servico *Servico) RepoDropFicheirosMeta(repoNome string) error {
+	collection := servico.Mongo.Database("documentacao").Collection("files-meta-data")
 	cntx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 
 	// Apaga toda a meta info dos ficheiros existentes, que sejam do repo especificado
@@ -71,12 +68,12 @@ func RepoDropFicheirosMeta(repoNome string) error {
 }
 
 // UpdateRepositorioPorNome Atualiza as informações do repositório especificado pelo nome passado nos params
-func UpdateRepositorioPorNome(repoName string, mundancas map[string]interface{}) *mongo.UpdateResult {
+func (servico *Servico) UpdateRepositorioPorNome(repoName string, mundancas map[string]interface{}) *mongo.UpdateResult {
 	// Set-up do filtro
 	filter := bson.M{"nome": repoName}
 
 	// Get collection
-	coll := endpointfuncs.MongoClient.Database("documentacao").Collection("repos")
+	coll := servico.Mongo.Database("documentacao").Collection("repos")
 	cntx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 
 	// Atualiza o item através do map especificado nos params
@@ -123,100 +120,47 @@ func VerificarInfoBaseRepo(info map[string]interface{}) (err error) {
 }
 
 // Adiciona o repo no serviço user-info, após criação neste serviço
-func AdicionarContrbRepoUsrInfo(repo *resolvedschema.Repositorio, token string) error {
-	// Mongodb query para atualizar o status do user
-	adicionarQuery := fmt.Sprintf("\"%s\",\n\"%s\",\n\"%s\",", repo.Autor, repo.Nome, token)
-	// DynamicGoQuery body para conssumir o endpoint do serviço userinfo
-	action := fmt.Sprintf("action:\nfuncs:\n\"AdicionarContrbRepo\":\n%s", adicionarQuery)
-
-	// Utilização do endpoint UpdateInfoUtilizador, exposto em http://0.0.0.0:8001
-	resp, err := http.Post("http://0.0.0.0:8001", "text/plain", bytes.NewBufferString(action))
+func (servico *Servico) AdicionarContrbRepoUsrInfo(ctx context.Context, repo *resolvedschema.Repositorio, token string) error {
+	// As contribuições são alteradas com a token de serviço, se estiver configurada
+	token, err := servico.TokenUserinfo(token)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
-	bodyContentBytes, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return err
-	}
-
-	loggers.ResolverLogger.Printf("AdicionarContrbRepo status: %v", string(bodyContentBytes))
-	return nil
+	return servico.Userinfo.AdicionarContrbRepo(ctx, repo.Autor, repo.Nome, token)
 }
 
 // RemoverContrbRepoFileUsrInfo Remove o ficheiro especificado do repo em que ele existe, no sistema da user-info
-func RemoverContrbRepoFileUsrInfo(repo *resolvedschema.Repositorio, token string) error {
-	// Mongodb query para atualizar o status do user
-	rmvQueryoptions := fmt.Sprintf(`{"user": %s,"repo": %s, "file": %s}`, repo.Autor, repo.Nome, token)
-	adicionarQuery := fmt.Sprintf("\"%s\",%s,\"%s\",\n", "rmv", rmvQueryoptions, token)
-	// DynamicGoQuery body para conssumir o endpoint do serviço userinfo
-	action := fmt.Sprintf("action:\nfuncs:\n\"ModificarContribuicoes\":\n%s", adicionarQuery)
-
-	// Utilização do endpoint UpdateInfoUtilizador, exposto em http://0.0.0.0:8001
-	resp, err := http.Post("http://0.0.0.0:8001", "text/plain", bytes.NewBufferString(action))
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-	bodyContentBytes, err := ioutil.ReadAll(resp.Body)
+func (servico *Servico) RemoverContrbRepoFileUsrInfo(ctx context.Context, repo *resolvedschema.Repositorio, ficheiro string, token string) error {
+	token, err := servico.TokenUserinfo(token)
 	if err != nil {
 		return err
 	}
-
-	loggers.ResolverLogger.Printf("ModificarContribuicoes status: %v", string(bodyContentBytes))
-	return nil
+	contribuicao := userinfo.Contribuicao{User: repo.Autor, Repo: repo.Nome, File: ficheiro}
+	return servico.Userinfo.ModificarContribuicoes(ctx, userinfo.OperacaoRemover, contribuicao, token)
 }
 
 // RemoverContrbRepoUsrInfo Remove o repo especificado do user-progile no sistema da user-info
-func RemoverContrbRepoUsrInfo(repo *resolvedschema.Repositorio, token string) error {
-	// Mongodb query para atualizar o status do user
-	rmvQueryoptions := fmt.Sprintf(`{"user":"%s","repo": "%s"}`, repo.Autor, repo.Nome)
-	adicionarQuery := fmt.Sprintf("%s,\n\"%s\",", rmvQueryoptions, token)
-	// DynamicGoQuery body para conssumir o endpoint do serviço userinfo
-	action := fmt.Sprintf("action:\nfuncs:\n\"RemoverRepoContributo\":\n%s", adicionarQuery)
-
-	// Utilização do endpoint UpdateInfoUtilizador, exposto em http://0.0.0.0:8001
-	resp, err := http.Post("http://0.0.0.0:8001", "text/plain", bytes.NewBufferString(action))
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-	bodyContentBytes, err := ioutil.ReadAll(resp.Body)
+func (servico *Servico) RemoverContrbRepoUsrInfo(ctx context.Context, repo *resolvedschema.Repositorio, token string) error {
+	// As contribuições são alteradas com a token de serviço, se estiver configurada
+	token, err := servico.TokenUserinfo(token)
 	if err != nil {
 		return err
 	}
-
-	loggers.ResolverLogger.Printf("RemoverRepoContributo status: %v", string(bodyContentBytes))
-	return nil
+	return servico.Userinfo.RemoverRepoContributo(ctx, userinfo.Contribuicao{User: repo.Autor, Repo: repo.Nome}, token)
 }
 
-func MudarContrbRepoNomeUsrInfo(repoNome string, novoNomeRepo string, usrNome string, token string) error {
-	// Mongodb query para atualizar o status do user
-	queryAtualiza := fmt.Sprintf("{\"contribuicoes.reponome\": \"%s\"}", novoNomeRepo)
-	// DynamicGoQuery body para conssumir o endpoint do serviço userinfo
-	action := fmt.Sprintf("action:\nfuncs:\n\"UpdateInfoUtilizador\":\n%s,\n%s,", queryAtualiza, token)
-
-	// Utilização do endpoint UpdateInfoUtilizador, exposto em http://0.0.0.0:8001
-	resp, err := http.Post("http://0.0.0.0:8001", "text/plain", bytes.NewBufferString(action))
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-	bodyContentBytes, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return err
-	}
-
-	loggers.ResolverLogger.Printf("UpdateInfoUtilizador status: %v", string(bodyContentBytes))
-	return nil
+// MudarContrbRepoNomeUsrInfo Muda o nome do repo nas contribuições do user, no sistema da user-info
+func (servico *Servico) MudarContrbRepoNomeUsrInfo(ctx context.Context, repoNome string, novoNomeRepo string, usrNome string, token string) error {
+	_, err := servico.Userinfo.UpdateInfoUtilizador(ctx, usrNome, map[string]interface{}{"contribuicoes.reponome": novoNomeRepo}, token)
+	return err
 }
 
 // BuscarReposPorUserNome Busca todos os repositórios em que u autor dos mesmos, é igual ao especificádo nos params
-func BuscarReposPorUserNome(usrNome string) (resultados []map[string]interface{}, err error) {
+func (servico *Servico) BuscarReposPorUserNome(usrNome string) (resultados []map[string]interface{}, err error) {
 	resultados = make([]map[string]interface{}, 0)
 
 	// Coleção a pesquisar
-	colecao := endpointfuncs.MongoClient.Database("documentacao").Collection("repos")
+	colecao := servico.Mongo.Database("documentacao").Collection("repos")
 	cntx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 
 	// False value para o filter - maneira muito pimposa de escrever *false
@@ -0,0 +1,15 @@
+package repos
+
+import (
+	"github.com/tomascpmarques/PAP/backend/robinservicodocumentacao/endpointfuncs"
+)
+
+// Servico Actions dos repositórios, com as dependências partilhadas do serviço
+type Servico struct {
+	*endpointfuncs.Servico
+}
+
+// NovoServico Cria as actions dos repositórios com as dependências dadas
+func NovoServico(base *endpointfuncs.Servico) *Servico {
+	return &Servico{Servico: base}
+}
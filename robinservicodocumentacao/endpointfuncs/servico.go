@@ -0,0 +1,58 @@
+package endpointfuncs
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/autorizacao"
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/clientes"
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/clientes/userinfo"
+	"github.com/tomascpmarques/PAP/backend/robinservicodocumentacao/loggers"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Servico Dependências partilhadas pelas actions dos repos e dos ficheiros, criadas no main (ou nos testes)
+// com o NovoServico, os campos nil usam os valores default
+type Servico struct {
+	// Mongo conexão à instancia mongo
+	Mongo *mongo.Client
+	// Autorizacao Verificador das tokens emitidas pelo serviço de autenticação: as chaves de verificação
+	// são buscadas ao endpoint JWKS e a revogação ao endpoint de introspeção, configurados na secção auth
+	Autorizacao *autorizacao.Verificador
+	// CredenciaisServico Conta de serviço (secção servico, ex: DOC_SERVICO_CONTA e DOC_SERVICO_SEGREDO) usada para alterar
+	// as contribuições dos users no serviço userinfo, nil se não houver conta
+	CredenciaisServico *autorizacao.CredenciaisServico
+	// Userinfo cliente das actions do serviço userinfo
+	Userinfo *userinfo.Cliente
+	// LoggerErros Erros do serviço
+	LoggerErros *log.Logger
+}
+
+// NovoServico Completa as dependências em falta com os valores default
+func NovoServico(deps Servico) *Servico {
+	servico := &deps
+	if servico.Userinfo == nil {
+		config := ConfigDefault()
+		servico.Userinfo = userinfo.Novo(clientes.Novo(config.URLUserinfo, nil, config.Userinfo))
+	}
+	if servico.LoggerErros == nil {
+		servico.LoggerErros = loggers.ServerErrorLogger
+	}
+	return servico
+}
+
+// TokenUserinfo Devolve a token a usar nas chamadas ao serviço userinfo, a token de serviço,
+// ou a token do user se o serviço não tiver uma conta de serviço configurada
+func (servico *Servico) TokenUserinfo(tokenUser string) (string, error) {
+	if !servico.CredenciaisServico.Configuradas() {
+		return tokenUser, nil
+	}
+	return servico.CredenciaisServico.Token()
+}
+
+// PingServico responde que o serviço está online
+func (servico *Servico) PingServico(name string) (retorno map[string]interface{}) {
+	retorno = make(map[string]interface{})
+	retorno["status"] = fmt.Sprintf("Hello %s, I'm alive and OK", name)
+	return
+}
@@ -0,0 +1,69 @@
+// Code generated by esquemagen a partir das actions registadas. DO NOT EDIT.
+
+package main
+
+import "github.com/tomascpmarques/PAP/backend/robinpartilhado/esquema"
+
+// descricoesAcoes Descrição, parametros e keys do retorno de cada action registada, tiradas do código fonte
+var descricoesAcoes = map[string]esquema.Descricao{
+	"ApagarFicheiroMetaData": {
+		Descricao: "Apaga a meta data referente a um ficheiro",
+		Params:    []string{"campos", "token"},
+		Respostas: []string{"sucesso"},
+	},
+	"BuscarConteudoFicheiro": {
+		Descricao: "Busca um ficheiro lê o seu conteudo e devolve oa user",
+		Params:    []string{"campos", "token"},
+		Respostas: []string{"conteudo", "sucesso"},
+	},
+	"BuscarMetaData": {
+		Descricao: "Busca a meta data do ficheiro que corresponde aos campos fornecidos",
+		Params:    []string{"campos", "token"},
+		Respostas: []string{"meta_data"},
+	},
+	"BuscarRepositorio": {
+		Descricao: "Busca um repositório existente, e devolve a sua estrutura/conteúdos",
+		Params:    []string{"campos", "token"},
+		Respostas: []string{"repo"},
+	},
+	"BuscarTodosOsReposNotTokenUsr": {
+		Descricao: "Retorna todos os repos existentes na BD",
+		Params:    []string{"token"},
+		Respostas: []string{"repos"},
+	},
+	"BuscarUserRepos": {
+		Descricao: "Busca todos os repos que o user, criou ou fez contribuições",
+		Params:    []string{"nomeUsr", "token"},
+		Respostas: []string{"encontrados", "repos"},
+	},
+	"CriarFicheiroMetaData": {
+		Descricao: "Cria a meta data de um ficheiro, para prepara o upload de conteúdo",
+		Params:    []string{"ficheiroMetaData", "token"},
+		Respostas: []string{"sucesso"},
+	},
+	"CriarRepositorio": {
+		Descricao: "Cria um repo para guardar a informação relativa a um tema e/ou tarefa",
+		Params:    []string{"repoInfo", "token"},
+		Respostas: []string{"resultado"},
+	},
+	"DropRepositorio": {
+		Descricao: "Busca o repo especificado pelos campos passados (o nome é obrigatorio), e apaga o mesmo, se esse pedido for feito pelo autor do repo",
+		Params:    []string{"campos", "token"},
+		Respostas: []string{"ok"},
+	},
+	"InserirConteudoFicheiro": {
+		Descricao: "Escreve o conteúdo no ficheiro, depois de verificar a hash do conteúdo, e adiciona o ficheiro às contribuições do user",
+		Params:    []string{"contntMeta", "token"},
+		Respostas: []string{"sucesso"},
+	},
+	"Ping": {
+		Descricao: "responde que o serviço está online",
+		Params:    []string{"name"},
+		Respostas: []string{"status"},
+	},
+	"VerificarFicheiroExiste": {
+		Descricao: "Verifica se o ficheiro especificado pelos campos fornecidos existe no repo",
+		Params:    []string{"params", "token"},
+		Respostas: []string{"existe"},
+	},
+}
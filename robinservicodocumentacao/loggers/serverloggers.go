@@ -1,26 +1,31 @@
 package loggers
 
 import (
-	"log"
 	"os"
+
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/registos"
 )
 
+// Registador - registador estruturado do serviço, escreve as linhas em JSON no stdout, todas com o campo servico.
+// Os loggers abaixo escrevem através dele, cada um com o campo componente
+var Registador = registos.Novo(os.Stdout, registos.Info).Com("servico", "documentacao")
+
 // ResolverLogger - loger para os resolvers da schema GraphQL
-var ResolverLogger = log.New(os.Stdout, "UserInfo-Resolver.(*) ", log.LstdFlags)
+var ResolverLogger = Registador.Logger(registos.Info, "resolver")
 
 // RedisLogger - logger para o o tratamento e criação do cliente que liga ao serviço redis
-var RedisLogger = log.New(os.Stdout, "Redis-Setup......[*] ", log.LstdFlags)
+var RedisLogger = Registador.Logger(registos.Info, "redis")
 
 // DbFuncsLogger - logger para o handeling de funções relacionadas á bd
-var DbFuncsLogger = log.New(os.Stdout, "DBIndexing.......<*> ", log.LstdFlags)
+var DbFuncsLogger = Registador.Logger(registos.Info, "bd-indexacao")
 
 // OperacoesBDLogger - logger para as operações relacionadas á bd
-var OperacoesBDLogger = log.New(os.Stdout, "Operações-BD.....|*| ", log.LstdFlags)
+var OperacoesBDLogger = Registador.Logger(registos.Info, "operacoes-bd")
 
 // ServerErrorLogger - Logger para erros do servidor
-var ServerErrorLogger = log.New(os.Stdout, "Erro-Server-BD...|*| ", log.LstdFlags)
+var ServerErrorLogger = Registador.Logger(registos.Erro, "servidor")
 
 // MongoDBLogger - Logger para as operações com MongoDB
-var MongoDBLogger = log.New(os.Stdout, "MongoDB-Handler....{*}", log.LstdFlags)
+var MongoDBLogger = Registador.Logger(registos.Info, "mongodb")
 
-var DocsStorage = log.New(os.Stdout, "DocsStorage........{*}", log.LstdFlags)
+var DocsStorage = Registador.Logger(registos.Info, "armazenamento")
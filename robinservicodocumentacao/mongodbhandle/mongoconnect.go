@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/tomascpmarques/PAP/backend/robinservicodocumentacao/loggers"
+	"go.mongodb.org/mongo-driver/event"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
@@ -12,7 +13,8 @@ import (
 
 // MongoConexaoParams - Parametros base para uma conexão á mongo bd
 type MongoConexaoParams struct {
-	URI string
+	URI     string
+	Monitor *event.CommandMonitor // Recebe os comandos enviados ao mongo (ex: métricas), pode ser nil
 }
 
 // MongoCtxMaker -
@@ -34,7 +36,11 @@ func CriarConexaoMongoDB(params MongoConexaoParams) *mongo.Client {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 
 	// Liga à instância mongo apontada pelos parametros
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(params.URI))
+	opcoes := options.Client().ApplyURI(params.URI)
+	if params.Monitor != nil {
+		opcoes.SetMonitor(params.Monitor)
+	}
+	client, err := mongo.Connect(ctx, opcoes)
 	defer cancel()
 	if err != nil {
 		panic(err)
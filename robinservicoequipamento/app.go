@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/TomascpMarques/dynamic-querys-go/actions"
+	"github.com/gorilla/mux"
+	"github.com/rs/cors"
+	acoesdespacho "github.com/tomascpmarques/PAP/backend/robinpartilhado/acoes"
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/autorizacao"
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/ciclovida"
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/esquema"
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/metricas"
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/rastreio"
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/registos"
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/saude"
+	"github.com/tomascpmarques/PAP/backend/robinservicoequipamento/endpointfuncs"
+	"github.com/tomascpmarques/PAP/backend/robinservicoequipamento/loggers"
+	"github.com/tomascpmarques/PAP/backend/robinservicoequipamento/mongodbhandle"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// As descrições das actions no /esquema (esquemagerado.go) são geradas a partir das funções registadas em registarAcoes
+//go:generate go run github.com/tomascpmarques/PAP/backend/robinpartilhado/cmd/esquemagen
+
+// App Serviço de gestão de equipamento montado a partir da configuração: o cliente mongo, o Servico com as actions,
+// e o ciclo de vida do servidor http
+type App struct {
+	config   Config
+	mongo    *mongo.Client
+	metricas *metricas.Metricas
+	esquema  esquema.Esquema
+	servico  *endpointfuncs.Servico
+	ciclo    *ciclovida.CicloVida
+}
+
+// NovaApp Liga à instância mongo, prepara a verificação das tokens e cria o servidor http,
+// as actions ficam registadas no actions.FuncsStorage
+func NovaApp(config Config) *App {
+	loggers.Registador.DefinirNivel(config.Servidor.NivelLogs())
+	desligarRastreio, err := rastreio.Configurar("equipamento", config.Rastreio)
+	if err != nil {
+		loggers.ServerErrorLogger.Fatal("Erro Fatal: ", err)
+	}
+	app := &App{config: config, metricas: metricas.Novas("equipamento")}
+	app.mongo = mongodbhandle.CriarConexaoMongoDB(mongodbhandle.MongoConexaoParams{
+		URI:     config.Endpoints.Mongo.URI,
+		Monitor: mongodbhandle.MonitorRastreio(mongodbhandle.MonitorMetricas(app.metricas)),
+	})
+	app.servico = endpointfuncs.NovoServico(endpointfuncs.Dependencias{
+		Mongo:       app.mongo,
+		Autorizacao: config.Endpoints.Auth.Verificador(loggers.ServerErrorLogger, app.metricas.Transporte("auth", nil)),
+		LoggerErros: loggers.ServerErrorLogger,
+	})
+
+	app.registarAcoes()
+	servidor := &http.Server{
+		Handler:      app.handler(),
+		Addr:         config.Servidor.Morada(),
+		IdleTimeout:  config.Servidor.TimeoutInativo,
+		WriteTimeout: config.Servidor.TimeoutEscrita,
+		ReadTimeout:  config.Servidor.TimeoutLeitura,
+		ErrorLog:     loggers.ServerErrorLogger,
+	}
+
+	// Ao desligar, a conexão ao mongo é fechada depois dos pedidos em curso terminarem,
+	// e os últimos spans são enviados no fim
+	app.ciclo = ciclovida.Novo(servidor, config.Servidor.Desligar, loggers.Registador.Logger(registos.Info, "servidor"))
+	app.ciclo.AoDesligar("rastreio", desligarRastreio)
+	app.ciclo.AoDesligar("mongo", app.mongo.Disconnect)
+	return app
+}
+
+// registarAcoes Cada action é registada com a politica de autorização que a token têm de cumprir
+func (app *App) registarAcoes() {
+	servico := app.servico
+	acoes := autorizacao.Acoes{Funcs: actions.FuncsStorage, Verificador: servico.Autorizacao(), Politicas: make(map[string]autorizacao.Politica)}
+
+	// Gestão de Registos
+	acoes.Registar("AtualizarRegistoDeItem", servico.AtualizarRegistoDeItem, autorizacao.Politica{Perms: autorizacao.USER})
+	acoes.Registar("ApagarRegistoDeItem", servico.ApagarRegistoPorID, autorizacao.Politica{Perms: autorizacao.USER})
+	acoes.Registar("AdicionarRegisto", servico.AdicionarRegisto, autorizacao.Politica{Perms: autorizacao.USER})
+
+	// Queries a registos
+	acoes.Registar("BuscarTodosRegistosBD", servico.BuscarTodosRegistosBD, autorizacao.Politica{Perms: autorizacao.USER})
+	acoes.Registar("BuscarTodosOsRegistosColecao", servico.BuscarTodosOsRegistosColecao, autorizacao.Politica{Perms: autorizacao.USER})
+	acoes.Registar("QueryRegistoJSON", servico.QueryRegistoJSON, autorizacao.Politica{Perms: autorizacao.USER})
+
+	// Health check
+	acoes.Registar("PingServico", servico.PingServico, autorizacao.Politica{Publica: true})
+
+	// Cada chamada às actions é medida, o /metrics mostra as chamadas, os erros e a duração de cada action
+	app.metricas.Instrumentar(actions.FuncsStorage)
+	app.descreverAcoes(acoes.Politicas)
+}
+
+// descreverAcoes Cria o esquema das actions servido no /esquema, as descrições desatualizadas (ver go generate) são avisadas no arranque
+func (app *App) descreverAcoes(politicas map[string]autorizacao.Politica) {
+	var avisos []string
+	app.esquema, avisos = esquema.Novo("equipamento", actions.FuncsStorage, politicas, descricoesAcoes)
+	for _, aviso := range avisos {
+		loggers.Registador.Aviso(context.Background(), "esquema das actions desatualizado", registos.CampoErro, aviso)
+	}
+}
+
+// handler Rotas do serviço, com as defenições de partilha de recursos cruzada
+func (app *App) handler() http.Handler {
+	router := mux.NewRouter()
+	// Cada action é registada com o id do pedido, o user e a latência
+	despachante := &acoesdespacho.Despachante{
+		Funcs:        actions.FuncsStorage,
+		Registador:   loggers.Registador,
+		Utilizador:   app.servico.Autorizacao().Utilizador,
+		ConfiarProxy: app.config.Servidor.ConfiarProxy,
+	}
+	router.Handle("/", despachante)
+	// As mesmas actions com os parametros em JSON, chamadas pelo gateway REST
+	router.HandleFunc(acoesdespacho.RotaJSON+"{acao}", despachante.ServeJSON).Methods(http.MethodPost)
+	// Liveness e readiness, usados pelo docker-compose e pelos orquestradores
+	verificacoes := app.verificacoesSaude()
+	router.HandleFunc("/healthz", verificacoes.Vivo).Methods(http.MethodGet)
+	router.HandleFunc("/readyz", verificacoes.Pronto).Methods(http.MethodGet)
+	// Métricas prometheus das actions, da BD e das chamadas aos outros serviços
+	router.Handle("/metrics", app.metricas.Handler()).Methods(http.MethodGet)
+	// Esquema das actions (parametros, autorização e keys do retorno), e a documentação gerada a partir dele
+	router.HandleFunc("/esquema", app.esquema.ServeJSON).Methods(http.MethodGet)
+	router.HandleFunc("/esquema/openapi.json", app.esquema.ServeOpenAPI).Methods(http.MethodGet)
+	router.HandleFunc("/esquema/acoes.md", app.esquema.ServeMarkdown).Methods(http.MethodGet)
+
+	corsOptions := cors.New(cors.Options{
+		AllowedOrigins:   app.config.Servidor.CORS.Origens,
+		AllowCredentials: app.config.Servidor.CORS.Credenciais,
+		AllowedHeaders:   []string{"Origin", "Accept", "Content-Type", "X-Requested-With", registos.CabecalhoIDPedido},
+		ExposedHeaders:   []string{registos.CabecalhoIDPedido},
+	})
+	// O id do pedido (X-Request-ID) é dado antes do CORS, para todos os pedidos serem registados,
+	// e cada pedido fica num span, continuado a partir do header traceparent
+	return registos.Middleware(loggers.Registador, rastreio.Middleware(corsOptions.Handler(router)))
+}
+
+// verificacoesSaude Dependências verificadas no /readyz, o serviço só está pronto com o mongo,
+// o serviço de autenticação só é contactado para atualizar as chaves de verificação das tokens
+func (app *App) verificacoesSaude() *saude.Saude {
+	verificacoes := saude.Nova(0)
+	verificacoes.Adicionar("mongo", func(ctx context.Context) error {
+		ctx, cancelar := context.WithCancel(ctx)
+		return mongodbhandle.CheckConexaoMongo(ctx, app.mongo, cancelar)
+	})
+	verificacoes.AdicionarOpcional("auth", saude.VerificarHTTP(nil, app.config.Endpoints.Auth.URLJWKS()))
+	return verificacoes
+}
+
+// Executar Serve os pedidos até o serviço ser desligado (SIGINT/SIGTERM ou fim do contexto)
+func (app *App) Executar(ctx context.Context) error {
+	return app.ciclo.Executar(ctx)
+}
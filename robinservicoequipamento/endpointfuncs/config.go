@@ -0,0 +1,18 @@
+package endpointfuncs
+
+import (
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/configuracao"
+)
+
+// Config Configuração das actions, parte da configuração do serviço
+type Config struct {
+	Mongo configuracao.Mongo        `conf:"mongo"`
+	Auth  configuracao.Autenticacao `conf:"auth"`
+}
+
+// ConfigDefault Instância mongo local e os endpoints default do serviço de autenticação
+func ConfigDefault() Config {
+	return Config{
+		Mongo: configuracao.Mongo{URI: "mongodb://0.0.0.0:27018/"},
+	}
+}
@@ -50,13 +50,13 @@ func CheckValMapStrInterface(val interface{}) bool {
 }
 
 // GetColecaoFromDB Devolve a coleção especificada, de um documento especifico
-func GetColecaoFromDB(colecao string) *mongo.Collection {
-	return MongoClient.Database("recursos").Collection(colecao)
+func (servico *Servico) GetColecaoFromDB(colecao string) *mongo.Collection {
+	return servico.mongo.Database("recursos").Collection(colecao)
 }
 
 // ReturnDB Devolve a base-de-dados dos recursos
-func ReturnDB() *mongo.Database {
-	return MongoClient.Database("recursos")
+func (servico *Servico) ReturnDB() *mongo.Database {
+	return servico.mongo.Database("recursos")
 }
 
 // GetRegistosDaColecao Busca todos os resultados de uma coleção, que igualam ao filtro
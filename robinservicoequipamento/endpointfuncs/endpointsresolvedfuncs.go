@@ -15,15 +15,8 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-var mongoParams = mongodbhandle.MongoConexaoParams{
-	URI: "mongodb://0.0.0.0:27018/",
-}
-
-// MongoClient cliente com a conexão à instancia mongo
-var MongoClient = mongodbhandle.CriarConexaoMongoDB(mongoParams)
-
 // PingServico responde que o serviço está online
-func PingServico(name string) map[string]interface{} {
+func (servico *Servico) PingServico(name string) map[string]interface{} {
 	result := make(map[string]interface{})
 
 	result["status"] = fmt.Sprintf("Hello %s, I'm alive and OK", name)
@@ -31,25 +24,19 @@ func PingServico(name string) map[string]interface{} {
 }
 
 // AdicionarRegisto Adiciona um registo numa base de dados e coleção especifícada
-func AdicionarRegisto(registoMeta map[string]interface{}, item map[string]interface{}, token string) (result map[string]interface{}) {
+func (servico *Servico) AdicionarRegisto(registoMeta map[string]interface{}, item map[string]interface{}, token string) (result map[string]interface{}) {
 	result = make(map[string]interface{})
 
-	// if VerificarTokenUser(token) != "OK" {
-	// 	fmt.Println("Erro: A token fornecida é inválida ou expirou")
-	// 	result["erro"] = "A token fornecida é inválida ou expirou"
-	// 	return result
-	// }
-
 	/* Defenição do novo registo */
 	// Verificação da meta do registo
 	if err := VerificarCamposMetaRegisto(registoMeta); err != nil {
-		loggers.ServerErrorLogger.Println("Error: ", err)
+		servico.loggerErros.Println("Error: ", err)
 		result["erro"] = err.Error()
 		return
 	}
 	// Verificação do corpo do novo registo
 	if !reflect.ValueOf(item).IsValid() || reflect.ValueOf(item).IsZero() {
-		loggers.ServerErrorLogger.Println("Error: ", "O corpo do registo não pode ser nulo ou inválido")
+		servico.loggerErros.Println("Error: ", "O corpo do registo não pode ser nulo ou inválido")
 		result["erro"] = "O corpo do registo não pode ser nulo ou inválido"
 		return
 	}
@@ -61,13 +48,13 @@ func AdicionarRegisto(registoMeta map[string]interface{}, item map[string]interf
 	}
 
 	// Get the mongo colection
-	mongoCollection := MongoClient.Database("recursos").Collection(registo.Meta.Tipo)
+	mongoCollection := servico.mongo.Database("recursos").Collection(registo.Meta.Tipo)
 
 	// Insser um registo na coleção e base de dados especificada
 	_, err := mongodbhandle.InserirUmRegisto(registo, mongoCollection, 10)
 
 	if err != nil {
-		loggers.ServerErrorLogger.Println("Error: ", err)
+		servico.loggerErros.Println("Error: ", err)
 		result["erro"] = err
 		return
 	}
@@ -79,23 +66,17 @@ func AdicionarRegisto(registoMeta map[string]interface{}, item map[string]interf
 
 // QueryRegistoJSON Executa um query nos registos encontrados que satisfazêm o filtro de pesquisa
 // Devolve só os campos pedidos dos registos encontrados, no formato { "key1.key2.key3.value1": result1 }
-func QueryRegistoJSON(campos map[string]interface{}, colecao string, token string) (result map[string]interface{}) {
+func (servico *Servico) QueryRegistoJSON(campos map[string]interface{}, colecao string, token string) (result map[string]interface{}) {
 	result = make(map[string]interface{})
 
-	// if VerificarTokenUser(token) != "OK" {
-	// 	fmt.Println("Erro: A token fornecida é inválida ou expirou")
-	// 	result["erro"] = "A token fornecida é inválida ou expirou"
-	// 	return result
-	// }
-
 	// Define o query a usar nas buscas e a colecao alvo
 	query := resolvedschema.QueryParaStruct(&campos)
-	colecaoAlvo := GetColecaoFromDB(colecao)
+	colecaoAlvo := servico.GetColecaoFromDB(colecao)
 
 	// Busca os registos da coleção, que igualêm os resultados
 	registos, err := GetRegistosDaColecao(query.Campos, colecaoAlvo)
 	if err != nil {
-		loggers.ServerErrorLogger.Println("Error: ", err)
+		servico.loggerErros.Println("Error: ", err)
 		result["erro"] = err
 		return
 	}
@@ -105,7 +86,7 @@ func QueryRegistoJSON(campos map[string]interface{}, colecao string, token strin
 
 	// Verifica se os resultados do query são válidos (!= 0)
 	if reflect.ValueOf(records).IsZero() {
-		loggers.ServerErrorLogger.Println("Error: ", "Erro ao extrair os campos pedidos")
+		servico.loggerErros.Println("Error: ", "Erro ao extrair os campos pedidos")
 		result["erro"] = "Erro ao extrair os campos pedidos"
 		return
 	}
@@ -118,20 +99,14 @@ func QueryRegistoJSON(campos map[string]interface{}, colecao string, token strin
 }
 
 // BuscarTodosOsRegistosColecao Faz o que o título da função descreve
-func BuscarTodosOsRegistosColecao(colecao string, token string) (retorno map[string]interface{}) {
+func (servico *Servico) BuscarTodosOsRegistosColecao(colecao string, token string) (retorno map[string]interface{}) {
 	retorno = make(map[string]interface{})
 
-	// if VerificarTokenUser(token) != "OK" {
-	// 	fmt.Println("Erro: A token fornecida é inválida ou expirou")
-	// 	result["erro"] = "A token fornecida é inválida ou expirou"
-	// 	return result
-	// }
-
 	// Define o query a usar nas buscas e a colecao alvo
-	colecaoAlvo := GetColecaoFromDB(colecao)
+	colecaoAlvo := servico.GetColecaoFromDB(colecao)
 	results, err := colecaoAlvo.Find(context.TODO(), bson.M{}, options.Find())
 	if err != nil {
-		loggers.ServerErrorLogger.Println("Error: ", err)
+		servico.loggerErros.Println("Error: ", err)
 		retorno["erro"] = "Erro ao buscar todos os registos"
 		return
 	}
@@ -139,7 +114,7 @@ func BuscarTodosOsRegistosColecao(colecao string, token string) (retorno map[str
 	registos := make([]map[string]interface{}, 0)
 	err = results.All(context.TODO(), &registos)
 	if err != nil {
-		loggers.ServerErrorLogger.Println("Error: ", err)
+		servico.loggerErros.Println("Error: ", err)
 		retorno["erro"] = err
 		return
 	}
@@ -149,17 +124,12 @@ func BuscarTodosOsRegistosColecao(colecao string, token string) (retorno map[str
 	return
 }
 
-func BuscarTodosRegistosBD(token string) (retorno map[string]interface{}) {
+// BuscarTodosRegistosBD Busca todos os registos de todas as coleções da bd, agrupados pelo nome da coleção
+func (servico *Servico) BuscarTodosRegistosBD(token string) (retorno map[string]interface{}) {
 	retorno = make(map[string]interface{})
 
-	// if VerificarTokenUser(token) != "OK" {
-	// 	fmt.Println("Erro: A token fornecida é inválida ou expirou")
-	// 	result["erro"] = "A token fornecida é inválida ou expirou"
-	// 	return result
-	// }
-
 	// Busca a base de dados usada pelo sistema
-	dataBase := ReturnDB()
+	dataBase := servico.ReturnDB()
 	// Extrai todos os nome de coleções existentes
 	colecoesNomes, err := dataBase.ListCollectionNames(context.TODO(), bson.M{})
 	if err != nil {
@@ -172,11 +142,11 @@ func BuscarTodosRegistosBD(token string) (retorno map[string]interface{}) {
 	registos := make(map[string]interface{})
 	for _, collName := range colecoesNomes {
 		// Busca o conteudo da coleção alvo
-		colecaoAlvo := GetColecaoFromDB(collName)
+		colecaoAlvo := servico.GetColecaoFromDB(collName)
 		// Busca todos os items presentes na coleção
 		results, err := colecaoAlvo.Find(context.TODO(), bson.M{}, options.Find())
 		if err != nil {
-			loggers.ServerErrorLogger.Println("Error: ", err)
+			servico.loggerErros.Println("Error: ", err)
 			retorno["erro"] = "Erro ao buscar todos os registos"
 			return
 		}
@@ -186,7 +156,7 @@ func BuscarTodosRegistosBD(token string) (retorno map[string]interface{}) {
 		// Descodifica todos os registos para a var temp
 		err = results.All(context.TODO(), &temp)
 		if err != nil {
-			loggers.ServerErrorLogger.Println("Error: ", err)
+			servico.loggerErros.Println("Error: ", err)
 			retorno["erro"] = err.Error()
 			return
 		}
@@ -201,19 +171,13 @@ func BuscarTodosRegistosBD(token string) (retorno map[string]interface{}) {
 }
 
 // ApagarRegistoPorID Apaga um registo pelo seu ObjectID, na bd e coleção fornecida
-func ApagarRegistoPorID(colecao string, idItem string, token string) map[string]interface{} {
+func (servico *Servico) ApagarRegistoPorID(colecao string, idItem string, token string) map[string]interface{} {
 	result := make(map[string]interface{})
 
-	// if VerificarTokenUser(token) != "OK" {
-	// 	fmt.Println("Erro: A token fornecida é inválida ou expirou")
-	// 	result["erro"] = "A token fornecida é inválida ou expirou"
-	// 	return result
-	// }
-
 	// Converte o ID de uma String para um ObjectID
 	idOBJ, err := primitive.ObjectIDFromHex(idItem)
 	if err != nil {
-		loggers.ServerErrorLogger.Println()
+		servico.loggerErros.Println()
 		fmt.Println("Error: ID de registo não pode ser convertido")
 		result["erro"] = err
 		return result
@@ -223,14 +187,14 @@ func ApagarRegistoPorID(colecao string, idItem string, token string) map[string]
 	filter := bson.M{"_id": idOBJ}
 
 	// Get collection
-	coll := MongoClient.Database("recursos").Collection(colecao)
+	coll := servico.mongo.Database("recursos").Collection(colecao)
 	cntx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 
 	// Operação de delete de um só registo
 	item, err := coll.DeleteOne(cntx, filter, options.Delete())
 	defer cancel()
 	if err != nil {
-		loggers.ServerErrorLogger.Println("Erro: Não foi possível apagar o registo de id: ", idItem)
+		servico.loggerErros.Println("Erro: Não foi possível apagar o registo de id: ", idItem)
 		result["erro"] = "Error: Não foi possível apagar o item de registo:" + idItem
 		return result
 	}
@@ -241,19 +205,13 @@ func ApagarRegistoPorID(colecao string, idItem string, token string) map[string]
 
 // AtualizarRegistoDeItem Na bd e coleção escolhida, o registo de id idItem
 // vai ser atualizado para os valores especificados em item
-func AtualizarRegistoDeItem(colecao string, idItem string, item map[string]interface{}, token string) map[string]interface{} {
+func (servico *Servico) AtualizarRegistoDeItem(colecao string, idItem string, item map[string]interface{}, token string) map[string]interface{} {
 	result := make(map[string]interface{})
 
-	// if VerificarTokenUser(token) != "OK" {
-	// 	fmt.Println("Erro: A token fornecida é inválida ou expirou")
-	// 	result["erro"] = "A token fornecida é inválida ou expirou"
-	// 	return result
-	// }
-
 	// Converte o ID de uma String para um ObjectID
 	idOBJ, err := primitive.ObjectIDFromHex(idItem)
 	if err != nil {
-		loggers.ServerErrorLogger.Println()
+		servico.loggerErros.Println()
 		fmt.Println("Error: ID de registo não pode ser convertido")
 		result["erro"] = err
 		return result
@@ -263,7 +221,7 @@ func AtualizarRegistoDeItem(colecao string, idItem string, item map[string]inter
 	filter := bson.M{"_id": idOBJ}
 
 	// Get collection
-	coll := MongoClient.Database("recursos").Collection(colecao)
+	coll := servico.mongo.Database("recursos").Collection(colecao)
 	cntx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 
 	// Atualiza o item através do map especificado nos params
@@ -271,7 +229,7 @@ func AtualizarRegistoDeItem(colecao string, idItem string, item map[string]inter
 	fmt.Println(matchCount)
 	defer cancel()
 	if err != nil {
-		loggers.ServerErrorLogger.Println("Erro: ", err, " | registo de id: ", idItem)
+		servico.loggerErros.Println("Erro: ", err, " | registo de id: ", idItem)
 		result["erro"] = "Error: registo:" + idItem
 		return result
 	}
@@ -0,0 +1,44 @@
+// Code generated by esquemagen a partir das actions registadas. DO NOT EDIT.
+
+package main
+
+import "github.com/tomascpmarques/PAP/backend/robinpartilhado/esquema"
+
+// descricoesAcoes Descrição, parametros e keys do retorno de cada action registada, tiradas do código fonte
+var descricoesAcoes = map[string]esquema.Descricao{
+	"AdicionarRegisto": {
+		Descricao: "Adiciona um registo numa base de dados e coleção especifícada",
+		Params:    []string{"registoMeta", "item", "token"},
+		Respostas: []string{"sucesso"},
+	},
+	"ApagarRegistoDeItem": {
+		Descricao: "Apaga um registo pelo seu ObjectID, na bd e coleção fornecida",
+		Params:    []string{"colecao", "idItem", "token"},
+		Respostas: []string{"registo_apagado"},
+	},
+	"AtualizarRegistoDeItem": {
+		Descricao: "Na bd e coleção escolhida, o registo de id idItem vai ser atualizado para os valores especificados em item",
+		Params:    []string{"colecao", "idItem", "item", "token"},
+		Respostas: []string{"atualizacoes"},
+	},
+	"BuscarTodosOsRegistosColecao": {
+		Descricao: "Faz o que o título da função descreve",
+		Params:    []string{"colecao", "token"},
+		Respostas: []string{"registos"},
+	},
+	"BuscarTodosRegistosBD": {
+		Descricao: "Busca todos os registos de todas as coleções da bd, agrupados pelo nome da coleção",
+		Params:    []string{"token"},
+		Respostas: []string{"registos"},
+	},
+	"PingServico": {
+		Descricao: "responde que o serviço está online",
+		Params:    []string{"name"},
+		Respostas: []string{"status"},
+	},
+	"QueryRegistoJSON": {
+		Descricao: "Executa um query nos registos encontrados que satisfazêm o filtro de pesquisa Devolve só os campos pedidos dos registos encontrados, no formato { \"key1.key2.key3.value1\": result1 }",
+		Params:    []string{"campos", "colecao", "token"},
+		Respostas: []string{"registos"},
+	},
+}
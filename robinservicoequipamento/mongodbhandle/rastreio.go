@@ -0,0 +1,47 @@
+package mongodbhandle
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/rastreio"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+// MonitorRastreio Monitor que cria um span por comando enviado ao mongo, filho do span do contexto da operação,
+// os eventos são passados também ao monitor base (ex: MonitorMetricas), que pode ser nil
+func MonitorRastreio(base *event.CommandMonitor) *event.CommandMonitor {
+	if base == nil {
+		base = &event.CommandMonitor{}
+	}
+	// Operações em curso, por id do pedido ao mongo
+	var operacoes sync.Map
+	terminar := func(id int64, err error) {
+		if terminar, existe := operacoes.LoadAndDelete(id); existe {
+			terminar.(rastreio.Terminar)(err)
+		}
+	}
+
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, evento *event.CommandStartedEvent) {
+			_, terminarOperacao := rastreio.OperacaoBD(ctx, "mongodb", evento.CommandName, evento.DatabaseName)
+			operacoes.Store(evento.RequestID, terminarOperacao)
+			if base.Started != nil {
+				base.Started(ctx, evento)
+			}
+		},
+		Succeeded: func(ctx context.Context, evento *event.CommandSucceededEvent) {
+			terminar(evento.RequestID, nil)
+			if base.Succeeded != nil {
+				base.Succeeded(ctx, evento)
+			}
+		},
+		Failed: func(ctx context.Context, evento *event.CommandFailedEvent) {
+			terminar(evento.RequestID, errors.New(evento.Failure))
+			if base.Failed != nil {
+				base.Failed(ctx, evento)
+			}
+		},
+	}
+}
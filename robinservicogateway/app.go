@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/cors"
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/ciclovida"
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/metricas"
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/rastreio"
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/registos"
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/saude"
+	"github.com/tomascpmarques/PAP/backend/robinservicogateway/loggers"
+	"github.com/tomascpmarques/PAP/backend/robinservicogateway/rotas"
+)
+
+// App Gateway REST montado a partir da configuração: o encaminhador das rotas para as actions dos serviços,
+// e o ciclo de vida do servidor http
+type App struct {
+	config       Config
+	metricas     *metricas.Metricas
+	encaminhador *rotas.Encaminhador
+	ciclo        *ciclovida.CicloVida
+}
+
+// NovaApp Cria os clientes http dos serviços e o servidor http com as rotas REST
+func NovaApp(config Config) (*App, error) {
+	loggers.Registador.DefinirNivel(config.Servidor.NivelLogs())
+	desligarRastreio, err := rastreio.Configurar("gateway", config.Rastreio)
+	if err != nil {
+		return nil, err
+	}
+	app := &App{config: config, metricas: metricas.Novas("gateway")}
+
+	// Cada serviço têm o seu cliente, as chamadas levam o id do pedido e o trace, e são medidas por destino
+	urls := config.Servicos.URLs()
+	clientes := make(map[string]*http.Client, len(urls))
+	for servico := range urls {
+		base := &http.Client{Timeout: config.Servicos.Timeout}
+		clientes[servico] = registos.Cliente(app.metricas.Cliente(servico, rastreio.Cliente(servico, base)))
+	}
+	app.encaminhador = &rotas.Encaminhador{
+		URLs:         urls,
+		Clientes:     clientes,
+		Registador:   loggers.Registador,
+		ConfiarProxy: config.Servidor.ConfiarProxy,
+	}
+
+	servidor := &http.Server{
+		Handler:      app.handler(),
+		Addr:         config.Servidor.Morada(),
+		IdleTimeout:  config.Servidor.TimeoutInativo,
+		WriteTimeout: config.Servidor.TimeoutEscrita,
+		ReadTimeout:  config.Servidor.TimeoutLeitura,
+		ErrorLog:     loggers.ServerErrorLogger,
+	}
+
+	// Ao desligar, os últimos spans são enviados depois dos pedidos em curso terminarem
+	app.ciclo = ciclovida.Novo(servidor, config.Servidor.Desligar, loggers.Registador.Logger(registos.Info, "servidor"))
+	app.ciclo.AoDesligar("rastreio", desligarRastreio)
+	return app, nil
+}
+
+// handler Rotas REST do gateway, com as defenições de partilha de recursos cruzada
+func (app *App) handler() http.Handler {
+	router := mux.NewRouter()
+	router.NotFoundHandler = http.HandlerFunc(rotas.NaoEncontrada)
+	router.MethodNotAllowedHandler = http.HandlerFunc(rotas.MetodoNaoPermitido)
+	app.encaminhador.Registar(router, rotas.Rotas)
+	// Liveness e readiness, usados pelo docker-compose e pelos orquestradores
+	verificacoes := app.verificacoesSaude()
+	router.HandleFunc("/healthz", verificacoes.Vivo).Methods(http.MethodGet)
+	router.HandleFunc("/readyz", verificacoes.Pronto).Methods(http.MethodGet)
+	// Métricas prometheus das chamadas aos serviços
+	router.Handle("/metrics", app.metricas.Handler()).Methods(http.MethodGet)
+
+	corsOptions := cors.New(cors.Options{
+		AllowedOrigins:   app.config.Servidor.CORS.Origens,
+		AllowCredentials: app.config.Servidor.CORS.Credenciais,
+		AllowedMethods:   []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete},
+		AllowedHeaders:   []string{"Origin", "Accept", "Content-Type", "Authorization", "X-Requested-With", registos.CabecalhoIDPedido},
+		ExposedHeaders:   []string{registos.CabecalhoIDPedido},
+	})
+	// O id do pedido (X-Request-ID) é dado antes do CORS, para todos os pedidos serem registados,
+	// e cada pedido fica num span, continuado a partir do header traceparent
+	return registos.Middleware(loggers.Registador, rastreio.Middleware(corsOptions.Handler(router)))
+}
+
+// verificacoesSaude Os serviços são dependências opcionais, o gateway continua a encaminhar as rotas dos serviços disponíveis
+func (app *App) verificacoesSaude() *saude.Saude {
+	verificacoes := saude.Nova(0)
+	for servico, endereco := range app.config.Servicos.URLs() {
+		verificacoes.AdicionarOpcional(servico, saude.VerificarHTTP(nil, saude.URLSaude(endereco)))
+	}
+	return verificacoes
+}
+
+// Executar Serve os pedidos até o serviço ser desligado (SIGINT/SIGTERM ou fim do contexto)
+func (app *App) Executar(ctx context.Context) error {
+	return app.ciclo.Executar(ctx)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"time"
+
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/configuracao"
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/rastreio"
+	"github.com/tomascpmarques/PAP/backend/robinservicogateway/rotas"
+)
+
+// PrefixoConfig prefixo das variáveis de ambiente do gateway, ex: GATEWAY_SERVICOS_AUTH
+const PrefixoConfig = "GATEWAY"
+
+// Config Configuração do gateway, os valores default são sobrepostos pelo ficheiro (-config),
+// pelas variáveis de ambiente e pelas flags (ver configuracao.Carregar)
+type Config struct {
+	Servidor configuracao.Servidor `conf:"servidor"`
+	Rastreio rastreio.Config       `conf:"rastreio"`
+	Servicos rotas.Config          `conf:"servicos"`
+}
+
+// configDefault Configuração usada em desenvolvimento local, com os serviços nas portas default
+func configDefault() Config {
+	return Config{
+		Servidor: configuracao.Servidor{
+			Endereco:       "0.0.0.0",
+			Porta:          8090,
+			TimeoutLeitura: time.Second * 5,
+			TimeoutEscrita: time.Second * 15,
+			TimeoutInativo: time.Second * 30,
+			Desligar:       time.Second * 15,
+			CORS: configuracao.CORS{
+				Origens:     []string{"http://localhost:8080"},
+				Credenciais: true,
+			},
+		},
+		Rastreio: rastreio.ConfigDefault(),
+		Servicos: rotas.ConfigDefault(),
+	}
+}
@@ -0,0 +1,11 @@
+module github.com/tomascpmarques/PAP/backend/robinservicogateway
+
+go 1.16
+
+require (
+	github.com/gorilla/mux v1.8.0
+	github.com/rs/cors v1.7.0
+	github.com/tomascpmarques/PAP/backend/robinpartilhado v0.0.0
+)
+
+replace github.com/tomascpmarques/PAP/backend/robinpartilhado => ../robinpartilhado
@@ -0,0 +1,14 @@
+package loggers
+
+import (
+	"os"
+
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/registos"
+)
+
+// Registador - registador estruturado do gateway, escreve as linhas em JSON no stdout, todas com o campo servico.
+// Os loggers abaixo escrevem através dele, cada um com o campo componente
+var Registador = registos.Novo(os.Stdout, registos.Info).Com("servico", "gateway")
+
+// ServerErrorLogger - Logger para erros do servidor
+var ServerErrorLogger = Registador.Logger(registos.Erro, "servidor")
@@ -0,0 +1,64 @@
+package rotas
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Nomes dos serviços para onde as rotas são encaminhadas
+const (
+	ServicoAuth         = "auth"
+	ServicoUserinfo     = "userinfo"
+	ServicoDocumentacao = "documentacao"
+	ServicoEquipamento  = "equipamento"
+	ServicoVideoshare   = "videoshare"
+)
+
+// Config Endereços dos serviços, parte da configuração do gateway (secção servicos)
+type Config struct {
+	Auth         string        `conf:"auth" desc:"endereço do serviço de autenticação"`
+	Userinfo     string        `conf:"userinfo" desc:"endereço do serviço de informação de utilizador"`
+	Documentacao string        `conf:"documentacao" desc:"endereço do serviço de documentação"`
+	Equipamento  string        `conf:"equipamento" desc:"endereço do serviço de gestão de equipamento"`
+	Videoshare   string        `conf:"videoshare" desc:"endereço do serviço de video-sharing"`
+	Timeout      time.Duration `conf:"timeout" desc:"tempo máximo de resposta de um serviço, depois o gateway responde 504"`
+}
+
+// ConfigDefault Os serviços locais, nas suas portas default
+func ConfigDefault() Config {
+	return Config{
+		Auth:         "http://0.0.0.0:8081",
+		Userinfo:     "http://0.0.0.0:8001",
+		Documentacao: "http://0.0.0.0:8118",
+		Equipamento:  "http://0.0.0.0:8000",
+		Videoshare:   "http://0.0.0.0:8008",
+		Timeout:      time.Second * 10,
+	}
+}
+
+// URLs Endereço de cada serviço, pelo nome usado nas rotas
+func (config Config) URLs() map[string]string {
+	return map[string]string{
+		ServicoAuth:         config.Auth,
+		ServicoUserinfo:     config.Userinfo,
+		ServicoDocumentacao: config.Documentacao,
+		ServicoEquipamento:  config.Equipamento,
+		ServicoVideoshare:   config.Videoshare,
+	}
+}
+
+// Validar Os endereços têm de ser urls http ou https, e o timeout maior que 0
+func (config *Config) Validar() error {
+	for servico, endereco := range config.URLs() {
+		valido, err := url.Parse(endereco)
+		if err != nil || (valido.Scheme != "http" && valido.Scheme != "https") || valido.Host == "" {
+			return fmt.Errorf("o endereço do serviço %s têm de ser um url http ou https", servico)
+		}
+	}
+	if config.Timeout <= 0 {
+		return errors.New("o timeout dos serviços têm de ser maior que 0")
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package rotas
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/acoes"
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/registos"
+)
+
+const (
+	// tamanhoMaximoCorpo tamanho máximo do body dos pedidos, o conteúdo dos ficheiros da documentação vai no body
+	tamanhoMaximoCorpo = 8 << 20
+	// prefixoBearer esquema do header Authorization com a token de acesso
+	prefixoBearer = "bearer "
+)
+
+// Rota Rota REST do gateway, encaminhada para uma action de um serviço
+type Rota struct {
+	Metodo  string
+	Caminho string // Caminho no formato do gorilla/mux, ex: /repos/{repo}
+	Servico string // Nome do serviço da action (ver Config.URLs)
+	Acao    string
+	// Params parametros da action a partir do pedido, sem o contexto e sem a token, nil se a action só recebe a token.
+	// Um erro é devolvido ao cliente com o estado 400
+	Params func(pedido *Pedido) ([]interface{}, error)
+	// SemToken a action não recebe a token (ex: Login), nas outras a token do header Authorization é o último parametro
+	SemToken bool
+	// Estado estado das respostas sem erro, 200 se for 0 (ex: 201 nas rotas que criam um recurso)
+	Estado int
+	// Erro estado dos erros da action que não são de autorização, 400 se for 0 (ex: 404 nas rotas que procuram um recurso)
+	Erro int
+}
+
+// Encaminhador Encaminha os pedidos REST para as actions dos serviços, com os parametros em JSON
+// (ver acoes.Despachante.ServeJSON), e responde com o retorno da action
+type Encaminhador struct {
+	URLs       map[string]string       // Endereço de cada serviço, pelo nome (ver Config.URLs)
+	Clientes   map[string]*http.Client // Cliente http de cada serviço, http.DefaultClient se não existir
+	Registador *registos.Registador    // registos.Padrao se for nil
+	// ConfiarProxy usa o IP do cliente dos headers X-Forwarded-For e X-Real-IP, só se o gateway estiver atrás de um proxy de confiança.
+	// O IP do cliente é enviado aos serviços no X-Forwarded-For
+	ConfiarProxy bool
+}
+
+// erroJSON Body das respostas de erro do gateway, com o mesmo formato dos erros das actions
+func erroJSON(rw http.ResponseWriter, estado int, mensagem string) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(estado)
+	json.NewEncoder(rw).Encode(map[string]interface{}{"erro": mensagem})
+}
+
+// NaoEncontrada Resposta das rotas que não existem
+func NaoEncontrada(rw http.ResponseWriter, r *http.Request) {
+	erroJSON(rw, http.StatusNotFound, "rota desconhecida: "+r.Method+" "+r.URL.Path)
+}
+
+// MetodoNaoPermitido Resposta dos métodos que a rota não aceita
+func MetodoNaoPermitido(rw http.ResponseWriter, r *http.Request) {
+	erroJSON(rw, http.StatusMethodNotAllowed, "método não permitido: "+r.Method+" "+r.URL.Path)
+}
+
+// token Token de acesso do header Authorization (Bearer <token>), vazia se não for enviada
+func token(r *http.Request) string {
+	autorizacao := r.Header.Get("Authorization")
+	if len(autorizacao) < len(prefixoBearer) || !strings.EqualFold(autorizacao[:len(prefixoBearer)], prefixoBearer) {
+		return ""
+	}
+	return strings.TrimSpace(autorizacao[len(prefixoBearer):])
+}
+
+// lerCorpo Lê o body do pedido, que têm de ser um objeto JSON, sem body devolve um map vazio
+func lerCorpo(rw http.ResponseWriter, r *http.Request) (map[string]interface{}, error) {
+	corpo := make(map[string]interface{})
+	err := json.NewDecoder(http.MaxBytesReader(rw, r.Body, tamanhoMaximoCorpo)).Decode(&corpo)
+	if err != nil && err != io.EOF {
+		return nil, errors.New("o body do pedido têm de ser um objeto JSON")
+	}
+	return corpo, nil
+}
+
+// Registar Adiciona as rotas ao router
+func (encaminhador *Encaminhador) Registar(router *mux.Router, rotas []Rota) {
+	for _, rota := range rotas {
+		router.Handle(rota.Caminho, encaminhador.Handler(rota)).Methods(rota.Metodo)
+	}
+}
+
+// Handler Handler http da rota: constrói os parametros da action a partir do pedido, chama a action no serviço da rota
+// e responde com o retorno da action. Os estados dos serviços passam para o cliente (401 e 403 nos erros de autorização),
+// os erros dos serviços (5xx) e os serviços que não respondem passam a 502, ou 504 se o serviço demorar mais que o timeout
+func (encaminhador *Encaminhador) Handler(rota Rota) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		registador := encaminhador.Registador
+		if registador == nil {
+			registador = registos.Padrao
+		}
+
+		corpo, err := lerCorpo(rw, r)
+		if err != nil {
+			erroJSON(rw, http.StatusBadRequest, err.Error())
+			return
+		}
+		params := make([]interface{}, 0, 4)
+		if rota.Params != nil {
+			if params, err = rota.Params(&Pedido{http: r, corpo: corpo}); err != nil {
+				erroJSON(rw, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+		if !rota.SemToken {
+			params = append(params, token(r))
+		}
+
+		resposta, err := encaminhador.chamar(r, rota, params)
+		if err != nil {
+			registador.Erro(r.Context(), "o serviço não respondeu", "destino", rota.Servico, registos.CampoAcao, rota.Acao, registos.CampoErro, err)
+			var erroRede net.Error
+			if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &erroRede) && erroRede.Timeout()) {
+				erroJSON(rw, http.StatusGatewayTimeout, "o serviço "+rota.Servico+" não respondeu a tempo")
+				return
+			}
+			erroJSON(rw, http.StatusBadGateway, "o serviço "+rota.Servico+" não está disponível")
+			return
+		}
+		defer resposta.Body.Close()
+		retorno, err := ioutil.ReadAll(resposta.Body)
+		if err != nil {
+			erroJSON(rw, http.StatusBadGateway, "resposta incompleta do serviço "+rota.Servico)
+			return
+		}
+
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(estadoResposta(rota, resposta.StatusCode))
+		rw.Write(retorno)
+	})
+}
+
+// estadoResposta Estado da resposta ao cliente a partir do estado da resposta do serviço
+func estadoResposta(rota Rota, estado int) int {
+	switch {
+	case estado == http.StatusOK && rota.Estado != 0:
+		return rota.Estado
+	case estado == http.StatusBadRequest && rota.Erro != 0:
+		return rota.Erro
+	// Uma action que não existe no serviço é um erro da configuração do gateway, não do cliente
+	case estado == http.StatusNotFound, estado >= http.StatusInternalServerError:
+		return http.StatusBadGateway
+	}
+	return estado
+}
+
+// chamar Chama a action da rota no serviço, com o contexto do pedido (id do pedido e trace)
+func (encaminhador *Encaminhador) chamar(r *http.Request, rota Rota, params []interface{}) (*http.Response, error) {
+	corpo, err := json.Marshal(acoes.PedidoJSON{Params: params})
+	if err != nil {
+		return nil, err
+	}
+	pedido, err := http.NewRequestWithContext(r.Context(), http.MethodPost, strings.TrimRight(encaminhador.URLs[rota.Servico], "/")+acoes.RotaJSON+rota.Acao, bytes.NewReader(corpo))
+	if err != nil {
+		return nil, err
+	}
+	pedido.Header.Set("Content-Type", "application/json")
+	// Os serviços que confiam no gateway usam o IP do cliente (ex: bloqueios do login no serviço de autenticação)
+	pedido.Header.Set("X-Forwarded-For", acoes.NovoPedido(r, encaminhador.ConfiarProxy).IP)
+
+	cliente, existe := encaminhador.Clientes[rota.Servico]
+	if !existe {
+		cliente = http.DefaultClient
+	}
+	return cliente.Do(pedido)
+}
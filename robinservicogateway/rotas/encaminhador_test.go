@@ -0,0 +1,280 @@
+package rotas
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/acoes"
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/registos"
+)
+
+// chamadaServico Chamada de uma action recebida pelo serviço de teste
+type chamadaServico struct {
+	acao    string
+	params  []interface{}
+	destino string // Header X-Forwarded-For
+}
+
+// servicoTeste Serviço de teste que regista as chamadas às actions, e responde com o estado indicado
+type servicoTeste struct {
+	mutex    sync.Mutex
+	chamadas []chamadaServico
+	estado   int
+	atraso   time.Duration
+}
+
+func (servico *servicoTeste) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	var pedido acoes.PedidoJSON
+	json.NewDecoder(r.Body).Decode(&pedido)
+	servico.mutex.Lock()
+	servico.chamadas = append(servico.chamadas, chamadaServico{
+		acao:    strings.TrimPrefix(r.URL.Path, acoes.RotaJSON),
+		params:  pedido.Params,
+		destino: r.Header.Get("X-Forwarded-For"),
+	})
+	estado, atraso := servico.estado, servico.atraso
+	servico.mutex.Unlock()
+
+	time.Sleep(atraso)
+	rw.WriteHeader(estado)
+	json.NewEncoder(rw).Encode(map[string]interface{}{"sucesso": true})
+}
+
+// ultima Última chamada recebida, falha o teste se o serviço não foi chamado
+func (servico *servicoTeste) ultima(t *testing.T) chamadaServico {
+	t.Helper()
+	servico.mutex.Lock()
+	defer servico.mutex.Unlock()
+	if len(servico.chamadas) == 0 {
+		t.Fatal("o serviço não foi chamado")
+	}
+	return servico.chamadas[len(servico.chamadas)-1]
+}
+
+// gatewayTeste Router com as rotas do gateway, todos os serviços apontam para o serviço de teste
+func gatewayTeste(t *testing.T, servico *servicoTeste, confiarProxy bool) http.Handler {
+	t.Helper()
+	servidor := httptest.NewServer(servico)
+	t.Cleanup(servidor.Close)
+
+	urls := make(map[string]string)
+	for nome := range ConfigDefault().URLs() {
+		urls[nome] = servidor.URL
+	}
+	encaminhador := &Encaminhador{
+		URLs:         urls,
+		Registador:   registos.Novo(io.Discard, registos.Erro),
+		ConfiarProxy: confiarProxy,
+	}
+	router := mux.NewRouter()
+	router.NotFoundHandler = http.HandlerFunc(NaoEncontrada)
+	router.MethodNotAllowedHandler = http.HandlerFunc(MetodoNaoPermitido)
+	encaminhador.Registar(router, Rotas)
+	return router
+}
+
+// pedirGateway Faz o pedido ao gateway com o header Authorization, sem o header se autorizacao for vazia
+func pedirGateway(gateway http.Handler, metodo string, caminho string, corpo string, autorizacao string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(metodo, caminho, strings.NewReader(corpo))
+	r.RemoteAddr = "192.0.2.1:4000"
+	if autorizacao != "" {
+		r.Header.Set("Authorization", autorizacao)
+	}
+	rw := httptest.NewRecorder()
+	gateway.ServeHTTP(rw, r)
+	return rw
+}
+
+func TestRotas(t *testing.T) {
+	casos := []struct {
+		nome          string
+		metodo        string
+		caminho       string
+		corpo         string
+		estadoServico int
+		acao          string
+		params        []interface{}
+		estado        int
+	}{
+		{"login sem token", http.MethodPost, "/sessoes", `{"user": "ana", "password": "segredo"}`, http.StatusOK,
+			"Login", []interface{}{"ana", "segredo"}, http.StatusOK},
+		{"login falhado", http.MethodPost, "/sessoes", `{"user": "ana", "password": "errada"}`, http.StatusBadRequest,
+			"Login", []interface{}{"ana", "errada"}, http.StatusUnauthorized},
+		{"só a token", http.MethodDelete, "/sessoes", "", http.StatusOK,
+			"Logout", []interface{}{"tok"}, http.StatusOK},
+		{"criação", http.MethodPost, "/users", `{"user": "rui", "password": "segredo", "perms": 2}`, http.StatusOK,
+			"Registar", []interface{}{"rui", "segredo", float64(2), "tok"}, http.StatusCreated},
+		{"pesquisa", http.MethodGet, "/users?limite=20&papel=a&papel=b", "", http.StatusOK,
+			"ListarUsers", []interface{}{map[string]interface{}{"limite": float64(20), "papel": []interface{}{"a", "b"}}, "tok"}, http.StatusOK},
+		{"variáveis", http.MethodDelete, "/equipamento/motores/42", "", http.StatusOK,
+			"ApagarRegistoDeItem", []interface{}{"motores", "42", "tok"}, http.StatusOK},
+		{"objetos do body", http.MethodPost, "/equipamento/motores", `{"meta": {"estado": "novo"}, "item": {"n": 1}}`, http.StatusOK,
+			"AdicionarRegisto", []interface{}{map[string]interface{}{"estado": "novo", "tipo": "motores"}, map[string]interface{}{"n": float64(1)}, "tok"}, http.StatusCreated},
+		{"ficheiro", http.MethodGet, "/repos/manuais/ficheiros/motores/limpeza.md", "", http.StatusOK,
+			"BuscarMetaData", []interface{}{map[string]interface{}{"reponome": "manuais", "nome": "limpeza.md", "path": []interface{}{"manuais", "motores", "limpeza.md"}}, "tok"}, http.StatusOK},
+		{"recurso inexistente", http.MethodGet, "/repos/manuais", "", http.StatusBadRequest,
+			"BuscarRepositorio", []interface{}{map[string]interface{}{"nome": "manuais"}, "tok"}, http.StatusNotFound},
+		{"sem autorização", http.MethodDelete, "/users/rui", "", http.StatusForbidden,
+			"ApagarUser", []interface{}{"rui", "tok"}, http.StatusForbidden},
+		{"serviço com erro", http.MethodPost, "/videos/pesquisa", "", http.StatusInternalServerError,
+			"GetVideoShares", []interface{}{map[string]interface{}{}, "tok"}, http.StatusBadGateway},
+		{"action desconhecida no serviço", http.MethodGet, "/equipamento", "", http.StatusNotFound,
+			"BuscarTodosRegistosBD", []interface{}{"tok"}, http.StatusBadGateway},
+	}
+	for _, caso := range casos {
+		t.Run(caso.nome, func(t *testing.T) {
+			servico := &servicoTeste{estado: caso.estadoServico}
+			gateway := gatewayTeste(t, servico, false)
+			rw := pedirGateway(gateway, caso.metodo, caso.caminho, caso.corpo, "Bearer tok")
+			if rw.Code != caso.estado {
+				t.Fatalf("esperava o estado %d, recebeu %d: %s", caso.estado, rw.Code, rw.Body)
+			}
+			chamada := servico.ultima(t)
+			if chamada.acao != caso.acao {
+				t.Fatalf("esperava a action %s, foi chamada %s", caso.acao, chamada.acao)
+			}
+			if !reflect.DeepEqual(chamada.params, caso.params) {
+				t.Fatalf("esperava os parametros %v, recebeu %v", caso.params, chamada.params)
+			}
+		})
+	}
+}
+
+func TestRotasErrosPedido(t *testing.T) {
+	casos := []struct {
+		nome    string
+		metodo  string
+		caminho string
+		corpo   string
+		estado  int
+	}{
+		{"campo em falta", http.MethodPost, "/sessoes", `{"user": "ana"}`, http.StatusBadRequest},
+		{"body que não é JSON", http.MethodPost, "/repos", "nome=manuais", http.StatusBadRequest},
+		{"body que não é um objeto", http.MethodPost, "/repos", `["manuais"]`, http.StatusBadRequest},
+		{"número não inteiro", http.MethodPost, "/users", `{"user": "rui", "password": "segredo", "perms": 1.5}`, http.StatusBadRequest},
+		{"parametro que não é número", http.MethodGet, "/users?limite=vinte", "", http.StatusBadRequest},
+		{"campo que não é objeto", http.MethodPost, "/equipamento/motores", `{"meta": "novo", "item": {}}`, http.StatusBadRequest},
+		{"rota desconhecida", http.MethodGet, "/inventada", "", http.StatusNotFound},
+		{"método não permitido", http.MethodPut, "/sessoes", "", http.StatusMethodNotAllowed},
+	}
+	for _, caso := range casos {
+		t.Run(caso.nome, func(t *testing.T) {
+			servico := &servicoTeste{estado: http.StatusOK}
+			gateway := gatewayTeste(t, servico, false)
+			rw := pedirGateway(gateway, caso.metodo, caso.caminho, caso.corpo, "Bearer tok")
+			if rw.Code != caso.estado {
+				t.Fatalf("esperava o estado %d, recebeu %d: %s", caso.estado, rw.Code, rw.Body)
+			}
+			var corpo map[string]interface{}
+			if err := json.NewDecoder(rw.Body).Decode(&corpo); err != nil || corpo["erro"] == nil {
+				t.Fatalf("esperava um erro em JSON, recebeu %v (%v)", corpo, err)
+			}
+			if len(servico.chamadas) != 0 {
+				t.Fatalf("o pedido inválido chegou ao serviço: %v", servico.chamadas)
+			}
+		})
+	}
+}
+
+func TestTokenECliente(t *testing.T) {
+	casos := map[string]struct {
+		autorizacao  string
+		confiarProxy bool
+		encaminhado  string
+		token        string
+		destino      string
+	}{
+		"bearer":                {"Bearer tok", false, "", "tok", "192.0.2.1"},
+		"bearer em minúsculas":  {"bearer  tok ", false, "", "tok", "192.0.2.1"},
+		"sem token":             {"", false, "", "", "192.0.2.1"},
+		"outro esquema":         {"Basic dXNlcjpwYXNz", false, "", "", "192.0.2.1"},
+		"proxy desconhecido":    {"Bearer tok", false, "203.0.113.9", "tok", "192.0.2.1"},
+		"proxy de confiança":    {"Bearer tok", true, "198.51.100.7, 203.0.113.9", "tok", "203.0.113.9"},
+		"confiança sem headers": {"Bearer tok", true, "", "tok", "192.0.2.1"},
+	}
+	for nome, caso := range casos {
+		t.Run(nome, func(t *testing.T) {
+			servico := &servicoTeste{estado: http.StatusOK}
+			gateway := gatewayTeste(t, servico, caso.confiarProxy)
+			r := httptest.NewRequest(http.MethodDelete, "/sessoes", nil)
+			r.RemoteAddr = "192.0.2.1:4000"
+			if caso.autorizacao != "" {
+				r.Header.Set("Authorization", caso.autorizacao)
+			}
+			if caso.encaminhado != "" {
+				r.Header.Set("X-Forwarded-For", caso.encaminhado)
+			}
+			gateway.ServeHTTP(httptest.NewRecorder(), r)
+
+			chamada := servico.ultima(t)
+			if !reflect.DeepEqual(chamada.params, []interface{}{caso.token}) {
+				t.Fatalf("esperava a token %q, recebeu %v", caso.token, chamada.params)
+			}
+			if chamada.destino != caso.destino {
+				t.Fatalf("esperava o IP do cliente %s, recebeu %s", caso.destino, chamada.destino)
+			}
+		})
+	}
+}
+
+func TestServicoIndisponivel(t *testing.T) {
+	rota := Rota{Metodo: http.MethodGet, Caminho: "/teste", Servico: ServicoAuth, Acao: "Teste"}
+	registador := registos.Novo(io.Discard, registos.Erro)
+
+	// Um serviço desligado
+	desligado := httptest.NewServer(http.NotFoundHandler())
+	desligado.Close()
+	encaminhador := &Encaminhador{URLs: map[string]string{ServicoAuth: desligado.URL}, Registador: registador}
+	rw := httptest.NewRecorder()
+	encaminhador.Handler(rota).ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/teste", nil))
+	if rw.Code != http.StatusBadGateway {
+		t.Fatalf("serviço desligado: esperava 502, recebeu %d", rw.Code)
+	}
+
+	// Um serviço que demora mais que o timeout do cliente
+	lento := httptest.NewServer(&servicoTeste{estado: http.StatusOK, atraso: time.Millisecond * 200})
+	t.Cleanup(lento.Close)
+	encaminhador = &Encaminhador{
+		URLs:       map[string]string{ServicoAuth: lento.URL},
+		Clientes:   map[string]*http.Client{ServicoAuth: {Timeout: time.Millisecond * 50}},
+		Registador: registador,
+	}
+	rw = httptest.NewRecorder()
+	encaminhador.Handler(rota).ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/teste", nil))
+	if rw.Code != http.StatusGatewayTimeout {
+		t.Fatalf("serviço lento: esperava 504, recebeu %d", rw.Code)
+	}
+}
+
+func TestEstadoResposta(t *testing.T) {
+	criacao := Rota{Estado: http.StatusCreated, Erro: http.StatusNotFound}
+	casos := []struct {
+		rota     Rota
+		servico  int
+		esperado int
+	}{
+		{Rota{}, http.StatusOK, http.StatusOK},
+		{criacao, http.StatusOK, http.StatusCreated},
+		{Rota{}, http.StatusBadRequest, http.StatusBadRequest},
+		{criacao, http.StatusBadRequest, http.StatusNotFound},
+		{criacao, http.StatusUnauthorized, http.StatusUnauthorized},
+		{criacao, http.StatusForbidden, http.StatusForbidden},
+		{criacao, http.StatusTooManyRequests, http.StatusTooManyRequests},
+		{criacao, http.StatusNotFound, http.StatusBadGateway},
+		{criacao, http.StatusInternalServerError, http.StatusBadGateway},
+		{criacao, http.StatusServiceUnavailable, http.StatusBadGateway},
+	}
+	for _, caso := range casos {
+		if estado := estadoResposta(caso.rota, caso.servico); estado != caso.esperado {
+			t.Errorf("rota %+v, serviço %d: esperava %d, recebeu %d", caso.rota, caso.servico, caso.esperado, estado)
+		}
+	}
+}
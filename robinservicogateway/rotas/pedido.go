@@ -0,0 +1,90 @@
+package rotas
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Pedido Pedido REST recebido pelo gateway, de onde cada rota tira os parametros da action:
+// as variáveis do caminho, o body em JSON e os parametros do url
+type Pedido struct {
+	http  *http.Request
+	corpo map[string]interface{}
+}
+
+// Var Variável do caminho da rota, ex: "repo" em /repos/{repo}
+func (pedido *Pedido) Var(nome string) string {
+	return mux.Vars(pedido.http)[nome]
+}
+
+// Caminho Segmentos da variável do caminho, ex: {caminho:.+} em /repos/{repo}/ficheiros/{caminho:.+}
+func (pedido *Pedido) Caminho(nome string) []string {
+	return strings.Split(strings.Trim(pedido.Var(nome), "/"), "/")
+}
+
+// Corpo Body do pedido (um objeto JSON), vazio se o pedido não tiver body.
+// Cada pedido têm o seu map, as rotas podem adicionar-lhe campos
+func (pedido *Pedido) Corpo() map[string]interface{} {
+	return pedido.corpo
+}
+
+// Texto Campo de texto do body, obrigatório
+func (pedido *Pedido) Texto(campo string) (string, error) {
+	texto, ok := pedido.corpo[campo].(string)
+	if !ok || texto == "" {
+		return "", fmt.Errorf("o campo %s é obrigatório", campo)
+	}
+	return texto, nil
+}
+
+// Inteiro Campo numérico do body, obrigatório
+func (pedido *Pedido) Inteiro(campo string) (int, error) {
+	numero, ok := pedido.corpo[campo].(float64)
+	if !ok || numero != float64(int(numero)) {
+		return 0, fmt.Errorf("o campo %s têm de ser um número inteiro", campo)
+	}
+	return int(numero), nil
+}
+
+// Objeto Campo do body que é um objeto JSON, obrigatório
+func (pedido *Pedido) Objeto(campo string) (map[string]interface{}, error) {
+	objeto, ok := pedido.corpo[campo].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("o campo %s têm de ser um objeto", campo)
+	}
+	return objeto, nil
+}
+
+// Pesquisa Parametros do url como um map, os parametros repetidos ficam numa lista,
+// e os parametros indicados em numeros são convertidos em números (ex: ?limite=20)
+func (pedido *Pedido) Pesquisa(numeros ...string) (map[string]interface{}, error) {
+	pesquisa := make(map[string]interface{})
+	for nome, valores := range pedido.http.URL.Query() {
+		if len(valores) == 1 {
+			pesquisa[nome] = valores[0]
+			continue
+		}
+		lista := make([]interface{}, len(valores))
+		for i, valor := range valores {
+			lista[i] = valor
+		}
+		pesquisa[nome] = lista
+	}
+
+	for _, nome := range numeros {
+		texto, existe := pesquisa[nome].(string)
+		if !existe {
+			continue
+		}
+		numero, err := strconv.ParseFloat(texto, 64)
+		if err != nil {
+			return nil, fmt.Errorf("o parametro %s têm de ser um número", nome)
+		}
+		pesquisa[nome] = numero
+	}
+	return pesquisa, nil
+}
@@ -0,0 +1,185 @@
+package rotas
+
+import (
+	"net/http"
+)
+
+// Parametros das actions a partir das partes do pedido, usados na tabela das rotas
+
+// corpo A action recebe o body do pedido
+func corpo(pedido *Pedido) ([]interface{}, error) {
+	return []interface{}{pedido.Corpo()}, nil
+}
+
+// variaveis A action recebe as variáveis do caminho, pela ordem indicada
+func variaveis(nomes ...string) func(pedido *Pedido) ([]interface{}, error) {
+	return func(pedido *Pedido) ([]interface{}, error) {
+		params := make([]interface{}, len(nomes))
+		for i, nome := range nomes {
+			params[i] = pedido.Var(nome)
+		}
+		return params, nil
+	}
+}
+
+// variavelECorpo A action recebe a variável do caminho e o body do pedido
+func variavelECorpo(nome string) func(pedido *Pedido) ([]interface{}, error) {
+	return func(pedido *Pedido) ([]interface{}, error) {
+		return []interface{}{pedido.Var(nome), pedido.Corpo()}, nil
+	}
+}
+
+// ficheiro Campos que identificam um ficheiro da documentação a partir do caminho, ex: /repos/manuais/ficheiros/motores/limpeza.md
+// é o ficheiro limpeza.md do repo manuais, com o path ["manuais", "motores", "limpeza.md"]
+func ficheiro(pedido *Pedido) map[string]interface{} {
+	repo := pedido.Var("repo")
+	caminho := pedido.Caminho("caminho")
+	path := make([]interface{}, 0, len(caminho)+1)
+	path = append(path, repo)
+	for _, parte := range caminho {
+		path = append(path, parte)
+	}
+	return map[string]interface{}{
+		"reponome": repo,
+		"nome":     caminho[len(caminho)-1],
+		"path":     path,
+	}
+}
+
+/*
+Rotas Rotas REST do gateway, cada uma chama uma action de um serviço. A token vai no header Authorization (Bearer <token>),
+os bodies são objetos JSON e as respostas são o retorno da action em JSON, ex:
+---
+
+	POST /repos  {"nome": "manutenção \"geral\"", "tema": "motores", "autor": "tomas"}  ->  201 {"resultado": ...}
+*/
+var Rotas = []Rota{
+	// Serviço de autenticação: sessões e gestão dos users
+	{Metodo: http.MethodPost, Caminho: "/sessoes", Servico: ServicoAuth, Acao: "Login", SemToken: true, Erro: http.StatusUnauthorized,
+		Params: func(pedido *Pedido) ([]interface{}, error) {
+			user, err := pedido.Texto("user")
+			if err != nil {
+				return nil, err
+			}
+			password, err := pedido.Texto("password")
+			if err != nil {
+				return nil, err
+			}
+			return []interface{}{user, password}, nil
+		}},
+	{Metodo: http.MethodDelete, Caminho: "/sessoes", Servico: ServicoAuth, Acao: "Logout"},
+	// A token do header é a token de refresh
+	{Metodo: http.MethodPost, Caminho: "/sessoes/renovar", Servico: ServicoAuth, Acao: "RenovarToken", Erro: http.StatusUnauthorized},
+	{Metodo: http.MethodGet, Caminho: "/users", Servico: ServicoAuth, Acao: "ListarUsers",
+		Params: func(pedido *Pedido) ([]interface{}, error) {
+			pesquisa, err := pedido.Pesquisa("limite")
+			return []interface{}{pesquisa}, err
+		}},
+	{Metodo: http.MethodPost, Caminho: "/users", Servico: ServicoAuth, Acao: "Registar", Estado: http.StatusCreated,
+		Params: func(pedido *Pedido) ([]interface{}, error) {
+			user, err := pedido.Texto("user")
+			if err != nil {
+				return nil, err
+			}
+			password, err := pedido.Texto("password")
+			if err != nil {
+				return nil, err
+			}
+			perms, err := pedido.Inteiro("perms")
+			if err != nil {
+				return nil, err
+			}
+			return []interface{}{user, password, perms}, nil
+		}},
+	{Metodo: http.MethodPatch, Caminho: "/users/{user}", Servico: ServicoAuth, Acao: "AtualizarUser", Params: variavelECorpo("user")},
+	{Metodo: http.MethodDelete, Caminho: "/users/{user}", Servico: ServicoAuth, Acao: "ApagarUser", Params: variaveis("user")},
+	{Metodo: http.MethodPut, Caminho: "/users/{user}/password", Servico: ServicoAuth, Acao: "MudarPassword", SemToken: true,
+		Params: func(pedido *Pedido) ([]interface{}, error) {
+			atual, err := pedido.Texto("atual")
+			if err != nil {
+				return nil, err
+			}
+			nova, err := pedido.Texto("nova")
+			if err != nil {
+				return nil, err
+			}
+			return []interface{}{pedido.Var("user"), atual, nova}, nil
+		}},
+
+	// Serviço de informação de utilizador
+	{Metodo: http.MethodGet, Caminho: "/users/{user}/info", Servico: ServicoUserinfo, Acao: "GetInfoUtilizador", Params: variaveis("user"), Erro: http.StatusNotFound},
+	{Metodo: http.MethodPatch, Caminho: "/users/{user}/info", Servico: ServicoUserinfo, Acao: "UpdateInfoUtilizador", Params: variavelECorpo("user")},
+
+	// Serviço de documentação: repos e ficheiros
+	{Metodo: http.MethodGet, Caminho: "/repos", Servico: ServicoDocumentacao, Acao: "BuscarTodosOsReposNotTokenUsr"},
+	{Metodo: http.MethodPost, Caminho: "/repos", Servico: ServicoDocumentacao, Acao: "CriarRepositorio", Params: corpo, Estado: http.StatusCreated},
+	{Metodo: http.MethodGet, Caminho: "/users/{user}/repos", Servico: ServicoDocumentacao, Acao: "BuscarUserRepos", Params: variaveis("user")},
+	{Metodo: http.MethodGet, Caminho: "/repos/{repo}", Servico: ServicoDocumentacao, Acao: "BuscarRepositorio", Erro: http.StatusNotFound,
+		Params: func(pedido *Pedido) ([]interface{}, error) {
+			return []interface{}{map[string]interface{}{"nome": pedido.Var("repo")}}, nil
+		}},
+	{Metodo: http.MethodDelete, Caminho: "/repos/{repo}", Servico: ServicoDocumentacao, Acao: "DropRepositorio",
+		Params: func(pedido *Pedido) ([]interface{}, error) {
+			return []interface{}{map[string]interface{}{"nome": pedido.Var("repo")}}, nil
+		}},
+	{Metodo: http.MethodPost, Caminho: "/repos/{repo}/ficheiros", Servico: ServicoDocumentacao, Acao: "CriarFicheiroMetaData", Estado: http.StatusCreated,
+		Params: func(pedido *Pedido) ([]interface{}, error) {
+			metaData := pedido.Corpo()
+			metaData["reponome"] = pedido.Var("repo")
+			return []interface{}{metaData}, nil
+		}},
+	{Metodo: http.MethodGet, Caminho: "/repos/{repo}/ficheiros/{caminho:.+}", Servico: ServicoDocumentacao, Acao: "BuscarMetaData", Erro: http.StatusNotFound,
+		Params: func(pedido *Pedido) ([]interface{}, error) {
+			return []interface{}{ficheiro(pedido)}, nil
+		}},
+	// O autor faz parte da hash da meta data do ficheiro, ex: ?autor=tomas
+	{Metodo: http.MethodDelete, Caminho: "/repos/{repo}/ficheiros/{caminho:.+}", Servico: ServicoDocumentacao, Acao: "ApagarFicheiroMetaData",
+		Params: func(pedido *Pedido) ([]interface{}, error) {
+			campos := ficheiro(pedido)
+			campos["autor"] = pedido.http.URL.Query().Get("autor")
+			return []interface{}{campos}, nil
+		}},
+	{Metodo: http.MethodGet, Caminho: "/repos/{repo}/conteudo/{caminho:.+}", Servico: ServicoDocumentacao, Acao: "BuscarConteudoFicheiro", Erro: http.StatusNotFound,
+		Params: func(pedido *Pedido) ([]interface{}, error) {
+			return []interface{}{ficheiro(pedido)}, nil
+		}},
+	// O body leva o conteudo e a sua hash
+	{Metodo: http.MethodPut, Caminho: "/repos/{repo}/conteudo/{caminho:.+}", Servico: ServicoDocumentacao, Acao: "InserirConteudoFicheiro",
+		Params: func(pedido *Pedido) ([]interface{}, error) {
+			conteudo := pedido.Corpo()
+			campos := ficheiro(pedido)
+			conteudo["nome"], conteudo["path"] = campos["nome"], campos["path"]
+			return []interface{}{conteudo}, nil
+		}},
+
+	// Serviço de gestão de equipamento, os registos de cada tipo ficam numa coleção
+	{Metodo: http.MethodGet, Caminho: "/equipamento", Servico: ServicoEquipamento, Acao: "BuscarTodosRegistosBD"},
+	{Metodo: http.MethodGet, Caminho: "/equipamento/{tipo}", Servico: ServicoEquipamento, Acao: "BuscarTodosOsRegistosColecao", Params: variaveis("tipo")},
+	// O body leva a meta do registo (estado e quantidade) e o item, ex: {"meta": {"estado": "novo", "quantidade": 2}, "item": {...}}
+	{Metodo: http.MethodPost, Caminho: "/equipamento/{tipo}", Servico: ServicoEquipamento, Acao: "AdicionarRegisto", Estado: http.StatusCreated,
+		Params: func(pedido *Pedido) ([]interface{}, error) {
+			meta, err := pedido.Objeto("meta")
+			if err != nil {
+				return nil, err
+			}
+			item, err := pedido.Objeto("item")
+			if err != nil {
+				return nil, err
+			}
+			meta["tipo"] = pedido.Var("tipo")
+			return []interface{}{meta, item}, nil
+		}},
+	{Metodo: http.MethodPost, Caminho: "/equipamento/{tipo}/pesquisa", Servico: ServicoEquipamento, Acao: "QueryRegistoJSON",
+		Params: func(pedido *Pedido) ([]interface{}, error) {
+			return []interface{}{pedido.Corpo(), pedido.Var("tipo")}, nil
+		}},
+	{Metodo: http.MethodPatch, Caminho: "/equipamento/{tipo}/{id}", Servico: ServicoEquipamento, Acao: "AtualizarRegistoDeItem",
+		Params: func(pedido *Pedido) ([]interface{}, error) {
+			return []interface{}{pedido.Var("tipo"), pedido.Var("id"), pedido.Corpo()}, nil
+		}},
+	{Metodo: http.MethodDelete, Caminho: "/equipamento/{tipo}/{id}", Servico: ServicoEquipamento, Acao: "ApagarRegistoDeItem", Params: variaveis("tipo", "id")},
+
+	// Serviço de video-sharing
+	{Metodo: http.MethodPost, Caminho: "/videos", Servico: ServicoVideoshare, Acao: "CriarVideoShare", Params: corpo, Estado: http.StatusCreated},
+	{Metodo: http.MethodPost, Caminho: "/videos/pesquisa", Servico: ServicoVideoshare, Acao: "GetVideoShares", Params: corpo},
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"context"
+
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/configuracao"
+	"github.com/tomascpmarques/PAP/backend/robinservicogateway/loggers"
+)
+
+func main() {
+	// Configuração do gateway: defaults, ficheiro (-config ou GATEWAY_CONFIG), variáveis de ambiente e flags
+	config := configDefault()
+	if err := configuracao.Carregar(&config, configuracao.Opcoes{Prefixo: PrefixoConfig}); err != nil {
+		loggers.ServerErrorLogger.Fatal("Erro Fatal: ", err)
+	}
+
+	// As rotas REST e os clientes http dos serviços são criados a partir da configuração
+	app, err := NovaApp(config)
+	if err != nil {
+		loggers.ServerErrorLogger.Fatal("Erro Fatal: ", err)
+	}
+
+	// Serve os pedidos até receber SIGINT ou SIGTERM, depois espera pelos pedidos em curso (até -graceful-timeout)
+	if err := app.Executar(context.Background()); err != nil {
+		loggers.ServerErrorLogger.Fatal("Erro Fatal: ", err)
+	}
+}
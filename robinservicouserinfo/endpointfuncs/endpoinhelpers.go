@@ -19,8 +19,8 @@ type MongoDBOperation struct {
 }
 
 // Setup Evita mais lihas desnecessárias e repetitivas para poder-se usar a coleção necessaria
-func SetupColecao(dbName, collName string) (defs MongoDBOperation) {
-	defs.Colecao = MongoClient.Database(dbName).Collection(collName)
+func (servico *Servico) SetupColecao(dbName, collName string) (defs MongoDBOperation) {
+	defs.Colecao = servico.mongo.Database(dbName).Collection(collName)
 	defs.Cntxt, defs.CancelFunc = context.WithTimeout(context.Background(), time.Second*10)
 	return
 }
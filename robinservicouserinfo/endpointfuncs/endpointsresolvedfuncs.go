@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"reflect"
 
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/autorizacao"
 	"github.com/tomascpmarques/PAP/backend/robinservicouserinfo/loggers"
 	"github.com/tomascpmarques/PAP/backend/robinservicouserinfo/mongodbhandle"
 	"github.com/tomascpmarques/PAP/backend/robinservicouserinfo/resolvedschema"
@@ -13,37 +14,23 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-var mongoParams = mongodbhandle.MongoConexaoParams{
-	URI: "mongodb://0.0.0.0:27019/",
-}
-
-// MongoClient cliente com a conexão à instancia mongo
-var MongoClient = mongodbhandle.CriarConexaoMongoDB(mongoParams)
-
 // PingServico responde que o serviço está online
-func PingServico(name string) (retorno map[string]interface{}) {
+func (servico *Servico) PingServico(name string) (retorno map[string]interface{}) {
 	retorno = make(map[string]interface{})
 	retorno["status"] = fmt.Sprintf("Hello %s, I'm alive and OK", name)
 	return
 }
 
 // GetInfoUtilizador Busca toda a informação do utilizador especificado pelo id usrNome
-func GetInfoUtilizador(usrNome string, token string) (retorno map[string]interface{}) {
+func (servico *Servico) GetInfoUtilizador(usrNome string, token string) (retorno map[string]interface{}) {
 	retorno = make(map[string]interface{})
 
-	// Se a token não for de um admin, ou do user em sí, não se atualiza o user
-	if VerificarTokenUser(token) != "OK" /*|| VerificarTokenUserSpecif(token, usrNome) != "OK"*/ {
-		loggers.ServerErrorLogger.Println("A token não têm permissões")
-		retorno["error"] = "A token não têm permissões"
-		return
-	}
-
 	// Defenição do filter a usar nas pesquisas da bd
 	// filter := bson.M{"user": usrNome}
 	// Conexão à bd e coleção a usar
 	//operacoesColl := MongoClient.Database("users_data").Collection("account_info")
 
-	operacoesColl := SetupColecao("users_data", "account_info")
+	operacoesColl := servico.SetupColecao("users_data", "account_info")
 	operacoesColl.Filter = bson.M{"user": usrNome}
 
 	// defenições de utilitários
@@ -62,23 +49,67 @@ func GetInfoUtilizador(usrNome string, token string) (retorno map[string]interfa
 	return
 }
 
-// UpdateInfoUtilizador Atualiza todos os dados especificádos, nos parametros da func, de um utilizador.
-func UpdateInfoUtilizador(usrNome string, params map[string]interface{}, token string) (retorno map[string]interface{}) {
+// camposAtualizaveis campos da informação do user que o UpdateInfoUtilizador pode alterar, e se são listas de strings.
+// O user só muda com o RenomearUtilizador (que verifica se o nome já existe), e as contribuições com as suas actions
+var camposAtualizaveis = map[string]bool{
+	"nome":           false,
+	"status":         false,
+	"email":          false,
+	"statusmss":      false,
+	"especialidades": true,
+}
+
+// validarAtualizacao Verifica se todos os campos podem ser atualizados e têm o tipo certo, devolve os campos a guardar
+func validarAtualizacao(params map[string]interface{}) (bson.M, error) {
+	if len(params) == 0 {
+		return nil, fmt.Errorf("não foram indicados campos para atualizar")
+	}
+	campos := make(bson.M, len(params))
+	for campo, valor := range params {
+		lista, permitido := camposAtualizaveis[campo]
+		if !permitido {
+			return nil, fmt.Errorf("o campo %s não pode ser atualizado", campo)
+		}
+		if !lista {
+			texto, ok := valor.(string)
+			if !ok {
+				return nil, fmt.Errorf("o campo %s têm de ser uma string", campo)
+			}
+			campos[campo] = texto
+			continue
+		}
+		valores, ok := valor.([]interface{})
+		textos := make([]string, 0, len(valores))
+		for _, elemento := range valores {
+			texto, e := elemento.(string)
+			ok = ok && e
+			textos = append(textos, texto)
+		}
+		if !ok {
+			return nil, fmt.Errorf("o campo %s têm de ser uma lista de strings", campo)
+		}
+		campos[campo] = textos
+	}
+	return campos, nil
+}
+
+// UpdateInfoUtilizador Atualiza os dados especificádos, nos parametros da func, de um utilizador.
+// Só os campos de camposAtualizaveis podem ser alterados
+func (servico *Servico) UpdateInfoUtilizador(usrNome string, params map[string]interface{}, token string) (retorno map[string]interface{}) {
 	retorno = make(map[string]interface{})
 
-	// Se a token não for de um admin, ou do user em sí, não se atualiza o user
-	if VerificarTokenAdmin(token) != "OK" || VerificarTokenUserSpecif(token, usrNome) != "OK" {
-		loggers.ServerErrorLogger.Println("A token não têm permissões")
-		retorno["error"] = "A token não têm permissões"
+	campos, err := validarAtualizacao(params)
+	if err != nil {
+		retorno["erro"] = err.Error()
 		return
 	}
 
 	// Defenição do filter a usar nas pesquisas da bd
 	filter := bson.M{"user": usrNome}
-	operacoesColl := SetupColecao("users_data", "account_info")
+	operacoesColl := servico.SetupColecao("users_data", "account_info")
 
 	// atualização do registo e retorno da operação
-	registosUpdt, err := operacoesColl.Colecao.UpdateOne(operacoesColl.Cntxt, filter, bson.M{"$set": params}, options.MergeUpdateOptions())
+	registosUpdt, err := operacoesColl.Colecao.UpdateOne(operacoesColl.Cntxt, filter, bson.M{"$set": campos}, options.MergeUpdateOptions())
 	defer operacoesColl.CancelFunc()
 	if err != nil {
 		loggers.OperacoesBDLogger.Println("Erro ao atualizar a info do utilizador, erro: ", err)
@@ -101,23 +132,49 @@ func UpdateInfoUtilizador(usrNome string, params map[string]interface{}, token s
 	return
 }
 
-// CriarRegistoUser cria um registo mongo db, com parametros nulos ou não, excepto o username (sempre !null)
-func CriarRegistoUser(userInfo map[string]interface{}, token string) (retorno map[string]interface{}) {
+// RenomearUtilizador Muda o nome do user no registo da sua informação, chamado pelo serviço de autenticação
+// quando o user muda de nome. Não altera nada se já existir informação para o nome novo
+func (servico *Servico) RenomearUtilizador(usrNome string, novoNome string, token string) (retorno map[string]interface{}) {
 	retorno = make(map[string]interface{})
 
-	// Se a token não for de um admin, não se regista um user novo
-	if VerificarTokenAdmin(token) != "OK" {
-		loggers.ServerErrorLogger.Println("A token não têm permissões")
-		retorno["error"] = "A token não têm permissões"
+	operacoesColl := servico.SetupColecao("users_data", "account_info")
+	defer operacoesColl.CancelFunc()
+
+	// O nome novo não pode pertencer a outro registo
+	err := operacoesColl.Colecao.FindOne(operacoesColl.Cntxt, bson.M{"user": novoNome}).Err()
+	if err == nil {
+		loggers.OperacoesBDLogger.Println("Já existe informação para o user: ", novoNome)
+		retorno["erro"] = "Já existe informação para o user: " + novoNome
+		return
+	}
+	if err != mongo.ErrNoDocuments {
+		loggers.OperacoesBDLogger.Println("Erro ao procurar o user, erro: ", err)
+		retorno["erro"] = "Erro ao procurar o user: " + novoNome
 		return
 	}
 
-	operacoesColl := SetupColecao("users_data", "account_info")
+	registosUpdt, err := operacoesColl.Colecao.UpdateOne(operacoesColl.Cntxt, bson.M{"user": usrNome}, bson.M{"$set": bson.M{"user": novoNome}})
+	if err != nil {
+		loggers.OperacoesBDLogger.Println("Erro ao mudar o nome do utilizador, erro: ", err)
+		retorno["erro"] = "Erro ao mudar o nome do utilizador: " + usrNome
+		return
+	}
+
+	// Um user sem informação registada não têm nada para mudar
+	retorno["renomeado"] = registosUpdt.ModifiedCount > 0
+	return
+}
+
+// CriarRegistoUser cria um registo mongo db, com parametros nulos ou não, excepto o username (sempre !null)
+func (servico *Servico) CriarRegistoUser(userInfo map[string]interface{}, token string) (retorno map[string]interface{}) {
+	retorno = make(map[string]interface{})
+
+	operacoesColl := servico.SetupColecao("users_data", "account_info")
 
 	// Verifica se a info do user que queremos inserir já existe
 	exists := operacoesColl.Colecao.FindOne(context.Background(), bson.M{"user": userInfo["user"]})
 	if exists != nil && exists.Err() != mongo.ErrNoDocuments {
-		loggers.ServerErrorLogger.Println("Já existe informação para esse user")
+		servico.loggerErros.Println("Já existe informação para esse user")
 		retorno["error"] = "Já existe informação para esse user"
 		return
 
@@ -126,7 +183,7 @@ func CriarRegistoUser(userInfo map[string]interface{}, token string) (retorno ma
 	// Conver-te a info de user, para uma struct
 	info := resolvedschema.UtilizadorParaStruct(&userInfo)
 	if reflect.ValueOf(info).IsZero() {
-		loggers.ServerErrorLogger.Println("Erro ao converter os dados para a struct correta")
+		servico.loggerErros.Println("Erro ao converter os dados para a struct correta")
 		retorno["error"] = "Erro com o tipo de dados e sua conversão"
 		return
 	}
@@ -134,7 +191,7 @@ func CriarRegistoUser(userInfo map[string]interface{}, token string) (retorno ma
 	// Insere o registo da info do user na BD
 	inserted, err := mongodbhandle.InserirUmRegisto(info, operacoesColl.Colecao, 10)
 	if err != nil {
-		loggers.ServerErrorLogger.Println("Error: ", err)
+		servico.loggerErros.Println("Error: ", err)
 		retorno["Error"] = err
 		return
 	}
@@ -143,42 +200,71 @@ func CriarRegistoUser(userInfo map[string]interface{}, token string) (retorno ma
 	return retorno
 }
 
-// ModificarContribuicoes Modifica o valor do array que contêm as contribuições, pode adicionar ou retirar desse mesmo array
-func ModificarContribuicoes(operacaoConfig string, repoUpdate map[string]interface{}, token string) (retorno map[string]interface{}) {
+// textosContribuicao Devolve os campos pedidos da contribuição, que têm de ser strings não vazias
+func textosContribuicao(contribuicao map[string]interface{}, campos ...string) ([]string, error) {
+	textos := make([]string, len(campos))
+	for i, campo := range campos {
+		texto, ok := contribuicao[campo].(string)
+		if !ok || texto == "" {
+			return nil, fmt.Errorf("o campo %s da contribuição têm de ser uma string", campo)
+		}
+		textos[i] = texto
+	}
+	return textos, nil
+}
+
+// exigirDonoContribuicoes Verifica se a token é do user das contribuições, de um admin,
+// ou de um serviço com o scope das contribuições
+func (servico *Servico) exigirDonoContribuicoes(user string, token string) error {
+	_, err := servico.autorizacao.Exigir(token, autorizacao.Alguma(
+		autorizacao.DonoOuAdmin(user),
+		autorizacao.Servico(autorizacao.ScopeUserinfoContribuicoes),
+	))
+	return err
+}
+
+// ModificarContribuicoes Modifica o valor do array que contêm as contribuições, pode adicionar ou retirar desse mesmo array.
+// Só o próprio user, um admin ou um serviço com o scope das contribuições podem alterar as contribuições do user
+func (servico *Servico) ModificarContribuicoes(operacaoConfig string, repoUpdate map[string]interface{}, token string) (retorno map[string]interface{}) {
 	retorno = make(map[string]interface{})
 
-	// Se a token não for de um utilizador, não executa a função
-	// if VerificarTokenAdmin(token) != "OK" /*|| VerificarTokenUserSpecif(token, usrNome) != "OK"*/ {
-	// 	loggers.ServerErrorLogger.Println("A token não têm permissões")
-	// 	retorno["error"] = "A token não têm permissões"
-	// 	return
-	// }
+	campos, err := textosContribuicao(repoUpdate, "user", "repo", "file")
+	if err != nil {
+		retorno["erro"] = err.Error()
+		return
+	}
+	user, repo, ficheiro := campos[0], campos[1], campos[2]
+	if err := servico.exigirDonoContribuicoes(user, token); err != nil {
+		servico.loggerErros.Println("Erro: a token não pode alterar as contribuições de ", user)
+		retorno["erro"] = err
+		return
+	}
 
 	// Defenições a serem usadas para executar as operações na BD
-	operacoesColl := SetupColecao("users_data", "account_info")
-	operacoesColl.Filter = bson.M{"user": repoUpdate["user"], "contribuicoes.reponome": repoUpdate["repo"].(string)}
+	operacoesColl := servico.SetupColecao("users_data", "account_info")
+	operacoesColl.Filter = bson.M{"user": user, "contribuicoes.reponome": repo}
 
 	// Avalia o tipo de operação pedido, add para adicionar contribuição, rmv para remover contribuição
 	switch operacaoConfig {
 	// Operação que adiciona um ficheiro ás contribuições do user
 	case "add":
-		err := operacoesColl.AdicionarContribuicao(repoUpdate["repo"].(string), repoUpdate["file"].(string))
+		err := operacoesColl.AdicionarContribuicao(repo, ficheiro)
 		if err != nil {
-			loggers.ServerErrorLogger.Println("Error: ", err)
+			servico.loggerErros.Println("Error: ", err)
 			retorno["Error"] = err
 			return
 		}
 		// Operação que remove um ficheiro ás contribuições do user
 	case "rmv":
-		err := operacoesColl.RemoverContribuicaoFile(repoUpdate["repo"].(string), repoUpdate["file"].(string))
+		err := operacoesColl.RemoverContribuicaoFile(repo, ficheiro)
 		if err != nil {
-			loggers.ServerErrorLogger.Println("Error: ", err)
+			servico.loggerErros.Println("Error: ", err)
 			retorno["Error"] = err
 			return
 		}
 		// Se a operação pedida não estiver implementada corre este código
 	default:
-		loggers.ServerErrorLogger.Println("Error: Tipo de operação não reconhecido, <'add' ou 'rmv'>")
+		servico.loggerErros.Println("Error: Tipo de operação não reconhecido, <'add' ou 'rmv'>")
 		retorno["Error"] = "Tipo de operação não reconhecido, <'adicionar' ou 'remover'>"
 		return
 	}
@@ -189,23 +275,16 @@ func ModificarContribuicoes(operacaoConfig string, repoUpdate map[string]interfa
 }
 
 // AdicionarContrbRepo Adiciona o repo de contribuições à informação do user
-func AdicionarContrbRepo(usrNome string, repoNome string, token string) (retorno map[string]interface{}) {
+func (servico *Servico) AdicionarContrbRepo(usrNome string, repoNome string, token string) (retorno map[string]interface{}) {
 	retorno = make(map[string]interface{})
 
-	// Se a token não for de um utilizador, não executa a função
-	// if VerificarTokenAdmin(token) != "OK" /*|| VerificarTokenUserSpecif(token, usrNome) != "OK"*/ {
-	// 	loggers.ServerErrorLogger.Println("A token não têm permissões")
-	// 	retorno["error"] = "A token não têm permissões"
-	// 	return
-	// }
-
 	// Defenições a serem usadas para executar as operações na BD
-	operacoesColl := SetupColecao("users_data", "account_info")
+	operacoesColl := servico.SetupColecao("users_data", "account_info")
 	operacoesColl.Filter = bson.M{"user": usrNome}
 
 	// Avalia se a operação de criar o repo teve sucesso
 	if err := operacoesColl.CriarRepoContribuicoes(repoNome); err != nil {
-		loggers.ServerErrorLogger.Println("Erro ao criar repo nas contribuições do user")
+		servico.loggerErros.Println("Erro ao criar repo nas contribuições do user")
 		retorno["erro"] = "Erro ao criar repo nas contribuições do user"
 		return
 	}
@@ -215,30 +294,35 @@ func AdicionarContrbRepo(usrNome string, repoNome string, token string) (retorno
 	return
 }
 
-// RemoverRepoContributo Remove o repo de contribuições
-func RemoverRepoContributo(repoinfo map[string]interface{}, token string) (retorno map[string]interface{}) {
+// RemoverRepoContributo Remove o repo de contribuições, com as mesmas permissões do ModificarContribuicoes
+func (servico *Servico) RemoverRepoContributo(repoinfo map[string]interface{}, token string) (retorno map[string]interface{}) {
 	retorno = make(map[string]interface{})
 
-	// Se a token não for de um utilizador, não executa a função
-	// if VerificarTokenAdmin(token) != "OK" /*|| VerificarTokenUserSpecif(token, usrNome) != "OK"*/ {
-	// 	loggers.ServerErrorLogger.Println("A token não têm permissões")
-	// 	retorno["error"] = "A token não têm permissões"
-	// 	return
-	// }
+	campos, err := textosContribuicao(repoinfo, "user", "repo")
+	if err != nil {
+		retorno["erro"] = err.Error()
+		return
+	}
+	user, repo := campos[0], campos[1]
+	if err := servico.exigirDonoContribuicoes(user, token); err != nil {
+		servico.loggerErros.Println("Erro: a token não pode alterar as contribuições de ", user)
+		retorno["erro"] = err
+		return
+	}
 
 	// Defenições a serem usadas para executar as operações na BD
-	operacoesColl := SetupColecao("users_data", "account_info")
-	operacoesColl.Filter = bson.M{"user": repoinfo["user"], "contribuicoes.reponome": repoinfo["repo"].(string)}
+	operacoesColl := servico.SetupColecao("users_data", "account_info")
+	operacoesColl.Filter = bson.M{"user": user, "contribuicoes.reponome": repo}
 
 	// Remove o repo das contribuições do utilizador
-	if err := operacoesColl.RemoverRepoContribuicao(repoinfo["repo"].(string)); err != nil {
+	if err := operacoesColl.RemoverRepoContribuicao(repo); err != nil {
 		loggers.MongoDBLogger.Println(err)
-		loggers.ServerErrorLogger.Println("Erro ao largar o repo nas contribuições do user pedido")
+		servico.loggerErros.Println("Erro ao largar o repo nas contribuições do user pedido")
 		retorno["erro"] = "Erro ao largar o repo nas contribuições do user pedido"
 		return
 	}
 
-	loggers.ServerErrorLogger.Println("Repo largado das contribuições do utilizador com sucesso")
+	servico.loggerErros.Println("Repo largado das contribuições do utilizador com sucesso")
 	retorno["sucesso"] = true
 	return
 }
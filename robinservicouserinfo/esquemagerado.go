@@ -0,0 +1,49 @@
+// Code generated by esquemagen a partir das actions registadas. DO NOT EDIT.
+
+package main
+
+import "github.com/tomascpmarques/PAP/backend/robinpartilhado/esquema"
+
+// descricoesAcoes Descrição, parametros e keys do retorno de cada action registada, tiradas do código fonte
+var descricoesAcoes = map[string]esquema.Descricao{
+	"AdicionarContrbRepo": {
+		Descricao: "Adiciona o repo de contribuições à informação do user",
+		Params:    []string{"usrNome", "repoNome", "token"},
+		Respostas: []string{"sucesso"},
+	},
+	"CriarRegistoUser": {
+		Descricao: "cria um registo mongo db, com parametros nulos ou não, excepto o username (sempre !null)",
+		Params:    []string{"userInfo", "token"},
+		Respostas: []string{"inserido"},
+	},
+	"GetInfoUtilizador": {
+		Descricao: "Busca toda a informação do utilizador especificado pelo id usrNome",
+		Params:    []string{"usrNome", "token"},
+		Respostas: []string{"user"},
+	},
+	"ModificarContribuicoes": {
+		Descricao: "Modifica o valor do array que contêm as contribuições, pode adicionar ou retirar desse mesmo array",
+		Params:    []string{"operacaoConfig", "repoUpdate", "token"},
+		Respostas: []string{"sucesso"},
+	},
+	"Ping": {
+		Descricao: "responde que o serviço está online",
+		Params:    []string{"name"},
+		Respostas: []string{"status"},
+	},
+	"RemoverRepoContributo": {
+		Descricao: "Remove o repo de contribuições",
+		Params:    []string{"repoinfo", "token"},
+		Respostas: []string{"sucesso"},
+	},
+	"RenomearUtilizador": {
+		Descricao: "Muda o nome do user no registo da sua informação, chamado pelo serviço de autenticação quando o user muda de nome. Não altera nada se já existir informação para o nome novo",
+		Params:    []string{"usrNome", "novoNome", "token"},
+		Respostas: []string{"renomeado"},
+	},
+	"UpdateInfoUtilizador": {
+		Descricao: "Atualiza todos os dados especificádos, nos parametros da func, de um utilizador.",
+		Params:    []string{"usrNome", "params", "token"},
+		Respostas: []string{"num_campos_updt"},
+	},
+}
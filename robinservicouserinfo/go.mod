@@ -4,9 +4,10 @@ go 1.16
 
 require (
 	github.com/TomascpMarques/dynamic-querys-go v1.3.3
-	github.com/dgrijalva/jwt-go v3.2.0+incompatible
 	github.com/gorilla/mux v1.8.0
 	github.com/rs/cors v1.7.0
-	github.com/tomascpmarques/custom-schema-go v0.4.5 // indirect
+	github.com/tomascpmarques/PAP/backend/robinpartilhado v0.0.0
 	go.mongodb.org/mongo-driver v1.5.0
 )
+
+replace github.com/tomascpmarques/PAP/backend/robinpartilhado => ../robinpartilhado
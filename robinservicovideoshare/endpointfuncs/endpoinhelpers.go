@@ -24,8 +24,8 @@ type MongoDBOperation struct {
 }
 
 // Setup Evita mais lihas desnecessárias e repetitivas para poder-se usar a coleção necessaria
-func SetupColecao(dbName, collName string) (defs MongoDBOperation) {
-	defs.Colecao = MongoClient.Database(dbName).Collection(collName)
+func (servico *Servico) SetupColecao(dbName, collName string) (defs MongoDBOperation) {
+	defs.Colecao = servico.mongo.Database(dbName).Collection(collName)
 	defs.Cntxt, defs.CancelFunc = context.WithTimeout(context.Background(), time.Second*10)
 	return
 }
@@ -92,8 +92,8 @@ func TrimURL(url string) string {
 }
 
 // Adiciona os dados da video-share à base de dados
-func AdicionarVideoShareDB(videoShare *resolvedschema.Video) error {
-	colecao := SetupColecao("videoshares", "videos")
+func (servico *Servico) AdicionarVideoShareDB(videoShare *resolvedschema.Video) error {
+	colecao := servico.SetupColecao("videoshares", "videos")
 
 	// Inserção do registo na BD
 	result, err := colecao.Colecao.InsertOne(colecao.Cntxt, videoShare, options.InsertOne())
@@ -113,9 +113,9 @@ func AdicionarVideoShareDB(videoShare *resolvedschema.Video) error {
 }
 
 // GetVideoShareWithParams Procura todos os registos de videoshares que igualem aos params passados
-func GetVideoShareWithParams(params *resolvedschema.VideoSearchParams) ([]resolvedschema.Video, error) {
+func (servico *Servico) GetVideoShareWithParams(params *resolvedschema.VideoSearchParams) ([]resolvedschema.Video, error) {
 	// Setup da coleção a usar & search params
-	colecao := SetupColecao("videoshares", "videos")
+	colecao := servico.SetupColecao("videoshares", "videos")
 	colecao.Filter = params.Params
 	opcoesBusca := options.Find().SetLimit(int64(params.Quanti))
 
@@ -4,20 +4,13 @@ import (
 	"fmt"
 	"reflect"
 
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/autorizacao"
 	"github.com/tomascpmarques/PAP/backend/robinservicovideoshare/loggers"
-	"github.com/tomascpmarques/PAP/backend/robinservicovideoshare/mongodbhandle"
 	"github.com/tomascpmarques/PAP/backend/robinservicovideoshare/resolvedschema"
 )
 
-var mongoParams = mongodbhandle.MongoConexaoParams{
-	URI: "mongodb://0.0.0.0:27022/",
-}
-
-// MongoClient cliente com a conexão à instancia mongo
-var MongoClient = mongodbhandle.CriarConexaoMongoDB(mongoParams)
-
 // PingServico responde que o serviço está online
-func PingServico(name string) (retorno map[string]interface{}) {
+func (servico *Servico) PingServico(name string) (retorno map[string]interface{}) {
 	retorno = make(map[string]interface{})
 	retorno["status"] = fmt.Sprintf("Hello %s, I'm alive and OK", name)
 	return
@@ -25,16 +18,9 @@ func PingServico(name string) (retorno map[string]interface{}) {
 
 // GetVideoShares Retorna 0 ou + resultados encontrados na mongobd de video-shares,
 // utiliza os params passados para a pesquisa, os params não podem ser parciais nas suas igualdades
-func GetVideoShares(paramsPesquisa map[string]interface{}, token string) (retorno map[string]interface{}) {
+func (servico *Servico) GetVideoShares(paramsPesquisa map[string]interface{}, token string) (retorno map[string]interface{}) {
 	retorno = make(map[string]interface{})
 
-	// Verifica se o request está a ser efetuado por um user logado
-	// if VerificarTokenUser(token) != "OK" {
-	// 	loggers.ResolverLogger.Println("Token inválida.")
-	// 	retorno["err"] = "Token inválida ou expirada"
-	// 	return
-	// }
-
 	// Verifica a validade dos params de pesquisa da func
 	if err := VerificarSearchParams(paramsPesquisa); err != nil {
 		loggers.ResolverLogger.Println(err.Error())
@@ -44,7 +30,7 @@ func GetVideoShares(paramsPesquisa map[string]interface{}, token string) (retorn
 
 	// Converte os params para a struct equivalente e inicia a busca
 	params := resolvedschema.SearchParamsParaStruct(&paramsPesquisa)
-	shares, err := GetVideoShareWithParams(&params)
+	shares, err := servico.GetVideoShareWithParams(&params)
 	if err != nil {
 		loggers.ResolverLogger.Println(err.Error())
 		retorno["aviso"] = err.Error()
@@ -58,19 +44,13 @@ func GetVideoShares(paramsPesquisa map[string]interface{}, token string) (retorn
 }
 
 // CriarVideoShare Cria um registo de uma video-share na MongoBD
-func CriarVideoShare(videoMetaData map[string]interface{}, token string) (retorno map[string]interface{}) {
+func (servico *Servico) CriarVideoShare(videoMetaData map[string]interface{}, token string) (retorno map[string]interface{}) {
 	retorno = make(map[string]interface{})
 
-	// Verifica se o request está a ser efetuado por um user logado
-	if VerificarTokenUser(token) != "OK" {
-		loggers.ResolverLogger.Println("Token inválida.")
-		retorno["err"] = "Token inválida ou expirada"
-		return
-	}
-
 	// Verifica se o criador do video é o mesmo que o que fez o request
 	// Assim evita outros users criarem videos à passarem-se por outros users
-	if VerificarTokenUserSpecif(token, videoMetaData["criador"].(string)) != "OK" {
+	criador, _ := videoMetaData["criador"].(string)
+	if _, err := servico.autorizacao.Exigir(token, autorizacao.User(criador)); err != nil {
 		loggers.ResolverLogger.Println("O criador deste vídeo não é o autor do request.")
 		retorno["err"] = "O criador deste vídeo não é o autor do request"
 		return
@@ -96,7 +76,7 @@ func CriarVideoShare(videoMetaData map[string]interface{}, token string) (retorn
 	videoSahre.URL = TrimURL(videoSahre.URL)
 
 	// Adicona a videoshare à bd
-	err = AdicionarVideoShareDB(&videoSahre)
+	err = servico.AdicionarVideoShareDB(&videoSahre)
 	if err != nil {
 		loggers.ResolverLogger.Println("Erro ao criar registo da videoshare na BD")
 		retorno["err"] = err.Error()
@@ -0,0 +1,41 @@
+package endpointfuncs
+
+import (
+	"log"
+
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/autorizacao"
+	"github.com/tomascpmarques/PAP/backend/robinservicovideoshare/loggers"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Dependencias Recursos externos usados pelas actions, criados no main (ou nos testes)
+type Dependencias struct {
+	Mongo       *mongo.Client            // Conexão à instancia mongo
+	Autorizacao *autorizacao.Verificador // Verificador das tokens emitidas pelo serviço de autenticação
+	LoggerErros *log.Logger              // Erros do serviço, nil usa o loggers.ServerErrorLogger
+}
+
+// Servico Serviço de video-sharing, as actions são métodos do Servico
+type Servico struct {
+	mongo       *mongo.Client
+	autorizacao *autorizacao.Verificador
+	loggerErros *log.Logger
+}
+
+// NovoServico Cria o serviço com as dependências dadas
+func NovoServico(deps Dependencias) *Servico {
+	servico := &Servico{
+		mongo:       deps.Mongo,
+		autorizacao: deps.Autorizacao,
+		loggerErros: deps.LoggerErros,
+	}
+	if servico.loggerErros == nil {
+		servico.loggerErros = loggers.ServerErrorLogger
+	}
+	return servico
+}
+
+// Autorizacao Verificador das tokens, usado no registo das actions
+func (servico *Servico) Autorizacao() *autorizacao.Verificador {
+	return servico.autorizacao
+}
@@ -0,0 +1,24 @@
+// Code generated by esquemagen a partir das actions registadas. DO NOT EDIT.
+
+package main
+
+import "github.com/tomascpmarques/PAP/backend/robinpartilhado/esquema"
+
+// descricoesAcoes Descrição, parametros e keys do retorno de cada action registada, tiradas do código fonte
+var descricoesAcoes = map[string]esquema.Descricao{
+	"CriarVideoShare": {
+		Descricao: "Cria um registo de uma video-share na MongoBD",
+		Params:    []string{"videoMetaData", "token"},
+		Respostas: []string{"sucesso"},
+	},
+	"GetVideoShares": {
+		Descricao: "Retorna 0 ou + resultados encontrados na mongobd de video-shares, utiliza os params passados para a pesquisa, os params não podem ser parciais nas suas igualdades",
+		Params:    []string{"paramsPesquisa", "token"},
+		Respostas: []string{"aviso", "shares", "sucesso"},
+	},
+	"Ping": {
+		Descricao: "responde que o serviço está online",
+		Params:    []string{"name"},
+		Respostas: []string{"status"},
+	},
+}
@@ -0,0 +1,22 @@
+package mongodbhandle
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/metricas"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+// MonitorMetricas Monitor que regista a duração e o resultado de cada comando enviado ao mongo (find, insert, ...)
+func MonitorMetricas(m *metricas.Metricas) *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Succeeded: func(_ context.Context, evento *event.CommandSucceededEvent) {
+			m.ObservarBD("mongo", evento.CommandName, time.Duration(evento.DurationNanos), nil)
+		},
+		Failed: func(_ context.Context, evento *event.CommandFailedEvent) {
+			m.ObservarBD("mongo", evento.CommandName, time.Duration(evento.DurationNanos), errors.New(evento.Failure))
+		},
+	}
+}
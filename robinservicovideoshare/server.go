@@ -2,77 +2,23 @@ package main
 
 import (
 	"context"
-	"flag"
-	"log"
-	"net/http"
-	"os"
-	"os/signal"
-	"syscall"
-	"time"
 
-	"github.com/TomascpMarques/dynamic-querys-go/actions"
-	"github.com/gorilla/mux"
-	"github.com/rs/cors"
-	"github.com/tomascpmarques/PAP/backend/robinservicovideoshare/endpointfuncs"
+	"github.com/tomascpmarques/PAP/backend/robinpartilhado/configuracao"
 	"github.com/tomascpmarques/PAP/backend/robinservicovideoshare/loggers"
 )
 
 func main() {
-	os.Setenv("ENV_ROBINUSERINFO_PORT", "8008")
-
-	// flag setup fo graceful-shutdown
-	var wait time.Duration
-	flag.DurationVar(&wait, "graceful-timeout", time.Second*15, "gracefully wait for existing connections to finish in 15s")
-	flag.Parse()
-
-	// VideoShare
-	actions.FuncsStorage["GetVideoShares"] = endpointfuncs.GetVideoShares
-	actions.FuncsStorage["CriarVideoShare"] = endpointfuncs.CriarVideoShare
-
-	// Utilidade
-	actions.FuncsStorage["Ping"] = endpointfuncs.PingServico
-
-	router := mux.NewRouter()
-	go router.HandleFunc("/", actions.Handler)
-
-	corsOptions := cors.New(cors.Options{
-		AllowedOrigins:   []string{"http://localhost:8080"},
-		AllowCredentials: true,
-	})
-
-	//handler := cors.Default().Handler(router)
-	corsHandlers := corsOptions.Handler(router)
-
-	server := &http.Server{
-		Handler:      corsHandlers,
-		Addr:         "0.0.0.0:" + os.Getenv("ENV_ROBINUSERINFO_PORT"),
-		IdleTimeout:  time.Second * 5,
-		WriteTimeout: time.Second * 3,
-		ReadTimeout:  time.Second * 2,
-		ErrorLog:     loggers.ServerErrorLogger,
+	// Configuração do serviço: defaults, ficheiro (-config ou VIDEOSHARE_CONFIG), variáveis de ambiente e flags
+	config := configDefault()
+	if err := configuracao.Carregar(&config, configuracao.Opcoes{Prefixo: PrefixoConfig}); err != nil {
+		loggers.ServerErrorLogger.Fatal("Erro Fatal: ", err)
 	}
+	// O cliente mongo, a verificação das tokens e as actions são criados a partir da configuração
+	app := NovaApp(config)
 
-	if err := server.ListenAndServe(); err != nil {
-		log.Println("Erro: ", err)
-		os.Exit(1)
+	// Serve os pedidos até receber SIGINT ou SIGTERM, depois espera pelos pedidos em curso
+	// (até -graceful-timeout) e fecha a conexão ao mongo
+	if err := app.Executar(context.Background()); err != nil {
+		loggers.ServerErrorLogger.Fatal("Erro Fatal: ", err)
 	}
-
-	// Graceful-Shutdown implementation
-	c := make(chan os.Signal, 1)
-	// We'll accept graceful shutdowns when quit via SIGINT (Ctrl+C) or SIGKILL,
-	// SIGQUIT or SIGTERM (Ctrl+/) will not be caught.
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-
-	// Block until we receive our signal.
-	<-c
-
-	// Create a deadline to wait for.
-	ctx, cancel := context.WithTimeout(context.Background(), wait)
-	defer cancel()
-	// Doesn't block if no connections, but will otherwise wait
-	// until the timeout deadline.
-	server.Shutdown(ctx)
-
-	actions.DQGLogger.Println("Servidor a desligar")
-	os.Exit(0)
 }